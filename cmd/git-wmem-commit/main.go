@@ -13,7 +13,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	err := internal.CommitWmem()
+	err := internal.CommitWmem(internal.CommitOptions{})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
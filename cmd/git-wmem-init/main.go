@@ -15,7 +15,7 @@ func main() {
 
 	targetDir := os.Args[1]
 
-	err := internal.InitWmemRepo(targetDir)
+	err := internal.InitWmemRepo(targetDir, internal.InitOptions{})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
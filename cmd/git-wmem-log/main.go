@@ -13,7 +13,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	err := internal.LogWmem()
+	err := internal.LogWmem(internal.LogOptions{})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 
@@ -24,8 +25,14 @@ var (
 	readme     = flag.Bool("readme", false, "show full documentation")
 	showHelp   = flag.Bool("help", false, "show usage information")
 	version    = flag.Bool("version", false, "show version information")
+	workDir    string
 )
 
+func init() {
+	flag.StringVar(&workDir, "dir", "", "run as if started in the given directory")
+	flag.StringVar(&workDir, "C", "", "run as if started in the given directory (short for --dir)")
+}
+
 // GitSHA is set at build time
 var GitSHA = "dev"
 
@@ -75,35 +82,147 @@ func main() {
 	command := args[0]
 	commandArgs := args[1:]
 
+	if workDir != "" {
+		if err := changeWorkDir(workDir, command); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	switch command {
 	case "init":
-		if len(commandArgs) != 1 {
-			fmt.Fprintf(os.Stderr, "Usage: git-wmem init <directory>\n")
+		targetDir, opts, ok := parseInitArgs(commandArgs)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Usage: git-wmem init [--bare-repos-shared] [--no-commit] [--gitignore-extra <pattern>]... <directory>\n")
 			os.Exit(1)
 		}
-		err := internal.InitWmemRepo(commandArgs[0])
+		err := internal.InitWmemRepo(targetDir, opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 
 	case "commit":
-		if len(commandArgs) != 0 {
-			fmt.Fprintf(os.Stderr, "Usage: git-wmem commit\n")
+		opts, ok := parseCommitArgs(commandArgs)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Usage: git-wmem commit [--parallel-fetch <n>] [--parallel <n>] [--snapshot-index] [--only-if-idle] [--report <file>] [--max-file-count <n>] [--compress] [--prune-empty-dirs=false] [--verify-after] [--workdir-timeout <dur>] [--keep-going] [--dedupe-identical-trees] [--respect-sparse-checkout] [--keep-commit-timestamps] [--batch-size <n>] [--treat-warnings-as-errors] [--shallow-tree-compare] [--post-merge-ff] [--index-only-detection] [--snapshot-tags] [--author-date-now=false] [--committer-date-now=false] [--refresh-cache] [--workdir-order <config|alpha|mtime>] [--ignore-case-conflicts <first|last|newest-mtime|error>] [--include-wmem-repo] [--exclude-branch <pattern>]... [--author-required] [--fsmonitor] [--normalize-line-endings] [--skip-clean-workdirs-fast] [--capture-stash] [--preserve-mtime-metadata] [--path-filter <glob>]... [--author-from-workdir-head-always] [--group-by-branch] [--snapshot-worktree-and-index] [--detect-moves] [--empty-repos-skip] [--json-report] [--dedupe-blobs-across-workdirs] [--annotate-wmem-uid-in-workdir] [--require-clean-wmem-repo] [--no-fetch] [--workdir-from-stdin] [--ignore-submodule-errors] [--single-commit-per-run] [--author-email-domain-check] [--max-total-runtime <dur>] [--verify-workdir-clean-after] [--blob-filter <cmd>] [--resume] [--on-conflict <accept-workdir|skip>] [--record-upstream] [--dry-run [--diff]] [--max-depth <n>]\n")
 			os.Exit(1)
 		}
-		err := internal.CommitWmem()
+		err := internal.CommitWmem(opts)
+		if status := internal.CommitExitStatus(err); status != 0 {
+			// --json-report: 3 and 4 aren't errors, the run report tells the details
+			if status == 1 {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			os.Exit(status)
+		}
+
+	case "log":
+		opts, ok := parseLogArgs(commandArgs)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Usage: git-wmem log [--json] [--no-pager] [--uid-only] [--files] [--parents] [--since-uid <uid>] [--workdir-status] [--check] [--workdir-path-style <rel|abs|name>] [--encoding <escape|replace|raw>] [--workdir-missing-ok=false] [--count] [--fetch] [--pretty] [--diff-wmem-repo] [--workdir-tree-size] [--color <auto|always|never>] [--color-by-workdir] [--workdir-count]\n")
+			os.Exit(1)
+		}
+		err := internal.LogWmem(opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 
-	case "log":
-		if len(commandArgs) != 0 {
-			fmt.Fprintf(os.Stderr, "Usage: git-wmem log\n")
+	case "remotes":
+		opts, ok := parseRemotesArgs(commandArgs)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Usage: git-wmem remotes [--fix]\n")
+			os.Exit(1)
+		}
+		err := internal.RemotesWmem(opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "history":
+		workdirName, filePath, opts, ok := parseHistoryArgs(commandArgs)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Usage: git-wmem history [--branch <name>] [--patch] <workdir-name> <file>\n")
+			os.Exit(1)
+		}
+		err := internal.HistoryWmem(workdirName, filePath, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "gc":
+		opts, ok := parseGcArgs(commandArgs)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Usage: git-wmem gc [--aggressive]\n")
+			os.Exit(1)
+		}
+		err := internal.GcWmem(opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "repair-refs":
+		if !parseRepairRefsArgs(commandArgs) {
+			fmt.Fprintf(os.Stderr, "Usage: git-wmem repair-refs\n")
+			os.Exit(1)
+		}
+		err := internal.RepairRefsWmem()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "fsck":
+		opts, ok := parseFsckArgs(commandArgs)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Usage: git-wmem fsck [--fix]\n")
+			os.Exit(1)
+		}
+		err := internal.FsckWmem(opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		err := internal.LogWmem()
+
+	case "validate-paths":
+		if !parseValidatePathsArgs(commandArgs) {
+			fmt.Fprintf(os.Stderr, "Usage: git-wmem validate-paths\n")
+			os.Exit(1)
+		}
+		err := internal.ValidatePathsWmem()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "export-all":
+		wmemUIDs, opts, ok := parseExportAllArgs(commandArgs)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Usage: git-wmem export-all [--output <file>] <wmem-uid>\n")
+			fmt.Fprintf(os.Stderr, "       git-wmem export-all --output-dir <dir> [--hardlink-dedupe] <wmem-uid>...\n")
+			os.Exit(1)
+		}
+		var err error
+		if opts.OutputDir != "" {
+			err = internal.ExportAllToDirWmem(wmemUIDs, opts)
+		} else {
+			err = internal.ExportAllWmem(wmemUIDs[0], opts)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "info":
+		if !parseInfoArgs(commandArgs) {
+			fmt.Fprintf(os.Stderr, "Usage: git-wmem info\n")
+			os.Exit(1)
+		}
+		err := internal.InfoWmem()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
@@ -111,7 +230,7 @@ func main() {
 
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
-		fmt.Fprintf(os.Stderr, "Available commands: init, commit, log\n")
+		fmt.Fprintf(os.Stderr, "Available commands: init, commit, log, remotes, history, gc, repair-refs, fsck, validate-paths, export-all, info\n")
 		os.Exit(1)
 	}
 
@@ -128,3 +247,245 @@ func main() {
 		}
 	}
 }
+
+// changeWorkDir changes to the --dir/-C directory before running a command
+// commit and log additionally require the directory to be a wmem-repo
+func changeWorkDir(dir string, command string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory %s: %w", dir, err)
+	}
+
+	if err := os.Chdir(absDir); err != nil {
+		return fmt.Errorf("failed to change to directory %s: %w", absDir, err)
+	}
+
+	if command == "commit" || command == "log" || command == "remotes" || command == "history" || command == "gc" || command == "repair-refs" || command == "fsck" || command == "validate-paths" || command == "export-all" || command == "info" {
+		if _, err := os.Stat(".git-wmem"); err != nil {
+			return fmt.Errorf("%s is not a wmem repository (missing .git-wmem file)", absDir)
+		}
+	}
+	return nil
+}
+
+// parseInitArgs parses git-wmem init flags and the target directory
+func parseInitArgs(args []string) (string, internal.InitOptions, bool) {
+	var opts internal.InitOptions
+
+	initFlags := flag.NewFlagSet("init", flag.ContinueOnError)
+	initFlags.BoolVar(&opts.BareReposShared, "bare-repos-shared", false, "share objects of all wmem-wd-repos via repos/_shared.git")
+	initFlags.BoolVar(&opts.NoCommit, "no-commit", false, "skip the initial commit (the first git-wmem commit creates it)")
+	initFlags.Func("gitignore-extra", "append this pattern to the default .gitignore of the wmem-repo (repeatable)", func(pattern string) error {
+		opts.GitignoreExtra = append(opts.GitignoreExtra, pattern)
+		return nil
+	})
+
+	if err := initFlags.Parse(args); err != nil || initFlags.NArg() != 1 {
+		return "", opts, false
+	}
+	return initFlags.Arg(0), opts, true
+}
+
+// parseCommitArgs parses git-wmem commit flags into commit options
+func parseCommitArgs(args []string) (internal.CommitOptions, bool) {
+	var opts internal.CommitOptions
+
+	commitFlags := flag.NewFlagSet("commit", flag.ContinueOnError)
+	commitFlags.IntVar(&opts.FetchParallelism, "parallel-fetch", 0, "max concurrent workdir fetches (0 = all at once)")
+	commitFlags.IntVar(&opts.CheckParallelism, "parallel", 0, "max concurrent workdir checks (0 = all at once)")
+	commitFlags.BoolVar(&opts.SnapshotIndex, "snapshot-index", false, "snapshot the workdir index (staged state) instead of the working tree")
+	commitFlags.BoolVar(&opts.OnlyIfIdle, "only-if-idle", false, "skip workdirs with a git operation in progress")
+	commitFlags.StringVar(&opts.ReportPath, "report", "", "write a JSON run report to the given file")
+	commitFlags.IntVar(&opts.MaxFileCount, "max-file-count", 0, "abort a workdir snapshot with more files than this (0 = unlimited)")
+	commitFlags.BoolVar(&opts.Compress, "compress", false, "pack loose objects of changed bare repos after the run")
+	commitFlags.BoolVar(&opts.VerifyAfter, "verify-after", false, "check new commits of changed bare repos for missing objects after the run")
+	commitFlags.DurationVar(&opts.WorkdirTimeout, "workdir-timeout", 0, "deadline of each workdir fetch and check, e.g. 30s (0 = no deadline)")
+	commitFlags.BoolVar(&opts.KeepGoing, "keep-going", false, "skip workdirs whose fetch or check failed instead of aborting")
+	commitFlags.BoolVar(&opts.DedupeIdenticalTrees, "dedupe-identical-trees", false, "skip snapshot commits whose tree equals the wmem-br tip tree")
+	commitFlags.BoolVar(&opts.RespectSparseCheckout, "respect-sparse-checkout", false, "keep files outside the sparse-checkout cone instead of recording them as deleted")
+	commitFlags.BoolVar(&opts.KeepCommitTimestamps, "keep-commit-timestamps", false, "give merge commits the author/committer times of the merged workdir commit")
+	commitFlags.IntVar(&opts.BatchSize, "batch-size", 0, "create a wmem-repo commit after every <n> workdirs (0 = one commit at the end)")
+	commitFlags.BoolVar(&opts.TreatWarningsAsErrors, "treat-warnings-as-errors", false, "exit with an error if the run printed any warning")
+	commitFlags.BoolVar(&opts.ShallowTreeCompare, "shallow-tree-compare", false, "treat clean workdirs at the wmem-br tip tree as unchanged without building a tree")
+	commitFlags.BoolVar(&opts.PostMergeFF, "post-merge-ff", false, "fast-forward wmem-br to new workdir commits of clean workdirs instead of merging")
+	commitFlags.BoolVar(&opts.IndexOnlyDetection, "index-only-detection", false, "detect workdir changes from the workdir index stat data like git status")
+	commitFlags.BoolVar(&opts.SnapshotTags, "snapshot-tags", false, "mirror workdir tags into refs/wmem-tags/<workdir-name>/* of the bare repos")
+	commitFlags.BoolVar(&opts.RefreshCache, "refresh-cache", false, "delete the persisted caches before the run and recompute everything")
+	commitFlags.StringVar(&opts.WorkdirOrder, "workdir-order", "config", "processing order of workdirs: config (as listed), alpha (by name) or mtime (most recently modified first)")
+	commitFlags.StringVar(&opts.CaseConflictPolicy, "ignore-case-conflicts", "", "resolve names colliding case-insensitively: first, last, newest-mtime or error (default keeps all)")
+	commitFlags.BoolVar(&opts.IncludeWmemRepo, "include-wmem-repo", false, "also snapshot the wmem-repo (without repos/) into repos/_wmem.git")
+	commitFlags.Func("exclude-branch", "skip workdirs whose current branch matches this pattern, e.g. tmp/* (repeatable, adds to md/commit/branch-denylist)", func(pattern string) error {
+		opts.ExcludeBranches = append(opts.ExcludeBranches, pattern)
+		return nil
+	})
+	commitFlags.BoolVar(&opts.AuthorRequired, "author-required", false, "fail if md/commit/author or md/commit/committer is the placeholder identity of git-wmem init")
+	commitFlags.BoolVar(&opts.FSMonitor, "fsmonitor", false, "detect workdir changes from the core.fsmonitor hook of each workdir, falls back when unavailable")
+	commitFlags.BoolVar(&opts.NormalizeLineEndings, "normalize-line-endings", false, "store CRLF as LF in snapshot blobs of text files (.gitattributes text/binary respected)")
+	commitFlags.BoolVar(&opts.SkipCleanWorkdirsFast, "skip-clean-workdirs-fast", false, "skip workdirs whose root directory and git files didn't change since their last check, without opening them")
+	commitFlags.BoolVar(&opts.CaptureStash, "capture-stash", false, "also keep the workdir stash entries as refs/wmem-stash/<workdir-name>/<n> in the wmem-wd-repo")
+	commitFlags.StringVar(&opts.DumpTree, "dump-tree", "", "debug: print the snapshot tree of the given workdir like git ls-tree -r -t and exit without committing")
+	commitFlags.BoolVar(&opts.PreserveMtimeMetadata, "preserve-mtime-metadata", false, "record the file mtimes of each snapshot as a refs/notes/wmem-mtime note of the snapshot commit")
+	commitFlags.Func("path-filter", "snapshot only workdir files matching this .gitignore style pattern, e.g. src/** (repeatable)", func(pattern string) error {
+		opts.PathFilters = append(opts.PathFilters, pattern)
+		return nil
+	})
+	commitFlags.BoolVar(&opts.AuthorFromWorkdirHead, "author-from-workdir-head-always", false, "take the author name and email of every snapshot from the workdir HEAD commit instead of md/commit/author")
+	commitFlags.BoolVar(&opts.GroupByBranch, "group-by-branch", false, "group the workdirs of the wmem-repo commit message by branch")
+	commitFlags.BoolVar(&opts.SnapshotWorktreeAndIndex, "snapshot-worktree-and-index", false, "snapshot the working tree to wmem-br/<branch> and the index to wmem-br/<branch>-index")
+	commitFlags.BoolVar(&opts.DetectMoves, "detect-moves", false, "record renamed files of snapshots in the wmem-repo commit message and the report")
+	commitFlags.BoolVar(&opts.EmptyReposSkip, "empty-repos-skip", false, "skip init-repos checks of mapped workdirs whose workdir and bare repo directories exist")
+	commitFlags.BoolVar(&opts.DedupeBlobsAcrossWorkdirs, "dedupe-blobs-across-workdirs", false, "store snapshot blobs once in repos/_shared.git (requires init --bare-repos-shared)")
+	commitFlags.BoolVar(&opts.AnnotateWmemUIDInWorkdir, "annotate-wmem-uid-in-workdir", false, "add the wmem-uid to a refs/notes/wmem note on the HEAD commit of each snapshotted workdir (writes to the workdir repo)")
+	commitFlags.BoolVar(&opts.RequireCleanWmemRepo, "require-clean-wmem-repo", false, "fail if the wmem-repo has uncommitted changes (e.g. md/ edits) before the run")
+	commitFlags.BoolVar(&opts.NoFetch, "no-fetch", false, "never fetch workdirs, skip those whose HEAD commit isn't in their wmem-wd-repo yet")
+	commitFlags.BoolVar(&opts.WorkdirFromStdin, "workdir-from-stdin", false, "read the workdir paths from stdin (one per line) instead of md/commit-workdir-paths")
+	commitFlags.BoolVar(&opts.IgnoreSubmoduleErrors, "ignore-submodule-errors", false, "skip nested repositories with an unborn or broken HEAD with a warning instead of failing")
+	commitFlags.BoolVar(&opts.SingleCommitPerRun, "single-commit-per-run", false, "create one snapshot commit per workdir, merging a new workdir HEAD into the snapshot of its uncommitted changes")
+	commitFlags.BoolVar(&opts.AuthorEmailDomainCheck, "author-email-domain-check", false, "fail unless the author and committer emails are in a domain listed in md/commit/allowed-domains")
+	commitFlags.DurationVar(&opts.MaxTotalRuntime, "max-total-runtime", 0, "wall-clock budget of the run, e.g. 5m: workdirs not started by then are skipped like with --keep-going (0 = no budget)")
+	commitFlags.BoolVar(&opts.VerifyWorkdirCleanAfter, "verify-workdir-clean-after", false, "fail if the file list or mtimes of a workdir changed during the run")
+	commitFlags.StringVar(&opts.BlobFilter, "blob-filter", "", "pipe files selected by md/commit/blob-filter-attributes through this shell command before storing them, like a git clean filter")
+	commitFlags.BoolVar(&opts.Resume, "resume", false, "continue an interrupted run with its wmem-uid, skipping the workdirs it already snapshotted")
+	commitFlags.StringVar(&opts.OnConflict, "on-conflict", "accept-workdir", "workdir HEAD not merged into wmem-br yet: accept-workdir (merge with the workdir tree) or skip (leave wmem-br behind)")
+	commitFlags.BoolVar(&opts.RecordUpstream, "record-upstream", false, "record the upstream of each workdir branch and how far ahead/behind it is in the report and the meta message")
+	commitFlags.BoolVar(&opts.DryRun, "dry-run", false, "list the workdirs that would get a snapshot and their changed files, without fetching or committing")
+	commitFlags.BoolVar(&opts.Diff, "diff", false, "with --dry-run: show the unified diff of each workdir against its last snapshot")
+	commitFlags.IntVar(&opts.MaxDepth, "max-depth", 0, "skip directories nested deeper than this below the workdir root with a warning (0 = unlimited)")
+	commitFlags.BoolVar(&opts.JSONReport, "json-report", false, "print the JSON run report to stdout (progress to stderr) and exit with 3 when nothing was committed, 4 when --keep-going skipped failed workdirs")
+	pruneEmptyDirs := commitFlags.Bool("prune-empty-dirs", true, "drop empty directories from snapshots (false = keep them with a placeholder file)")
+	authorDateNow := commitFlags.Bool("author-date-now", true, "date the author of snapshot and merge commits with the time of the run (false = the source: newest changed file or merged workdir commit)")
+	committerDateNow := commitFlags.Bool("committer-date-now", true, "date the committer of snapshot and merge commits with the time of the run (false = the source)")
+
+	if err := commitFlags.Parse(args); err != nil || commitFlags.NArg() != 0 {
+		return opts, false
+	}
+	opts.KeepEmptyDirs = !*pruneEmptyDirs
+	opts.AuthorDateFromSource = !*authorDateNow
+	opts.CommitterDateFromSource = !*committerDateNow
+	return opts, true
+}
+
+// parseLogArgs parses git-wmem log flags into log options
+func parseLogArgs(args []string) (internal.LogOptions, bool) {
+	var opts internal.LogOptions
+
+	logFlags := flag.NewFlagSet("log", flag.ContinueOnError)
+	logFlags.BoolVar(&opts.JSON, "json", false, "print the log as a JSON document")
+	logFlags.BoolVar(&opts.NoPager, "no-pager", false, "do not pipe output into a pager")
+	logFlags.BoolVar(&opts.UIDOnly, "uid-only", false, "print only wmem-uids, one per line")
+	logFlags.BoolVar(&opts.Files, "files", false, "list changed files of each workdir snapshot (slower)")
+	logFlags.BoolVar(&opts.Parents, "parents", false, "show the parent hashes of each workdir snapshot")
+	logFlags.BoolVar(&opts.Check, "check", false, "report wmem-repo commits without a valid wmem-uid line instead of the log")
+	logFlags.StringVar(&opts.WorkdirPathStyle, "workdir-path-style", "rel", "show workdirs as the workdir-map path (rel), absolute path (abs) or workdir-name (name)")
+	logFlags.StringVar(&opts.Encoding, "encoding", "escape", "print invalid UTF-8 and control characters of messages escaped (escape), as U+FFFD (replace) or as is (raw)")
+	workdirMissingOK := logFlags.Bool("workdir-missing-ok", true, "show workdirs without an openable bare repo as unknown (false = fail)")
+	logFlags.BoolVar(&opts.Count, "count", false, "print only the number of wmem commits, distinct workdirs and the date range")
+	logFlags.BoolVar(&opts.Fetch, "fetch", false, "with --workdir-status, fetch new workdir commits into the bare repos first")
+	logFlags.BoolVar(&opts.Pretty, "pretty", false, "with --json, indent the JSON document for reading")
+	logFlags.BoolVar(&opts.DiffWmemRepo, "diff-wmem-repo", false, "show the diff of the wmem-repo's own files (md/, ...) of each commit")
+	logFlags.BoolVar(&opts.WorkdirTreeSize, "workdir-tree-size", false, "show the total file size of each workdir snapshot tree (walks every tree)")
+	logFlags.StringVar(&opts.Color, "color", "auto", "print colors on a terminal (auto), always or never")
+	logFlags.BoolVar(&opts.ColorByWorkdir, "color-by-workdir", false, "print each workdir in its own color, stable per workdir-name")
+	logFlags.BoolVar(&opts.WorkdirCount, "workdir-count", false, "show how many workdirs changed in each commit")
+	logFlags.StringVar(&opts.SinceUID, "since-uid", "", "show only commits newer than the given wmem-uid")
+	logFlags.BoolVar(&opts.WorkdirStatus, "workdir-status", false, "start with a banner of workdirs the next commit would snapshot (slower)")
+
+	if err := logFlags.Parse(args); err != nil || logFlags.NArg() != 0 {
+		return opts, false
+	}
+	opts.StrictWorkdirs = !*workdirMissingOK
+	return opts, true
+}
+
+// parseRemotesArgs parses git-wmem remotes flags into remotes options
+func parseRemotesArgs(args []string) (internal.RemotesOptions, bool) {
+	var opts internal.RemotesOptions
+
+	remotesFlags := flag.NewFlagSet("remotes", flag.ContinueOnError)
+	remotesFlags.BoolVar(&opts.Fix, "fix", false, "point mismatched wmem-wd remotes at the workdir-map path")
+
+	if err := remotesFlags.Parse(args); err != nil || remotesFlags.NArg() != 0 {
+		return opts, false
+	}
+	return opts, true
+}
+
+// parseHistoryArgs parses git-wmem history flags and the <workdir-name> <file> arguments
+func parseHistoryArgs(args []string) (string, string, internal.HistoryOptions, bool) {
+	var opts internal.HistoryOptions
+
+	historyFlags := flag.NewFlagSet("history", flag.ContinueOnError)
+	historyFlags.StringVar(&opts.Branch, "branch", "", "workdir branch to follow (default: wmem-br/head)")
+	historyFlags.BoolVar(&opts.Patch, "patch", false, "show a unified diff to the previous version of the file")
+
+	if err := historyFlags.Parse(args); err != nil || historyFlags.NArg() != 2 {
+		return "", "", opts, false
+	}
+	return historyFlags.Arg(0), historyFlags.Arg(1), opts, true
+}
+
+// parseGcArgs parses git-wmem gc flags into gc options
+func parseGcArgs(args []string) (internal.GcOptions, bool) {
+	var opts internal.GcOptions
+
+	gcFlags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	gcFlags.BoolVar(&opts.Aggressive, "aggressive", false, "repack all reachable objects of each bare repo into a single pack")
+
+	if err := gcFlags.Parse(args); err != nil || gcFlags.NArg() != 0 {
+		return opts, false
+	}
+	return opts, true
+}
+
+// parseRepairRefsArgs checks that git-wmem repair-refs got no flags or arguments
+func parseRepairRefsArgs(args []string) bool {
+	repairFlags := flag.NewFlagSet("repair-refs", flag.ContinueOnError)
+	return repairFlags.Parse(args) == nil && repairFlags.NArg() == 0
+}
+
+// parseFsckArgs parses git-wmem fsck flags into fsck options
+func parseFsckArgs(args []string) (internal.FsckOptions, bool) {
+	var opts internal.FsckOptions
+
+	fsckFlags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	fsckFlags.BoolVar(&opts.Fix, "fix", false, "reset broken wmem-br branches to their last good commit")
+
+	if err := fsckFlags.Parse(args); err != nil || fsckFlags.NArg() != 0 {
+		return opts, false
+	}
+	return opts, true
+}
+
+// parseValidatePathsArgs checks that git-wmem validate-paths got no flags or arguments
+func parseValidatePathsArgs(args []string) bool {
+	validateFlags := flag.NewFlagSet("validate-paths", flag.ContinueOnError)
+	return validateFlags.Parse(args) == nil && validateFlags.NArg() == 0
+}
+
+// parseInfoArgs checks that git-wmem info got no flags or arguments
+func parseInfoArgs(args []string) bool {
+	infoFlags := flag.NewFlagSet("info", flag.ContinueOnError)
+	return infoFlags.Parse(args) == nil && infoFlags.NArg() == 0
+}
+
+// parseExportAllArgs parses git-wmem export-all flags and the wmem-uids
+// A tar archive takes one wmem-uid, --output-dir one or more
+func parseExportAllArgs(args []string) ([]string, internal.ExportAllOptions, bool) {
+	var opts internal.ExportAllOptions
+
+	exportFlags := flag.NewFlagSet("export-all", flag.ContinueOnError)
+	exportFlags.StringVar(&opts.Output, "output", "", "write the tar archive to the given file (default: stdout)")
+	exportFlags.StringVar(&opts.OutputDir, "output-dir", "", "write the files of each wmem-uid to <dir>/<wmem-uid>/ instead of a tar archive")
+	exportFlags.BoolVar(&opts.HardlinkDedupe, "hardlink-dedupe", false, "hardlink identical files across the exported snapshots (--output-dir)")
+
+	if err := exportFlags.Parse(args); err != nil || exportFlags.NArg() == 0 {
+		return nil, opts, false
+	}
+	if opts.OutputDir == "" && (exportFlags.NArg() != 1 || opts.HardlinkDedupe) {
+		return nil, opts, false
+	}
+	if opts.OutputDir != "" && opts.Output != "" {
+		return nil, opts, false
+	}
+	return exportFlags.Args(), opts, true
+}
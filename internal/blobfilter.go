@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+)
+
+// blobFilterAttributesPath selects the files --blob-filter cleans, in .gitattributes syntax
+// Reference: docs/use-cases/git-wmem-commit/basic.md#blob-filter
+const blobFilterAttributesPath = "md/commit/blob-filter-attributes"
+
+// blobFilterAttribute is the attribute of md/commit/blob-filter-attributes marking files to clean
+const blobFilterAttribute = "wmem-blob-filter"
+
+// blobFilter pipes the content of matching files through a command before it becomes a snapshot blob,
+// like a git clean filter (--blob-filter)
+type blobFilter struct {
+	command string
+	root    string
+	matcher gitattributes.Matcher
+}
+
+// readBlobFilterAttributes reads the patterns of md/commit/blob-filter-attributes (none when the file is missing)
+// Empty lines and lines starting with # are ignored
+func readBlobFilterAttributes() ([]gitattributes.MatchAttribute, error) {
+	file, err := os.Open(blobFilterAttributesPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var attributes []gitattributes.MatchAttribute
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		attribute, err := gitattributes.ParseAttributesLine(line, nil, false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid line %q: %w", line, err)
+		}
+		attributes = append(attributes, attribute)
+	}
+	return attributes, scanner.Err()
+}
+
+// validateBlobFilter checks that --blob-filter has files to clean
+func validateBlobFilter(opts CommitOptions) error {
+	if opts.BlobFilter == "" {
+		return nil
+	}
+	attributes, err := readBlobFilterAttributes()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", blobFilterAttributesPath, err)
+	}
+	if len(attributes) == 0 {
+		return fmt.Errorf("--blob-filter needs the files to clean in %s, e.g. '*.env %s'", blobFilterAttributesPath, blobFilterAttribute)
+	}
+	return nil
+}
+
+// newBlobFilter returns the blob filter of the snapshot root, nil without --blob-filter
+func newBlobFilter(root, command string) (*blobFilter, error) {
+	if command == "" {
+		return nil, nil
+	}
+	attributes, err := readBlobFilterAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", blobFilterAttributesPath, err)
+	}
+	return &blobFilter{command: command, root: root, matcher: gitattributes.NewMatcher(attributes)}, nil
+}
+
+// apply returns the content to store for the file at filePath
+// Matching files are piped through the command (sh -c, run in the snapshot root, with the
+// root-relative path in GIT_WMEM_BLOB_FILTER_PATH), a nil filter keeps all content as is
+func (f *blobFilter) apply(filePath string, content []byte) ([]byte, error) {
+	if f == nil {
+		return content, nil
+	}
+	relPath, err := filepath.Rel(f.root, filePath)
+	if err != nil {
+		return content, nil
+	}
+	relPath = filepath.ToSlash(relPath)
+	attrs, _ := f.matcher.Match(strings.Split(relPath, "/"), []string{blobFilterAttribute})
+	if attr := attrs[blobFilterAttribute]; attr == nil || !attr.IsSet() {
+		return content, nil
+	}
+
+	cmd := exec.Command("sh", "-c", f.command)
+	cmd.Dir = f.root
+	cmd.Env = append(os.Environ(), "GIT_WMEM_BLOB_FILTER_PATH="+relPath)
+	cmd.Stdin = bytes.NewReader(content)
+	filtered, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("blob filter failed for %s: %w: %s", relPath, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("blob filter failed for %s: %w", relPath, err)
+	}
+	return filtered, nil
+}
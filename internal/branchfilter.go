@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// branchDenylistPath lists branch patterns of workdirs git-wmem commit skips, one per line
+// Reference: docs/use-cases/git-wmem-commit/basic.md#branch-denylist
+const branchDenylistPath = "md/commit/branch-denylist"
+
+// readBranchDenylist reads the patterns of md/commit/branch-denylist (none when the file is missing)
+// Empty lines and lines starting with # are ignored
+func readBranchDenylist() ([]string, error) {
+	file, err := os.Open(branchDenylistPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// validateBranchPatterns checks the glob syntax of branch patterns
+func validateBranchPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid branch pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchBranchPattern returns the first pattern matching branchName, or "" when none does
+// Patterns use path.Match syntax, so * doesn't match / (tmp/* matches tmp/experiment, not tmp/a/b)
+func matchBranchPattern(branchName string, patterns []string) string {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, branchName); matched {
+			return pattern
+		}
+	}
+	return ""
+}
@@ -10,6 +10,9 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 )
 
+// cacheDirName is the directory of the wmem-repo holding the persisted caches, never part of wmem-repo commits
+const cacheDirName = "cache"
+
 // Simple file-based cache for directory mtimes
 func readLastMtimeFromFile(cacheFile string) (time.Time, error) {
 	data, err := os.ReadFile(cacheFile)
@@ -64,7 +67,7 @@ func getCacheFilePath(workdirPath string) (string, error) {
 		return "", err
 	}
 
-	cacheDir := filepath.Join(wmemRoot, "cache")
+	cacheDir := filepath.Join(wmemRoot, cacheDirName)
 	cacheFile := filepath.Join(cacheDir, fmt.Sprintf("git-wmem-cache-%s.json", filepath.Base(workdirPath)))
 	return cacheFile, nil
 }
@@ -150,6 +153,22 @@ func (cc *CommitCache) clearCache() {
 	cc.treeHashCache = make(map[string]treeHashCacheEntry)
 	cc.directoryStateCache = make(map[string]directoryStateCacheEntry)
 	cc.fileListCache = make(map[string]fileListCacheEntry)
+	cc.wmemTreeCache = make(map[string]wmemTreeCacheEntry)
+}
+
+// refreshCache drops the in-memory caches and the on-disk cache directory of the wmem repo
+// Reference: docs/use-cases/git-wmem-commit/basic.md#refresh-cache
+func refreshCache() error {
+	globalCommitCache.clearCache()
+
+	wmemRoot, err := findWmemRepoRoot()
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(wmemRoot, cacheDirName)); err != nil {
+		return fmt.Errorf("failed to remove cache directory: %w", err)
+	}
+	return nil
 }
 
 // getCacheStats returns cache statistics for debugging
@@ -257,9 +276,9 @@ func hasFilesDeletedUsingDirectoryMtime(workdirPath, workdirName, currentBranchN
 		previousFiles = cachedFileList.fileList
 	} else {
 		// Need to get file list from wmem tree
-		fmt.Printf("Debug: Cache miss - fetching from wmem tree for %s (hasFileCache=%v, headSHA1 currentVScached=%s vs %s)\n", workdirPath, hasFileCache, headSHA1[:8], func() string {
+		fmt.Printf("Debug: Cache miss - fetching from wmem tree for %s (hasFileCache=%v, headSHA1 currentVScached=%s vs %s)\n", workdirPath, hasFileCache, abbrevHash(headSHA1), func() string {
 			if hasFileCache {
-				return cachedFileList.headSHA1[:8]
+				return abbrevHash(cachedFileList.headSHA1)
 			}
 			return "no cache"
 		}())
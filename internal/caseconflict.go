@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// validateCaseConflictPolicy checks the git-wmem commit --ignore-case-conflicts value
+func validateCaseConflictPolicy(policy string) error {
+	switch policy {
+	case "", "first", "last", "newest-mtime", "error":
+		return nil
+	default:
+		return fmt.Errorf("invalid --ignore-case-conflicts %q (first, last, newest-mtime or error)", policy)
+	}
+}
+
+// caseConflictLosers returns the names dropped from a snapshot because they collide case-insensitively
+// with another name (README.md vs readme.md), according to the --ignore-case-conflicts policy:
+// first/last keep the first/last name in byte order, newest-mtime the most recently modified one,
+// error fails the snapshot. Without a policy all names are kept.
+// names are relative to dirPath, only names in the same directory can collide
+// Reference: docs/use-cases/git-wmem-commit/basic.md#case-conflicts
+func caseConflictLosers(dirPath string, names []string, policy string) (map[string]bool, error) {
+	if policy == "" {
+		return nil, nil
+	}
+
+	groups := make(map[string][]string)
+	for _, name := range names {
+		key := strings.ToLower(name)
+		groups[key] = append(groups[key], name)
+	}
+
+	losers := make(map[string]bool)
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Strings(group)
+
+		winner := group[0]
+		switch policy {
+		case "error":
+			return nil, fmt.Errorf("case conflict in %s: %s (--ignore-case-conflicts=error)", dirPath, strings.Join(group, ", "))
+		case "last":
+			winner = group[len(group)-1]
+		case "newest-mtime":
+			var newest time.Time
+			for _, name := range group {
+				info, err := os.Lstat(filepath.Join(dirPath, name))
+				if err != nil {
+					continue
+				}
+				if info.ModTime().After(newest) {
+					newest = info.ModTime()
+					winner = name
+				}
+			}
+		}
+
+		for _, name := range group {
+			if name != winner {
+				losers[name] = true
+			}
+		}
+		fmt.Printf("Debug: Case conflict in %s: keeping %s of %s (--ignore-case-conflicts=%s)\n", dirPath, winner, strings.Join(group, ", "), policy)
+	}
+	return losers, nil
+}
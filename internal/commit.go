@@ -1,7 +1,9 @@
 package internal
 
 import (
+	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -14,6 +16,7 @@ import (
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
@@ -22,40 +25,180 @@ import (
 // workdirCheckResult holds the result of parallel workdir checking
 type workdirCheckResult struct {
 	WorkdirPath       string
+	ResolvedPath      string
 	WorkdirName       string
 	CurrentBranchName string
+	OldTip            plumbing.Hash
+	MergedTip         plumbing.Hash
+	Kind              WorkdirCommitKind
 	HasModifiedFiles  bool
+	SkipReason        string
+	Excluded          bool
+	Upstream          *UpstreamStatus
 	Error             error
 }
 
 // CommitWmem performs the main git-wmem-commit operation
 // Reference: docs/use-cases/git-wmem-commit/basic.md
-func CommitWmem() error {
+func CommitWmem(opts CommitOptions) error {
 	// Check if we're in a wmem-repo
 	if !isWmemRepo() {
 		return fmt.Errorf("not in a wmem repository (missing .git-wmem file). Run this command from a wmem-repo directory.")
 	}
 
+	if opts.DumpTree != "" {
+		// Read-only, so no lock is needed
+		return dumpWorkdirTree(opts.DumpTree, opts)
+	}
+	if opts.Diff && !opts.DryRun {
+		return fmt.Errorf("--diff requires --dry-run")
+	}
+	if opts.DryRun {
+		// Read-only as well
+		return dryRunCommit(opts)
+	}
+
+	// Reference: docs/use-cases/git-wmem-commit/basic.md#exit-status
+	var jsonOut io.Writer
+	if opts.JSONReport {
+		// stdout carries only the run report, the progress lines go to stderr
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = stdout }()
+		jsonOut = stdout
+	}
+
+	// git-wmem gc must not repack while this run writes objects
+	release, err := acquireWmemLock("commit")
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	// Check if workdir paths are configured
-	workdirPaths, err := readWorkdirPaths()
+	var workdirPaths []string
+	if opts.WorkdirFromStdin {
+		// Reference: docs/use-cases/git-wmem-commit/basic.md#workdir-paths-from-stdin
+		workdirPaths, err = readWorkdirPathsFrom(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read workdir paths from stdin: %w", err)
+		}
+		if len(workdirPaths) == 0 {
+			return fmt.Errorf("No workdir paths on stdin (--workdir-from-stdin).")
+		}
+	} else {
+		workdirPaths, err = readWorkdirPaths()
+		if err != nil {
+			return fmt.Errorf("failed to read workdir paths: %w", err)
+		}
+		if len(workdirPaths) == 0 {
+			return fmt.Errorf("No workdirs configured for commit. Add paths to your workdirs in md/commit-workdir-paths file.")
+		}
+	}
+
+	if opts.AuthorRequired {
+		if err := checkRealIdentity(); err != nil {
+			return err
+		}
+	}
+	if opts.AuthorEmailDomainCheck {
+		// Stop before anything is created, parseCommitSignatures checks the identity of every commit
+		commitInfo, err := readCommitInfo()
+		if err != nil {
+			return err
+		}
+		if _, _, err := parseCommitSignatures(commitInfo, time.Time{}, time.Time{}, opts); err != nil {
+			return err
+		}
+	}
+
+	if err := validateWorkdirOrder(opts.WorkdirOrder); err != nil {
+		return err
+	}
+	if err := validateCaseConflictPolicy(opts.CaseConflictPolicy); err != nil {
+		return err
+	}
+	if err := validateOnConflict(opts.OnConflict); err != nil {
+		return err
+	}
+	if err := validatePathFilters(opts); err != nil {
+		return err
+	}
+	if err := validateDedupeBlobs(opts); err != nil {
+		return err
+	}
+	if err := validateBlobFilter(opts); err != nil {
+		return err
+	}
+	if opts.SnapshotWorktreeAndIndex && opts.SnapshotIndex {
+		return fmt.Errorf("--snapshot-worktree-and-index can't be combined with --snapshot-index")
+	}
+
+	// Reference: docs/use-cases/git-wmem-commit/basic.md#branch-denylist
+	denylist, err := readBranchDenylist()
 	if err != nil {
-		return fmt.Errorf("failed to read workdir paths: %w", err)
+		return fmt.Errorf("failed to read %s: %w", branchDenylistPath, err)
+	}
+	opts.ExcludeBranches = append(denylist, opts.ExcludeBranches...)
+	if err := validateBranchPatterns(opts.ExcludeBranches); err != nil {
+		return err
 	}
 
-	if len(workdirPaths) == 0 {
-		return fmt.Errorf("No workdirs configured for commit. Add paths to your workdirs in md/commit-workdir-paths file.")
+	// Reference: docs/use-cases/git-wmem-commit/basic.md#object-format
+	for _, workdirPath := range workdirPaths {
+		// Fail before creating bare repos, a SHA-256 workdir can't be fetched
+		if err := checkObjectFormat(workdirPath); err != nil {
+			return err
+		}
+		if opts.SnapshotWorktreeAndIndex {
+			if err := checkIndexBranchCollision(workdirPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Reference: docs/use-cases/git-wmem-commit/basic.md#require-clean-wmem-repo
+	if opts.RequireCleanWmemRepo {
+		dirty, err := hasWmemRepoMetadataChanges()
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("wmem-repo has uncommitted changes from before this run (--require-clean-wmem-repo), commit or revert them first (see git status)")
+		}
+	}
+
+	if opts.RefreshCache {
+		if err := refreshCache(); err != nil {
+			return fmt.Errorf("failed to refresh cache: %w", err)
+		}
+		fmt.Printf("Info: Cleared in-memory and on-disk caches (--refresh-cache)\n")
 	}
 
 	// Perform init-repos operation
-	if err := initRepos(workdirPaths); err != nil {
+	if err := initRepos(workdirPaths, opts); err != nil {
 		return fmt.Errorf("failed to init repos: %w", err)
 	}
 
 	// Perform commit-all operation
-	if err := commitAll(workdirPaths); err != nil {
+	outcome, err := commitAll(workdirPaths, opts, jsonOut)
+	if err != nil {
 		return fmt.Errorf("failed to commit all: %w", err)
 	}
 
+	// The run is complete, warnings only change the exit status
+	if opts.TreatWarningsAsErrors && warningCount.Load() > 0 {
+		return fmt.Errorf("%d warning(s) emitted (--treat-warnings-as-errors)", warningCount.Load())
+	}
+
+	if opts.JSONReport {
+		switch outcome {
+		case outcomeNothingToCommit:
+			return ErrNothingToCommit
+		case outcomePartial:
+			return ErrPartialCommit
+		}
+	}
 	return nil
 }
 
@@ -63,92 +206,338 @@ func CommitWmem() error {
 
 // commitAll implements the commit-all sub-operation
 // Reference: docs/use-cases/git-wmem-commit/basic.md#uc-git-wmem-commit-commit-all
-func commitAll(workdirPaths []string) error {
+// Returns the outcome of the run, the run report goes to jsonOut too when it isn't nil (--json-report)
+func commitAll(workdirPaths []string, opts CommitOptions, jsonOut io.Writer) (commitOutcome, error) {
+	startTime := time.Now()
+
 	// Read commit info
 	commitInfo, err := readCommitInfo()
 	if err != nil {
-		return fmt.Errorf("failed to read commit info: %w", err)
+		return "", fmt.Errorf("failed to read commit info: %w", err)
 	}
+	commitInfo.GroupByBranch = opts.GroupByBranch
+
+	// --resume: continue the interrupted run with its wmem-uid, skipping its done workdirs
+	// Reference: docs/use-cases/git-wmem-commit/basic.md#resume
+	runState, err := startCommitRun(commitInfo, opts.Resume)
+	if err != nil {
+		return "", err
+	}
+	defer runState.discardIfNothingDone()
+	workdirPaths = runState.remaining(workdirPaths)
 
 	// Read workdir map
 	workdirMap, err := readWorkdirMap()
 	if err != nil {
-		return fmt.Errorf("failed to read workdir map: %w", err)
+		return "", fmt.Errorf("failed to read workdir map: %w", err)
+	}
+
+	// --workdir-order: everything below (fetches, checks, snapshots, batches) follows this order
+	if opts.WorkdirOrder != "" && opts.WorkdirOrder != "config" {
+		workdirPaths = orderWorkdirPaths(workdirPaths, workdirMap, opts.WorkdirOrder)
+		fmt.Printf("Info: Workdir order (%s): %s\n", opts.WorkdirOrder, strings.Join(workdirPaths, ", "))
+	}
+
+	// --skip-clean-workdirs-fast: drop workdirs unchanged since their last check before anything is opened
+	var fastSkipStamps map[string]time.Time
+	if opts.SkipCleanWorkdirsFast {
+		fastSkipStamps, err = readFastSkipStamps()
+		if err != nil {
+			return "", err
+		}
+		workdirPaths = fastSkipWorkdirs(workdirPaths, fastSkipStamps)
+	}
+
+	// --verify-workdir-clean-after: snapshots only read workdirs, compare them before and after the run
+	var workdirFingerprints map[string]string
+	if opts.VerifyWorkdirCleanAfter {
+		workdirFingerprints = recordWorkdirFingerprints(workdirPaths)
+	}
+
+	// --max-total-runtime: no new workdir fetch or check starts after this deadline, checked workdirs are committed
+	// Reference: docs/validations.md#max-total-runtime
+	budget := context.Background()
+	if opts.MaxTotalRuntime > 0 {
+		var cancel context.CancelFunc
+		budget, cancel = context.WithDeadline(budget, startTime.Add(opts.MaxTotalRuntime))
+		defer cancel()
+	}
+
+	// Phase 0: Fetch all workdirs up front (step 4 of UC: sync-workdir)
+	// Fetches are I/O bound, so they get their own parallelism limit
+	fetchErrs := runParallelFetches(budget, workdirPaths, workdirMap, opts)
+	if !opts.KeepGoing {
+		for i, err := range fetchErrs {
+			if err != nil && !errors.Is(err, errMaxTotalRuntimeExceeded) && !errors.Is(err, errFetchNeeded) {
+				return "", fmt.Errorf("failed to fetch workdir %s: %w", workdirPaths[i], err)
+			}
+		}
 	}
 
 	// Phase 1: Run initial checks in parallel to determine which workdirs have changes
 	// For single workdir, skip parallel overhead and run directly
 	var checkResults []workdirCheckResult
-	if len(workdirPaths) == 1 {
+	if len(workdirPaths) == 0 {
+		fmt.Printf("Info: No workdirs left to check\n")
+	} else if len(workdirPaths) == 1 {
 		fmt.Printf("Info: Processing single workdir %s\n", workdirPaths[0])
-		result := checkWorkdirInParallel(workdirPaths[0], workdirMap, commitInfo)
+		result := checkWorkdirWithTimeout(budget, workdirPaths[0], fetchErrs[0], workdirMap, commitInfo, opts)
 		checkResults = []workdirCheckResult{result}
 	} else {
 		fmt.Printf("Info: Running parallel checks on %d workdir(s)\n", len(workdirPaths))
-		checkResults = runParallelWorkdirChecks(workdirPaths, workdirMap, commitInfo)
+		checkResults = runParallelWorkdirChecks(budget, workdirPaths, fetchErrs, workdirMap, commitInfo, opts)
 	}
 
 	// Phase 2: Process workdirs with changes sequentially to avoid race conditions
-	var workdirResults []WorkdirCommitResult
-	hasAnyChanges := false
+	// Results of the interrupted run (--resume) go into the first wmem-repo commit
+	workdirResults := append([]WorkdirCommitResult(nil), runState.Pending...)
+	hasAnyChanges := countChangedWorkdirs(workdirResults) > 0
 
+	// Failed checks abort the run before any workdir gets a snapshot commit
 	for _, checkResult := range checkResults {
-		if checkResult.Error != nil {
-			return fmt.Errorf("failed to check workdir %s: %w", checkResult.WorkdirPath, checkResult.Error)
+		if errors.Is(checkResult.Error, errMaxFileCountExceeded) {
+			return "", fmt.Errorf("workdir %s has more than %d files (--max-file-count), nothing was committed", checkResult.WorkdirPath, opts.MaxFileCount)
 		}
-
-		if !checkResult.HasModifiedFiles {
-			fmt.Printf("Info: No modified files in workdir %s, skipping commit creation\n", checkResult.WorkdirPath)
-			workdirResults = append(workdirResults, WorkdirCommitResult{
-				WorkdirName: checkResult.WorkdirName,
-				BranchName:  checkResult.CurrentBranchName,
-				CommitHash:  "", // No new commit created
-				HasChanges:  false,
-			})
-			continue
+		if checkResult.Error != nil && !opts.KeepGoing && !errors.Is(checkResult.Error, errMaxTotalRuntimeExceeded) {
+			return "", fmt.Errorf("failed to check workdir %s: %w", checkResult.WorkdirPath, checkResult.Error)
 		}
+	}
 
-		// Process workdir with changes (steps 7-9 of UC: sync-workdir)
-		result, err := commitWorkdirWithChanges(checkResult.WorkdirPath, checkResult.WorkdirName, checkResult.CurrentBranchName, commitInfo)
+	batchStart := 0
+	batchCommits := 0
+	for i, checkResult := range checkResults {
+		result, err := commitCheckedWorkdir(checkResult, commitInfo, opts)
 		if err != nil {
-			return fmt.Errorf("failed to commit workdir %s: %w", checkResult.WorkdirPath, err)
+			return "", err
 		}
 		workdirResults = append(workdirResults, result)
 
 		// Track if any workdir has changes
-		if result.HasChanges {
+		if result.HasChanges || result.IndexCommitHash != "" {
 			hasAnyChanges = true
 		}
+
+		// Only snapshotted workdirs are done, --resume checks failed and skipped ones again
+		if checkResult.Error == nil && checkResult.SkipReason == "" {
+			if err := runState.workdirDone(checkResult.WorkdirPath, workdirResults[batchStart:]); err != nil {
+				return "", err
+			}
+		}
+
+		// --batch-size: checkpoint every N workdirs with its own wmem-repo commit
+		if opts.BatchSize > 0 && ((i+1)%opts.BatchSize == 0 || i+1 == len(checkResults)) {
+			batch := workdirResults[batchStart:]
+			batchStart = len(workdirResults)
+			if countChangedWorkdirs(batch) == 0 {
+				continue
+			}
+
+			batchInfo := *commitInfo
+			batchInfo.Batch = fmt.Sprintf("%d/%d", i/opts.BatchSize+1, (len(checkResults)+opts.BatchSize-1)/opts.BatchSize)
+			if err := createWmemCommit(&batchInfo, batch); err != nil {
+				return "", fmt.Errorf("failed to create wmem commit for batch %s: %w", batchInfo.Batch, err)
+			}
+			batchCommits++
+			if err := runState.recordPending(nil); err != nil {
+				return "", err
+			}
+			fmt.Printf("Info: Created wmem-repo commit for batch %s with changes from %d workdir(s)\n", batchInfo.Batch, countChangedWorkdirs(batch))
+		}
+	}
+
+	fmt.Printf("Info: Workdir snapshots: %s\n", summarizeWorkdirKinds(workdirResults))
+
+	if opts.IncludeWmemRepo {
+		snapshotted, err := snapshotWmemRepo(commitInfo, opts)
+		if err != nil {
+			return "", fmt.Errorf("failed to snapshot wmem-repo: %w", err)
+		}
+		if snapshotted {
+			fmt.Printf("Info: Snapshotted wmem-repo into repos/%s.git\n", wmemRepoName)
+		} else {
+			fmt.Printf("Info: No changes in wmem-repo since its last snapshot in repos/%s.git\n", wmemRepoName)
+		}
 	}
 
 	// Only create wmem-repo commit if there are actual changes in at least one workdir
 	// or if there are metadata changes in the wmem-repo itself
-	if hasAnyChanges {
+	wmemCommitCreated := batchCommits > 0
+	if hasAnyChanges && !wmemCommitCreated {
 		if err := createWmemCommit(commitInfo, workdirResults); err != nil {
-			return fmt.Errorf("failed to create wmem commit: %w", err)
+			return "", fmt.Errorf("failed to create wmem commit: %w", err)
 		}
+		wmemCommitCreated = true
 		fmt.Printf("Info: Created wmem-repo commit with changes from %d workdir(s)\n", countChangedWorkdirs(workdirResults))
-	} else {
+	} else if !hasAnyChanges {
 		// Check if there are metadata changes that should trigger a wmem-repo commit
 		hasMetadataChanges, err := hasWmemRepoMetadataChanges()
 		if err != nil {
-			return fmt.Errorf("failed to check wmem-repo metadata changes: %w", err)
+			return "", fmt.Errorf("failed to check wmem-repo metadata changes: %w", err)
 		}
 
 		if hasMetadataChanges {
 			if err := createWmemCommit(commitInfo, workdirResults); err != nil {
-				return fmt.Errorf("failed to create wmem commit: %w", err)
+				return "", fmt.Errorf("failed to create wmem commit: %w", err)
 			}
+			wmemCommitCreated = true
 			fmt.Printf("Info: Created wmem-repo commit due to metadata changes (no workdir changes)\n")
 		} else {
 			fmt.Printf("Info: No changes detected in any workdir or metadata, skipping wmem-repo commit creation\n")
 		}
 	}
 
+	if err := runState.finish(); err != nil {
+		return "", err
+	}
+
+	if opts.AnnotateWmemUIDInWorkdir && wmemCommitCreated {
+		if err := annotateWorkdirHeads(commitInfo, workdirResults); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.Compress {
+		if err := compressChangedBareRepos(workdirResults); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.VerifyAfter {
+		if err := verifyChangedBareRepos(workdirResults); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.SkipCleanWorkdirsFast {
+		if err := recordFastSkipStamps(fastSkipStamps, checkResults, startTime); err != nil {
+			return "", fmt.Errorf("failed to save --skip-clean-workdirs-fast cache: %w", err)
+		}
+	}
+
+	if opts.VerifyWorkdirCleanAfter {
+		if err := verifyWorkdirFingerprints(workdirFingerprints, workdirPaths); err != nil {
+			return "", err
+		}
+	}
+
 	// Print cache statistics at the end
 	printCacheStats()
 
-	return nil
+	if opts.ReportPath != "" || jsonOut != nil {
+		if err := writeCommitReport(opts.ReportPath, jsonOut, startTime, commitInfo, workdirResults, wmemCommitCreated); err != nil {
+			return "", fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+
+	return runOutcome(workdirResults, wmemCommitCreated), nil
+}
+
+// commitCheckedWorkdir runs steps 7-9 of UC: sync-workdir for a checked workdir with changes
+// Skipped, failed (--keep-going) and unchanged workdirs get a result without a snapshot commit
+func commitCheckedWorkdir(checkResult workdirCheckResult, commitInfo *CommitInfo, opts CommitOptions) (WorkdirCommitResult, error) {
+	if errors.Is(checkResult.Error, errMaxTotalRuntimeExceeded) {
+		printWarning("Skipping workdir %s: %v\n", checkResult.WorkdirPath, checkResult.Error)
+		result := newWorkdirCommitResult(checkResult)
+		result.SkipReason = fmt.Sprintf("failed: %v", checkResult.Error)
+		return result, nil
+	}
+	if checkResult.Error != nil {
+		printWarning("Skipping failed workdir %s (--keep-going): %v\n", checkResult.WorkdirPath, checkResult.Error)
+		result := newWorkdirCommitResult(checkResult)
+		result.SkipReason = fmt.Sprintf("failed: %v", checkResult.Error)
+		return result, nil
+	}
+
+	if checkResult.Excluded {
+		// Skipped on purpose, not a warning
+		fmt.Printf("Info: Skipping workdir %s: %s\n", checkResult.WorkdirPath, checkResult.SkipReason)
+		return newWorkdirCommitResult(checkResult), nil
+	}
+
+	if checkResult.SkipReason != "" {
+		printWarning("Skipping workdir %s: %s\n", checkResult.WorkdirPath, checkResult.SkipReason)
+		return newWorkdirCommitResult(checkResult), nil
+	}
+
+	var result WorkdirCommitResult
+	if !checkResult.HasModifiedFiles {
+		fmt.Printf("Info: No modified files in workdir %s, skipping commit creation\n", checkResult.WorkdirPath)
+		result = newWorkdirCommitResult(checkResult)
+	} else {
+		// Process workdir with changes (steps 7-9 of UC: sync-workdir)
+		var err error
+		result, err = commitWorkdirWithChanges(checkResult.ResolvedPath, checkResult.WorkdirName, checkResult.CurrentBranchName, commitInfo, opts)
+		if errors.Is(err, errMaxFileCountExceeded) {
+			return WorkdirCommitResult{}, fmt.Errorf("workdir %s has more than %d files (--max-file-count), aborting before its snapshot commit", checkResult.WorkdirPath, opts.MaxFileCount)
+		}
+		if err != nil {
+			return WorkdirCommitResult{}, fmt.Errorf("failed to commit workdir %s: %w", checkResult.WorkdirPath, err)
+		}
+		if !result.HasChanges {
+			// Deduplicated snapshot, wmem-br stays at the step 5 tip
+			result = newWorkdirCommitResult(checkResult)
+		}
+		result.WorkdirPath = checkResult.WorkdirPath
+		result.OldTip = hashString(checkResult.OldTip)
+		result.MergeCommit = checkResult.Kind == WorkdirCommitMerge
+		result.Upstream = checkResult.Upstream
+	}
+
+	// --snapshot-worktree-and-index: the index gets its own snapshot on wmem-br/<branch>-index
+	if opts.SnapshotWorktreeAndIndex {
+		indexCommitHash, err := commitWorkdirIndex(checkResult.ResolvedPath, checkResult.WorkdirName, checkResult.CurrentBranchName, commitInfo, opts)
+		if err != nil {
+			return WorkdirCommitResult{}, fmt.Errorf("failed to snapshot the index of workdir %s: %w", checkResult.WorkdirPath, err)
+		}
+		if !indexCommitHash.IsZero() {
+			fmt.Printf("Info: Successfully committed the index of workdir %s to %s\n", checkResult.WorkdirPath, wmemIndexBranchNameFor(checkResult.CurrentBranchName))
+			result.IndexCommitHash = indexCommitHash.String()
+		}
+	}
+	return result, nil
+}
+
+// newWorkdirCommitResult creates the result of a workdir without a new snapshot commit
+func newWorkdirCommitResult(checkResult workdirCheckResult) WorkdirCommitResult {
+	kind := checkResult.Kind
+	if kind == "" {
+		// Skipped or failed before step 5
+		kind = WorkdirCommitNone
+	}
+	return WorkdirCommitResult{
+		WorkdirName: checkResult.WorkdirName,
+		WorkdirPath: checkResult.WorkdirPath,
+		BranchName:  checkResult.CurrentBranchName,
+		OldTip:      hashString(checkResult.OldTip),
+		NewTip:      hashString(checkResult.MergedTip),
+		CommitHash:  "", // No new commit created
+		HasChanges:  false,
+		MergeCommit: checkResult.Kind == WorkdirCommitMerge,
+		Kind:        kind,
+		SkipReason:  checkResult.SkipReason,
+		Upstream:    checkResult.Upstream,
+	}
+}
+
+// summarizeWorkdirKinds returns a one-line summary of what the run created per workdir
+func summarizeWorkdirKinds(results []WorkdirCommitResult) string {
+	counts := make(map[WorkdirCommitKind]int)
+	for _, result := range results {
+		counts[result.Kind]++
+	}
+	summary := fmt.Sprintf("%d regular, %d merge, %d unchanged", counts[WorkdirCommitRegular], counts[WorkdirCommitMerge], counts[WorkdirCommitNone])
+	if counts[WorkdirCommitFastForward] > 0 {
+		summary += fmt.Sprintf(", %d fast-forward", counts[WorkdirCommitFastForward])
+	}
+	return summary
+}
+
+// hashString returns the hex form of hash, or "" for the zero hash
+func hashString(hash plumbing.Hash) string {
+	if hash.IsZero() {
+		return ""
+	}
+	return hash.String()
 }
 
 // readCommitInfo reads commit information from md/commit/ files
@@ -192,6 +581,29 @@ func readCommitInfo() (*CommitInfo, error) {
 	}, nil
 }
 
+// checkRealIdentity fails when md/commit/author or md/commit/committer is still the placeholder of git-wmem init
+// Reference: docs/validations.md#author-required
+func checkRealIdentity() error {
+	placeholder, err := parseSignature(defaultIdentity)
+	if err != nil {
+		return err
+	}
+	for _, identityPath := range []string{"md/commit/author", "md/commit/committer"} {
+		content, err := os.ReadFile(identityPath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", identityPath, err)
+		}
+		identity, err := parseSignature(strings.TrimSpace(string(content)))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", identityPath, err)
+		}
+		if identity.Name == placeholder.Name && identity.Email == placeholder.Email {
+			return fmt.Errorf("%s is the placeholder identity %s (--author-required), set your own, e.g. echo 'Your Name <you@example.com>' > %s", identityPath, defaultIdentity, identityPath)
+		}
+	}
+	return nil
+}
+
 // generateWmemUID generates a unique wmem-uid
 // Reference: docs/data-structures.md#wmem-uid
 func generateWmemUID() (string, error) {
@@ -218,16 +630,58 @@ func generateWmemUID() (string, error) {
 	return fmt.Sprintf("wmem-%s-%s-%s", datePart, timePart, string(randomPart)), nil
 }
 
+// runParallelFetches fetches latest changes for all workdirs (step 4 of UC: sync-workdir)
+// with at most opts.FetchParallelism concurrent fetches (0 means no limit)
+// Returns the fetch error of each workdir, nil for successful fetches
+// Fetches not started before the --max-total-runtime deadline of budget fail with errMaxTotalRuntimeExceeded
+func runParallelFetches(budget context.Context, workdirPaths []string, workdirMap WorkdirMap, opts CommitOptions) []error {
+	startFetch := time.Now()
+	errs := make([]error, len(workdirPaths))
+	sem := newParallelismLimiter(opts.FetchParallelism, len(workdirPaths))
+	var wg sync.WaitGroup
+
+	for i, workdirPath := range workdirPaths {
+		wg.Add(1)
+		go func(index int, path string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := budgetExceeded(budget, opts); err != nil {
+				errs[index] = fmt.Errorf("fetch not started: %w", err)
+				return
+			}
+
+			workdirName, exists := FindWorkdirName(path, workdirMap)
+			if !exists {
+				errs[index] = fmt.Errorf("workdir %s not found in workdir map", path)
+				return
+			}
+			errs[index] = runWithWorkdirTimeout(opts.WorkdirTimeout, "fetch", func(ctx context.Context) error {
+				return fetchLatestChanges(ctx, workdirName, opts)
+			})
+		}(i, workdirPath)
+	}
+
+	wg.Wait()
+	fmt.Printf("Debug: Fetch phase took %v for %d workdir(s)\n", time.Since(startFetch), len(workdirPaths))
+	return errs
+}
+
 // runParallelWorkdirChecks runs initial checks (steps 1-6) on all workdirs in parallel
-func runParallelWorkdirChecks(workdirPaths []string, workdirMap WorkdirMap, commitInfo *CommitInfo) []workdirCheckResult {
+// with at most opts.CheckParallelism concurrent checks (0 means no limit)
+// Checks not started before the --max-total-runtime deadline of budget fail with errMaxTotalRuntimeExceeded
+func runParallelWorkdirChecks(budget context.Context, workdirPaths []string, fetchErrs []error, workdirMap WorkdirMap, commitInfo *CommitInfo, opts CommitOptions) []workdirCheckResult {
 	results := make([]workdirCheckResult, len(workdirPaths))
+	sem := newParallelismLimiter(opts.CheckParallelism, len(workdirPaths))
 	var wg sync.WaitGroup
 
 	for i, workdirPath := range workdirPaths {
 		wg.Add(1)
 		go func(index int, path string) {
 			defer wg.Done()
-			results[index] = checkWorkdirInParallel(path, workdirMap, commitInfo)
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[index] = checkWorkdirWithTimeout(budget, path, fetchErrs[index], workdirMap, commitInfo, opts)
 		}(i, workdirPath)
 	}
 
@@ -235,8 +689,94 @@ func runParallelWorkdirChecks(workdirPaths []string, workdirMap WorkdirMap, comm
 	return results
 }
 
+// errWorkdirTimeout is returned when a workdir fetch or check exceeds --workdir-timeout
+var errWorkdirTimeout = errors.New("workdir timed out")
+
+// errMaxTotalRuntimeExceeded marks workdirs skipped because the --max-total-runtime deadline passed
+// before their fetch or check started, they are skipped like with --keep-going
+var errMaxTotalRuntimeExceeded = errors.New("--max-total-runtime exceeded")
+
+// budgetExceeded returns errMaxTotalRuntimeExceeded once the deadline of budget passed
+func budgetExceeded(budget context.Context, opts CommitOptions) error {
+	if budget.Err() == nil {
+		return nil
+	}
+	return fmt.Errorf("%w (%v)", errMaxTotalRuntimeExceeded, opts.MaxTotalRuntime)
+}
+
+// runWithWorkdirTimeout runs fn with a deadline of timeout (0 means no deadline)
+// fn stops at its next cancellation point once the deadline passed, nothing of it runs on after the return
+// Reference: docs/validations.md#workdir-timeout
+func runWithWorkdirTimeout(timeout time.Duration, operation string, fn func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return fn(context.Background())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := fn(ctx)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w: %s didn't finish within %v (--workdir-timeout)", errWorkdirTimeout, operation, timeout)
+	}
+	return err
+}
+
+// checkWorkdirWithTimeout runs the checks of a workdir unless its fetch failed, within --workdir-timeout
+// A check not started before the --max-total-runtime deadline of budget fails with errMaxTotalRuntimeExceeded
+func checkWorkdirWithTimeout(budget context.Context, workdirPath string, fetchErr error, workdirMap WorkdirMap, commitInfo *CommitInfo, opts CommitOptions) workdirCheckResult {
+	if errors.Is(fetchErr, errFetchNeeded) {
+		workdirName, _ := FindWorkdirName(workdirPath, workdirMap)
+		return workdirCheckResult{
+			WorkdirPath: workdirPath,
+			WorkdirName: workdirName,
+			SkipReason:  fetchErr.Error(),
+		}
+	}
+	if fetchErr != nil {
+		if !errors.Is(fetchErr, errMaxTotalRuntimeExceeded) {
+			fetchErr = fmt.Errorf("failed to fetch: %w", fetchErr)
+		}
+		workdirName, _ := FindWorkdirName(workdirPath, workdirMap)
+		return workdirCheckResult{
+			WorkdirPath: workdirPath,
+			WorkdirName: workdirName,
+			Error:       fetchErr,
+		}
+	}
+	if err := budgetExceeded(budget, opts); err != nil {
+		workdirName, _ := FindWorkdirName(workdirPath, workdirMap)
+		return workdirCheckResult{
+			WorkdirPath: workdirPath,
+			WorkdirName: workdirName,
+			Error:       fmt.Errorf("check not started: %w", err),
+		}
+	}
+
+	// A timed out check keeps what it did before, e.g. the step 5 merge commit
+	var result workdirCheckResult
+	result.Error = runWithWorkdirTimeout(opts.WorkdirTimeout, "check", func(ctx context.Context) error {
+		result = checkWorkdirInParallel(ctx, workdirPath, workdirMap, commitInfo, opts)
+		return result.Error
+	})
+	return result
+}
+
+// newParallelismLimiter returns a semaphore channel allowing parallelism concurrent holders
+// A parallelism of 0 (or less) allows all n tasks to run at once
+func newParallelismLimiter(parallelism, n int) chan struct{} {
+	if parallelism <= 0 || parallelism > n {
+		parallelism = n
+	}
+	if parallelism == 0 {
+		parallelism = 1
+	}
+	return make(chan struct{}, parallelism)
+}
+
 // checkWorkdirInParallel performs steps 1-6 of UC: sync-workdir in parallel
-func checkWorkdirInParallel(workdirPath string, workdirMap WorkdirMap, commitInfo *CommitInfo) workdirCheckResult {
+// Step 4 (fetch) is done beforehand by runParallelFetches
+func checkWorkdirInParallel(ctx context.Context, workdirPath string, workdirMap WorkdirMap, commitInfo *CommitInfo, opts CommitOptions) workdirCheckResult {
 	result := workdirCheckResult{
 		WorkdirPath: workdirPath,
 	}
@@ -249,6 +789,37 @@ func checkWorkdirInParallel(workdirPath string, workdirMap WorkdirMap, commitInf
 	}
 	result.WorkdirName = workdirName
 
+	// All further operations use the symlink-resolved path, workdirPath stays the map key
+	workdirPath, err := resolveWorkdirPath(workdirPath)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	result.ResolvedPath = workdirPath
+
+	// Don't snapshot a workdir while another git operation holds its index
+	indexLocked, err := isWorkdirIndexLocked(workdirPath)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to check workdir index lock: %w", err)
+		return result
+	}
+	if indexLocked {
+		result.SkipReason = "index.lock present, another git operation may be in progress"
+		return result
+	}
+
+	if opts.OnlyIfIdle {
+		operation, err := workdirGitOperationInProgress(workdirPath)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to check git operations in progress: %w", err)
+			return result
+		}
+		if operation != "" {
+			result.SkipReason = operation
+			return result
+		}
+	}
+
 	// Step 1: Get the current branch name of workdir-path
 	currentBranchName, err := getCurrentBranchName(workdirPath)
 	if err != nil {
@@ -257,6 +828,24 @@ func checkWorkdirInParallel(workdirPath string, workdirMap WorkdirMap, commitInf
 	}
 	result.CurrentBranchName = currentBranchName
 
+	// Denylisted branches are skipped before any wmem-br branch is created for them
+	if pattern := matchBranchPattern(currentBranchName, opts.ExcludeBranches); pattern != "" {
+		result.SkipReason = fmt.Sprintf("branch %s matches the branch denylist pattern %s", currentBranchName, pattern)
+		result.Excluded = true
+		return result
+	}
+
+	if opts.RecordUpstream {
+		result.Upstream, err = readWorkdirUpstream(workdirPath, currentBranchName)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to read upstream: %w", err)
+			return result
+		}
+		if result.Upstream != nil {
+			fmt.Printf("Debug: Upstream of workdir %s: %s\n", result.WorkdirPath, result.Upstream)
+		}
+	}
+
 	// Step 2: Ensure wmem-br/<current-branch-name> branch exists in wmem-wd-repo
 	err = ensureWmemBranchExists(workdirName, currentBranchName, workdirPath)
 	if err != nil {
@@ -271,22 +860,60 @@ func checkWorkdirInParallel(workdirPath string, workdirMap WorkdirMap, commitInf
 		return result
 	}
 
-	// Step 4: Fetch latest changes from wmem-wd remote repo
-	err = fetchLatestChanges(workdirName)
+	result.OldTip, err = wmemBranchTip(workdirName, currentBranchName)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to fetch latest changes: %w", err)
+		result.Error = err
+		return result
+	}
+
+	// Don't start updating wmem-br after the --workdir-timeout deadline
+	if err := ctx.Err(); err != nil {
+		result.Error = err
 		return result
 	}
 
+	// --single-commit-per-run: a dirty workdir with a new HEAD commit gets one snapshot merging it (step 8)
+	// Reference: docs/use-cases/git-wmem-commit/basic.md#single-commit-per-run
+	if opts.SingleCommitPerRun && opts.OnConflict != "skip" {
+		deferred, err := deferWorkdirMerge(workdirPath, workdirName, result.OldTip)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to check workdir merge: %w", err)
+			return result
+		}
+		if deferred {
+			fmt.Printf("Debug: Merging workdir HEAD of %s with its snapshot commit (--single-commit-per-run)\n", workdirPath)
+			result.Kind = WorkdirCommitMerge
+			result.MergedTip = result.OldTip
+			result.HasModifiedFiles = true
+			return result
+		}
+	}
+
 	// Step 5: Ensure that wmem-wd current-branch-name commit is already merged to wmem-wd-repo's wmem-br/<current-branch-name> branch
-	_, err = ensureWorkdirCommitMerged(workdirPath, workdirName, currentBranchName, commitInfo)
+	result.Kind, err = ensureWorkdirCommitMerged(ctx, workdirPath, workdirName, currentBranchName, commitInfo, opts)
+	var skipped *mergeSkippedError
+	if errors.As(err, &skipped) {
+		result.SkipReason = skipped.Error()
+		return result
+	}
 	if err != nil {
 		result.Error = fmt.Errorf("failed to ensure workdir commit merged: %w", err)
 		return result
 	}
 
+	result.MergedTip, err = wmemBranchTip(workdirName, currentBranchName)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
 	// Step 6: Check that there are modified files in the workdir-path (Alternative 6b)
-	hasModifiedFiles, err := checkModifiedFiles(workdirPath, workdirName, currentBranchName)
+	var hasModifiedFiles bool
+	if opts.SnapshotIndex {
+		hasModifiedFiles, err = checkModifiedIndex(workdirPath, workdirName, currentBranchName)
+	} else {
+		hasModifiedFiles, err = checkModifiedFiles(ctx, workdirPath, workdirName, currentBranchName, opts)
+	}
 	if err != nil {
 		result.Error = fmt.Errorf("failed to check modified files: %w", err)
 		return result
@@ -297,10 +924,19 @@ func checkWorkdirInParallel(workdirPath string, workdirMap WorkdirMap, commitInf
 }
 
 // commitWorkdirWithChanges performs steps 7-9 of UC: sync-workdir for workdirs with changes
-func commitWorkdirWithChanges(workdirPath, workdirName, currentBranchName string, commitInfo *CommitInfo) (WorkdirCommitResult, error) {
+func commitWorkdirWithChanges(workdirPath, workdirName, currentBranchName string, commitInfo *CommitInfo, opts CommitOptions) (WorkdirCommitResult, error) {
 	// Step 7: Add all files (like git add -A) in workdir-path to the index in wmem-wd-repo
 	// Step 8: Create a new commit to wmem-br/<current-branch-name> branch
-	newCommitHash, err := addFilesAndCommit(workdirPath, workdirName, currentBranchName, commitInfo)
+	newCommitHash, err := addFilesAndCommit(workdirPath, workdirName, currentBranchName, commitInfo, opts)
+	if errors.Is(err, errIdenticalTree) {
+		fmt.Printf("Info: Snapshot of workdir %s is identical to %s, skipping duplicate commit\n", workdirPath, wmemBranchNameFor(currentBranchName))
+		return WorkdirCommitResult{
+			WorkdirName: workdirName,
+			BranchName:  currentBranchName,
+			HasChanges:  false,
+			Kind:        WorkdirCommitNone,
+		}, nil
+	}
 	if err != nil {
 		return WorkdirCommitResult{}, fmt.Errorf("failed to add files and commit: %w", err)
 	}
@@ -311,13 +947,61 @@ func commitWorkdirWithChanges(workdirPath, workdirName, currentBranchName string
 		return WorkdirCommitResult{}, fmt.Errorf("failed to update wmem-br/head: %w", err)
 	}
 
-	fmt.Printf("Info: Successfully committed changes in workdir %s to wmem-br/%s\n", workdirPath, currentBranchName)
-	return WorkdirCommitResult{
+	fmt.Printf("Info: Successfully committed changes in workdir %s to %s\n", workdirPath, wmemBranchNameFor(currentBranchName))
+	result := WorkdirCommitResult{
 		WorkdirName: workdirName,
 		BranchName:  currentBranchName,
+		NewTip:      newCommitHash.String(),
 		CommitHash:  newCommitHash.String(),
 		HasChanges:  true,
-	}, nil
+		Kind:        WorkdirCommitRegular,
+	}
+	if opts.DetectMoves {
+		result.Renames, err = detectSnapshotRenames(workdirName, newCommitHash)
+		if err != nil {
+			return WorkdirCommitResult{}, fmt.Errorf("failed to detect renames: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// detectSnapshotRenames lists the files a snapshot commit renamed as "<old> -> <new>" (--detect-moves)
+// Renames are detected like git diff -M: exact and similar content (60% similarity) count
+// Reference: docs/use-cases/git-wmem-commit/basic.md#detect-moves
+func detectSnapshotRenames(workdirName string, commitHash plumbing.Hash) ([]string, error) {
+	bareRepo, err := openBareRepo(workdirName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+	commit, err := bareRepo.CommitObject(commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot commit: %w", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot tree: %w", err)
+	}
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot parent: %w", err)
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parent tree: %w", err)
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), parentTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff trees: %w", err)
+	}
+	var renames []string
+	for _, change := range changes {
+		if change.From.Name != "" && change.To.Name != "" && change.From.Name != change.To.Name {
+			renames = append(renames, change.From.Name+" -> "+change.To.Name)
+		}
+	}
+	sort.Strings(renames)
+	return renames, nil
 }
 
 // commitWorkdir implements UC: sync-workdir
@@ -342,19 +1026,19 @@ func commitWorkdir(workdirPath, workdirName string, commitInfo *CommitInfo) (Wor
 	}
 
 	// Step 4: Fetch latest changes from wmem-wd remote repo
-	err = fetchLatestChanges(workdirName)
+	err = fetchLatestChanges(context.Background(), workdirName, CommitOptions{})
 	if err != nil {
 		return WorkdirCommitResult{}, fmt.Errorf("failed to fetch latest changes: %w", err)
 	}
 
 	// Step 5: Ensure that wmem-wd current-branch-name commit is already merged to wmem-wd-repo's wmem-br/<current-branch-name> branch
-	_, err = ensureWorkdirCommitMerged(workdirPath, workdirName, currentBranchName, commitInfo)
+	_, err = ensureWorkdirCommitMerged(context.Background(), workdirPath, workdirName, currentBranchName, commitInfo, CommitOptions{})
 	if err != nil {
 		return WorkdirCommitResult{}, fmt.Errorf("failed to ensure workdir commit merged: %w", err)
 	}
 
 	// Step 6: Check that there are modified files in the workdir-path (Alternative 6b)
-	hasModifiedFiles, err := checkModifiedFiles(workdirPath, workdirName, currentBranchName)
+	hasModifiedFiles, err := checkModifiedFiles(context.Background(), workdirPath, workdirName, currentBranchName, CommitOptions{})
 	if err != nil {
 		return WorkdirCommitResult{}, fmt.Errorf("failed to check modified files: %w", err)
 	}
@@ -366,12 +1050,13 @@ func commitWorkdir(workdirPath, workdirName string, commitInfo *CommitInfo) (Wor
 			BranchName:  currentBranchName,
 			CommitHash:  "", // No new commit created
 			HasChanges:  false,
+			Kind:        WorkdirCommitNone,
 		}, nil
 	}
 
 	// Step 7: Add all files (like git add -A) in workdir-path to the index in wmem-wd-repo
 	// Step 8: Create a new commit to wmem-br/<current-branch-name> branch
-	newCommitHash, err := addFilesAndCommit(workdirPath, workdirName, currentBranchName, commitInfo)
+	newCommitHash, err := addFilesAndCommit(workdirPath, workdirName, currentBranchName, commitInfo, CommitOptions{})
 	if err != nil {
 		return WorkdirCommitResult{}, fmt.Errorf("failed to add files and commit: %w", err)
 	}
@@ -382,86 +1067,216 @@ func commitWorkdir(workdirPath, workdirName string, commitInfo *CommitInfo) (Wor
 		return WorkdirCommitResult{}, fmt.Errorf("failed to update wmem-br/head: %w", err)
 	}
 
-	fmt.Printf("Info: Successfully committed changes in workdir %s to wmem-br/%s\n", workdirPath, currentBranchName)
+	fmt.Printf("Info: Successfully committed changes in workdir %s to %s\n", workdirPath, wmemBranchNameFor(currentBranchName))
 	return WorkdirCommitResult{
 		WorkdirName: workdirName,
 		BranchName:  currentBranchName,
 		CommitHash:  newCommitHash.String(),
 		HasChanges:  true,
+		Kind:        WorkdirCommitRegular,
 	}, nil
 }
 
 // ensureBranchNameMatches implements step 1 of UC: sync-workdir
 // Alternative 1b: Creates wmem-br/<current-branch-name> if it doesn't match pattern
 
+// beforeWmemMerge runs right before step 5b creates the merge commit, tests use it to hit a deadline there
+var beforeWmemMerge = func(ctx context.Context) {}
+
 // ensureWorkdirCommitMerged implements step 5 of UC: sync-workdir (Alternative 5b)
-func ensureWorkdirCommitMerged(workdirPath, workdirName, currentBranchName string, commitInfo *CommitInfo) (bool, error) {
+// Returns WorkdirCommitNone if the workdir HEAD commit was already merged, otherwise
+// WorkdirCommitMerge or WorkdirCommitFastForward (--post-merge-ff)
+// wmem-br/<current-branch-name> isn't moved once ctx is done (--workdir-timeout)
+func ensureWorkdirCommitMerged(ctx context.Context, workdirPath, workdirName, currentBranchName string, commitInfo *CommitInfo, opts CommitOptions) (WorkdirCommitKind, error) {
 	absWorkdirPath, err := filepath.Abs(workdirPath)
 	if err != nil {
-		return false, fmt.Errorf("failed to get absolute workdir path: %w", err)
+		return WorkdirCommitNone, fmt.Errorf("failed to get absolute workdir path: %w", err)
 	}
 
 	workdirRepo, err := git.PlainOpen(absWorkdirPath)
 	if err != nil {
-		return false, fmt.Errorf("failed to open workdir repository: %w", err)
+		return WorkdirCommitNone, fmt.Errorf("failed to open workdir repository: %w", err)
 	}
 
 	head, err := workdirRepo.Head()
 	if err != nil {
-		return false, fmt.Errorf("failed to get workdir HEAD: %w", err)
+		return WorkdirCommitNone, fmt.Errorf("failed to get workdir HEAD: %w", err)
 	}
 
-	repoPath := filepath.Join("repos", workdirName+".git")
-	bareRepo, err := git.PlainOpen(repoPath)
+	bareRepo, err := openBareRepo(workdirName)
 	if err != nil {
-		return false, fmt.Errorf("failed to open bare repository: %w", err)
+		return WorkdirCommitNone, fmt.Errorf("failed to open bare repository: %w", err)
 	}
 
-	wmemBranchName := fmt.Sprintf("wmem-br/%s", currentBranchName)
+	wmemBranchName := wmemBranchNameFor(currentBranchName)
 	wmemBranchRef := plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", wmemBranchName))
 
 	wmemBranchHashRef, err := bareRepo.Reference(wmemBranchRef, true)
 	if err != nil {
-		return false, fmt.Errorf("failed to get wmem branch reference: %w", err)
+		return WorkdirCommitNone, fmt.Errorf("failed to get wmem branch reference: %w", err)
 	}
 
 	// Check if workdir HEAD commit is already merged
 	isAlreadyMerged, err := isCommitMerged(bareRepo, head.Hash(), wmemBranchHashRef.Hash())
 	if err != nil {
-		return false, fmt.Errorf("failed to check if commit is merged: %w", err)
+		return WorkdirCommitNone, fmt.Errorf("failed to check if commit is merged: %w", err)
 	}
 
-	if !isAlreadyMerged {
-		// Alternative 5b: Create merge commit following ALG: wmem merge
-		authorSig, committerSig, err := parseCommitSignatures(commitInfo)
-		if err != nil {
-			return false, fmt.Errorf("failed to parse commit signatures: %w", err)
-		}
+	if isAlreadyMerged {
+		return WorkdirCommitNone, nil
+	}
 
-		newCommitHash, err := createWmemMergeCommit(bareRepo, wmemBranchHashRef.Hash(), head.Hash(), currentBranchName, commitInfo, authorSig, committerSig)
+	if opts.PostMergeFF {
+		canFastForward, err := canFastForwardWmemBranch(bareRepo, wmemBranchHashRef.Hash(), head.Hash(), workdirPath)
 		if err != nil {
-			return false, fmt.Errorf("failed to create merge commit: %w", err)
+			return WorkdirCommitNone, fmt.Errorf("failed to check fast-forward: %w", err)
 		}
-
-		// Update wmem-br/<current-branch-name> to point to new merge commit
-		newWmemBranchRef := plumbing.NewHashReference(wmemBranchRef, newCommitHash)
-		err = bareRepo.Storer.SetReference(newWmemBranchRef)
-		if err != nil {
-			return false, fmt.Errorf("failed to update wmem branch: %w", err)
+		if canFastForward {
+			if err := ctx.Err(); err != nil {
+				return WorkdirCommitNone, err
+			}
+			if err := setWmemBranchTips(bareRepo, wmemBranchRef, head.Hash()); err != nil {
+				return WorkdirCommitNone, err
+			}
+			fmt.Printf("Info: Fast-forwarded %s to workdir HEAD %s for workdir %s\n", wmemBranchName, abbrevHash(head.Hash().String()), workdirPath)
+			return WorkdirCommitFastForward, nil
 		}
+	}
+
+	// --on-conflict=skip: leave wmem-br/<current-branch-name> behind the workdir HEAD
+	// Reference: docs/use-cases/git-wmem-commit/basic.md#on-conflict
+	if opts.OnConflict == "skip" {
+		return WorkdirCommitNone, &mergeSkippedError{head: head.Hash(), branch: wmemBranchName}
+	}
+
+	// Alternative 5b: Create merge commit following ALG: wmem merge
+	// The source of a merge is the merged workdir commit
+	workdirCommit, err := bareRepo.CommitObject(head.Hash())
+	if err != nil {
+		return WorkdirCommitNone, fmt.Errorf("failed to get workdir commit: %w", err)
+	}
+	authorSig, committerSig, err := parseCommitSignatures(commitInfo, workdirCommit.Author.When, workdirCommit.Committer.When, opts)
+	if err != nil {
+		return WorkdirCommitNone, fmt.Errorf("failed to parse commit signatures: %w", err)
+	}
+
+	// --keep-commit-timestamps: the merge carries the times of the merged workdir commit
+	if opts.KeepCommitTimestamps {
+		authorSig.When = workdirCommit.Author.When
+		committerSig.When = workdirCommit.Committer.When
+	}
+	// --author-from-workdir-head-always: the merged workdir commit is the workdir HEAD
+	if opts.AuthorFromWorkdirHead {
+		authorSig.Name, authorSig.Email = workdirCommit.Author.Name, workdirCommit.Author.Email
+	}
+
+	beforeWmemMerge(ctx)
+	if err := ctx.Err(); err != nil {
+		return WorkdirCommitNone, err
+	}
+	newCommitHash, err := createWmemMergeCommit(bareRepo, wmemBranchHashRef.Hash(), head.Hash(), currentBranchName, commitInfo, authorSig, committerSig)
+	if err != nil {
+		return WorkdirCommitNone, fmt.Errorf("failed to create merge commit: %w", err)
+	}
+
+	// Update wmem-br/<current-branch-name> and wmem-br/head to point to new merge commit
+	// A merge commit left by the deadline is unreferenced, git gc drops it
+	if err := ctx.Err(); err != nil {
+		return WorkdirCommitNone, err
+	}
+	if err := setWmemBranchTips(bareRepo, wmemBranchRef, newCommitHash); err != nil {
+		return WorkdirCommitNone, err
+	}
+
+	fmt.Printf("Info: Created merge commit for workdir %s into %s\n", workdirPath, wmemBranchName)
+
+	return WorkdirCommitMerge, nil
+}
+
+// mergeSkippedError reports a workdir HEAD left unmerged by --on-conflict=skip
+type mergeSkippedError struct {
+	head   plumbing.Hash
+	branch string
+}
+
+func (e *mergeSkippedError) Error() string {
+	return fmt.Sprintf("workdir HEAD %s isn't merged into %s (--on-conflict=skip)", abbrevHash(e.head.String()), e.branch)
+}
+
+// deferWorkdirMerge tells whether step 5 is left to the snapshot commit (--single-commit-per-run):
+// the workdir HEAD isn't merged into the wmem-br tip yet and the workdir has uncommitted changes
+func deferWorkdirMerge(workdirPath, workdirName string, wmemTip plumbing.Hash) (bool, error) {
+	bareRepo, err := openBareRepo(workdirName)
+	if err != nil {
+		return false, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+	head, err := unmergedWorkdirHead(bareRepo, workdirPath, wmemTip)
+	if err != nil || head.IsZero() {
+		return false, err
+	}
+	return hasWorkingDirectoryChanges(workdirPath)
+}
+
+// unmergedWorkdirHead returns the workdir HEAD commit when it is in the wmem-wd-repo but not merged
+// into wmemTip yet, the zero hash otherwise
+func unmergedWorkdirHead(bareRepo *git.Repository, workdirPath string, wmemTip plumbing.Hash) (plumbing.Hash, error) {
+	workdirRepo, err := git.PlainOpen(workdirPath)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+	head, err := workdirRepo.Head()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to get workdir HEAD: %w", err)
+	}
+	if _, err := bareRepo.CommitObject(head.Hash()); err != nil {
+		// Not fetched (e.g. committed after step 4), the next run merges it
+		return plumbing.ZeroHash, nil
+	}
+	merged, err := isCommitMerged(bareRepo, head.Hash(), wmemTip)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to check if commit is merged: %w", err)
+	}
+	if merged {
+		return plumbing.ZeroHash, nil
+	}
+	return head.Hash(), nil
+}
 
-		// Update wmem-br/head to point to new merge commit
-		wmemHeadRef := plumbing.ReferenceName("refs/heads/wmem-br/head")
-		newWmemHeadRef := plumbing.NewHashReference(wmemHeadRef, newCommitHash)
-		err = bareRepo.Storer.SetReference(newWmemHeadRef)
-		if err != nil {
-			return false, fmt.Errorf("failed to update wmem-br/head: %w", err)
-		}
+// canFastForwardWmemBranch checks for --post-merge-ff that wmem-br/<current-branch-name> can simply move to the workdir HEAD:
+// the tip is an ancestor of HEAD and the workdir has no uncommitted changes
+func canFastForwardWmemBranch(bareRepo *git.Repository, wmemTip, workdirHead plumbing.Hash, workdirPath string) (bool, error) {
+	tipCommit, err := bareRepo.CommitObject(wmemTip)
+	if err != nil {
+		return false, fmt.Errorf("failed to get wmem branch commit: %w", err)
+	}
+	headCommit, err := bareRepo.CommitObject(workdirHead)
+	if err != nil {
+		return false, fmt.Errorf("failed to get workdir commit: %w", err)
+	}
+	isAncestor, err := tipCommit.IsAncestor(headCommit)
+	if err != nil {
+		return false, fmt.Errorf("failed to check ancestry: %w", err)
+	}
+	if !isAncestor {
+		return false, nil
+	}
 
-		fmt.Printf("Info: Created merge commit for workdir %s into wmem-br/%s\n", workdirPath, currentBranchName)
+	hasChanges, err := hasWorkingDirectoryChanges(workdirPath)
+	if err != nil {
+		return false, err
 	}
+	return !hasChanges, nil
+}
 
-	return isAlreadyMerged, nil
+// setWmemBranchTips points wmem-br/<current-branch-name> and wmem-br/head at commitHash
+func setWmemBranchTips(bareRepo *git.Repository, wmemBranchRef plumbing.ReferenceName, commitHash plumbing.Hash) error {
+	if err := bareRepo.Storer.SetReference(plumbing.NewHashReference(wmemBranchRef, commitHash)); err != nil {
+		return fmt.Errorf("failed to update wmem branch: %w", err)
+	}
+	if err := bareRepo.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName("refs/heads/wmem-br/head"), commitHash)); err != nil {
+		return fmt.Errorf("failed to update wmem-br/head: %w", err)
+	}
+	return nil
 }
 
 // getTouchedFilesSinceMerge gets all files that have been touched since the last merge
@@ -523,7 +1338,7 @@ func getTouchedFilesSinceMerge(workdirPath string, lastMergeHash plumbing.Hash)
 
 // createTreeFromCurrentState creates a git tree from the current workdir state
 // Optimized replacement for filesystem-based tree creation
-func createTreeFromCurrentState(workdirPath string, targetRepo *git.Repository) (plumbing.Hash, error) {
+func createTreeFromCurrentState(ctx context.Context, workdirPath string, targetRepo *git.Repository, opts CommitOptions) (plumbing.Hash, error) {
 	// Handle nested git repos correctly maintaining gitlink support
 	// Use the filesystem-based approach to maintain gitlink handling
 	absWorkdirPath, err := filepath.Abs(workdirPath)
@@ -531,8 +1346,20 @@ func createTreeFromCurrentState(workdirPath string, targetRepo *git.Repository)
 		return plumbing.ZeroHash, fmt.Errorf("failed to get absolute workdir path: %w", err)
 	}
 
+	walk, err := newTreeWalkOptions(opts, absWorkdirPath)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := walk.dedupeBlobs(opts); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
 	// Use the createTreeFromFilesystem which handles gitlinks correctly
-	return createTreeFromFilesystem(targetRepo, absWorkdirPath)
+	treeHash, err := createTreeFromFilesystem(ctx, targetRepo, absWorkdirPath, &fileCountLimit{max: opts.MaxFileCount}, walk)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return applySparseCheckout(absWorkdirPath, targetRepo, treeHash, opts)
 }
 
 // findLastMergeCommit finds the most recent merge commit in the branch history
@@ -585,6 +1412,48 @@ func hasWorkingDirectoryChanges(workdirPath string) (bool, error) {
 	return !status.IsClean(), nil
 }
 
+// isCleanAtWmemBase checks for --shallow-tree-compare that the workdir status is clean
+// and its HEAD tree is the wmem-br/<current-branch-name> tip tree, so a snapshot would be identical
+// Reference: docs/use-cases/git-wmem-commit/basic.md#shallow-tree-compare
+func isCleanAtWmemBase(workdirPath, workdirName, currentBranchName string) (bool, error) {
+	workdirRepo, err := git.PlainOpen(workdirPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+
+	headRef, err := workdirRepo.Head()
+	if err != nil {
+		return false, fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	headCommit, err := workdirRepo.CommitObject(headRef.Hash())
+	if err != nil {
+		return false, fmt.Errorf("failed to get HEAD commit: %w", err)
+	}
+
+	tip, err := wmemBranchTip(workdirName, currentBranchName)
+	if err != nil {
+		return false, err
+	}
+	bareRepo, err := openBareRepo(workdirName)
+	if err != nil {
+		return false, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+	wmemCommit, err := bareRepo.CommitObject(tip)
+	if err != nil {
+		return false, fmt.Errorf("failed to get wmem commit: %w", err)
+	}
+	if wmemCommit.TreeHash != headCommit.TreeHash {
+		return false, nil
+	}
+
+	// Status is only needed when HEAD matches, it's the expensive part
+	hasChanges, err := hasWorkingDirectoryChanges(workdirPath)
+	if err != nil {
+		return false, err
+	}
+	return !hasChanges, nil
+}
+
 // isHeadUnchangedSinceLastWmemCommit checks if the current HEAD of workdir
 // is the same as what was last processed in the wmem branch
 func isHeadUnchangedSinceLastWmemCommit(workdirPath, workdirName, currentBranchName string) (bool, error) {
@@ -601,13 +1470,12 @@ func isHeadUnchangedSinceLastWmemCommit(workdirPath, workdirName, currentBranchN
 	currentHead := headRef.Hash()
 
 	// Get the last commit in wmem-br/<current-branch-name>
-	repoPath := filepath.Join("repos", workdirName+".git")
-	bareRepo, err := git.PlainOpen(repoPath)
+	bareRepo, err := openBareRepo(workdirName)
 	if err != nil {
 		return false, fmt.Errorf("failed to open bare repository: %w", err)
 	}
 
-	wmemBranchName := fmt.Sprintf("wmem-br/%s", currentBranchName)
+	wmemBranchName := wmemBranchNameFor(currentBranchName)
 	wmemBranchRef := plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", wmemBranchName))
 
 	wmemBranchHashRef, err := bareRepo.Reference(wmemBranchRef, true)
@@ -643,28 +1511,73 @@ func isHeadUnchangedSinceLastWmemCommit(workdirPath, workdirName, currentBranchN
 // checkModifiedFiles implements step 6 of UC: sync-workdir
 // Compares the current filesystem state in workdir with wmem-repo's wmem-br/<current-branch-name> branch
 // Uses multi-level optimization strategy - see docs/optimizations.md#multi-level-architecture
-func checkModifiedFiles(workdirPath, workdirName, currentBranchName string) (bool, error) {
+func checkModifiedFiles(ctx context.Context, workdirPath, workdirName, currentBranchName string, opts CommitOptions) (bool, error) {
 	fmt.Printf("Debug: checkModifiedFiles called for workdir %s\n", workdirPath)
 
-	// Timestamp-based early exit optimization - see docs/optimizations.md#timestamp-check
-	startTimestamp := time.Now()
-	hasRecentChanges, err := hasFilesNewerThanLastWmemCommit(workdirPath, workdirName, currentBranchName)
-	if err == nil && !hasRecentChanges {
-		fmt.Printf("Debug: No files newer than last wmem commit - ultra-fast early exit for %s (took %v)\n", workdirPath, time.Since(startTimestamp))
-		return false, nil // Early exit: No files modified since last commit
+	if opts.ShallowTreeCompare {
+		cleanAtBase, err := isCleanAtWmemBase(workdirPath, workdirName, currentBranchName)
+		if err != nil {
+			fmt.Printf("Debug: Shallow tree compare failed, proceeding with full check: %v\n", err)
+		} else if cleanAtBase {
+			fmt.Printf("Debug: Shallow tree compare: clean worktree at %s tree - no changes for %s\n", wmemBranchNameFor(currentBranchName), workdirPath)
+			return false, nil
+		} else {
+			fmt.Printf("Debug: Shallow tree compare: worktree dirty or HEAD moved, proceeding with full check for %s\n", workdirPath)
+		}
 	}
-	if err != nil {
-		fmt.Printf("Debug: Timestamp check failed, falling back to git status check: %v\n", err)
+
+	if len(opts.PathFilters) > 0 {
+		// Changes outside the filter don't count, so only a full comparison of the filtered tree can tell
+		return filteredTreeDiffers(ctx, workdirPath, workdirName, currentBranchName, opts)
 	}
-	fmt.Printf("Debug: Timestamp check took %v for %s\n", time.Since(startTimestamp), workdirPath)
 
-	// Quick check for working directory changes
-	hasCurrentChanges, err := hasWorkingDirectoryChanges(workdirPath)
-	if err != nil {
-		return false, fmt.Errorf("failed to check working directory changes: %w", err)
+	// fsmonitor or index-based detection replaces the timestamp and status checks when it can answer
+	detected := false
+	hasCurrentChanges := false
+	if opts.FSMonitor {
+		changed, err := detectChangesFromFSMonitor(workdirPath, workdirName, currentBranchName)
+		if err != nil {
+			fmt.Printf("Debug: fsmonitor unavailable, falling back to timestamp and status checks for %s: %v\n", workdirPath, err)
+		} else {
+			detected = true
+			hasCurrentChanges = changed
+			fmt.Printf("Debug: fsmonitor detection: changed=%v for %s\n", changed, workdirPath)
+		}
+	}
+	if !detected && opts.IndexOnlyDetection {
+		changed, stale, err := detectChangesFromIndex(workdirPath)
+		if err != nil {
+			fmt.Printf("Debug: Index detection failed, falling back to timestamp and status checks: %v\n", err)
+		} else if stale {
+			fmt.Printf("Debug: Index detection: stale index, falling back to timestamp and status checks for %s\n", workdirPath)
+		} else {
+			detected = true
+			hasCurrentChanges = changed
+			fmt.Printf("Debug: Index detection: changed=%v for %s\n", changed, workdirPath)
+		}
 	}
 
-	fmt.Printf("Debug: hasWorkingDirectoryChanges=%v for %s\n", hasCurrentChanges, workdirPath)
+	if !detected {
+		// Timestamp-based early exit optimization - see docs/optimizations.md#timestamp-check
+		startTimestamp := time.Now()
+		hasRecentChanges, err := hasFilesNewerThanLastWmemCommit(workdirPath, workdirName, currentBranchName)
+		if err == nil && !hasRecentChanges {
+			fmt.Printf("Debug: No files newer than last wmem commit - ultra-fast early exit for %s (took %v)\n", workdirPath, time.Since(startTimestamp))
+			return false, nil // Early exit: No files modified since last commit
+		}
+		if err != nil {
+			fmt.Printf("Debug: Timestamp check failed, falling back to git status check: %v\n", err)
+		}
+		fmt.Printf("Debug: Timestamp check took %v for %s\n", time.Since(startTimestamp), workdirPath)
+
+		// Quick check for working directory changes
+		hasCurrentChanges, err = hasWorkingDirectoryChanges(workdirPath)
+		if err != nil {
+			return false, fmt.Errorf("failed to check working directory changes: %w", err)
+		}
+
+		fmt.Printf("Debug: hasWorkingDirectoryChanges=%v for %s\n", hasCurrentChanges, workdirPath)
+	}
 
 	// Early exit if no working directory changes and no new commits
 	if !hasCurrentChanges {
@@ -692,14 +1605,13 @@ func checkModifiedFiles(workdirPath, workdirName, currentBranchName string) (boo
 	}
 
 	// Open wmem-repo's bare repository
-	repoPath := filepath.Join("repos", workdirName+".git")
-	bareRepo, err := git.PlainOpen(repoPath)
+	bareRepo, err := openBareRepo(workdirName)
 	if err != nil {
 		return false, fmt.Errorf("failed to open bare repository: %w", err)
 	}
 
 	// Get wmem-br/<current-branch-name> branch
-	wmemBranchName := fmt.Sprintf("wmem-br/%s", currentBranchName)
+	wmemBranchName := wmemBranchNameFor(currentBranchName)
 	wmemBranchRef := plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", wmemBranchName))
 
 	wmemBranchHashRef, err := bareRepo.Reference(wmemBranchRef, true)
@@ -725,13 +1637,25 @@ func checkModifiedFiles(workdirPath, workdirName, currentBranchName string) (boo
 		return false, fmt.Errorf("failed to get HEAD: %w", err)
 	}
 
+	walk, err := newTreeWalkOptions(opts, absWorkdirPath)
+	if err != nil {
+		return false, err
+	}
+	if err := walk.dedupeBlobs(opts); err != nil {
+		return false, err
+	}
+
 	lastMergeHash, err := findLastMergeCommit(workdirRepo, headRef.Hash())
 	if err != nil {
 		// If no merge commit found, use full tree creation
-		currentTreeHash, err := createTreeFromFilesystem(bareRepo, absWorkdirPath)
+		currentTreeHash, err := createTreeFromFilesystem(ctx, bareRepo, absWorkdirPath, &fileCountLimit{max: opts.MaxFileCount}, walk)
 		if err != nil {
 			return false, fmt.Errorf("failed to create tree from filesystem: %w", err)
 		}
+		currentTreeHash, err = applySparseCheckout(absWorkdirPath, bareRepo, currentTreeHash, opts)
+		if err != nil {
+			return false, err
+		}
 		return currentTreeHash != wmemCommit.TreeHash, nil
 	}
 
@@ -739,7 +1663,7 @@ func checkModifiedFiles(workdirPath, workdirName, currentBranchName string) (boo
 	headSHA1 := headRef.Hash().String()
 	lastMergeSHA1 := lastMergeHash.String()
 
-	fmt.Printf("Debug: Getting touched files for %s (HEAD: %s, LastMerge: %s)\n", workdirPath, headSHA1[:8], lastMergeSHA1[:8])
+	fmt.Printf("Debug: Getting touched files for %s (HEAD: %s, LastMerge: %s)\n", workdirPath, abbrevHash(headSHA1), abbrevHash(lastMergeSHA1))
 	startTouched := time.Now()
 
 	// Try to get touched files from cache first
@@ -776,7 +1700,7 @@ func checkModifiedFiles(workdirPath, workdirName, currentBranchName string) (boo
 	} else {
 		// Cache miss - compute tree hash and cache the result
 		fmt.Printf("Debug: CACHE MISS for tree hash - computing...\n")
-		currentTreeHash, err = createTreeFromTouchedFiles(bareRepo, absWorkdirPath, touchedFiles, wmemCommit.TreeHash)
+		currentTreeHash, err = createTreeFromTouchedFiles(ctx, bareRepo, absWorkdirPath, touchedFiles, wmemCommit.TreeHash, walk)
 		if err != nil {
 			return false, fmt.Errorf("failed to create tree from touched files: %w", err)
 		}
@@ -803,14 +1727,13 @@ func isBrokenSymlink(path string) bool {
 }
 
 // addFilesAndCommit implements steps 7-8 of UC: sync-workdir
-func addFilesAndCommit(workdirPath, workdirName, currentBranchName string, commitInfo *CommitInfo) (plumbing.Hash, error) {
-	repoPath := filepath.Join("repos", workdirName+".git")
-	bareRepo, err := git.PlainOpen(repoPath)
+func addFilesAndCommit(workdirPath, workdirName, currentBranchName string, commitInfo *CommitInfo, opts CommitOptions) (plumbing.Hash, error) {
+	bareRepo, err := openBareRepo(workdirName)
 	if err != nil {
 		return plumbing.ZeroHash, fmt.Errorf("failed to open bare repository: %w", err)
 	}
 
-	wmemBranchName := fmt.Sprintf("wmem-br/%s", currentBranchName)
+	wmemBranchName := wmemBranchNameFor(currentBranchName)
 	wmemBranchRef := plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", wmemBranchName))
 
 	wmemBranchHashRef, err := bareRepo.Reference(wmemBranchRef, true)
@@ -818,14 +1741,8 @@ func addFilesAndCommit(workdirPath, workdirName, currentBranchName string, commi
 		return plumbing.ZeroHash, fmt.Errorf("failed to get wmem branch reference: %w", err)
 	}
 
-	// Parse commit signatures
-	authorSig, committerSig, err := parseCommitSignatures(commitInfo)
-	if err != nil {
-		return plumbing.ZeroHash, fmt.Errorf("failed to parse commit signatures: %w", err)
-	}
-
 	// Create regular commit with all changes from workdir
-	newCommitHash, err := createRegularCommit(bareRepo, wmemBranchHashRef.Hash(), commitInfo, authorSig, committerSig, workdirPath)
+	newCommitHash, err := createRegularCommit(bareRepo, wmemBranchHashRef.Hash(), currentBranchName, commitInfo, workdirPath, opts)
 	if err != nil {
 		return plumbing.ZeroHash, fmt.Errorf("failed to create regular commit: %w", err)
 	}
@@ -837,13 +1754,18 @@ func addFilesAndCommit(workdirPath, workdirName, currentBranchName string, commi
 		return plumbing.ZeroHash, fmt.Errorf("failed to update wmem branch: %w", err)
 	}
 
+	if opts.DedupeBlobsAcrossWorkdirs {
+		if err := keepSharedBlobsReachable(bareRepo, workdirName, wmemBranchName, newCommitHash); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to keep shared blobs reachable: %w", err)
+		}
+	}
+
 	return newCommitHash, nil
 }
 
 // updateWmemHeadBranch implements step 9 of UC: sync-workdir
 func updateWmemHeadBranch(workdirName string, newCommitHash plumbing.Hash) error {
-	repoPath := filepath.Join("repos", workdirName+".git")
-	bareRepo, err := git.PlainOpen(repoPath)
+	bareRepo, err := openBareRepo(workdirName)
 	if err != nil {
 		return fmt.Errorf("failed to open bare repository: %w", err)
 	}
@@ -859,6 +1781,7 @@ func updateWmemHeadBranch(workdirName string, newCommitHash plumbing.Hash) error
 }
 
 // isCommitMerged checks if a commit is already merged into a target branch
+// Unrelated histories (e.g. an orphan branch) share no ancestor and are reported as not merged
 func isCommitMerged(repo *git.Repository, commitHash, targetHash plumbing.Hash) (bool, error) {
 	// If the commit hashes are the same, it's already merged
 	if commitHash == targetHash {
@@ -878,6 +1801,7 @@ func isCommitMerged(repo *git.Repository, commitHash, targetHash plumbing.Hash)
 	}
 
 	// Check if commitToCheck is an ancestor of targetCommit (i.e., commitHash is reachable from targetHash)
+	// The walk ends at the root commits of targetHash, so an unrelated commit is simply not found
 	isAncestor, err := commitToCheck.IsAncestor(targetCommit)
 	if err != nil {
 		return false, fmt.Errorf("failed to check ancestry: %w", err)
@@ -887,7 +1811,9 @@ func isCommitMerged(repo *git.Repository, commitHash, targetHash plumbing.Hash)
 }
 
 // parseCommitSignatures parses author and committer signatures from commit info
-func parseCommitSignatures(commitInfo *CommitInfo) (*object.Signature, *object.Signature, error) {
+// Both dates are the time of the run unless --author-date-now=false or --committer-date-now=false
+// select the given source times (zero source times keep the time of the run)
+func parseCommitSignatures(commitInfo *CommitInfo, authorSource, committerSource time.Time, opts CommitOptions) (*object.Signature, *object.Signature, error) {
 	authorSig, err := parseSignature(commitInfo.Author)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to parse author: %w", err)
@@ -898,24 +1824,144 @@ func parseCommitSignatures(commitInfo *CommitInfo) (*object.Signature, *object.S
 		return nil, nil, fmt.Errorf("failed to parse committer: %w", err)
 	}
 
+	if opts.AuthorDateFromSource && !authorSource.IsZero() {
+		authorSig.When = authorSource
+	}
+	if opts.CommitterDateFromSource && !committerSource.IsZero() {
+		committerSig.When = committerSource
+	}
+
+	if opts.AuthorEmailDomainCheck {
+		if err := checkSignatureDomains(authorSig, committerSig); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	return authorSig, committerSig, nil
 }
 
+// setAuthorFromWorkdirHead takes the author name and email of a snapshot from the workdir HEAD commit,
+// the closest real authorship of uncommitted changes (--author-from-workdir-head-always)
+// The date is kept, a workdir without commits keeps md/commit/author
+// Reference: docs/use-cases/git-wmem-commit/basic.md#author-from-workdir-head
+func setAuthorFromWorkdirHead(author *object.Signature, workdirPath string) error {
+	workdirRepo, err := git.PlainOpen(workdirPath)
+	if err != nil {
+		return fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+	head, err := workdirRepo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get workdir HEAD: %w", err)
+	}
+	headCommit, err := workdirRepo.CommitObject(head.Hash())
+	if err != nil {
+		return fmt.Errorf("failed to get workdir HEAD commit: %w", err)
+	}
+	author.Name, author.Email = headCommit.Author.Name, headCommit.Author.Email
+	return nil
+}
+
+// newestChangeTime returns the newest mtime of workdir files added or modified between two snapshot trees
+// Returns the zero time if only deletions changed
+func newestChangeTime(repo *git.Repository, oldTreeHash, newTreeHash plumbing.Hash, workdirPath string) (time.Time, error) {
+	oldTree, err := repo.TreeObject(oldTreeHash)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get tree %s: %w", oldTreeHash, err)
+	}
+	newTree, err := repo.TreeObject(newTreeHash)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get tree %s: %w", newTreeHash, err)
+	}
+	changes, err := object.DiffTree(oldTree, newTree)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to diff trees: %w", err)
+	}
+
+	var newest time.Time
+	for _, change := range changes {
+		if change.To.Name == "" {
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(workdirPath, filepath.FromSlash(change.To.Name)))
+		if err != nil {
+			// e.g. the placeholder file of an empty directory
+			continue
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest, nil
+}
+
 // createRegularCommit creates a regular commit when HEAD is already merged and there are uncommitted changes
 // This implements steps 7-8 of UC: sync-workdir with READ-ONLY access to workdir
 // Uses optimized tree creation from current repository state
-func createRegularCommit(repo *git.Repository, wmemBranchHash plumbing.Hash, commitInfo *CommitInfo, author, committer *object.Signature, workdirPath string) (plumbing.Hash, error) {
-	// Build tree directly from current state (READ-ONLY approach)
-	rootTreeHash, err := createTreeFromCurrentState(workdirPath, repo)
+// With opts.SnapshotIndex the tree is built from the workdir index (staged state) instead
+func createRegularCommit(repo *git.Repository, wmemBranchHash plumbing.Hash, currentBranchName string, commitInfo *CommitInfo, workdirPath string, opts CommitOptions) (plumbing.Hash, error) {
+	var rootTreeHash plumbing.Hash
+	var err error
+	message := commitInfo.Message + workdirBranchNote(currentBranchName)
+	if opts.SnapshotIndex {
+		rootTreeHash, err = createTreeFromIndex(workdirPath, repo)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to create tree from workdir index: %w", err)
+		}
+		message += "\n\nSnapshot of workdir index (staged changes only)"
+	} else {
+		// Build tree directly from current state (READ-ONLY approach)
+		rootTreeHash, err = createTreeFromCurrentState(context.Background(), workdirPath, repo, opts)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to create tree from current state: %w", err)
+		}
+	}
+
+	parentCommit, err := repo.CommitObject(wmemBranchHash)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to get wmem branch commit: %w", err)
+	}
+	parents := []plumbing.Hash{wmemBranchHash} // wmem-br branch as parent
+	if opts.SingleCommitPerRun {
+		// Step 5 was left to this commit, the workdir HEAD becomes the second parent like in ALG: wmem merge
+		workdirHead, err := unmergedWorkdirHead(repo, workdirPath, wmemBranchHash)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if !workdirHead.IsZero() {
+			parents = append(parents, workdirHead)
+			message += fmt.Sprintf("\n\nMerges workdir commit %s (--single-commit-per-run)", workdirHead)
+		}
+	}
+	if opts.DedupeIdenticalTrees && parentCommit.TreeHash == rootTreeHash && len(parents) == 1 {
+		return plumbing.ZeroHash, errIdenticalTree
+	}
+
+	// The source of a snapshot is the newest change in the workdir (--author-date-now=false)
+	var sourceTime time.Time
+	if opts.AuthorDateFromSource || opts.CommitterDateFromSource {
+		sourceTime, err = newestChangeTime(repo, parentCommit.TreeHash, rootTreeHash, workdirPath)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+	author, committer, err := parseCommitSignatures(commitInfo, sourceTime, sourceTime, opts)
 	if err != nil {
-		return plumbing.ZeroHash, fmt.Errorf("failed to create tree from current state: %w", err)
+		return plumbing.ZeroHash, fmt.Errorf("failed to parse commit signatures: %w", err)
+	}
+	if opts.AuthorFromWorkdirHead {
+		if err := setAuthorFromWorkdirHead(author, workdirPath); err != nil {
+			return plumbing.ZeroHash, err
+		}
 	}
 
 	// Step 8: Create new commit to wmem-br/<current-branch-name> branch based on commit-info
 	commit := &object.Commit{
-		Message:      commitInfo.Message,
-		TreeHash:     rootTreeHash,                    // Tree built from filesystem
-		ParentHashes: []plumbing.Hash{wmemBranchHash}, // wmem-br branch as parent
+		Message:      message,
+		TreeHash:     rootTreeHash, // Tree built from filesystem
+		ParentHashes: parents,
 		Author:       *author,
 		Committer:    *committer,
 	}
@@ -931,6 +1977,12 @@ func createRegularCommit(repo *git.Repository, wmemBranchHash plumbing.Hash, com
 		return plumbing.ZeroHash, fmt.Errorf("failed to store commit: %w", err)
 	}
 
+	if opts.PreserveMtimeMetadata && !opts.SnapshotIndex {
+		if err := recordMtimeNote(repo, commitHash, rootTreeHash, workdirPath, committer); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to record file mtimes: %w", err)
+		}
+	}
+
 	return commitHash, nil
 }
 
@@ -946,8 +1998,8 @@ func createWmemMergeCommit(repo *git.Repository, wmemBranchHash, workdirCommitHa
 	}
 
 	// Create merge commit message that explains the merge strategy
-	mergeMessage := fmt.Sprintf("Merge workdir '%s' into 'wmem-br/%s' accepting workdir's branch tree hash\n\n%s",
-		currentBranchName, currentBranchName, commitInfo.Message)
+	mergeMessage := fmt.Sprintf("Merge workdir '%s' into '%s' accepting workdir's branch tree hash\n\n%s",
+		currentBranchName, wmemBranchNameFor(currentBranchName), commitInfo.Message)
 
 	// Create merge commit object with workdir's tree and both parents
 	// Parent order: wmem-br parent first (main line), then workdir parent (merged branch)
@@ -989,6 +2041,8 @@ func createWmemCommit(commitInfo *CommitInfo, workdirResults []WorkdirCommitResu
 	if err != nil {
 		return fmt.Errorf("failed to get worktree: %w", err)
 	}
+	// Skip the persisted caches also in wmem-repos whose .gitignore predates the cache/ default
+	worktree.Excludes = append(worktree.Excludes, gitignore.ParsePattern(cacheDirName+"/", nil))
 
 	// Add all files (metadata might have changed)
 	// Explicitly add metadata directories to ensure they're tracked
@@ -1064,18 +2118,38 @@ func generateWmemRepoCommitMessage(commitInfo *CommitInfo, workdirResults []Work
 
 	// Add wmem-repo specific msg-body
 	message += "\n\nMeta wmem-commit of workdir commits"
-	hasAnyWorkdirChanges := false
+	if commitInfo.Batch != "" {
+		message += fmt.Sprintf(" (batch %s)", commitInfo.Batch)
+	}
+	var lines []string
+	var branches []string
+	branchLines := make(map[string][]string)
 	for _, result := range workdirResults {
-		if result.HasChanges {
-			// Truncate commit hash to 12 characters for readability
-			shortHash := result.CommitHash
-			if len(shortHash) > 12 {
-				shortHash = shortHash[:12]
+		resultLines := workdirResultLines(result)
+		if len(resultLines) == 0 {
+			// Skip workdirs with no changes - they won't appear in the commit message
+			continue
+		}
+		lines = append(lines, resultLines...)
+		if _, seen := branchLines[result.BranchName]; !seen {
+			branches = append(branches, result.BranchName)
+		}
+		branchLines[result.BranchName] = append(branchLines[result.BranchName], resultLines...)
+	}
+	hasAnyWorkdirChanges := len(lines) > 0
+
+	if commitInfo.GroupByBranch && hasAnyWorkdirChanges {
+		// --group-by-branch: one section per branch in order of first appearance, the bullets stay as they are
+		for _, branch := range branches {
+			message += fmt.Sprintf("\n\nBranch `%s`:", branch)
+			for _, line := range branchLines[branch] {
+				message += "\n" + line
 			}
-			message += fmt.Sprintf("\n- `%s` `%s` `%s`", result.WorkdirName, result.BranchName, shortHash)
-			hasAnyWorkdirChanges = true
 		}
-		// Skip workdirs with no changes - they won't appear in the commit message
+	} else {
+		for _, line := range lines {
+			message += "\n" + line
+		}
 	}
 
 	// If no workdirs had changes, indicate this was a metadata-only commit
@@ -1086,11 +2160,36 @@ func generateWmemRepoCommitMessage(commitInfo *CommitInfo, workdirResults []Work
 	return message
 }
 
+// workdirResultLines returns the wmem-repo commit message bullets of a workdir, none for workdirs without changes
+// Renames of --detect-moves follow the snapshot line, an index snapshot of --snapshot-worktree-and-index
+// gets a line of its own with an " (index)" suffix
+func workdirResultLines(result WorkdirCommitResult) []string {
+	var lines []string
+	if result.HasChanges {
+		// Truncate commit hash to 12 characters for readability
+		lines = append(lines, fmt.Sprintf("- `%s` `%s` `%s`", result.WorkdirName, result.BranchName, abbrevHash(result.CommitHash)))
+	} else if (result.Kind == WorkdirCommitMerge || result.Kind == WorkdirCommitFastForward) && result.NewTip != "" {
+		// Merge-only workdirs are listed with their merge commit, fast-forwarded ones with the new tip
+		lines = append(lines, fmt.Sprintf("- `%s` `%s` `%s` (%s)", result.WorkdirName, result.BranchName, abbrevHash(result.NewTip), result.Kind))
+	}
+	for _, rename := range result.Renames {
+		// Indented, so they aren't taken for workdir lines
+		lines = append(lines, "  renamed: "+rename)
+	}
+	if result.Upstream != nil && len(lines) > 0 {
+		lines = append(lines, "  upstream: "+result.Upstream.String())
+	}
+	if result.IndexCommitHash != "" {
+		lines = append(lines, fmt.Sprintf("- `%s` `%s` `%s` (index)", result.WorkdirName, result.BranchName, abbrevHash(result.IndexCommitHash)))
+	}
+	return lines
+}
+
 // countChangedWorkdirs counts how many workdirs had changes
 func countChangedWorkdirs(results []WorkdirCommitResult) int {
 	count := 0
 	for _, result := range results {
-		if result.HasChanges {
+		if result.HasChanges || result.IndexCommitHash != "" {
 			count++
 		}
 	}
@@ -1136,42 +2235,69 @@ func parseSignature(sigStr string) (*object.Signature, error) {
 	}, nil
 }
 
-// copyTreeObjects recursively copies a tree and all its referenced objects (subtrees and blobs)
-// from the source repository to the destination repository
+// copyTreeObjects copies a tree and all its referenced objects (subtrees and blobs)
+// Uses an explicit work stack instead of recursion so deeply nested trees can't exhaust the stack,
+// and a visited set so subtrees shared by several entries are walked only once
 func copyTreeObjects(srcRepo, dstRepo *git.Repository, treeHash plumbing.Hash) error {
-	// Get the tree object from source repository
-	srcTree, err := srcRepo.TreeObject(treeHash)
-	if err != nil {
-		return fmt.Errorf("failed to get tree object from source: %w", err)
+	type copyFrame struct {
+		hash     plumbing.Hash
+		expanded bool // entries are already queued, copy the tree itself once popped
 	}
 
-	// Check if tree already exists in destination repository
-	_, err = dstRepo.TreeObject(treeHash)
-	if err == nil {
-		// Tree already exists, no need to copy
-		return nil
-	}
+	visited := make(map[plumbing.Hash]bool)
+	stack := []copyFrame{{hash: treeHash}}
 
-	// Copy all referenced objects first (depth-first)
-	for _, entry := range srcTree.Entries {
-		switch entry.Mode {
-		case filemode.Dir:
-			// Recursively copy subtree
-			err = copyTreeObjects(srcRepo, dstRepo, entry.Hash)
-			if err != nil {
-				return fmt.Errorf("failed to copy subtree %s: %w", entry.Hash, err)
+	for len(stack) > 0 {
+		top := len(stack) - 1
+		frame := stack[top]
+
+		if frame.expanded {
+			// All referenced objects are copied, now copy the tree object itself
+			stack = stack[:top]
+			if err := copyObject(srcRepo, dstRepo, frame.hash); err != nil {
+				return fmt.Errorf("failed to copy tree %s: %w", frame.hash, err)
 			}
-		case filemode.Regular, filemode.Executable:
-			// Copy blob object
-			err = copyBlobObject(srcRepo, dstRepo, entry.Hash)
-			if err != nil {
-				return fmt.Errorf("failed to copy blob %s: %w", entry.Hash, err)
+			continue
+		}
+
+		if visited[frame.hash] {
+			stack = stack[:top]
+			continue
+		}
+		visited[frame.hash] = true
+
+		// Check if tree already exists in destination repository
+		if _, err := dstRepo.TreeObject(frame.hash); err == nil {
+			// Tree already exists, no need to copy
+			stack = stack[:top]
+			continue
+		}
+
+		// Get the tree object from source repository
+		srcTree, err := srcRepo.TreeObject(frame.hash)
+		if err != nil {
+			return fmt.Errorf("failed to get tree object from source: %w", err)
+		}
+
+		// Copy all referenced objects first (subtrees are queued above this frame)
+		stack[top].expanded = true
+		for _, entry := range srcTree.Entries {
+			if visited[entry.Hash] {
+				continue
+			}
+			switch entry.Mode {
+			case filemode.Dir:
+				stack = append(stack, copyFrame{hash: entry.Hash})
+			case filemode.Regular, filemode.Executable:
+				visited[entry.Hash] = true
+				if err := copyBlobObject(srcRepo, dstRepo, entry.Hash); err != nil {
+					return fmt.Errorf("failed to copy blob %s: %w", entry.Hash, err)
+				}
 			}
 		}
 	}
 
-	// Now copy the tree object itself
-	return copyObject(srcRepo, dstRepo, treeHash)
+	return nil
 }
 
 // copyBlobObject copies a blob object from source to destination repository
@@ -1214,7 +2340,7 @@ func copyObject(srcRepo, dstRepo *git.Repository, objectHash plumbing.Hash) erro
 // createTreeFromTouchedFiles creates a git tree from only the specified touched files
 // Only processes files that have actually changed for better performance
 // Implementation: docs/optimizations.md#touched-files-optimization
-func createTreeFromTouchedFiles(repo *git.Repository, dirPath string, touchedFiles []string, baseTreeHash plumbing.Hash) (plumbing.Hash, error) {
+func createTreeFromTouchedFiles(ctx context.Context, repo *git.Repository, dirPath string, touchedFiles []string, baseTreeHash plumbing.Hash, walk treeWalkOptions) (plumbing.Hash, error) {
 	// Get base tree to start with
 	baseTree, err := repo.TreeObject(baseTreeHash)
 	if err != nil {
@@ -1242,7 +2368,11 @@ func createTreeFromTouchedFiles(repo *git.Repository, dirPath string, touchedFil
 	}
 
 	// Update entries for touched files
+	blobRepo := walk.blobTarget(repo)
 	for _, filename := range touchedFiles {
+		if err := ctx.Err(); err != nil {
+			return plumbing.ZeroHash, err
+		}
 		filePath := filepath.Join(dirPath, filename)
 
 		// Check if file exists in filesystem
@@ -1269,7 +2399,7 @@ func createTreeFromTouchedFiles(repo *git.Repository, dirPath string, touchedFil
 			}
 
 			// Create blob from symlink target
-			blob := repo.Storer.NewEncodedObject()
+			blob := blobRepo.Storer.NewEncodedObject()
 			blob.SetType(plumbing.BlobObject)
 			writer, err := blob.Writer()
 			if err != nil {
@@ -1283,7 +2413,7 @@ func createTreeFromTouchedFiles(repo *git.Repository, dirPath string, touchedFil
 			}
 			writer.Close()
 
-			blobHash, err := repo.Storer.SetEncodedObject(blob)
+			blobHash, err := blobRepo.Storer.SetEncodedObject(blob)
 			if err != nil {
 				return plumbing.ZeroHash, fmt.Errorf("failed to store symlink blob: %w", err)
 			}
@@ -1301,8 +2431,12 @@ func createTreeFromTouchedFiles(repo *git.Repository, dirPath string, touchedFil
 		if err != nil {
 			return plumbing.ZeroHash, fmt.Errorf("failed to read file %s: %w", filePath, err)
 		}
+		content, err = walk.blobContent(filePath, content)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
 
-		blob := repo.Storer.NewEncodedObject()
+		blob := blobRepo.Storer.NewEncodedObject()
 		blob.SetType(plumbing.BlobObject)
 		writer, err := blob.Writer()
 		if err != nil {
@@ -1316,7 +2450,7 @@ func createTreeFromTouchedFiles(repo *git.Repository, dirPath string, touchedFil
 		}
 		writer.Close()
 
-		blobHash, err := repo.Storer.SetEncodedObject(blob)
+		blobHash, err := blobRepo.Storer.SetEncodedObject(blob)
 		if err != nil {
 			return plumbing.ZeroHash, fmt.Errorf("failed to store blob: %w", err)
 		}
@@ -1334,6 +2468,19 @@ func createTreeFromTouchedFiles(repo *git.Repository, dirPath string, touchedFil
 		}
 	}
 
+	// Names colliding case-insensitively are resolved by the --ignore-case-conflicts policy
+	var names []string
+	for name := range baseEntries {
+		names = append(names, name)
+	}
+	caseLosers, err := caseConflictLosers(dirPath, names, walk.caseConflicts)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	for name := range caseLosers {
+		delete(baseEntries, name)
+	}
+
 	// Create tree from updated entries
 	var treeEntries []object.TreeEntry
 	for _, entry := range baseEntries {
@@ -1355,21 +2502,108 @@ func createTreeFromTouchedFiles(repo *git.Repository, dirPath string, touchedFil
 	return repo.Storer.SetEncodedObject(treeObj)
 }
 
+// treeWalkOptions are the git-wmem commit options that shape a snapshot tree built from the filesystem
+type treeWalkOptions struct {
+	keepEmptyDirs bool
+	caseConflicts string
+	lineEndings   *lineEndingPolicy
+	blobFilter    *blobFilter
+	pathFilter    *pathFilter
+	// blobRepo stores the blobs instead of the tree repository (--dedupe-blobs-across-workdirs)
+	blobRepo *git.Repository
+	// ignoreSubmoduleErrors omits nested repositories without a readable HEAD (--ignore-submodule-errors)
+	ignoreSubmoduleErrors bool
+	// maxDepth is the deepest directory level below the root the walk descends into (--max-depth, 0 = unlimited)
+	maxDepth int
+	// depth is the level of the walked directory below the root
+	depth int
+}
+
+// newTreeWalkOptions prepares the tree walk options of one snapshot root (a workdir or the wmem-repo)
+func newTreeWalkOptions(opts CommitOptions, rootPath string) (treeWalkOptions, error) {
+	walk := treeWalkOptions{
+		keepEmptyDirs:         opts.KeepEmptyDirs,
+		caseConflicts:         opts.CaseConflictPolicy,
+		pathFilter:            newPathFilter(rootPath, opts.PathFilters),
+		ignoreSubmoduleErrors: opts.IgnoreSubmoduleErrors,
+		maxDepth:              opts.MaxDepth,
+	}
+	if opts.NormalizeLineEndings {
+		policy, err := newLineEndingPolicy(rootPath)
+		if err != nil {
+			return walk, err
+		}
+		walk.lineEndings = policy
+	}
+	filter, err := newBlobFilter(rootPath, opts.BlobFilter)
+	if err != nil {
+		return walk, err
+	}
+	walk.blobFilter = filter
+	return walk, nil
+}
+
+// blobContent returns the content to store for the file at filePath: cleaned by --blob-filter,
+// then normalized by --normalize-line-endings, like git runs the clean filter before the eol conversion
+func (walk treeWalkOptions) blobContent(filePath string, content []byte) ([]byte, error) {
+	content, err := walk.blobFilter.apply(filePath, content)
+	if err != nil {
+		return nil, err
+	}
+	return walk.lineEndings.apply(filePath, content), nil
+}
+
+// skippedNestedRepos holds the nested repositories --ignore-submodule-errors already warned about
+var skippedNestedRepos sync.Map
+
+// skippedDeepDirs holds the directories below --max-depth already warned about
+var skippedDeepDirs sync.Map
+
+// nestedRepoHead returns the HEAD of a nested git repository, the commit of its gitlink entry
+// An unborn HEAD (no commits yet) or a broken repository is an error
+func nestedRepoHead(repoPath string) (*plumbing.Reference, error) {
+	nestedRepo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open nested git repository %s: %w", repoPath, err)
+	}
+
+	head, err := nestedRepo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HEAD of nested git repository %s: %w", repoPath, err)
+	}
+	return head, nil
+}
+
 // createTreeFromFilesystem creates a git tree object from the filesystem directory structure
 // This is a READ-ONLY approach that doesn't modify the working directory or its repo
-func createTreeFromFilesystem(repo *git.Repository, dirPath string) (plumbing.Hash, error) {
+// No further blobs are stored once ctx is done (--workdir-timeout)
+func createTreeFromFilesystem(ctx context.Context, repo *git.Repository, dirPath string, limit *fileCountLimit, walk treeWalkOptions) (plumbing.Hash, error) {
+	if err := ctx.Err(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
 	// Read directory entries
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
 		return plumbing.ZeroHash, fmt.Errorf("failed to read directory %s: %w", dirPath, err)
 	}
 
+	// Names colliding case-insensitively are resolved by the --ignore-case-conflicts policy
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	caseLosers, err := caseConflictLosers(dirPath, names, walk.caseConflicts)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
 	var treeEntries []object.TreeEntry
 
 	// Process each entry in the directory
 	for _, entry := range entries {
 		// Skip .git directory specifically (like git add -A does), but include other dotfiles
-		if entry.Name() == ".git" {
+		if entry.Name() == ".git" || caseLosers[entry.Name()] {
 			continue
 		}
 
@@ -1391,16 +2625,23 @@ func createTreeFromFilesystem(repo *git.Repository, dirPath string) (plumbing.Ha
 			// Reference: docs/use-cases/git-wmem-commit/basic.md step 7 detail
 			gitPath := filepath.Join(entryPath, ".git")
 			if _, err := os.Stat(gitPath); err == nil {
-				// Handle nested git repository as gitlink (like git add -A does)
-				// Get the HEAD commit hash from the nested repository
-				nestedRepo, err := git.PlainOpen(entryPath)
-				if err != nil {
-					return plumbing.ZeroHash, fmt.Errorf("failed to open nested git repository %s: %w", entryPath, err)
+				if !walk.pathFilter.includes(entryPath) {
+					continue
 				}
 
-				head, err := nestedRepo.Head()
+				// Handle nested git repository as gitlink (like git add -A does)
+				// Get the HEAD commit hash from the nested repository
+				head, err := nestedRepoHead(entryPath)
 				if err != nil {
-					return plumbing.ZeroHash, fmt.Errorf("failed to get HEAD of nested git repository %s: %w", entryPath, err)
+					// Reference: docs/use-cases/git-wmem-commit/basic.md#submodule-errors
+					if walk.ignoreSubmoduleErrors {
+						// The tree is built by the check and again for the snapshot, warn once
+						if _, warned := skippedNestedRepos.LoadOrStore(entryPath, true); !warned {
+							printWarning("Skipping nested git repository (--ignore-submodule-errors): %v\n", err)
+						}
+						continue
+					}
+					return plumbing.ZeroHash, err
 				}
 
 				// Add gitlink entry to tree (mode 160000 like git add -A does)
@@ -1412,12 +2653,29 @@ func createTreeFromFilesystem(repo *git.Repository, dirPath string) (plumbing.Ha
 				continue
 			}
 
+			// Reference: docs/validations.md#max-depth
+			if walk.maxDepth > 0 && walk.depth >= walk.maxDepth {
+				// The tree is built by the check and again for the snapshot, warn once
+				if _, warned := skippedDeepDirs.LoadOrStore(entryPath, true); !warned {
+					printWarning("Skipping directory %s deeper than --max-depth %d\n", entryPath, walk.maxDepth)
+				}
+				continue
+			}
+
 			// Recursively create subtree for regular directories
-			subTreeHash, err := createTreeFromFilesystem(repo, entryPath)
+			subWalk := walk
+			subWalk.depth++
+			subTreeHash, err := createTreeFromFilesystem(ctx, repo, entryPath, limit, subWalk)
 			if err != nil {
 				return plumbing.ZeroHash, fmt.Errorf("failed to create subtree for %s: %w", entryPath, err)
 			}
 
+			// Skip directories without any tracked content (like git add -A does)
+			// Reference: docs/use-cases/git-wmem-commit/basic.md#empty-directories
+			if subTreeHash == emptyTreeHash {
+				continue
+			}
+
 			// Add directory entry to tree
 			treeEntries = append(treeEntries, object.TreeEntry{
 				Name: entry.Name(),
@@ -1431,8 +2689,21 @@ func createTreeFromFilesystem(repo *git.Repository, dirPath string) (plumbing.Ha
 				continue
 			}
 
+			// Files outside --path-filter are treated as absent
+			if !walk.pathFilter.includes(entryPath) {
+				continue
+			}
+
+			// Abort before storing anything beyond the safety limit
+			if err := limit.add(); err != nil {
+				return plumbing.ZeroHash, err
+			}
+			if err := ctx.Err(); err != nil {
+				return plumbing.ZeroHash, err
+			}
+
 			// Create blob for file
-			blobHash, err := createBlobFromFile(repo, entryPath)
+			blobHash, err := createBlobFromFile(walk.blobTarget(repo), entryPath, walk)
 			if err != nil {
 				return plumbing.ZeroHash, fmt.Errorf("failed to create blob for %s: %w", entryPath, err)
 			}
@@ -1457,6 +2728,19 @@ func createTreeFromFilesystem(repo *git.Repository, dirPath string) (plumbing.Ha
 		}
 	}
 
+	// Keep an empty directory in the snapshot by adding a placeholder blob (--prune-empty-dirs=false)
+	if walk.keepEmptyDirs && len(entries) == 0 && walk.pathFilter.includes(filepath.Join(dirPath, emptyDirPlaceholderName)) {
+		placeholderHash, err := storeEmptyBlob(walk.blobTarget(repo))
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to create placeholder for %s: %w", dirPath, err)
+		}
+		treeEntries = append(treeEntries, object.TreeEntry{
+			Name: emptyDirPlaceholderName,
+			Mode: filemode.Regular,
+			Hash: placeholderHash,
+		})
+	}
+
 	// Sort entries by name using go-git's native sorting (ensures Git compatibility)
 	sort.Sort(object.TreeEntrySorter(treeEntries))
 
@@ -1479,13 +2763,58 @@ func createTreeFromFilesystem(repo *git.Repository, dirPath string) (plumbing.Ha
 	return treeHash, nil
 }
 
+// emptyTreeHash is the hash of a tree object without entries
+var emptyTreeHash = plumbing.NewHash("4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+
+// emptyDirPlaceholderName is the placeholder file added to empty directories with --prune-empty-dirs=false
+const emptyDirPlaceholderName = ".gitkeep"
+
+// storeEmptyBlob stores the empty blob used as the empty directory placeholder
+func storeEmptyBlob(repo *git.Repository) (plumbing.Hash, error) {
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(0)
+	return repo.Storer.SetEncodedObject(obj)
+}
+
+// errIdenticalTree is returned with --dedupe-identical-trees when a snapshot tree equals its parent's tree
+// Reference: docs/use-cases/git-wmem-commit/basic.md#identical-trees
+var errIdenticalTree = errors.New("snapshot tree identical to wmem-br tip")
+
+// errMaxFileCountExceeded is returned when a workdir has more files than --max-file-count
+var errMaxFileCountExceeded = errors.New("max file count exceeded")
+
+// fileCountLimit aborts a filesystem walk once more than max files are seen (0 = unlimited)
+// Reference: docs/validations.md#max-file-count
+type fileCountLimit struct {
+	max   int
+	count int
+}
+
+// add counts one file and fails once the limit is exceeded
+func (l *fileCountLimit) add() error {
+	if l == nil || l.max <= 0 {
+		return nil
+	}
+	l.count++
+	if l.count > l.max {
+		return fmt.Errorf("%w: more than %d files", errMaxFileCountExceeded, l.max)
+	}
+	return nil
+}
+
 // createBlobFromFile creates a git blob object from a file
-func createBlobFromFile(repo *git.Repository, filePath string) (plumbing.Hash, error) {
+// The content goes through --blob-filter and --normalize-line-endings first (walk.blobContent)
+func createBlobFromFile(repo *git.Repository, filePath string, walk treeWalkOptions) (plumbing.Hash, error) {
 	// Read file content
 	content, err := os.ReadFile(filePath)
 	if err != nil {
 		return plumbing.ZeroHash, fmt.Errorf("failed to read file %s: %w", filePath, err)
 	}
+	content, err = walk.blobContent(filePath, content)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
 
 	// Create blob with the file content
 	blob := &object.Blob{}
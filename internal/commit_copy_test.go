@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// storeTestTree stores a tree with the given entries and returns its hash
+func storeTestTree(t *testing.T, repo *git.Repository, entries []object.TreeEntry) plumbing.Hash {
+	t.Helper()
+	obj := repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{Entries: entries}).Encode(obj); err != nil {
+		t.Fatalf("failed to encode tree: %v", err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("failed to store tree: %v", err)
+	}
+	return hash
+}
+
+// storeTestBlob stores a blob with the given content and returns its hash
+func storeTestBlob(t *testing.T, repo *git.Repository, content string) plumbing.Hash {
+	t.Helper()
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	writer, err := obj.Writer()
+	if err != nil {
+		t.Fatalf("failed to get blob writer: %v", err)
+	}
+	if _, err := writer.Write([]byte(content)); err != nil {
+		t.Fatalf("failed to write blob: %v", err)
+	}
+	writer.Close()
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("failed to store blob: %v", err)
+	}
+	return hash
+}
+
+// newTestMemoryRepo creates an in-memory repository for object copy tests
+func newTestMemoryRepo(t *testing.T) *git.Repository {
+	t.Helper()
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		t.Fatalf("failed to init memory repository: %v", err)
+	}
+	return repo
+}
+
+// TestCopyTreeObjects_DeeplyNested copies a tree nested 5000 levels deep
+func TestCopyTreeObjects_DeeplyNested(t *testing.T) {
+	const depth = 5000
+	srcRepo := newTestMemoryRepo(t)
+	dstRepo := newTestMemoryRepo(t)
+
+	blobHash := storeTestBlob(t, srcRepo, "deepest file")
+	treeHash := storeTestTree(t, srcRepo, []object.TreeEntry{{Name: "file.txt", Mode: filemode.Regular, Hash: blobHash}})
+	for i := 0; i < depth; i++ {
+		treeHash = storeTestTree(t, srcRepo, []object.TreeEntry{{Name: "d", Mode: filemode.Dir, Hash: treeHash}})
+	}
+
+	if err := copyTreeObjects(srcRepo, dstRepo, treeHash); err != nil {
+		t.Fatalf("copyTreeObjects failed: %v", err)
+	}
+
+	// Walk down the copied tree to the blob
+	for i := 0; i < depth; i++ {
+		tree, err := dstRepo.TreeObject(treeHash)
+		if err != nil {
+			t.Fatalf("tree at level %d missing in destination: %v", i, err)
+		}
+		treeHash = tree.Entries[0].Hash
+	}
+	if _, err := dstRepo.BlobObject(blobHash); err != nil {
+		t.Fatalf("deepest blob missing in destination: %v", err)
+	}
+}
+
+// TestCopyTreeObjects_SharedSubtrees copies a tree where many entries share the same subtrees
+func TestCopyTreeObjects_SharedSubtrees(t *testing.T) {
+	srcRepo := newTestMemoryRepo(t)
+	dstRepo := newTestMemoryRepo(t)
+
+	// Each level references the level below 20 times: 20^30 paths without memoization
+	blobHash := storeTestBlob(t, srcRepo, "shared file")
+	treeHash := storeTestTree(t, srcRepo, []object.TreeEntry{{Name: "file.txt", Mode: filemode.Regular, Hash: blobHash}})
+	for level := 0; level < 30; level++ {
+		var entries []object.TreeEntry
+		for i := 0; i < 20; i++ {
+			entries = append(entries, object.TreeEntry{Name: fmt.Sprintf("d%02d", i), Mode: filemode.Dir, Hash: treeHash})
+		}
+		treeHash = storeTestTree(t, srcRepo, entries)
+	}
+
+	if err := copyTreeObjects(srcRepo, dstRepo, treeHash); err != nil {
+		t.Fatalf("copyTreeObjects failed: %v", err)
+	}
+
+	if _, err := dstRepo.TreeObject(treeHash); err != nil {
+		t.Fatalf("root tree missing in destination: %v", err)
+	}
+	if _, err := dstRepo.BlobObject(blobHash); err != nil {
+		t.Fatalf("shared blob missing in destination: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// testSignature is the author and committer of the workdir commits of the tests
+var testSignature = object.Signature{Name: "Test", Email: "test@example.com", When: time.Unix(0, 0)}
+
+// newTestWmemRepo creates a wmem-repo with the workdir ../project (file.txt committed on main)
+// and its initial snapshot, the current directory is the wmem-repo until the test ends
+func newTestWmemRepo(t *testing.T) (string, *git.Repository) {
+	t.Helper()
+	root := t.TempDir()
+	workdirPath := filepath.Join(root, "project")
+	workdirRepo, err := git.PlainInitWithOptions(workdirPath, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.Main},
+	})
+	if err != nil {
+		t.Fatalf("failed to init workdir: %v", err)
+	}
+	commitTestFile(t, workdirRepo, "file.txt", "initial content")
+
+	t.Chdir(root)
+	if err := InitWmemRepo("wmem", InitOptions{}); err != nil {
+		t.Fatalf("InitWmemRepo failed: %v", err)
+	}
+	t.Chdir(filepath.Join(root, "wmem"))
+	if err := os.WriteFile("md/commit-workdir-paths", []byte("../project\n"), 0644); err != nil {
+		t.Fatalf("failed to write commit-workdir-paths: %v", err)
+	}
+	if err := CommitWmem(CommitOptions{}); err != nil {
+		t.Fatalf("initial CommitWmem failed: %v", err)
+	}
+	return "../project", workdirRepo
+}
+
+// commitTestFile writes a file into the workdir of repo and commits it
+func commitTestFile(t *testing.T, repo *git.Repository, name, content string) {
+	t.Helper()
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(worktree.Filesystem.Root(), name), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	if _, err := worktree.Add(name); err != nil {
+		t.Fatalf("failed to add %s: %v", name, err)
+	}
+	if _, err := worktree.Commit("Change "+name, &git.CommitOptions{Author: &testSignature}); err != nil {
+		t.Fatalf("failed to commit %s: %v", name, err)
+	}
+}
+
+// testWmemBranchTip returns the wmem-br/main commit of the wmem-wd-repo of the workdir project
+func testWmemBranchTip(t *testing.T) *object.Commit {
+	t.Helper()
+	tip, err := wmemBranchTip("project", "main")
+	if err != nil {
+		t.Fatalf("failed to get wmem-br/main: %v", err)
+	}
+	repo, err := openBareRepo("project")
+	if err != nil {
+		t.Fatalf("failed to open bare repo: %v", err)
+	}
+	commit, err := repo.CommitObject(tip)
+	if err != nil {
+		t.Fatalf("failed to get wmem-br/main commit: %v", err)
+	}
+	return commit
+}
+
+// TestCommitWorkdirWithChanges_DedupeIdenticalTrees snapshots an unchanged workdir, as after
+// a check reporting changes that the snapshot tree doesn't have
+func TestCommitWorkdirWithChanges_DedupeIdenticalTrees(t *testing.T) {
+	workdirPath, _ := newTestWmemRepo(t)
+	commitInfo, err := readCommitInfo()
+	if err != nil {
+		t.Fatalf("readCommitInfo failed: %v", err)
+	}
+	tipBefore := testWmemBranchTip(t)
+
+	result, err := commitWorkdirWithChanges(workdirPath, "project", "main", commitInfo, CommitOptions{DedupeIdenticalTrees: true})
+	if err != nil {
+		t.Fatalf("commitWorkdirWithChanges with DedupeIdenticalTrees failed: %v", err)
+	}
+	if result.HasChanges || result.Kind != WorkdirCommitNone {
+		t.Errorf("expected no snapshot with DedupeIdenticalTrees, got %+v", result)
+	}
+	if tip := testWmemBranchTip(t); tip.Hash != tipBefore.Hash {
+		t.Errorf("expected wmem-br/main to stay at %s, got %s", tipBefore.Hash, tip.Hash)
+	}
+
+	// Without the guard the snapshot commit gets its parent's tree
+	result, err = commitWorkdirWithChanges(workdirPath, "project", "main", commitInfo, CommitOptions{})
+	if err != nil {
+		t.Fatalf("commitWorkdirWithChanges failed: %v", err)
+	}
+	tip := testWmemBranchTip(t)
+	if !result.HasChanges || tip.Hash == tipBefore.Hash {
+		t.Fatalf("expected a snapshot commit without DedupeIdenticalTrees, got %+v", result)
+	}
+	if tip.TreeHash != tipBefore.TreeHash {
+		t.Errorf("expected the same tree %s, got %s", tipBefore.TreeHash, tip.TreeHash)
+	}
+}
+
+// TestCheckWorkdirWithTimeout_DuringMerge hits --workdir-timeout while step 5 merges a new workdir commit
+func TestCheckWorkdirWithTimeout_DuringMerge(t *testing.T) {
+	workdirPath, workdirRepo := newTestWmemRepo(t)
+	commitTestFile(t, workdirRepo, "file.txt", "new workdir commit")
+	if err := fetchLatestChanges(context.Background(), "project", CommitOptions{}); err != nil {
+		t.Fatalf("fetchLatestChanges failed: %v", err)
+	}
+	workdirMap, err := readWorkdirMap()
+	if err != nil {
+		t.Fatalf("readWorkdirMap failed: %v", err)
+	}
+	commitInfo, err := readCommitInfo()
+	if err != nil {
+		t.Fatalf("readCommitInfo failed: %v", err)
+	}
+	tipBefore := testWmemBranchTip(t)
+
+	// The merge is still running when the deadline passes
+	origBeforeWmemMerge := beforeWmemMerge
+	defer func() { beforeWmemMerge = origBeforeWmemMerge }()
+	merging := false
+	beforeWmemMerge = func(ctx context.Context) {
+		merging = true
+		<-ctx.Done()
+	}
+
+	opts := CommitOptions{WorkdirTimeout: 100 * time.Millisecond}
+	result := checkWorkdirWithTimeout(context.Background(), workdirPath, nil, workdirMap, commitInfo, opts)
+	if !merging {
+		t.Fatalf("expected the check to reach the step 5 merge, got %+v", result)
+	}
+	if !errors.Is(result.Error, errWorkdirTimeout) {
+		t.Fatalf("expected a workdir timeout, got %v", result.Error)
+	}
+	if tip := testWmemBranchTip(t); tip.Hash != tipBefore.Hash {
+		t.Errorf("expected wmem-br/main to stay at %s after the timeout, got %s", tipBefore.Hash, tip.Hash)
+	}
+	repo, err := openBareRepo("project")
+	if err != nil {
+		t.Fatalf("failed to open bare repo: %v", err)
+	}
+	// The initial run of the clean workdir created no wmem-br/head, the merge would
+	if headRef, err := repo.Reference(plumbing.ReferenceName("refs/heads/wmem-br/head"), true); err == nil {
+		t.Errorf("expected no wmem-br/head after the timeout, got %s", headRef.Hash())
+	}
+
+	// Within the deadline the same check merges
+	beforeWmemMerge = origBeforeWmemMerge
+	result = checkWorkdirWithTimeout(context.Background(), workdirPath, nil, workdirMap, commitInfo, opts)
+	if result.Error != nil || result.Kind != WorkdirCommitMerge {
+		t.Fatalf("expected a merge within the deadline, got %+v", result)
+	}
+	if tip := testWmemBranchTip(t); tip.NumParents() != 2 || tip.ParentHashes[0] != tipBefore.Hash {
+		t.Errorf("expected wmem-br/main to move to a merge on top of %s, got %s", tipBefore.Hash, tip.Hash)
+	}
+}
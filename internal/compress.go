@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// compressChangedBareRepos packs loose objects of the wmem-wd-repos that got new commits in this run
+// Reference: docs/use-cases/git-wmem-commit/basic.md#compression
+func compressChangedBareRepos(workdirResults []WorkdirCommitResult) error {
+	for _, result := range workdirResults {
+		if result.NewTip == "" || result.NewTip == result.OldTip {
+			continue
+		}
+
+		packed, err := compressBareRepo(result.WorkdirName)
+		if err != nil {
+			return fmt.Errorf("failed to compress repos/%s.git: %w", result.WorkdirName, err)
+		}
+		fmt.Printf("Info: Packed %d loose object(s) in repos/%s.git\n", packed, result.WorkdirName)
+	}
+	return nil
+}
+
+// compressBareRepo packs the loose objects of a wmem-wd-repo into a new packfile
+// Only loose objects are packed (like `git repack -d`), existing packs and objects
+// in the shared object store are left alone
+func compressBareRepo(workdirName string) (int, error) {
+	repo, err := openBareRepo(workdirName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+
+	looseStorer, ok := repo.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return 0, fmt.Errorf("storage doesn't support loose objects")
+	}
+	packWriterStorer, ok := repo.Storer.(storer.PackfileWriter)
+	if !ok {
+		return 0, fmt.Errorf("storage doesn't support writing packfiles")
+	}
+
+	var looseHashes []plumbing.Hash
+	err = looseStorer.ForEachObjectHash(func(hash plumbing.Hash) error {
+		looseHashes = append(looseHashes, hash)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list loose objects: %w", err)
+	}
+	if len(looseHashes) == 0 {
+		return 0, nil
+	}
+
+	repoConfig, err := repo.Config()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read repository config: %w", err)
+	}
+
+	packWriter, err := packWriterStorer.PackfileWriter()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create packfile writer: %w", err)
+	}
+	encoder := packfile.NewEncoder(packWriter, repo.Storer, false)
+	if _, err := encoder.Encode(looseHashes, repoConfig.Pack.Window); err != nil {
+		packWriter.Close()
+		return 0, fmt.Errorf("failed to encode packfile: %w", err)
+	}
+	// Closing writes the pack index, loose objects are deleted only after that succeeded
+	if err := packWriter.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write packfile: %w", err)
+	}
+
+	for _, hash := range looseHashes {
+		if err := looseStorer.DeleteLooseObject(hash); err != nil {
+			return 0, fmt.Errorf("failed to delete packed loose object %s: %w", hash, err)
+		}
+	}
+	return len(looseHashes), nil
+}
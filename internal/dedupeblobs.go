@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// validateDedupeBlobs checks that git-wmem commit --dedupe-blobs-across-workdirs has a shared object store
+// Reference: docs/use-cases/git-wmem-commit/basic.md#dedupe-blobs-across-workdirs
+func validateDedupeBlobs(opts CommitOptions) error {
+	if opts.DedupeBlobsAcrossWorkdirs && !isBareReposShared() {
+		return fmt.Errorf("--dedupe-blobs-across-workdirs requires a wmem-repo created with git-wmem init --bare-repos-shared")
+	}
+	return nil
+}
+
+// dedupeBlobs makes the walk store new blobs in repos/_shared.git (--dedupe-blobs-across-workdirs)
+// Trees and commits stay in the wmem-wd-repo, which reads the blobs through its alternates
+func (w *treeWalkOptions) dedupeBlobs(opts CommitOptions) error {
+	if !opts.DedupeBlobsAcrossWorkdirs {
+		return nil
+	}
+	sharedRepo, err := openBareRepo(sharedRepoName)
+	if err != nil {
+		return fmt.Errorf("failed to open shared bare repository: %w", err)
+	}
+	w.blobRepo = sharedRepo
+	return nil
+}
+
+// blobTarget returns the repository the blobs of a tree built in repo go to
+func (w treeWalkOptions) blobTarget(repo *git.Repository) *git.Repository {
+	if w.blobRepo != nil {
+		return w.blobRepo
+	}
+	return repo
+}
+
+// wmemBlobsRefPrefix returns the ref prefix of repos/_shared.git keeping the deduped blobs of a workdir reachable
+func wmemBlobsRefPrefix(workdirName string) string {
+	return fmt.Sprintf("refs/wmem-blobs/%s/", workdirName)
+}
+
+// keepSharedBlobsReachable records the tree of a snapshot commit in repos/_shared.git, so a plain git gc
+// there doesn't prune its deduped blobs (--dedupe-blobs-across-workdirs)
+// refs/wmem-blobs/<workdir-name>/<branch> gets a commit with the snapshot tree on top of the previous one
+// Reference: docs/use-cases/git-wmem-commit/basic.md#dedupe-blobs-across-workdirs
+func keepSharedBlobsReachable(repo *git.Repository, workdirName, wmemBranchName string, snapshotHash plumbing.Hash) error {
+	snapshot, err := repo.CommitObject(snapshotHash)
+	if err != nil {
+		return fmt.Errorf("failed to get snapshot commit: %w", err)
+	}
+
+	sharedRepoMu.Lock()
+	defer sharedRepoMu.Unlock()
+
+	sharedRepo, err := openBareRepo(sharedRepoName)
+	if err != nil {
+		return fmt.Errorf("failed to open shared bare repository: %w", err)
+	}
+	// Blobs of earlier snapshots without --dedupe-blobs-across-workdirs are copied too
+	if err := copyTreeObjects(repo, sharedRepo, snapshot.TreeHash); err != nil {
+		return err
+	}
+
+	refName := plumbing.ReferenceName(wmemBlobsRefPrefix(workdirName) + strings.TrimPrefix(wmemBranchName, "wmem-br/"))
+	commit := &object.Commit{
+		Message:   fmt.Sprintf("Blobs of %s snapshot %s\n", workdirName, snapshotHash),
+		TreeHash:  snapshot.TreeHash,
+		Author:    snapshot.Committer,
+		Committer: snapshot.Committer,
+	}
+	if ref, err := sharedRepo.Reference(refName, true); err == nil {
+		commit.ParentHashes = []plumbing.Hash{ref.Hash()}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return fmt.Errorf("failed to read %s: %w", refName, err)
+	}
+
+	obj := sharedRepo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return fmt.Errorf("failed to encode commit: %w", err)
+	}
+	commitHash, err := sharedRepo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return fmt.Errorf("failed to store commit: %w", err)
+	}
+	if err := sharedRepo.Storer.SetReference(plumbing.NewHashReference(refName, commitHash)); err != nil {
+		return fmt.Errorf("failed to update %s: %w", refName, err)
+	}
+	return nil
+}
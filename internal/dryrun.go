@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// dryRunCommit prints which workdirs the next git-wmem commit would snapshot and their changed files,
+// with opts.Diff also the unified diff between the filesystem and the last snapshot tree (--dry-run)
+// Read-only like --dump-tree: the snapshot trees are built in memory, nothing is fetched or committed
+// Reference: docs/use-cases/git-wmem-commit/basic.md#dry-run
+func dryRunCommit(opts CommitOptions) error {
+	if err := validateCaseConflictPolicy(opts.CaseConflictPolicy); err != nil {
+		return err
+	}
+	if err := validatePathFilters(opts); err != nil {
+		return err
+	}
+	if err := validateBlobFilter(opts); err != nil {
+		return err
+	}
+
+	workdirPaths, err := readWorkdirPaths()
+	if err != nil {
+		return fmt.Errorf("failed to read workdir paths: %w", err)
+	}
+	if len(workdirPaths) == 0 {
+		return fmt.Errorf("No workdirs configured for commit. Add paths to your workdirs in md/commit-workdir-paths file.")
+	}
+	workdirMap, err := readWorkdirMap()
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read workdir map: %w", err)
+	}
+
+	// Nothing is stored, also no blobs in repos/_shared.git
+	opts.DedupeBlobsAcrossWorkdirs = false
+
+	fmt.Printf("Info: Dry run, nothing is fetched or committed (--dry-run)\n")
+	pending := 0
+	for _, workdirPath := range workdirPaths {
+		changes, snapshotBranch, err := dryRunWorkdirChanges(workdirPath, workdirMap, opts)
+		if err != nil {
+			return fmt.Errorf("failed to preview workdir %s: %w", workdirPath, err)
+		}
+		if len(changes) == 0 {
+			fmt.Printf("No changes in workdir %s\n", workdirPath)
+			continue
+		}
+		pending++
+		fmt.Printf("Would snapshot workdir %s (%s):\n", workdirPath, snapshotBranch)
+		for _, file := range changedFilesOf(changes) {
+			fmt.Printf("  %s %s\n", file.Marker, file.Path)
+		}
+		if !opts.Diff {
+			continue
+		}
+		patch, err := changes.Patch()
+		if err != nil {
+			return fmt.Errorf("failed to create diff of workdir %s: %w", workdirPath, err)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(patch.String(), "\n"), "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+	fmt.Printf("Info: %d of %d workdir(s) would get a snapshot\n", pending, len(workdirPaths))
+	return nil
+}
+
+// dryRunWorkdirChanges diffs the last snapshot tree of a workdir (the wmem-br/<current-branch-name> tip)
+// against the tree a snapshot would get now, also returns the name of the snapshot branch
+// A workdir without a snapshot yet is diffed against its HEAD tree, which is where init-repos starts wmem-br
+func dryRunWorkdirChanges(workdirPath string, workdirMap WorkdirMap, opts CommitOptions) (object.Changes, string, error) {
+	resolvedPath, err := resolveWorkdirPath(workdirPath)
+	if err != nil {
+		return nil, "", err
+	}
+	workdirRepo, err := git.PlainOpen(resolvedPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("workdir %s is not a git repository: %w", workdirPath, err)
+	}
+	currentBranchName, err := getCurrentBranchName(resolvedPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get current branch name: %w", err)
+	}
+	snapshotBranch := wmemBranchNameFor(currentBranchName)
+
+	var baseTree *object.Tree
+	if workdirName, exists := FindWorkdirName(workdirPath, workdirMap); exists {
+		if tip, err := wmemBranchTip(workdirName, currentBranchName); err == nil {
+			bareRepo, err := openBareRepo(workdirName)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to open bare repository: %w", err)
+			}
+			if baseTree, err = commitTree(bareRepo, tip); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if baseTree == nil {
+		head, err := workdirRepo.Head()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get workdir HEAD: %w", err)
+		}
+		if baseTree, err = commitTree(workdirRepo, head.Hash()); err != nil {
+			return nil, "", err
+		}
+	}
+
+	memRepo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to init in-memory repository: %w", err)
+	}
+	treeHash, err := createTreeFromCurrentState(context.Background(), resolvedPath, memRepo, opts)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create tree from filesystem: %w", err)
+	}
+	if treeHash == baseTree.Hash {
+		return nil, snapshotBranch, nil
+	}
+	tree, err := memRepo.TreeObject(treeHash)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get snapshot tree: %w", err)
+	}
+	// Each tree reads its blobs from its own repository
+	changes, err := object.DiffTree(baseTree, tree)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to diff trees: %w", err)
+	}
+	return changes, snapshotBranch, nil
+}
+
+// commitTree returns the tree of a commit
+func commitTree(repo *git.Repository, commitHash plumbing.Hash) (*object.Tree, error) {
+	commit, err := repo.CommitObject(commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", abbrevHash(commitHash.String()), err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of %s: %w", abbrevHash(commitHash.String()), err)
+	}
+	return tree, nil
+}
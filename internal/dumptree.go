@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// dumpWorkdirTree prints the tree a snapshot of a workdir would get, like git ls-tree -r -t (--dump-tree)
+// The tree is built in memory, nothing is fetched or committed
+// Reference: docs/use-cases/git-wmem-commit/basic.md#dump-tree
+func dumpWorkdirTree(workdirPath string, opts CommitOptions) error {
+	if err := validateCaseConflictPolicy(opts.CaseConflictPolicy); err != nil {
+		return err
+	}
+	if err := validatePathFilters(opts); err != nil {
+		return err
+	}
+	expandedPath, err := expandWorkdirPath(workdirPath)
+	if err != nil {
+		return err
+	}
+	resolvedPath, err := resolveWorkdirPath(expandedPath)
+	if err != nil {
+		return err
+	}
+	if _, err := git.PlainOpen(resolvedPath); err != nil {
+		return fmt.Errorf("workdir %s is not a git repository: %w", workdirPath, err)
+	}
+
+	// Nothing is stored, also no blobs in repos/_shared.git
+	opts.DedupeBlobsAcrossWorkdirs = false
+	memRepo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to init in-memory repository: %w", err)
+	}
+	treeHash, err := createTreeFromCurrentState(context.Background(), resolvedPath, memRepo, opts)
+	if err != nil {
+		return fmt.Errorf("failed to create tree from filesystem: %w", err)
+	}
+	return printTreeEntries(memRepo, treeHash, "")
+}
+
+// printTreeEntries prints one "<mode> <type> <hash>\t<path>" line per entry, subtrees before their entries
+func printTreeEntries(repo *git.Repository, treeHash plumbing.Hash, prefix string) error {
+	tree, err := repo.TreeObject(treeHash)
+	if err != nil {
+		return fmt.Errorf("failed to get tree %s: %w", treeHash, err)
+	}
+	for _, entry := range tree.Entries {
+		entryPath := path.Join(prefix, entry.Name)
+		objectType := plumbing.BlobObject
+		switch entry.Mode {
+		case filemode.Dir:
+			objectType = plumbing.TreeObject
+		case filemode.Submodule:
+			objectType = plumbing.CommitObject
+		}
+		fmt.Printf("%06o %s %s\t%s\n", uint32(entry.Mode), objectType, entry.Hash, entryPath)
+		if entry.Mode == filemode.Dir {
+			if err := printTreeEntries(repo, entry.Hash, entryPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// allowedDomainsPath lists the email domains git-wmem commit --author-email-domain-check accepts, one per line
+// Reference: docs/use-cases/git-wmem-commit/basic.md#author-email-domain-check
+const allowedDomainsPath = "md/commit/allowed-domains"
+
+// readAllowedDomains reads the lower-cased domains of md/commit/allowed-domains (none when the file is missing)
+// Empty lines and lines starting with # are ignored, a leading @ is dropped
+func readAllowedDomains() ([]string, error) {
+	file, err := os.Open(allowedDomainsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var domains []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, strings.ToLower(strings.TrimPrefix(line, "@")))
+	}
+	return domains, scanner.Err()
+}
+
+// checkSignatureDomains fails unless the emails of author and committer are in one of the allowed domains
+// The domain is the part after the last @, compared case-insensitively and exactly (no subdomains)
+func checkSignatureDomains(author, committer *object.Signature) error {
+	domains, err := readAllowedDomains()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", allowedDomainsPath, err)
+	}
+	if len(domains) == 0 {
+		return fmt.Errorf("no domains in %s (--author-email-domain-check)", allowedDomainsPath)
+	}
+	for _, sig := range []struct {
+		role string
+		*object.Signature
+	}{{"author", author}, {"committer", committer}} {
+		if !emailInDomains(sig.Email, domains) {
+			return fmt.Errorf("%s email %q is not in an allowed domain of %s (--author-email-domain-check): %s", sig.role, sig.Email, allowedDomainsPath, strings.Join(domains, ", "))
+		}
+	}
+	return nil
+}
+
+// emailInDomains tells whether the domain of email is one of domains
+func emailInDomains(email string, domains []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range domains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
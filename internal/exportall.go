@@ -0,0 +1,409 @@
+package internal
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// exportManifestName is the file at the root of a git-wmem export-all archive listing the exported commits
+const exportManifestName = "wmem-export-manifest.txt"
+
+// exportedWorkdir is a workdir snapshot of a git-wmem export-all archive
+type exportedWorkdir struct {
+	Name       string
+	Branch     string
+	ShortHash  string
+	RecordedBy string
+	Commit     *object.Commit
+}
+
+// ExportAllWmem archives the state of every workdir at a wmem-uid into one tar archive, a <workdir-name>/
+// directory per workdir with the files of its snapshot commit and a manifest listing the commits
+// A workdir unchanged by the run of the wmem-uid is exported at its last snapshot before it
+// Reference: docs/use-cases/git-wmem-export-all/basic.md
+func ExportAllWmem(ref string, opts ExportAllOptions) error {
+	if !isWmemRepo() {
+		return fmt.Errorf("not in a wmem repository (missing .git-wmem file). Run this command from a wmem-repo directory.")
+	}
+	if opts.Output == "" && isTerminal(os.Stdout) {
+		return fmt.Errorf("refusing to write a tar archive to a terminal, use --output <file> or redirect stdout")
+	}
+
+	repo, head, err := openExportedWmemRepo()
+	if err != nil {
+		return err
+	}
+	wmemUID, workdirs, snapshotTime, err := resolveExportedWorkdirs(repo, head, ref)
+	if err != nil {
+		return err
+	}
+
+	// Read-only, so no lock is needed
+	out := os.Stdout
+	summary := os.Stderr
+	if opts.Output != "" {
+		out, err = os.Create(opts.Output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", opts.Output, err)
+		}
+		summary = os.Stdout
+	}
+	err = writeExportArchive(out, wmemUID, snapshotTime, workdirs)
+	if opts.Output != "" {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(opts.Output)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(summary, "Exported %d workdir(s) of %s\n", len(workdirs), wmemUID)
+	return nil
+}
+
+// ExportAllToDirWmem writes the state of every workdir at each wmem-uid to <output-dir>/<wmem-uid>/, the same
+// layout as the tar archive of ExportAllWmem, with opts.HardlinkDedupe identical files are hardlinked
+// Reference: docs/use-cases/git-wmem-export-all/basic.md#output-directory
+func ExportAllToDirWmem(refs []string, opts ExportAllOptions) error {
+	if !isWmemRepo() {
+		return fmt.Errorf("not in a wmem repository (missing .git-wmem file). Run this command from a wmem-repo directory.")
+	}
+	repo, head, err := openExportedWmemRepo()
+	if err != nil {
+		return err
+	}
+
+	// Resolve everything first, a typo in the last wmem-uid writes nothing
+	type exportedSnapshot struct {
+		wmemUID      string
+		workdirs     []exportedWorkdir
+		snapshotTime time.Time
+	}
+	var snapshots []exportedSnapshot
+	exported := make(map[string]bool)
+	for _, ref := range refs {
+		wmemUID, workdirs, snapshotTime, err := resolveExportedWorkdirs(repo, head, ref)
+		if err != nil {
+			return err
+		}
+		if exported[wmemUID] {
+			continue
+		}
+		exported[wmemUID] = true
+		if _, err := os.Lstat(filepath.Join(opts.OutputDir, wmemUID)); err == nil {
+			return fmt.Errorf("%s already exists", filepath.Join(opts.OutputDir, wmemUID))
+		}
+		snapshots = append(snapshots, exportedSnapshot{wmemUID, workdirs, snapshotTime})
+	}
+
+	// Read-only, so no lock is needed
+	var links map[exportedBlob]string
+	if opts.HardlinkDedupe {
+		links = make(map[exportedBlob]string)
+	}
+	linked := 0
+	for _, snapshot := range snapshots {
+		dir := filepath.Join(opts.OutputDir, snapshot.wmemUID)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+		manifestPath := filepath.Join(dir, exportManifestName)
+		if err := os.WriteFile(manifestPath, []byte(exportManifest(snapshot.wmemUID, snapshot.workdirs)), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", manifestPath, err)
+		}
+		if err := os.Chtimes(manifestPath, snapshot.snapshotTime, snapshot.snapshotTime); err != nil {
+			return fmt.Errorf("failed to date %s: %w", manifestPath, err)
+		}
+		for _, workdir := range snapshot.workdirs {
+			n, err := writeExportedDir(dir, workdir, links)
+			if err != nil {
+				return fmt.Errorf("failed to export %s: %w", workdir.Name, err)
+			}
+			linked += n
+		}
+		fmt.Printf("Exported %d workdir(s) of %s to %s\n", len(snapshot.workdirs), snapshot.wmemUID, dir)
+	}
+	if opts.HardlinkDedupe {
+		fmt.Printf("Hardlinked %d identical file(s)\n", linked)
+	}
+	return nil
+}
+
+// openExportedWmemRepo opens the wmem-repo in the current directory and returns its HEAD commit
+func openExportedWmemRepo() (*git.Repository, plumbing.Hash, error) {
+	repo, err := git.PlainOpen(".")
+	if err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("failed to open wmem repository: %w", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	return repo, head.Hash(), nil
+}
+
+// resolveExportedWorkdirs resolves a wmem-uid reference and collects the workdir snapshots to export
+func resolveExportedWorkdirs(repo *git.Repository, head plumbing.Hash, ref string) (string, []exportedWorkdir, time.Time, error) {
+	wmemUID, err := resolveWmemUID(repo, head, ref)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	workdirs, snapshotTime, err := collectExportedWorkdirs(repo, head, wmemUID)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	if len(workdirs) == 0 {
+		return "", nil, time.Time{}, fmt.Errorf("no workdir snapshots recorded up to %s", wmemUID)
+	}
+	return wmemUID, workdirs, snapshotTime, nil
+}
+
+// collectExportedWorkdirs walks the wmem-repo history from the newest commit of wmemUID back and picks the
+// newest snapshot line of each workdir, index snapshots (--snapshot-worktree-and-index) aren't exported
+// Returns the workdirs sorted by name and the time of the wmem-uid commit
+func collectExportedWorkdirs(repo *git.Repository, from plumbing.Hash, wmemUID string) ([]exportedWorkdir, time.Time, error) {
+	commitIter, err := repo.Log(&git.LogOptions{From: from})
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to get commit log: %w", err)
+	}
+
+	var snapshotTime time.Time
+	seen := make(map[string]bool)
+	var workdirs []exportedWorkdir
+	err = commitIter.ForEach(func(commit *object.Commit) error {
+		commitUID := extractWmemUID(commit.Message)
+		if snapshotTime.IsZero() {
+			if commitUID != wmemUID {
+				// Newer than the exported wmem-uid
+				return nil
+			}
+			snapshotTime = commit.Committer.When
+		}
+		for _, match := range workdirCommitLineRe.FindAllStringSubmatch(commit.Message, -1) {
+			if match[5] == "index" || seen[match[1]] {
+				continue
+			}
+			seen[match[1]] = true
+			workdirs = append(workdirs, exportedWorkdir{Name: match[1], Branch: match[2], ShortHash: match[3], RecordedBy: commitUID})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to process commits: %w", err)
+	}
+
+	sort.Slice(workdirs, func(i, j int) bool {
+		return workdirs[i].Name < workdirs[j].Name
+	})
+	for i := range workdirs {
+		workdirRepo, err := openBareRepo(workdirs[i].Name)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to open bare repository of %s: %w", workdirs[i].Name, err)
+		}
+		hash, err := workdirRepo.ResolveRevision(plumbing.Revision(workdirs[i].ShortHash))
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to resolve commit %s of %s: %w", workdirs[i].ShortHash, workdirs[i].Name, err)
+		}
+		workdirs[i].Commit, err = workdirRepo.CommitObject(*hash)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to get commit %s of %s: %w", workdirs[i].ShortHash, workdirs[i].Name, err)
+		}
+	}
+	return workdirs, snapshotTime, nil
+}
+
+// writeExportArchive writes the manifest and the files of each workdir snapshot as a tar archive
+func writeExportArchive(out io.Writer, wmemUID string, snapshotTime time.Time, workdirs []exportedWorkdir) error {
+	tw := tar.NewWriter(out)
+
+	manifest := exportManifest(wmemUID, workdirs)
+	header := &tar.Header{Name: exportManifestName, Mode: 0644, Size: int64(len(manifest)), ModTime: snapshotTime}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", exportManifestName, err)
+	}
+	if _, err := io.WriteString(tw, manifest); err != nil {
+		return fmt.Errorf("failed to write %s: %w", exportManifestName, err)
+	}
+
+	for _, workdir := range workdirs {
+		if err := writeExportedTree(tw, workdir); err != nil {
+			return fmt.Errorf("failed to export %s: %w", workdir.Name, err)
+		}
+	}
+	return tw.Close()
+}
+
+// exportManifest returns the manifest listing the exported commits
+func exportManifest(wmemUID string, workdirs []exportedWorkdir) string {
+	var manifest strings.Builder
+	fmt.Fprintf(&manifest, "# git-wmem export-all %s\n", wmemUID)
+	for _, workdir := range workdirs {
+		fmt.Fprintf(&manifest, "%s\t%s\t%s\t%s\n", workdir.Name, workdir.Commit.Hash, workdir.Branch, workdir.RecordedBy)
+	}
+	return manifest.String()
+}
+
+// writeExportedTree adds the tree of a workdir snapshot under <workdir-name>/ like git archive,
+// symlinks as links and submodules (gitlinks) as empty directories
+func writeExportedTree(tw *tar.Writer, workdir exportedWorkdir) error {
+	modTime := workdir.Commit.Committer.When
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: workdir.Name + "/", Mode: 0755, ModTime: modTime}); err != nil {
+		return err
+	}
+
+	tree, err := workdir.Commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to get tree of %s: %w", workdir.Commit.Hash, err)
+	}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to walk tree of %s: %w", workdir.Commit.Hash, err)
+		}
+		path := workdir.Name + "/" + name
+
+		switch entry.Mode {
+		case filemode.Dir, filemode.Submodule:
+			if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: path + "/", Mode: 0755, ModTime: modTime}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		content, err := readExportedBlob(tree, name, &entry)
+		if err != nil {
+			return err
+		}
+
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: path, Mode: 0644, Size: int64(len(content)), ModTime: modTime}
+		switch entry.Mode {
+		case filemode.Executable:
+			header.Mode = 0755
+		case filemode.Symlink:
+			header = &tar.Header{Typeflag: tar.TypeSymlink, Name: path, Linkname: string(content), Mode: 0777, ModTime: modTime}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write(content); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// exportedBlob identifies identical exported files for --hardlink-dedupe
+type exportedBlob struct {
+	Hash plumbing.Hash
+	Mode filemode.FileMode
+}
+
+// writeExportedDir writes the tree of a workdir snapshot to <dir>/<workdir-name>/ like writeExportedTree
+// With links (--hardlink-dedupe) a file whose blob and mode were already written is hardlinked to the first
+// copy, which keeps the date of its snapshot
+// Returns the number of hardlinked files
+func writeExportedDir(dir string, workdir exportedWorkdir, links map[exportedBlob]string) (int, error) {
+	modTime := workdir.Commit.Committer.When
+	root := filepath.Join(dir, workdir.Name)
+	if err := os.Mkdir(root, 0755); err != nil {
+		return 0, err
+	}
+
+	tree, err := workdir.Commit.Tree()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get tree of %s: %w", workdir.Commit.Hash, err)
+	}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	linked := 0
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			return linked, nil
+		}
+		if err != nil {
+			return linked, fmt.Errorf("failed to walk tree of %s: %w", workdir.Commit.Hash, err)
+		}
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		switch entry.Mode {
+		case filemode.Dir, filemode.Submodule:
+			if err := os.Mkdir(path, 0755); err != nil {
+				return linked, err
+			}
+			continue
+		}
+
+		key := exportedBlob{Hash: entry.Hash, Mode: entry.Mode}
+		if first, ok := links[key]; ok && entry.Mode != filemode.Symlink {
+			if err := os.Link(first, path); err != nil {
+				return linked, fmt.Errorf("failed to hardlink %s: %w", name, err)
+			}
+			linked++
+			continue
+		}
+
+		content, err := readExportedBlob(tree, name, &entry)
+		if err != nil {
+			return linked, err
+		}
+		if entry.Mode == filemode.Symlink {
+			if err := os.Symlink(string(content), path); err != nil {
+				return linked, err
+			}
+			continue
+		}
+		perm := os.FileMode(0644)
+		if entry.Mode == filemode.Executable {
+			perm = 0755
+		}
+		if err := os.WriteFile(path, content, perm); err != nil {
+			return linked, err
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			return linked, err
+		}
+		if links != nil {
+			links[key] = path
+		}
+	}
+}
+
+// readExportedBlob reads the content of a file of an exported tree
+func readExportedBlob(tree *object.Tree, name string, entry *object.TreeEntry) ([]byte, error) {
+	blob, err := tree.TreeEntryFile(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob of %s: %w", name, err)
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob of %s: %w", name, err)
+	}
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob of %s: %w", name, err)
+	}
+	return content, nil
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fastSkipCacheFile keeps, per workdir-path, the start time of the last run that checked the workdir
+// Reference: docs/use-cases/git-wmem-commit/basic.md#skip-clean-workdirs-fast
+const fastSkipCacheFile = "git-wmem-fast-skip.json"
+
+// fastSkipStampPaths are the workdir entries whose mtime tells the workdir changed, relative to the workdir root
+// The root directory changes with top-level creates, deletes and renames, the git files with staging,
+// commits, checkouts and resets
+var fastSkipStampPaths = []string{".", ".git/HEAD", ".git/index", ".git/logs/HEAD"}
+
+// fastSkipCachePath returns the path of the --skip-clean-workdirs-fast cache in the wmem-repo
+func fastSkipCachePath() (string, error) {
+	wmemRoot, err := findWmemRepoRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(wmemRoot, cacheDirName, fastSkipCacheFile), nil
+}
+
+// readFastSkipStamps reads the last check times of workdirs, an empty map when there is no cache yet
+func readFastSkipStamps() (map[string]time.Time, error) {
+	stamps := make(map[string]time.Time)
+	cachePath, err := fastSkipCachePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(cachePath)
+	if os.IsNotExist(err) {
+		return stamps, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", cachePath, err)
+	}
+	if err := json.Unmarshal(data, &stamps); err != nil {
+		// A broken cache only costs a full check
+		fmt.Printf("Debug: Ignoring unreadable %s: %v\n", cachePath, err)
+		return make(map[string]time.Time), nil
+	}
+	return stamps, nil
+}
+
+// writeFastSkipStamps stores the last check times of workdirs
+func writeFastSkipStamps(stamps map[string]time.Time) error {
+	cachePath, err := fastSkipCachePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(stamps, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", fastSkipCacheFile, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return os.WriteFile(cachePath, append(data, '\n'), 0644)
+}
+
+// isWorkdirCleanFast tells from a few os.Stat calls, without opening the repository, that a workdir
+// didn't change since lastChecked: the root directory and the git files that any git operation updates
+// are all older. In-place edits of existing files and changes in subdirectories aren't seen
+func isWorkdirCleanFast(workdirPath string, lastChecked time.Time) bool {
+	for _, stampPath := range fastSkipStampPaths {
+		info, err := os.Stat(filepath.Join(workdirPath, stampPath))
+		if os.IsNotExist(err) && stampPath != "." && stampPath != ".git/HEAD" {
+			// No index or reflog yet
+			continue
+		}
+		if err != nil || info.ModTime().After(lastChecked) {
+			return false
+		}
+	}
+	return true
+}
+
+// fastSkipWorkdirs drops the workdirs that didn't change since the last --skip-clean-workdirs-fast run
+// checked them, before anything is fetched or opened
+func fastSkipWorkdirs(workdirPaths []string, stamps map[string]time.Time) []string {
+	var remaining []string
+	for _, workdirPath := range workdirPaths {
+		lastChecked, exists := stamps[workdirPath]
+		if exists && isWorkdirCleanFast(workdirPath, lastChecked) {
+			fmt.Printf("Info: Skipping workdir %s: unchanged since %s (--skip-clean-workdirs-fast)\n", workdirPath, lastChecked.Format(time.RFC3339))
+			continue
+		}
+		remaining = append(remaining, workdirPath)
+	}
+	return remaining
+}
+
+// recordFastSkipStamps remembers runStart as the last check time of workdirs that are now up to date
+// Failed and skipped workdirs keep their previous time, so they are checked again
+func recordFastSkipStamps(stamps map[string]time.Time, checkResults []workdirCheckResult, runStart time.Time) error {
+	for _, checkResult := range checkResults {
+		if checkResult.Error != nil || checkResult.SkipReason != "" {
+			continue
+		}
+		stamps[checkResult.WorkdirPath] = runStart
+	}
+	return writeFastSkipStamps(stamps)
+}
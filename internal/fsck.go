@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// branchCheck is the result of checking the snapshot history of one wmem-br/<branch>
+type branchCheck struct {
+	branch string
+	tip    plumbing.Hash
+	// commits is the number of checked commits of the first-parent history
+	commits int
+	// problem describes the oldest broken commit, empty for a consistent history
+	problem string
+	// lastGood is the newest commit whose whole first-parent history is consistent, zero if there is none
+	lastGood plumbing.Hash
+	// dropped is the number of commits above lastGood
+	dropped int
+}
+
+// FsckWmem checks that every commit of every wmem-br/<branch> of the bare repos in repos/ has all its
+// objects (trees, blobs, parents), and with opts.Fix resets broken branches to their last good commit
+// Reference: docs/use-cases/git-wmem-fsck/basic.md
+func FsckWmem(opts FsckOptions) error {
+	if !isWmemRepo() {
+		return fmt.Errorf("not in a wmem repository (missing .git-wmem file). Run this command from a wmem-repo directory.")
+	}
+
+	if opts.Fix {
+		release, err := acquireWmemLock("fsck")
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	repoNames, err := listBareRepoNames()
+	if err != nil {
+		return err
+	}
+
+	broken, fixed, checked := 0, 0, 0
+	for _, repoName := range repoNames {
+		repoPath := filepath.Join("repos", repoName+".git")
+		repo, err := openBareRepo(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", repoPath, err)
+		}
+
+		checks, err := checkWmemBranches(repo)
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", repoPath, err)
+		}
+		repoFixed := false
+		for _, check := range checks {
+			checked++
+			if check.problem == "" {
+				fmt.Printf("%s: %s ok (%d commit(s))\n", repoPath, check.branch, check.commits)
+				continue
+			}
+			broken++
+			fmt.Printf("%s: %s broken: %s\n", repoPath, check.branch, check.problem)
+			if !opts.Fix {
+				continue
+			}
+			if check.lastGood.IsZero() {
+				fmt.Printf("%s: %s not fixed: no commit with a consistent history left, move %s away to let git-wmem commit recreate it\n", repoPath, check.branch, repoPath)
+				continue
+			}
+			ref := plumbing.NewHashReference(plumbing.ReferenceName("refs/heads/"+check.branch), check.lastGood)
+			if err := repo.Storer.SetReference(ref); err != nil {
+				return fmt.Errorf("failed to reset %s of %s: %w", check.branch, repoPath, err)
+			}
+			fixed++
+			repoFixed = true
+			fmt.Printf("%s: %s reset %s -> %s (last good commit, dropped %d snapshot(s))\n", repoPath, check.branch, abbrevHash(check.tip.String()), abbrevHash(check.lastGood.String()), check.dropped)
+		}
+
+		if repoFixed {
+			// wmem-br/head may point at a dropped snapshot
+			report, repaired, err := repairWmemHead(repo)
+			if err != nil {
+				return fmt.Errorf("failed to repair wmem-br/head of %s: %w", repoPath, err)
+			}
+			if repaired {
+				fmt.Printf("%s: %s\n", repoPath, report)
+			}
+		}
+	}
+
+	switch {
+	case broken == 0:
+		fmt.Printf("All %d wmem-br branch(es) consistent\n", checked)
+	case !opts.Fix:
+		return fmt.Errorf("found %d broken of %d wmem-br branch(es), run git-wmem fsck --fix to reset them to their last good commit", broken, checked)
+	case fixed < broken:
+		return fmt.Errorf("fixed %d of %d broken wmem-br branch(es)", fixed, broken)
+	default:
+		fmt.Printf("Fixed %d of %d wmem-br branch(es)\n", fixed, checked)
+	}
+	return nil
+}
+
+// checkWmemBranches checks the first-parent history of every wmem-br/<branch> of a bare repo, sorted by branch
+// wmem-br/head only follows the other branches and isn't checked on its own
+func checkWmemBranches(repo *git.Repository) ([]branchCheck, error) {
+	refs, err := listRefsWithPrefix(repo, "refs/heads/wmem-br/")
+	if err != nil {
+		return nil, err
+	}
+	delete(refs, wmemHeadRefName)
+
+	var checks []branchCheck
+	for name, tip := range refs {
+		check := checkSnapshotHistory(repo, tip)
+		check.branch = strings.TrimPrefix(name.String(), "refs/heads/")
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].branch < checks[j].branch
+	})
+	return checks, nil
+}
+
+// checkSnapshotHistory verifies the objects of every commit from tip along the first parents
+// A snapshot records the whole tree, not the changes, so a missing tree or blob can't be rebuilt;
+// the last good commit is the parent of the oldest broken commit
+func checkSnapshotHistory(repo *git.Repository, tip plumbing.Hash) branchCheck {
+	check := branchCheck{tip: tip}
+	visited := make(map[plumbing.Hash]bool)
+	var history []plumbing.Hash
+	oldestBroken := -1
+
+	for hash := tip; ; {
+		history = append(history, hash)
+		if _, err := verifyCommitObjectsSeen(repo, hash, visited); err != nil {
+			check.problem = err.Error()
+			oldestBroken = len(history) - 1
+			// Partially checked trees must be checked again for older commits
+			visited = make(map[plumbing.Hash]bool)
+		}
+		commit, err := repo.CommitObject(hash)
+		if err != nil || commit.NumParents() == 0 {
+			break
+		}
+		if _, err := repo.CommitObject(commit.ParentHashes[0]); err != nil {
+			// Already reported as a missing parent of commit
+			break
+		}
+		hash = commit.ParentHashes[0]
+	}
+
+	check.commits = len(history)
+	if oldestBroken >= 0 && oldestBroken+1 < len(history) {
+		check.lastGood = history[oldestBroken+1]
+		check.dropped = oldestBroken + 1
+	}
+	return check
+}
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// errFSMonitorUnavailable is returned when a workdir has no usable fsmonitor hook
+var errFSMonitorUnavailable = errors.New("fsmonitor unavailable")
+
+// detectChangesFromFSMonitor asks the fsmonitor hook of a workdir which paths changed since the
+// last snapshot and compares only those with the wmem-br/<current-branch-name> tip tree
+// Returns errFSMonitorUnavailable (wrapped) when the hook can't answer, the caller falls back
+// Reference: docs/use-cases/git-wmem-commit/basic.md#fsmonitor
+func detectChangesFromFSMonitor(workdirPath, workdirName, currentBranchName string) (bool, error) {
+	bareRepo, err := openBareRepo(workdirName)
+	if err != nil {
+		return false, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+	wmemBranchRef := plumbing.ReferenceName("refs/heads/" + wmemBranchNameFor(currentBranchName))
+	tipRef, err := bareRepo.Reference(wmemBranchRef, true)
+	if err != nil {
+		return false, fmt.Errorf("failed to get wmem branch reference: %w", err)
+	}
+	tip, err := bareRepo.CommitObject(tipRef.Hash())
+	if err != nil {
+		return false, fmt.Errorf("failed to get wmem commit: %w", err)
+	}
+	tipTree, err := tip.Tree()
+	if err != nil {
+		return false, fmt.Errorf("failed to get wmem tree: %w", err)
+	}
+
+	paths, err := queryFSMonitor(workdirPath, tip.Committer.When)
+	if err != nil {
+		return false, err
+	}
+	fmt.Printf("Debug: fsmonitor reported %d changed path(s) for %s\n", len(paths), workdirPath)
+
+	for _, changedPath := range paths {
+		changed, err := fsmonitorPathChanged(workdirPath, tipTree, changedPath)
+		if err != nil {
+			return false, err
+		}
+		if changed {
+			fmt.Printf("Debug: fsmonitor path %s differs from %s for %s\n", changedPath, wmemBranchNameFor(currentBranchName), workdirPath)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// queryFSMonitor runs the core.fsmonitor hook of a workdir and returns the paths it reports changed since
+// Hook protocol version 2 gets the time as token and prints its new token first, version 1 gets the time
+// in nanoseconds; without core.fsmonitorHookVersion version 2 is tried first, like git does
+// The builtin fsmonitor daemon (core.fsmonitor=true) isn't supported
+func queryFSMonitor(workdirPath string, since time.Time) ([]string, error) {
+	workdirRepo, err := git.PlainOpen(workdirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+	cfg, err := workdirRepo.Config()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workdir config: %w", err)
+	}
+	hook := cfg.Raw.Section("core").Option("fsmonitor")
+	switch strings.ToLower(hook) {
+	case "", "false":
+		return nil, fmt.Errorf("%w: core.fsmonitor not set", errFSMonitorUnavailable)
+	case "true":
+		return nil, fmt.Errorf("%w: the builtin fsmonitor daemon isn't supported, only hooks", errFSMonitorUnavailable)
+	}
+	if !filepath.IsAbs(hook) {
+		hook = filepath.Join(workdirPath, hook)
+	}
+
+	versions := []int{2, 1}
+	if version := cfg.Raw.Section("core").Option("fsmonitorHookVersion"); version != "" {
+		v, err := strconv.Atoi(version)
+		if err != nil || (v != 1 && v != 2) {
+			return nil, fmt.Errorf("%w: invalid core.fsmonitorHookVersion %q", errFSMonitorUnavailable, version)
+		}
+		versions = []int{v}
+	}
+
+	token := strconv.FormatInt(since.UnixNano(), 10)
+	var lastErr error
+	for _, version := range versions {
+		cmd := exec.Command(hook, strconv.Itoa(version), token)
+		cmd.Dir = workdirPath
+		output, err := cmd.Output()
+		if err != nil {
+			lastErr = fmt.Errorf("%w: hook %s (version %d) failed: %v", errFSMonitorUnavailable, hook, version, err)
+			continue
+		}
+		return parseFSMonitorOutput(output, version)
+	}
+	return nil, lastErr
+}
+
+// parseFSMonitorOutput splits the NUL separated hook output into workdir-relative paths
+// Version 2 output starts with the new token, which isn't needed as the next query uses the next snapshot time
+func parseFSMonitorOutput(output []byte, version int) ([]string, error) {
+	fields := bytes.Split(output, []byte{0})
+	if version == 2 {
+		if len(fields) == 0 || len(fields[0]) == 0 {
+			return nil, fmt.Errorf("%w: hook printed no token", errFSMonitorUnavailable)
+		}
+		fields = fields[1:]
+	}
+
+	var paths []string
+	for _, field := range fields {
+		changedPath := string(field)
+		switch {
+		case changedPath == "":
+			continue
+		case changedPath == "/":
+			// The hook lost track, everything may have changed
+			return nil, fmt.Errorf("%w: hook reported everything as changed", errFSMonitorUnavailable)
+		case changedPath == ".git" || strings.HasPrefix(changedPath, ".git/"):
+			continue
+		case strings.HasSuffix(changedPath, "/"):
+			return nil, fmt.Errorf("%w: hook reported directory %s", errFSMonitorUnavailable, changedPath)
+		}
+		paths = append(paths, changedPath)
+	}
+	return paths, nil
+}
+
+// fsmonitorPathChanged compares one reported path of the workdir with the snapshot tree
+func fsmonitorPathChanged(workdirPath string, tree *object.Tree, changedPath string) (bool, error) {
+	entry, err := tree.FindEntry(changedPath)
+	inTree := err == nil
+
+	filePath := filepath.Join(workdirPath, filepath.FromSlash(changedPath))
+	info, err := os.Lstat(filePath)
+	if os.IsNotExist(err) {
+		// Deleted since the snapshot, or created and deleted again
+		return inTree, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", changedPath, err)
+	}
+	if info.IsDir() {
+		// Files of a directory are reported on their own
+		return false, nil
+	}
+
+	if !inTree {
+		ignored, err := isPathIgnored(filepath.Dir(filePath), filepath.Base(filePath))
+		if err != nil {
+			return false, fmt.Errorf("failed to check gitignore for %s: %w", changedPath, err)
+		}
+		return !ignored, nil
+	}
+
+	var content []byte
+	mode := filemode.Regular
+	if info.Mode()&os.ModeSymlink != 0 {
+		mode = filemode.Symlink
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return false, fmt.Errorf("failed to read symlink %s: %w", changedPath, err)
+		}
+		content = []byte(target)
+	} else {
+		if info.Mode()&0111 != 0 {
+			mode = filemode.Executable
+		}
+		content, err = os.ReadFile(filePath)
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", changedPath, err)
+		}
+	}
+	return mode != entry.Mode || plumbing.ComputeHash(plumbing.BlobObject, content) != entry.Hash, nil
+}
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/idxfile"
+)
+
+// objectStats are the object count and on-disk size of the object store of a bare repo
+type objectStats struct {
+	Objects int
+	Size    int64
+}
+
+// GcWmem packs the objects of every bare repo in repos/ and reports the object count and size before and after
+// --aggressive repacks all reachable objects into a single pack and drops unreachable ones
+// Reference: docs/use-cases/git-wmem-gc/basic.md
+func GcWmem(opts GcOptions) error {
+	if !isWmemRepo() {
+		return fmt.Errorf("not in a wmem repository (missing .git-wmem file). Run this command from a wmem-repo directory.")
+	}
+
+	release, err := acquireWmemLock("gc")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	repoNames, err := listBareRepoNames()
+	if err != nil {
+		return err
+	}
+
+	var totalBefore, totalAfter objectStats
+	for _, repoName := range repoNames {
+		repoPath := filepath.Join("repos", repoName+".git")
+		before, err := readObjectStats(repoPath)
+		if err != nil {
+			return fmt.Errorf("failed to count objects of %s: %w", repoPath, err)
+		}
+
+		mode, err := gcBareRepo(repoName, opts.Aggressive)
+		if err != nil {
+			return fmt.Errorf("failed to gc %s: %w", repoPath, err)
+		}
+
+		after, err := readObjectStats(repoPath)
+		if err != nil {
+			return fmt.Errorf("failed to count objects of %s: %w", repoPath, err)
+		}
+		fmt.Printf("%s: %d objects, %s -> %d objects, %s (%s)\n", repoPath, before.Objects, formatSize(before.Size), after.Objects, formatSize(after.Size), mode)
+
+		totalBefore.Objects += before.Objects
+		totalBefore.Size += before.Size
+		totalAfter.Objects += after.Objects
+		totalAfter.Size += after.Size
+	}
+	fmt.Printf("Total: %d objects, %s -> %d objects, %s\n", totalBefore.Objects, formatSize(totalBefore.Size), totalAfter.Objects, formatSize(totalAfter.Size))
+	return nil
+}
+
+// listBareRepoNames returns the names of the bare repos in repos/ (without .git), sorted
+func listBareRepoNames() ([]string, error) {
+	entries, err := os.ReadDir("repos")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repos directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".git") {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".git"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// gcBareRepo packs one bare repo and returns how it was packed
+// Repos sharing objects (repos/_shared.git and the repos using it via alternates) only get their loose
+// objects packed: a full repack would copy shared objects into every repo or drop objects other repos need
+func gcBareRepo(repoName string, aggressive bool) (string, error) {
+	shared := repoName == sharedRepoName
+	if _, err := os.Stat(filepath.Join("repos", repoName+".git", "objects", "info", "alternates")); err == nil {
+		shared = true
+	}
+
+	if !aggressive || shared {
+		packed, err := compressBareRepo(repoName)
+		if err != nil {
+			return "", err
+		}
+		mode := fmt.Sprintf("packed %d loose object(s)", packed)
+		if aggressive {
+			mode += ", shared objects aren't repacked"
+		}
+		return mode, nil
+	}
+
+	repo, err := openBareRepo(repoName)
+	if err != nil {
+		return "", fmt.Errorf("failed to open bare repository: %w", err)
+	}
+	if err := repo.RepackObjects(&git.RepackConfig{}); err != nil {
+		return "", fmt.Errorf("failed to repack: %w", err)
+	}
+	return "repacked", nil
+}
+
+// readObjectStats counts the loose and packed objects of a bare repo and sums the size of its object store
+func readObjectStats(repoPath string) (objectStats, error) {
+	var stats objectStats
+	objectsDir := filepath.Join(repoPath, "objects")
+	err := filepath.WalkDir(objectsDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		stats.Size += info.Size()
+
+		relPath, err := filepath.Rel(objectsDir, path)
+		if err != nil {
+			return err
+		}
+		dir := filepath.Dir(relPath)
+		switch {
+		case len(dir) == 2:
+			// objects/ab/cdef... is one loose object
+			stats.Objects++
+		case dir == "pack" && strings.HasSuffix(relPath, ".idx"):
+			count, err := countPackIndexObjects(path)
+			if err != nil {
+				return err
+			}
+			stats.Objects += count
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// countPackIndexObjects reads the object count of a pack index
+func countPackIndexObjects(idxPath string) (int, error) {
+	f, err := os.Open(idxPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	idx := idxfile.NewMemoryIndex()
+	if err := idxfile.NewDecoder(f).Decode(idx); err != nil {
+		return 0, fmt.Errorf("failed to read pack index %s: %w", idxPath, err)
+	}
+	count, err := idx.Count()
+	return int(count), err
+}
+
+// formatSize renders a size in bytes with a binary unit (B, KiB, MiB, GiB)
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size) / unit
+	for _, suffix := range []string{"KiB", "MiB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f GiB", value)
+}
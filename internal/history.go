@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// fileSnapshot is a workdir snapshot commit that changed the followed file
+type fileSnapshot struct {
+	Commit *object.Commit
+	// RenamedFrom is the previous path of the file if this commit renamed it
+	RenamedFrom string
+	Patch       string
+}
+
+// HistoryWmem prints the snapshots of one workdir where the content of a file changed
+// Reference: docs/use-cases/git-wmem-history/basic.md
+func HistoryWmem(workdirName, filePath string, opts HistoryOptions) error {
+	if !isWmemRepo() {
+		return fmt.Errorf("not in a wmem repository (missing .git-wmem file). Run this command from a wmem-repo directory.")
+	}
+
+	workdirMap, err := readWorkdirMap()
+	if err != nil {
+		return fmt.Errorf("failed to read workdir map: %w", err)
+	}
+	if _, exists := workdirMap[workdirName]; !exists {
+		return fmt.Errorf("unknown workdir %s (not in md-internal/workdir-map.json)", workdirName)
+	}
+
+	filePath = path.Clean(strings.TrimPrefix(filePath, "./"))
+
+	branchName := opts.Branch
+	if branchName == "" {
+		branchName = "head"
+	}
+	tip, err := wmemBranchTip(workdirName, branchName)
+	if err != nil {
+		return fmt.Errorf("failed to read %s of %s: %w", wmemBranchNameFor(branchName), workdirName, err)
+	}
+
+	repo, err := openBareRepo(workdirName)
+	if err != nil {
+		return fmt.Errorf("failed to open bare repository: %w", err)
+	}
+
+	snapshots, err := collectFileSnapshots(repo, tip, filePath, opts.Patch)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return fmt.Errorf("%s was never changed on %s of %s", filePath, wmemBranchNameFor(branchName), workdirName)
+	}
+
+	for _, snapshot := range snapshots {
+		displayFileSnapshot(snapshot, opts)
+	}
+	return nil
+}
+
+// displayFileSnapshot prints one snapshot line "<wmem-uid> <date> <hash>" and its optional diff
+// Commits fetched from the workdir have no wmem-uid and show "-" instead
+func displayFileSnapshot(snapshot fileSnapshot, opts HistoryOptions) {
+	commit := snapshot.Commit
+	wmemUID := extractWmemUID(commit.Message)
+	if wmemUID == "" {
+		wmemUID = "-"
+	}
+
+	line := fmt.Sprintf("%s %s %s", wmemUID, commit.Author.When.Format("2006-01-02 15:04:05 -0700"), abbrevHash(commit.Hash.String()))
+	if commit.NumParents() > 1 {
+		line += " (merge)"
+	}
+	if snapshot.RenamedFrom != "" {
+		line += fmt.Sprintf(" (renamed from %s)", snapshot.RenamedFrom)
+	}
+	fmt.Println(line)
+
+	if opts.Patch {
+		fmt.Print(snapshot.Patch)
+		fmt.Println()
+	}
+}
+
+// collectFileSnapshots walks the first-parent history from tip and returns the commits that changed filePath, oldest first
+// Renames are followed best-effort via go-git rename detection when the file first appears at its path
+func collectFileSnapshots(repo *git.Repository, tip plumbing.Hash, filePath string, withPatch bool) ([]fileSnapshot, error) {
+	var snapshots []fileSnapshot
+
+	commit, err := repo.CommitObject(tip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", tip, err)
+	}
+	for commit != nil {
+		tree, err := commit.Tree()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tree of %s: %w", commit.Hash, err)
+		}
+
+		var parent *object.Commit
+		parentTree := &object.Tree{}
+		if commit.NumParents() > 0 {
+			parent, err = commit.Parent(0)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get parent of %s: %w", commit.Hash, err)
+			}
+			parentTree, err = parent.Tree()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get tree of %s: %w", parent.Hash, err)
+			}
+		}
+
+		currentHash, err := fileBlobHash(tree, filePath)
+		if err != nil {
+			return nil, err
+		}
+		parentHash, err := fileBlobHash(parentTree, filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		if currentHash != parentHash {
+			snapshot := fileSnapshot{Commit: commit}
+			var fileChanges object.Changes
+			if withPatch || (parentHash.IsZero() && parent != nil) {
+				fileChanges, err = fileTreeChanges(parentTree, tree, filePath)
+				if err != nil {
+					return nil, fmt.Errorf("failed to diff %s in %s: %w", filePath, commit.Hash, err)
+				}
+			}
+
+			previousPath := filePath
+			for _, change := range fileChanges {
+				if change.To.Name == filePath && change.From.Name != "" && change.From.Name != filePath {
+					previousPath = change.From.Name
+					snapshot.RenamedFrom = previousPath
+				}
+			}
+
+			// A pure rename keeps the content and is only followed, not listed
+			previousHash, err := fileBlobHash(parentTree, previousPath)
+			if err != nil {
+				return nil, err
+			}
+			if previousHash != currentHash || snapshot.RenamedFrom == "" {
+				if withPatch {
+					patch, err := fileChanges.Patch()
+					if err != nil {
+						return nil, fmt.Errorf("failed to create patch of %s in %s: %w", filePath, commit.Hash, err)
+					}
+					snapshot.Patch = patch.String()
+				}
+				snapshots = append(snapshots, snapshot)
+			}
+			filePath = previousPath
+		}
+		commit = parent
+	}
+
+	// Oldest snapshot first
+	for i, j := 0, len(snapshots)-1; i < j; i, j = i+1, j-1 {
+		snapshots[i], snapshots[j] = snapshots[j], snapshots[i]
+	}
+	return snapshots, nil
+}
+
+// fileBlobHash returns the blob hash of filePath in tree, or the zero hash if the file doesn't exist
+func fileBlobHash(tree *object.Tree, filePath string) (plumbing.Hash, error) {
+	if len(tree.Entries) == 0 {
+		return plumbing.ZeroHash, nil
+	}
+	entry, err := tree.FindEntry(filePath)
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return plumbing.ZeroHash, nil
+	}
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to find %s: %w", filePath, err)
+	}
+	if !entry.Mode.IsFile() {
+		return plumbing.ZeroHash, nil
+	}
+	return entry.Hash, nil
+}
+
+// fileTreeChanges returns the changes between two trees that touch filePath, with renames detected
+func fileTreeChanges(fromTree, toTree *object.Tree, filePath string) (object.Changes, error) {
+	changes, err := object.DiffTreeWithOptions(context.Background(), fromTree, toTree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileChanges object.Changes
+	for _, change := range changes {
+		if change.From.Name == filePath || change.To.Name == filePath {
+			fileChanges = append(fileChanges, change)
+		}
+	}
+	return fileChanges, nil
+}
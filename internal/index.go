@@ -0,0 +1,451 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// indexTreeNode is a directory level of the tree being built from a workdir index
+type indexTreeNode struct {
+	entries  []object.TreeEntry
+	children map[string]*indexTreeNode
+}
+
+// createTreeFromIndex creates a tree in targetRepo from the workdir index (staged state)
+// The result is the same tree `git write-tree` would create in the workdir
+// Reference: docs/use-cases/git-wmem-commit/basic.md#alternatives (6c)
+func createTreeFromIndex(workdirPath string, targetRepo *git.Repository) (plumbing.Hash, error) {
+	workdirRepo, err := git.PlainOpen(workdirPath)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+
+	idx, err := workdirRepo.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to read workdir index: %w", err)
+	}
+
+	root := &indexTreeNode{children: make(map[string]*indexTreeNode)}
+	for _, entry := range idx.Entries {
+		// Stage 0 is a fully merged entry (go-git's index.Merged constant is 1, so it can't be used here)
+		if entry.Stage != 0 {
+			return plumbing.ZeroHash, fmt.Errorf("workdir index has unresolved conflicts (%s)", entry.Name)
+		}
+		if entry.IntentToAdd {
+			// Like git write-tree, intent-to-add entries are not part of the tree
+			continue
+		}
+
+		// Gitlinks point to commits of other repositories, only blobs are copied
+		if entry.Mode != filemode.Submodule {
+			if err := copyBlobObject(workdirRepo, targetRepo, entry.Hash); err != nil {
+				return plumbing.ZeroHash, fmt.Errorf("failed to copy blob for %s: %w", entry.Name, err)
+			}
+		}
+
+		root.add(entry.Name, entry.Mode, entry.Hash)
+	}
+
+	return writeIndexTreeNode(targetRepo, root)
+}
+
+// add places a file entry at its slash-separated path below the node
+func (node *indexTreeNode) add(entryPath string, mode filemode.FileMode, hash plumbing.Hash) {
+	dir, name := path.Split(entryPath)
+	if dir != "" {
+		for _, part := range strings.Split(strings.TrimSuffix(dir, "/"), "/") {
+			child, exists := node.children[part]
+			if !exists {
+				child = &indexTreeNode{children: make(map[string]*indexTreeNode)}
+				node.children[part] = child
+			}
+			node = child
+		}
+	}
+	node.entries = append(node.entries, object.TreeEntry{Name: name, Mode: mode, Hash: hash})
+}
+
+// writeIndexTreeNode stores a tree node and all its subtrees, returning the tree hash
+func writeIndexTreeNode(repo *git.Repository, node *indexTreeNode) (plumbing.Hash, error) {
+	treeEntries := append([]object.TreeEntry{}, node.entries...)
+	for name, child := range node.children {
+		childHash, err := writeIndexTreeNode(repo, child)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		treeEntries = append(treeEntries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: childHash})
+	}
+
+	// Git orders tree entries as if directory names had a trailing slash
+	sort.Slice(treeEntries, func(i, j int) bool {
+		return gitTreeSortKey(treeEntries[i]) < gitTreeSortKey(treeEntries[j])
+	})
+
+	tree := &object.Tree{Entries: treeEntries}
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.TreeObject)
+	if err := tree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to encode tree object: %w", err)
+	}
+
+	treeHash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to store tree object: %w", err)
+	}
+	return treeHash, nil
+}
+
+// gitTreeSortKey returns the name git uses to order a tree entry
+func gitTreeSortKey(entry object.TreeEntry) string {
+	if entry.Mode == filemode.Dir {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+// checkModifiedIndex implements step 6 of UC: sync-workdir for --snapshot-index
+// Compares the workdir index tree with wmem-repo's wmem-br/<current-branch-name> branch
+func checkModifiedIndex(workdirPath, workdirName, currentBranchName string) (bool, error) {
+	bareRepo, err := openBareRepo(workdirName)
+	if err != nil {
+		return false, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+
+	wmemBranchRef := plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", wmemBranchNameFor(currentBranchName)))
+	wmemBranchHashRef, err := bareRepo.Reference(wmemBranchRef, true)
+	if err != nil {
+		return false, fmt.Errorf("failed to get wmem branch reference: %w", err)
+	}
+
+	wmemCommit, err := bareRepo.CommitObject(wmemBranchHashRef.Hash())
+	if err != nil {
+		return false, fmt.Errorf("failed to get wmem commit: %w", err)
+	}
+
+	indexTreeHash, err := createTreeFromIndex(workdirPath, bareRepo)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("Debug: Index tree %s vs wmem tree %s for %s\n", abbrevHash(indexTreeHash.String()), abbrevHash(wmemCommit.TreeHash.String()), workdirPath)
+	return indexTreeHash != wmemCommit.TreeHash, nil
+}
+
+// wmemIndexBranchNameFor returns the wmem-br/<branch>-index branch of --snapshot-worktree-and-index
+func wmemIndexBranchNameFor(branchName string) string {
+	return wmemBranchNameFor(branchName) + "-index"
+}
+
+// checkIndexBranchCollision fails when the current workdir branch and another local branch map to the same
+// wmem-br name through the index branch, e.g. main and main-index (--snapshot-worktree-and-index)
+// Reference: docs/use-cases/git-wmem-commit/basic.md#worktree-and-index
+func checkIndexBranchCollision(workdirPath string) error {
+	repo, err := git.PlainOpen(workdirPath)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		// Missing workdirs are reported by the regular workdir checks
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open repository %s: %w", workdirPath, err)
+	}
+	head, err := repo.Head()
+	if err != nil || !head.Name().IsBranch() {
+		// Unborn or detached HEAD, no index branch
+		return nil
+	}
+	current := head.Name().Short()
+
+	branches, err := repo.Branches()
+	if err != nil {
+		return fmt.Errorf("failed to list branches of %s: %w", workdirPath, err)
+	}
+	return branches.ForEach(func(ref *plumbing.Reference) error {
+		other := ref.Name().Short()
+		if wmemBranchNameFor(other) == wmemIndexBranchNameFor(current) {
+			return fmt.Errorf("workdir %s has a branch %s, %s can't also hold the index snapshots of %s (--snapshot-worktree-and-index)", workdirPath, other, wmemIndexBranchNameFor(current), current)
+		}
+		if wmemIndexBranchNameFor(other) == wmemBranchNameFor(current) {
+			return fmt.Errorf("workdir %s has a branch %s, %s can't also hold the working tree snapshots of %s (--snapshot-worktree-and-index)", workdirPath, other, wmemBranchNameFor(current), current)
+		}
+		return nil
+	})
+}
+
+// commitWorkdirIndex records the workdir index on wmem-br/<current-branch-name>-index next to the
+// working tree snapshot on wmem-br/<current-branch-name> (--snapshot-worktree-and-index)
+// The first index snapshot starts from the wmem-br/<current-branch-name> tip, an index equal to the
+// previous index snapshot creates no commit and zero hash is returned
+// Reference: docs/use-cases/git-wmem-commit/basic.md#worktree-and-index
+func commitWorkdirIndex(workdirPath, workdirName, currentBranchName string, commitInfo *CommitInfo, opts CommitOptions) (plumbing.Hash, error) {
+	bareRepo, err := openBareRepo(workdirName)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+
+	indexTreeHash, err := createTreeFromIndex(workdirPath, bareRepo)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to create tree from workdir index: %w", err)
+	}
+
+	indexBranchRef := plumbing.ReferenceName("refs/heads/" + wmemIndexBranchNameFor(currentBranchName))
+	parentRef, err := bareRepo.Reference(indexBranchRef, true)
+	if err == plumbing.ErrReferenceNotFound {
+		parentRef, err = bareRepo.Reference(plumbing.ReferenceName("refs/heads/"+wmemBranchNameFor(currentBranchName)), true)
+	}
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to get wmem branch reference: %w", err)
+	}
+	parent, err := bareRepo.CommitObject(parentRef.Hash())
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to get wmem commit: %w", err)
+	}
+
+	if parent.TreeHash == indexTreeHash {
+		if parentRef.Name() != indexBranchRef {
+			// Nothing staged or unstaged beyond the working tree snapshot, the index branch starts at it
+			if err := bareRepo.Storer.SetReference(plumbing.NewHashReference(indexBranchRef, parent.Hash)); err != nil {
+				return plumbing.ZeroHash, fmt.Errorf("failed to create %s: %w", indexBranchRef.Short(), err)
+			}
+		}
+		return plumbing.ZeroHash, nil
+	}
+
+	author, committer, err := parseCommitSignatures(commitInfo, time.Time{}, time.Time{}, opts)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to parse commit signatures: %w", err)
+	}
+	if opts.AuthorFromWorkdirHead {
+		if err := setAuthorFromWorkdirHead(author, workdirPath); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	commit := &object.Commit{
+		Message:      commitInfo.Message + workdirBranchNote(currentBranchName) + "\n\nSnapshot of workdir index (staged changes only)",
+		TreeHash:     indexTreeHash,
+		ParentHashes: []plumbing.Hash{parent.Hash},
+		Author:       *author,
+		Committer:    *committer,
+	}
+	obj := bareRepo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to encode commit: %w", err)
+	}
+	commitHash, err := bareRepo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to store commit: %w", err)
+	}
+	if err := bareRepo.Storer.SetReference(plumbing.NewHashReference(indexBranchRef, commitHash)); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to update %s: %w", indexBranchRef.Short(), err)
+	}
+	return commitHash, nil
+}
+
+// detectChangesFromIndex implements --index-only-detection
+// Like git status, it trusts the stat data cached in the workdir index and only hashes files whose stat changed
+// stale is true when index entries carry no stat data (e.g. written by `git read-tree`), callers then fall back to the other checks
+// Reference: docs/use-cases/git-wmem-commit/basic.md#index-only-detection
+func detectChangesFromIndex(workdirPath string) (changed bool, stale bool, err error) {
+	workdirRepo, err := git.PlainOpen(workdirPath)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+	gitDir, err := workdirGitDir(workdirPath)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to find workdir git directory: %w", err)
+	}
+	indexInfo, err := os.Stat(filepath.Join(gitDir, "index"))
+	if err != nil {
+		return false, false, fmt.Errorf("failed to stat workdir index: %w", err)
+	}
+	idx, err := workdirRepo.Storer.Index()
+	if err != nil {
+		return false, false, fmt.Errorf("failed to read workdir index: %w", err)
+	}
+
+	// Staged changes: index vs HEAD tree
+	staged, err := indexDiffersFromHead(workdirRepo, idx)
+	if err != nil {
+		return false, false, err
+	}
+	if staged {
+		return true, false, nil
+	}
+
+	// Unstaged changes: index vs working tree
+	tracked := make(map[string]bool, len(idx.Entries))
+	submodules := make(map[string]bool)
+	for _, entry := range idx.Entries {
+		tracked[entry.Name] = true
+		if entry.Mode == filemode.Submodule {
+			submodules[entry.Name] = true
+			continue
+		}
+		if entry.SkipWorktree {
+			continue
+		}
+		if entry.ModifiedAt.IsZero() {
+			return false, true, nil
+		}
+
+		entryChanged, err := indexEntryChanged(workdirPath, entry, indexInfo.ModTime())
+		if err != nil {
+			return false, false, err
+		}
+		if entryChanged {
+			return true, false, nil
+		}
+	}
+
+	// Untracked files not covered by .gitignore
+	untracked, err := hasUntrackedFiles(workdirPath, tracked, submodules)
+	if err != nil {
+		return false, false, err
+	}
+	return untracked, false, nil
+}
+
+// indexDiffersFromHead compares index entries with the files of the HEAD tree
+func indexDiffersFromHead(workdirRepo *git.Repository, idx *index.Index) (bool, error) {
+	headFiles := make(map[string]object.TreeEntry)
+	headRef, err := workdirRepo.Head()
+	if err == nil {
+		headCommit, err := workdirRepo.CommitObject(headRef.Hash())
+		if err != nil {
+			return false, fmt.Errorf("failed to get HEAD commit: %w", err)
+		}
+		headTree, err := headCommit.Tree()
+		if err != nil {
+			return false, fmt.Errorf("failed to get HEAD tree: %w", err)
+		}
+		walker := object.NewTreeWalker(headTree, true, nil)
+		defer walker.Close()
+		for {
+			name, entry, err := walker.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return false, fmt.Errorf("failed to walk HEAD tree: %w", err)
+			}
+			if entry.Mode != filemode.Dir {
+				headFiles[name] = entry
+			}
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return false, fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	if len(headFiles) != len(idx.Entries) {
+		return true, nil
+	}
+	for _, entry := range idx.Entries {
+		headEntry, exists := headFiles[entry.Name]
+		// Unmerged and intent-to-add entries are reported by git status too
+		if !exists || entry.Stage != 0 || entry.IntentToAdd || headEntry.Hash != entry.Hash || headEntry.Mode != entry.Mode {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// indexEntryChanged checks a single index entry against the working tree
+// A stat match is trusted unless the entry is racily clean (modified no earlier than the index was written)
+func indexEntryChanged(workdirPath string, entry *index.Entry, indexModTime time.Time) (bool, error) {
+	filePath := filepath.Join(workdirPath, filepath.FromSlash(entry.Name))
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to stat %s: %w", entry.Name, err)
+	}
+
+	mode, err := filemode.NewFromOSFileMode(info.Mode())
+	if err != nil || mode != entry.Mode {
+		return true, nil
+	}
+
+	racy := !entry.ModifiedAt.Before(indexModTime)
+	if !racy && info.Size() == int64(entry.Size) && info.ModTime().Equal(entry.ModifiedAt) {
+		return false, nil
+	}
+
+	// Stat changed or can't be trusted, the content decides (e.g. touched but identical files)
+	var content []byte
+	if mode == filemode.Symlink {
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return false, fmt.Errorf("failed to read symlink %s: %w", entry.Name, err)
+		}
+		content = []byte(target)
+	} else {
+		content, err = os.ReadFile(filePath)
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", entry.Name, err)
+		}
+	}
+	return plumbing.ComputeHash(plumbing.BlobObject, content) != entry.Hash, nil
+}
+
+// hasUntrackedFiles walks the working tree for files that are neither in the index nor ignored
+func hasUntrackedFiles(workdirPath string, tracked, submodules map[string]bool) (bool, error) {
+	patterns, err := gitignore.ReadPatterns(osfs.New(workdirPath), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to read gitignore patterns: %w", err)
+	}
+	matcher := gitignore.NewMatcher(patterns)
+
+	found := false
+	err = filepath.WalkDir(workdirPath, func(walkPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if walkPath == workdirPath {
+			return nil
+		}
+		relPath, err := filepath.Rel(workdirPath, walkPath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if d.Name() == ".git" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if submodules[relPath] || matcher.Match(strings.Split(relPath, "/"), true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if tracked[relPath] || matcher.Match(strings.Split(relPath, "/"), false) {
+			return nil
+		}
+		found = true
+		return filepath.SkipAll
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to walk working tree: %w", err)
+	}
+	return found, nil
+}
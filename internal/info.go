@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// InfoWmem prints a summary of the wmem-repo: workdirs, snapshots in the bare repos, the last
+// git-wmem commit, the on-disk size of repos/ and cache/ and the configured author and committer
+// Reference: docs/use-cases/git-wmem-info/basic.md
+func InfoWmem() error {
+	if !isWmemRepo() {
+		return fmt.Errorf("not in a wmem repository (missing .git-wmem file). Run this command from a wmem-repo directory.")
+	}
+
+	workdirMap, err := readWorkdirMap()
+	if err != nil {
+		return fmt.Errorf("failed to read workdir map: %w", err)
+	}
+	fmt.Printf("Workdirs: %d\n", len(workdirMap))
+
+	repoNames, err := listBareRepoNames()
+	if err != nil {
+		return err
+	}
+	snapshots := 0
+	for _, repoName := range repoNames {
+		repo, err := openBareRepo(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to open repos/%s.git: %w", repoName, err)
+		}
+		count, err := countSnapshotCommits(repo)
+		if err != nil {
+			return fmt.Errorf("failed to count snapshots of repos/%s.git: %w", repoName, err)
+		}
+		snapshots += count
+	}
+	fmt.Printf("Snapshots: %d in %d bare repo(s)\n", snapshots, len(repoNames))
+
+	last, err := lastWmemCommit()
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		fmt.Printf("Last commit: none yet\n")
+	} else {
+		fmt.Printf("Last commit: %s %s\n", last.Committer.When.Format("2006-01-02 15:04:05 -0700"), extractWmemUID(last.Message))
+	}
+
+	for _, dir := range []string{"repos", cacheDirName} {
+		size, err := diskUsage(dir)
+		if err != nil {
+			return fmt.Errorf("failed to get the size of %s/: %w", dir, err)
+		}
+		fmt.Printf("Size of %s/: %s\n", dir, formatSize(size))
+	}
+
+	for _, identity := range []struct{ label, path string }{{"Author", "md/commit/author"}, {"Committer", "md/commit/committer"}} {
+		content, err := os.ReadFile(identity.path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", identity.path, err)
+		}
+		fmt.Printf("%s: %s\n", identity.label, strings.TrimSpace(string(content)))
+	}
+	return nil
+}
+
+// countSnapshotCommits counts the commits with a wmem-uid in the first-parent histories of the
+// wmem-br/<branch> branches of a bare repo, commits shared by several branches count once
+// Workdir commits (the start of each wmem-br and the second parents of merges) have no wmem-uid
+func countSnapshotCommits(repo *git.Repository) (int, error) {
+	refs, err := listRefsWithPrefix(repo, "refs/heads/wmem-br/")
+	if err != nil {
+		return 0, err
+	}
+	delete(refs, wmemHeadRefName)
+
+	seen := make(map[plumbing.Hash]bool)
+	count := 0
+	for _, tip := range refs {
+		for hash := tip; !seen[hash]; {
+			seen[hash] = true
+			commit, err := repo.CommitObject(hash)
+			if err != nil {
+				return 0, fmt.Errorf("failed to get commit %s: %w", hash, err)
+			}
+			if extractWmemUID(commit.Message) != "" {
+				count++
+			}
+			if commit.NumParents() == 0 {
+				break
+			}
+			hash = commit.ParentHashes[0]
+		}
+	}
+	return count, nil
+}
+
+// lastWmemCommit returns the newest wmem-repo commit with a wmem-uid, nil before the first git-wmem commit
+func lastWmemCommit() (*object.Commit, error) {
+	repo, err := git.PlainOpen(".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wmem repository: %w", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wmem-repo HEAD: %w", err)
+	}
+	commitIter, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit log: %w", err)
+	}
+	defer commitIter.Close()
+
+	var last *object.Commit
+	err = commitIter.ForEach(func(commit *object.Commit) error {
+		if extractWmemUID(commit.Message) == "" {
+			return nil
+		}
+		last = commit
+		return storer.ErrStop
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to process commits: %w", err)
+	}
+	return last, nil
+}
+
+// diskUsage returns the total size of the regular files below dir, 0 when dir doesn't exist
+func diskUsage(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && os.IsNotExist(err) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
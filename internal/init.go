@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5"
@@ -13,7 +14,13 @@ import (
 
 // InitWmemRepo initializes a new wmem repository
 // Reference: docs/use-cases/git-wmem-init/basic.md#main-scenario
-func InitWmemRepo(targetDir string) error {
+func InitWmemRepo(targetDir string, opts InitOptions) error {
+	for _, pattern := range opts.GitignoreExtra {
+		if strings.TrimSpace(pattern) == "" || strings.ContainsAny(pattern, "\r\n") {
+			return fmt.Errorf("invalid --gitignore-extra %q", pattern)
+		}
+	}
+
 	// Check if directory exists and if it should be created
 	if targetDir == "." {
 		// Current directory case - check if empty
@@ -65,16 +72,27 @@ func InitWmemRepo(targetDir string) error {
 	}
 
 	// Create the directory structure
-	if err := createWmemStructure(); err != nil {
+	if err := createWmemStructure(opts.GitignoreExtra); err != nil {
 		return fmt.Errorf("failed to create wmem structure: %w", err)
 	}
 
+	if opts.BareReposShared {
+		if err := createSharedRepo(); err != nil {
+			return err
+		}
+	}
+
 	// Initialize git repository
 	repo, err := git.PlainInit(workDir, false)
 	if err != nil {
 		return fmt.Errorf("failed to initialize git repository: %w", err)
 	}
 
+	if opts.NoCommit {
+		// md/ files can be seeded before the first git-wmem commit
+		return nil
+	}
+
 	// Create initial commit
 	if err := createInitialCommit(repo, filepath.Base(workDir)); err != nil {
 		return fmt.Errorf("failed to create initial commit: %w", err)
@@ -83,15 +101,22 @@ func InitWmemRepo(targetDir string) error {
 	return nil
 }
 
+// defaultIdentity is the placeholder author and committer of md/commit/ written by git-wmem init
+const defaultIdentity = "WMem Git <git-wmem@mj41.cz>"
+
 // createWmemStructure creates the directory structure for wmem repository
-func createWmemStructure() error {
+// gitignoreExtra patterns (--gitignore-extra) are appended to the default .gitignore
+func createWmemStructure(gitignoreExtra []string) error {
 	// Create .git-wmem marker file
 	if err := os.WriteFile(".git-wmem", []byte(""), 0644); err != nil {
 		return fmt.Errorf("failed to create .git-wmem file: %w", err)
 	}
 
-	// Create .gitignore
-	gitignoreContent := "repos/\n"
+	// Create .gitignore, the persisted caches of git-wmem commit are never committed
+	gitignoreContent := "repos/\ncache/\n"
+	for _, pattern := range gitignoreExtra {
+		gitignoreContent += pattern + "\n"
+	}
 	if err := os.WriteFile(".gitignore", []byte(gitignoreContent), 0644); err != nil {
 		return fmt.Errorf("failed to create .gitignore: %w", err)
 	}
@@ -104,13 +129,18 @@ func createWmemStructure() error {
 		}
 	}
 
+	workdirMapContent, err := encodeWorkdirMap(WorkdirMap{})
+	if err != nil {
+		return fmt.Errorf("failed to encode workdir map: %w", err)
+	}
+
 	// Create metadata files
 	files := map[string]string{
 		"md/commit-workdir-paths":      "",
 		"md/commit/msg-prefix":         "",
-		"md/commit/author":             "WMem Git <git-wmem@mj41.cz>",
-		"md/commit/committer":          "WMem Git <git-wmem@mj41.cz>",
-		"md-internal/workdir-map.json": "{}",
+		"md/commit/author":             defaultIdentity,
+		"md/commit/committer":          defaultIdentity,
+		"md-internal/workdir-map.json": string(workdirMapContent),
 	}
 
 	for filePath, content := range files {
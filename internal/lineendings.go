@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+)
+
+// binarySniffLen is how much of a file is checked for NUL bytes to tell binary from text, like git
+const binarySniffLen = 8000
+
+// lineEndingPolicy normalizes CRLF to LF in snapshot blobs of one workdir (--normalize-line-endings)
+// .gitattributes of the workdir decide like core.autocrlf does in git: text or eol normalizes,
+// -text or binary never does, text=auto and unspecified files are normalized unless they look binary
+// Reference: docs/use-cases/git-wmem-commit/basic.md#line-endings
+type lineEndingPolicy struct {
+	root    string
+	matcher gitattributes.Matcher
+}
+
+// newLineEndingPolicy reads the .gitattributes files of the workdir at root
+func newLineEndingPolicy(root string) (*lineEndingPolicy, error) {
+	// binary is a builtin macro in git, go-git only knows macros defined in .gitattributes
+	binaryMacro, err := gitattributes.ParseAttributesLine("[attr]binary -diff -merge -text", nil, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to define the binary attribute macro: %w", err)
+	}
+	patterns, err := gitattributes.ReadPatterns(osfs.New(root), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gitattributes of %s: %w", root, err)
+	}
+	stack := append([]gitattributes.MatchAttribute{binaryMacro}, patterns...)
+	return &lineEndingPolicy{root: root, matcher: gitattributes.NewMatcher(stack)}, nil
+}
+
+// apply returns the content to store for the file at filePath
+// A nil policy (no --normalize-line-endings) keeps all content as is
+func (p *lineEndingPolicy) apply(filePath string, content []byte) []byte {
+	if p == nil || !bytes.Contains(content, []byte("\r\n")) {
+		return content
+	}
+
+	relPath, err := filepath.Rel(p.root, filePath)
+	if err != nil {
+		return content
+	}
+	attrs, _ := p.matcher.Match(strings.Split(filepath.ToSlash(relPath), "/"), []string{"text", "eol"})
+
+	text, eol := attrs["text"], attrs["eol"]
+	switch {
+	case text != nil && text.IsUnset():
+		return content
+	case text != nil && text.IsSet(), text == nil && eol != nil && eol.IsValueSet():
+		// Declared text, even with NUL bytes
+	case isBinaryContent(content):
+		return content
+	}
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+}
+
+// isBinaryContent tells binary from text content the way git does: a NUL byte in the first 8000 bytes
+func isBinaryContent(content []byte) bool {
+	if len(content) > binarySniffLen {
+		content = content[:binarySniffLen]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
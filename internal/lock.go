@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// wmemLockPath is the lock held by git-wmem commands writing to repos/, inside the .git directory of the
+// wmem-repo so it is never committed or snapshotted
+// Reference: docs/validations.md#wmem-repo-lock
+var wmemLockPath = filepath.Join(".git", "git-wmem.lock")
+
+// acquireWmemLock takes the wmem-repo lock for command, so git-wmem commit and gc never run concurrently
+// The lock appears with its "<pid> <command>" line already in it (hard link of a written temp file),
+// a lock left by a process that no longer runs is taken over with a warning
+// Returns the function releasing the lock
+func acquireWmemLock(command string) (func(), error) {
+	tmpFile, err := os.CreateTemp(filepath.Dir(wmemLockPath), filepath.Base(wmemLockPath)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", wmemLockPath, err)
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = fmt.Fprintf(tmpFile, "%d %s\n", os.Getpid(), command)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", wmemLockPath, err)
+	}
+
+	unlockGuard, err := lockWmemLockGuard()
+	if err != nil {
+		return nil, err
+	}
+	defer unlockGuard()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		err := os.Link(tmpFile.Name(), wmemLockPath)
+		if err == nil {
+			return releaseWmemLock, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create %s: %w", wmemLockPath, err)
+		}
+
+		pid, holder, err := readWmemLock()
+		if err != nil {
+			// Never stale, git-wmem writes no lock without its pid
+			return nil, fmt.Errorf("%w. Remove it if no git-wmem is running", err)
+		}
+		if isProcessRunning(pid) {
+			return nil, fmt.Errorf("another git-wmem %s is running (pid %d, %s), try again later", holder, pid, wmemLockPath)
+		}
+		printWarning("Removing stale %s left by git-wmem %s (pid %d is not running)\n", wmemLockPath, holder, pid)
+		if err := os.Remove(wmemLockPath); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale %s: %w", wmemLockPath, err)
+		}
+	}
+	return nil, fmt.Errorf("failed to acquire %s", wmemLockPath)
+}
+
+// releaseWmemLock removes the lock if it is still the lock of this process
+func releaseWmemLock() {
+	unlockGuard, err := lockWmemLockGuard()
+	if err != nil {
+		return
+	}
+	defer unlockGuard()
+	if pid, _, err := readWmemLock(); err == nil && pid == os.Getpid() {
+		os.Remove(wmemLockPath)
+	}
+}
+
+// lockWmemLockGuard serializes the creation, stale takeover and release of the lock between processes,
+// so no process removes a lock another one just created
+// The guard file stays, the kernel releases its flock when a process dies
+func lockWmemLockGuard() (func(), error) {
+	guardPath := wmemLockPath + ".guard"
+	guard, err := os.OpenFile(guardPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", guardPath, err)
+	}
+	if err := syscall.Flock(int(guard.Fd()), syscall.LOCK_EX); err != nil {
+		guard.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", guardPath, err)
+	}
+	return func() {
+		syscall.Flock(int(guard.Fd()), syscall.LOCK_UN)
+		guard.Close()
+	}, nil
+}
+
+// readWmemLock reads the "<pid> <command>" line of the lock
+func readWmemLock() (int, string, error) {
+	content, err := os.ReadFile(wmemLockPath)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read %s: %w", wmemLockPath, err)
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) < 2 {
+		return 0, "", fmt.Errorf("%s has no \"<pid> <command>\" line", wmemLockPath)
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || pid <= 0 {
+		return 0, "", fmt.Errorf("%s has an invalid pid %q", wmemLockPath, fields[0])
+	}
+	return pid, fields[1], nil
+}
+
+// isProcessRunning checks whether a process with pid exists (signal 0 delivers nothing)
+func isProcessRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+)
+
+// newTestLockDir makes the current directory a wmem-repo stand-in with a .git directory
+func newTestLockDir(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir(".git", 0755); err != nil {
+		t.Fatalf("failed to create .git: %v", err)
+	}
+}
+
+// acquireConcurrently runs n acquirers at once and returns the release functions of the successful ones
+func acquireConcurrently(t *testing.T, n int) []func() {
+	t.Helper()
+	var mu sync.Mutex
+	var releases []func()
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			release, err := acquireWmemLock(fmt.Sprintf("test%d", i))
+			if err == nil {
+				mu.Lock()
+				releases = append(releases, release)
+				mu.Unlock()
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return releases
+}
+
+// TestAcquireWmemLock_Concurrent lets exactly one of many concurrent acquirers take the lock
+func TestAcquireWmemLock_Concurrent(t *testing.T) {
+	newTestLockDir(t)
+
+	releases := acquireConcurrently(t, 20)
+	if len(releases) != 1 {
+		t.Fatalf("expected exactly one acquirer to take the lock, got %d", len(releases))
+	}
+	pid, _, err := readWmemLock()
+	if err != nil || pid != os.Getpid() {
+		t.Errorf("expected the lock to hold pid %d, got %d (%v)", os.Getpid(), pid, err)
+	}
+	releases[0]()
+	if _, err := os.Stat(wmemLockPath); !os.IsNotExist(err) {
+		t.Errorf("expected the lock to be removed on release, got %v", err)
+	}
+}
+
+// TestAcquireWmemLock_ConcurrentStaleTakeover lets exactly one of many concurrent acquirers take over a stale lock
+func TestAcquireWmemLock_ConcurrentStaleTakeover(t *testing.T) {
+	newTestLockDir(t)
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Fatalf("failed to run true: %v", err)
+	}
+	if err := os.WriteFile(wmemLockPath, []byte(fmt.Sprintf("%d commit\n", exited.Process.Pid)), 0644); err != nil {
+		t.Fatalf("failed to write stale lock: %v", err)
+	}
+
+	releases := acquireConcurrently(t, 20)
+	if len(releases) != 1 {
+		t.Fatalf("expected exactly one acquirer to take over the stale lock, got %d", len(releases))
+	}
+	releases[0]()
+}
+
+// TestAcquireWmemLock_UnreadableLockNotStale keeps an empty or unparsable lock
+func TestAcquireWmemLock_UnreadableLockNotStale(t *testing.T) {
+	for _, content := range []string{"", "not-a-pid commit\n", "12345\n"} {
+		newTestLockDir(t)
+		if err := os.WriteFile(wmemLockPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write lock: %v", err)
+		}
+		if _, err := acquireWmemLock("gc"); err == nil {
+			t.Errorf("expected the lock %q not to be taken over", content)
+		}
+		if got, err := os.ReadFile(wmemLockPath); err != nil || string(got) != content {
+			t.Errorf("expected the lock %q to stay, got %q (%v)", content, got, err)
+		}
+	}
+}
+
+// TestReleaseWmemLock_OnlyOwnLock doesn't remove a lock another process holds
+func TestReleaseWmemLock_OnlyOwnLock(t *testing.T) {
+	newTestLockDir(t)
+	release, err := acquireWmemLock("commit")
+	if err != nil {
+		t.Fatalf("acquireWmemLock failed: %v", err)
+	}
+
+	// Another process took the lock over in the meantime
+	other := fmt.Sprintf("%d gc\n", os.Getppid())
+	if err := os.WriteFile(wmemLockPath, []byte(other), 0644); err != nil {
+		t.Fatalf("failed to write lock: %v", err)
+	}
+	release()
+	if got, err := os.ReadFile(wmemLockPath); err != nil || string(got) != other {
+		t.Errorf("expected the lock of the other process to stay, got %q (%v)", got, err)
+	}
+}
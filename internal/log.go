@@ -1,19 +1,102 @@
 package internal
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
+// LogJSONSchemaVersion is the version of the git-wmem log --json document
+// Bump it on incompatible changes and add an entry to the schema changelog
+// Reference: docs/use-cases/git-wmem-log/basic.md#json-output
+const LogJSONSchemaVersion = 1
+
+// logJSON is the top-level git-wmem log --json document
+type logJSON struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Commits       []logJSONCommit `json:"commits"`
+}
+
+type logJSONCommit struct {
+	WmemUID  string           `json:"wmemUid"`
+	Hash     string           `json:"hash"`
+	Date     time.Time        `json:"date"`
+	Message  string           `json:"message"`
+	Workdirs []logJSONWorkdir `json:"workdirs"`
+}
+
+type logJSONWorkdir struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Commit string `json:"commit"`
+}
+
 // LogWmem displays wmem commit history
 // Reference: docs/use-cases/git-wmem-log/basic.md
-func LogWmem() error {
+func LogWmem(opts LogOptions) error {
+	if opts.UIDOnly && opts.JSON {
+		return fmt.Errorf("--uid-only and --json can't be combined")
+	}
+	if opts.Files && (opts.UIDOnly || opts.JSON) {
+		return fmt.Errorf("--files can't be combined with --uid-only or --json")
+	}
+	if opts.WorkdirStatus && (opts.UIDOnly || opts.JSON) {
+		return fmt.Errorf("--workdir-status can't be combined with --uid-only or --json")
+	}
+	if opts.Parents && (opts.UIDOnly || opts.JSON) {
+		return fmt.Errorf("--parents can't be combined with --uid-only or --json")
+	}
+	if opts.DiffWmemRepo && (opts.UIDOnly || opts.JSON) {
+		return fmt.Errorf("--diff-wmem-repo can't be combined with --uid-only or --json")
+	}
+	if opts.WorkdirTreeSize && (opts.UIDOnly || opts.JSON) {
+		return fmt.Errorf("--workdir-tree-size can't be combined with --uid-only or --json")
+	}
+	if opts.WorkdirCount && (opts.UIDOnly || opts.JSON) {
+		return fmt.Errorf("--workdir-count can't be combined with --uid-only or --json")
+	}
+	if err := validateColorMode(opts.Color); err != nil {
+		return err
+	}
+	if opts.ColorByWorkdir && (opts.UIDOnly || opts.JSON) {
+		return fmt.Errorf("--color-by-workdir can't be combined with --uid-only or --json")
+	}
+	if err := validateWorkdirPathStyle(opts.WorkdirPathStyle); err != nil {
+		return err
+	}
+	if opts.WorkdirPathStyle != "" && opts.WorkdirPathStyle != "rel" && (opts.UIDOnly || opts.JSON) {
+		return fmt.Errorf("--workdir-path-style can't be combined with --uid-only or --json")
+	}
+	if err := validateMessageEncoding(opts.Encoding); err != nil {
+		return err
+	}
+	if opts.Encoding != "" && opts.Encoding != "escape" && opts.JSON {
+		return fmt.Errorf("--encoding can't be combined with --json (JSON strings are always escaped)")
+	}
+	if opts.Check && (opts.UIDOnly || opts.JSON || opts.Files || opts.Parents || opts.WorkdirStatus || opts.DiffWmemRepo || opts.WorkdirTreeSize || opts.ColorByWorkdir || opts.WorkdirCount) {
+		return fmt.Errorf("--check can only be combined with --since-uid and --no-pager")
+	}
+	if opts.Pretty && !opts.JSON {
+		return fmt.Errorf("--pretty requires --json")
+	}
+	if opts.Fetch && !opts.WorkdirStatus {
+		return fmt.Errorf("--fetch requires --workdir-status")
+	}
+	if opts.Count && (opts.UIDOnly || opts.JSON || opts.Files || opts.Parents || opts.WorkdirStatus || opts.Check || opts.DiffWmemRepo || opts.WorkdirTreeSize || opts.ColorByWorkdir || opts.WorkdirCount) {
+		return fmt.Errorf("--count can only be combined with --since-uid and --no-pager")
+	}
+
 	// Check if we're in a wmem-repo
 	if !isWmemRepo() {
 		return fmt.Errorf("not in a wmem repository (missing .git-wmem file). Run this command from a wmem-repo directory.")
@@ -36,15 +119,65 @@ func LogWmem() error {
 		return fmt.Errorf("failed to get commit log: %w", err)
 	}
 
+	if opts.SinceUID != "" {
+		sinceUID, err := resolveWmemUID(repo, ref.Hash(), opts.SinceUID)
+		if err != nil {
+			return fmt.Errorf("failed to resolve --since-uid: %w", err)
+		}
+		commitIter = &untilWmemUIDIter{CommitIter: commitIter, wmemUID: sinceUID}
+	}
+
 	// Read workdir map
 	workdirMap, err := readWorkdirMap()
 	if err != nil {
 		return fmt.Errorf("failed to read workdir map: %w", err)
 	}
 
+	// Decided before the pager replaces the terminal stdout
+	if opts.ColorByWorkdir && !useColor(opts.Color) {
+		opts.ColorByWorkdir = false
+	}
+
+	if !opts.NoPager {
+		stopPager, err := startPager()
+		if err != nil {
+			return err
+		}
+		defer stopPager()
+	}
+
+	if opts.JSON {
+		return displayLogJSON(commitIter, workdirMap, opts.StrictWorkdirs, opts.Pretty)
+	}
+
+	if opts.Check {
+		return checkLogCommits(commitIter)
+	}
+
+	if opts.Count {
+		return countLogCommits(commitIter)
+	}
+
+	if opts.WorkdirStatus {
+		if opts.Fetch {
+			// Fetching writes to the bare repos like git-wmem commit
+			release, err := acquireWmemLock("log")
+			if err != nil {
+				return err
+			}
+			err = displayWorkdirStatus(workdirMap, true)
+			release()
+			if err != nil {
+				return err
+			}
+		} else if err := displayWorkdirStatus(workdirMap, false); err != nil {
+			return err
+		}
+	}
+
 	// Process commits
 	err = commitIter.ForEach(func(commit *object.Commit) error {
-		return displayCommit(commit, workdirMap)
+		return displayCommit(commit, workdirMap, opts)
 	})
 
 	if err != nil {
@@ -54,8 +187,66 @@ func LogWmem() error {
 	return nil
 }
 
+// displayLogJSON writes wmem commits as a single JSON document to stdout
+// The document is compact (one line) for piping, pretty indents it for reading (--pretty)
+// Reference: docs/use-cases/git-wmem-log/basic.md#json-output
+func displayLogJSON(commitIter object.CommitIter, workdirMap WorkdirMap, strictWorkdirs, pretty bool) error {
+	doc := logJSON{
+		SchemaVersion: LogJSONSchemaVersion,
+		Commits:       []logJSONCommit{},
+	}
+
+	workdirNames := make([]string, 0, len(workdirMap))
+	for workdirName := range workdirMap {
+		workdirNames = append(workdirNames, workdirName)
+	}
+	sort.Strings(workdirNames)
+
+	err := commitIter.ForEach(func(commit *object.Commit) error {
+		wmemUID := extractWmemUID(commit.Message)
+		if wmemUID == "" {
+			// Skip non-wmem commits
+			return nil
+		}
+
+		entry := logJSONCommit{
+			WmemUID:  wmemUID,
+			Hash:     commit.Hash.String(),
+			Date:     commit.Committer.When,
+			Message:  extractMainMessage(commit.Message),
+			Workdirs: []logJSONWorkdir{},
+		}
+		for _, workdirName := range workdirNames {
+			hash, err := getWorkdirCommitHash(workdirName)
+			if err != nil {
+				if strictWorkdirs {
+					return missingWorkdirError(workdirName, err)
+				}
+				hash = ""
+			}
+			entry.Workdirs = append(entry.Workdirs, logJSONWorkdir{
+				Name:   workdirName,
+				Path:   workdirMap[workdirName],
+				Commit: hash,
+			})
+		}
+
+		doc.Commits = append(doc.Commits, entry)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to process commits: %w", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	if pretty {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder.Encode(doc)
+}
+
 // displayCommit displays a single commit in the wmem log format
-func displayCommit(commit *object.Commit, workdirMap WorkdirMap) error {
+func displayCommit(commit *object.Commit, workdirMap WorkdirMap, opts LogOptions) error {
 	message := commit.Message
 
 	// Extract wmem-uid from commit message
@@ -65,27 +256,473 @@ func displayCommit(commit *object.Commit, workdirMap WorkdirMap) error {
 		return nil
 	}
 
+	if opts.UIDOnly {
+		fmt.Println(wmemUID)
+		return nil
+	}
+
 	// Extract the main message (everything before wmem-uid line)
 	mainMessage := extractMainMessage(message)
 
 	// Display commit header
-	fmt.Printf("%s: %s\n", wmemUID, mainMessage)
+	fmt.Printf("%s: %s\n", wmemUID, sanitizeMessage(mainMessage, opts.Encoding))
+	if opts.WorkdirCount {
+		fmt.Printf("  %d workdir(s) changed\n", countMessageWorkdirs(message))
+	}
 
 	// Display workdir information
 	// Show workdir paths with their commit status
 	for workdirName, workdirPath := range workdirMap {
+		workdirPath = formatWorkdirPath(workdirName, workdirPath, opts.WorkdirPathStyle)
+		if opts.ColorByWorkdir {
+			workdirPath = colorizeWorkdir(workdirName, workdirPath)
+		}
 		hash, err := getWorkdirCommitHash(workdirName)
+		if err != nil && opts.StrictWorkdirs {
+			return missingWorkdirError(workdirName, err)
+		}
 		if err == nil && hash != "" {
-			fmt.Printf("  %s: %s\n", workdirPath, hash[:12]+"...")
+			fmt.Printf("  %s: %s\n", workdirPath, abbrevHash(hash)+"...")
 		} else {
 			fmt.Printf("  %s: %s\n", workdirPath, "unknown")
 		}
 	}
 
+	if opts.Parents {
+		displayParents(message, workdirMap, opts.WorkdirPathStyle)
+	}
+
+	if opts.Files {
+		if err := displayChangedFiles(message, workdirMap, opts.WorkdirPathStyle); err != nil {
+			return err
+		}
+	}
+
+	if opts.WorkdirTreeSize {
+		displayWorkdirTreeSizes(message, workdirMap, opts.WorkdirPathStyle)
+	}
+
+	if opts.DiffWmemRepo {
+		if err := displayWmemRepoDiff(commit); err != nil {
+			return err
+		}
+	}
+
 	fmt.Println() // Empty line between commits
 	return nil
 }
 
+// missingWorkdirError reports a workdir-map entry without an openable bare repo (--workdir-missing-ok=false)
+// Reference: docs/use-cases/git-wmem-log/basic.md#missing-workdirs
+func missingWorkdirError(workdirName string, err error) error {
+	return fmt.Errorf("workdir %s has no usable bare repo repos/%s.git (--workdir-missing-ok=false): %w", workdirName, workdirName, err)
+}
+
+// validateMessageEncoding checks the git-wmem log --encoding value
+func validateMessageEncoding(encoding string) error {
+	switch encoding {
+	case "", "escape", "replace", "raw":
+		return nil
+	default:
+		return fmt.Errorf("invalid --encoding %q (escape, replace or raw)", encoding)
+	}
+}
+
+// sanitizeMessage makes a commit message safe to print to a terminal
+// escape shows invalid UTF-8 bytes and control characters as \xNN (\u0085 above ASCII),
+// replace prints U+FFFD instead, raw prints the message as is. Newlines and tabs are kept
+// Reference: docs/use-cases/git-wmem-log/basic.md#message-encoding
+func sanitizeMessage(message, encoding string) string {
+	if encoding == "raw" {
+		return message
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(message); {
+		r, size := utf8.DecodeRuneInString(message[i:])
+		switch {
+		case r == '\n' || r == '\t':
+			b.WriteRune(r)
+		case r == utf8.RuneError && size == 1, unicode.IsControl(r):
+			if encoding == "replace" {
+				b.WriteRune(utf8.RuneError)
+			} else if r < utf8.RuneSelf || size == 1 {
+				fmt.Fprintf(&b, "\\x%02x", message[i])
+			} else {
+				fmt.Fprintf(&b, "\\u%04x", r)
+			}
+		default:
+			b.WriteString(message[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// validateWorkdirPathStyle checks the git-wmem log --workdir-path-style value
+func validateWorkdirPathStyle(style string) error {
+	switch style {
+	case "", "rel", "abs", "name":
+		return nil
+	default:
+		return fmt.Errorf("invalid --workdir-path-style %q (rel, abs or name)", style)
+	}
+}
+
+// formatWorkdirPath renders a workdir in the log: rel is the workdir-map path (relative to the wmem-repo),
+// abs the absolute path with symlinks resolved, name the workdir-name
+// Reference: docs/use-cases/git-wmem-log/basic.md#workdir-path-style
+func formatWorkdirPath(workdirName, workdirPath, style string) string {
+	switch style {
+	case "name":
+		return workdirName
+	case "abs":
+		absPath, err := filepath.Abs(workdirPath)
+		if err != nil {
+			return workdirPath
+		}
+		if resolvedPath, err := filepath.EvalSymlinks(absPath); err == nil {
+			return resolvedPath
+		}
+		// A workdir that no longer exists keeps its unresolved absolute path
+		return absPath
+	default:
+		return workdirPath
+	}
+}
+
+// workdirCommitLineRe matches the "- `<workdir-name>` `<branch>` `<short-hash>`" lines of wmem-repo commit messages
+// Merge-only workdirs have a " (merge)" suffix, fast-forwarded ones " (fast-forward)", index snapshots " (index)"
+var workdirCommitLineRe = regexp.MustCompile("(?m)^- `([^`]+)` `([^`]+)` `([0-9a-f]+)`( \\((merge|fast-forward|index)\\))?$")
+
+// changedFile is a file changed by a workdir snapshot commit
+type changedFile struct {
+	Marker string // "+" added, "-" deleted, "~" modified
+	Path   string
+}
+
+// displayChangedFiles lists the changed files of each workdir snapshot referenced by a wmem-repo commit
+// Reference: docs/use-cases/git-wmem-log/basic.md#changed-files
+func displayChangedFiles(message string, workdirMap WorkdirMap, pathStyle string) error {
+	for _, match := range workdirCommitLineRe.FindAllStringSubmatch(message, -1) {
+		workdirName, shortHash := match[1], match[3]
+		workdirPath, exists := workdirMap[workdirName]
+		if !exists {
+			workdirPath = workdirName
+		}
+		workdirPath = formatWorkdirPath(workdirName, workdirPath, pathStyle)
+
+		files, err := listChangedFiles(workdirName, shortHash)
+		if err != nil {
+			fmt.Printf("  %s files: unknown (%v)\n", workdirPath, err)
+			continue
+		}
+
+		fmt.Printf("  %s files (%s):\n", workdirPath, shortHash)
+		for _, file := range files {
+			fmt.Printf("    %s %s\n", file.Marker, file.Path)
+		}
+	}
+	return nil
+}
+
+// displayWmemRepoDiff prints the diff of the wmem-repo tree of a commit against its first parent,
+// i.e. the changes of md/ (msg-prefix, author, workdir paths, ...) the commit recorded
+// The first commit is diffed against an empty tree
+// Reference: docs/use-cases/git-wmem-log/basic.md#wmem-repo-diff
+func displayWmemRepoDiff(commit *object.Commit) error {
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to get tree of %s: %w", commit.Hash, err)
+	}
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return fmt.Errorf("failed to get parent of %s: %w", commit.Hash, err)
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			return fmt.Errorf("failed to get parent tree of %s: %w", commit.Hash, err)
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return fmt.Errorf("failed to diff trees: %w", err)
+	}
+	if len(changes) == 0 {
+		fmt.Printf("  wmem-repo diff: none\n")
+		return nil
+	}
+	patch, err := changes.Patch()
+	if err != nil {
+		return fmt.Errorf("failed to create patch of %s: %w", commit.Hash, err)
+	}
+
+	fmt.Printf("  wmem-repo diff:\n")
+	for _, line := range strings.Split(strings.TrimSuffix(patch.String(), "\n"), "\n") {
+		fmt.Printf("    %s\n", line)
+	}
+	return nil
+}
+
+// displayParents prints the parent hashes of each workdir snapshot referenced by a wmem-repo commit
+// A merge snapshot (ALG: wmem merge) has two parents, a regular snapshot one
+// Reference: docs/use-cases/git-wmem-log/basic.md#parents
+func displayParents(message string, workdirMap WorkdirMap, pathStyle string) {
+	for _, match := range workdirCommitLineRe.FindAllStringSubmatch(message, -1) {
+		workdirName, shortHash := match[1], match[3]
+		workdirPath, exists := workdirMap[workdirName]
+		if !exists {
+			workdirPath = workdirName
+		}
+		workdirPath = formatWorkdirPath(workdirName, workdirPath, pathStyle)
+
+		parents, err := listParents(workdirName, shortHash)
+		if err != nil {
+			fmt.Printf("  %s parents: unknown (%v)\n", workdirPath, err)
+			continue
+		}
+		if len(parents) == 0 {
+			parents = []string{"none"}
+		}
+		fmt.Printf("  %s parents (%s): %s\n", workdirPath, shortHash, strings.Join(parents, " "))
+	}
+}
+
+// countMessageWorkdirs counts the distinct workdirs with a snapshot line in a wmem-repo commit message,
+// the workdirs changed by that snapshot (--workdir-count)
+// Reference: docs/use-cases/git-wmem-log/basic.md#workdir-count
+func countMessageWorkdirs(message string) int {
+	workdirs := make(map[string]bool)
+	for _, match := range workdirCommitLineRe.FindAllStringSubmatch(message, -1) {
+		workdirs[match[1]] = true
+	}
+	return len(workdirs)
+}
+
+// displayWorkdirTreeSizes prints the total size of the files of each workdir snapshot referenced
+// by a wmem-repo commit, the sum of the blob sizes of the whole snapshot tree
+// Reference: docs/use-cases/git-wmem-log/basic.md#workdir-tree-size
+func displayWorkdirTreeSizes(message string, workdirMap WorkdirMap, pathStyle string) {
+	for _, match := range workdirCommitLineRe.FindAllStringSubmatch(message, -1) {
+		workdirName, shortHash := match[1], match[3]
+		workdirPath, exists := workdirMap[workdirName]
+		if !exists {
+			workdirPath = workdirName
+		}
+		workdirPath = formatWorkdirPath(workdirName, workdirPath, pathStyle)
+
+		size, files, err := snapshotTreeSize(workdirName, shortHash)
+		if err != nil {
+			fmt.Printf("  %s tree size: unknown (%v)\n", workdirPath, err)
+			continue
+		}
+		fmt.Printf("  %s tree size (%s): %d bytes in %d file(s)\n", workdirPath, shortHash, size, files)
+	}
+}
+
+// snapshotTreeSize returns the sum of the blob sizes and the file count of a wmem-wd-repo snapshot tree
+// Submodule entries have no blob and aren't counted
+func snapshotTreeSize(workdirName, shortHash string) (int64, int, error) {
+	repo, err := openBareRepo(workdirName)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+
+	commitHash, err := repo.ResolveRevision(plumbing.Revision(shortHash))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to resolve commit %s: %w", shortHash, err)
+	}
+	commit, err := repo.CommitObject(*commitHash)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get commit %s: %w", shortHash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get tree of %s: %w", shortHash, err)
+	}
+
+	var size int64
+	files := 0
+	err = tree.Files().ForEach(func(file *object.File) error {
+		size += file.Size
+		files++
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to walk tree of %s: %w", shortHash, err)
+	}
+	return size, files, nil
+}
+
+// listParents returns the abbreviated parent hashes of a wmem-wd-repo snapshot commit
+func listParents(workdirName, shortHash string) ([]string, error) {
+	repo, err := openBareRepo(workdirName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+
+	commitHash, err := repo.ResolveRevision(plumbing.Revision(shortHash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve commit %s: %w", shortHash, err)
+	}
+	commit, err := repo.CommitObject(*commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", shortHash, err)
+	}
+
+	var parents []string
+	for _, parentHash := range commit.ParentHashes {
+		parents = append(parents, abbrevHash(parentHash.String()))
+	}
+	return parents, nil
+}
+
+// listChangedFiles diffs a wmem-wd-repo snapshot commit against the previous snapshot (its first parent)
+func listChangedFiles(workdirName, shortHash string) ([]changedFile, error) {
+	repo, err := openBareRepo(workdirName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+
+	commitHash, err := repo.ResolveRevision(plumbing.Revision(shortHash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve commit %s: %w", shortHash, err)
+	}
+	commit, err := repo.CommitObject(*commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", shortHash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of %s: %w", shortHash, err)
+	}
+
+	// The first snapshot is diffed against an empty tree
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent of %s: %w", shortHash, err)
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent tree of %s: %w", shortHash, err)
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff trees: %w", err)
+	}
+	return changedFilesOf(changes), nil
+}
+
+// changedFilesOf returns the changed files of a tree diff sorted by path
+func changedFilesOf(changes object.Changes) []changedFile {
+	var files []changedFile
+	for _, change := range changes {
+		switch {
+		case change.From.Name == "":
+			files = append(files, changedFile{Marker: "+", Path: change.To.Name})
+		case change.To.Name == "":
+			files = append(files, changedFile{Marker: "-", Path: change.From.Name})
+		default:
+			files = append(files, changedFile{Marker: "~", Path: change.To.Name})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// checkLogCommits reports the wmem-repo commits git-wmem log skips because they have no valid wmem-uid line
+// Reference: docs/use-cases/git-wmem-log/basic.md#check
+func checkLogCommits(commitIter object.CommitIter) error {
+	total, invalid := 0, 0
+	err := commitIter.ForEach(func(commit *object.Commit) error {
+		total++
+		problem := wmemUIDProblem(commit)
+		if problem == "" {
+			return nil
+		}
+		if invalid == 0 {
+			fmt.Println("Check: wmem-repo commits skipped by git-wmem log:")
+		}
+		invalid++
+		subject := strings.SplitN(strings.TrimSpace(commit.Message), "\n", 2)[0]
+		fmt.Printf("  %s %s %q: %s\n", abbrevHash(commit.Hash.String()), commit.Committer.When.Format("2006-01-02 15:04:05"), subject, problem)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to process commits: %w", err)
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d wmem-repo commit(s) have no valid wmem-uid line", invalid, total)
+	}
+	fmt.Printf("Check: all %d wmem-repo commit(s) have a valid wmem-uid line\n", total)
+	return nil
+}
+
+// countLogCommits prints one summary line instead of the log: wmem commits, distinct workdirs and date range
+// Workdirs are counted from the snapshot lines of the commit messages, so a workdir counts once it was snapshotted
+// Reference: docs/use-cases/git-wmem-log/basic.md#count
+func countLogCommits(commitIter object.CommitIter) error {
+	count := 0
+	workdirs := make(map[string]bool)
+	var oldest, newest time.Time
+	err := commitIter.ForEach(func(commit *object.Commit) error {
+		if extractWmemUID(commit.Message) == "" {
+			// Skip non-wmem commits, like the log does
+			return nil
+		}
+		count++
+		for _, match := range workdirCommitLineRe.FindAllStringSubmatch(commit.Message, -1) {
+			workdirs[match[1]] = true
+		}
+		when := commit.Committer.When
+		if oldest.IsZero() || when.Before(oldest) {
+			oldest = when
+		}
+		if newest.IsZero() || when.After(newest) {
+			newest = when
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to process commits: %w", err)
+	}
+
+	if count == 0 {
+		fmt.Println("0 wmem snapshot(s)")
+		return nil
+	}
+	const dateFormat = "2006-01-02 15:04:05"
+	fmt.Printf("%d wmem snapshot(s) over %d workdir(s), %s .. %s\n", count, len(workdirs), oldest.Format(dateFormat), newest.Format(dateFormat))
+	return nil
+}
+
+// wmemUIDProblem tells why git-wmem log would skip a wmem-repo commit, or "" when it has a valid wmem-uid
+// The initial commit of git-wmem init has no wmem-uid and isn't a problem
+func wmemUIDProblem(commit *object.Commit) string {
+	if extractWmemUID(commit.Message) != "" {
+		return ""
+	}
+	if commit.NumParents() == 0 && strings.HasPrefix(commit.Message, "Initialize git-wmem repository") {
+		return ""
+	}
+	for _, line := range strings.Split(commit.Message, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "wmem-uid:") {
+			return fmt.Sprintf("malformed wmem-uid line %q", strings.TrimSpace(line))
+		}
+	}
+	return "no wmem-uid line"
+}
+
 // extractWmemUID extracts wmem-uid from commit message
 func extractWmemUID(message string) string {
 	// Look for wmem-uid: wmem-YYMMDD-HHMMSS-abXY1234 pattern
@@ -118,9 +755,7 @@ func extractMainMessage(message string) string {
 
 // getWorkdirCommitHash gets the latest commit hash for a workdir
 func getWorkdirCommitHash(workdirName string) (string, error) {
-	repoPath := filepath.Join("repos", workdirName+".git")
-
-	repo, err := git.PlainOpen(repoPath)
+	repo, err := openBareRepo(workdirName)
 	if err != nil {
 		return "", err
 	}
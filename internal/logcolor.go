@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+)
+
+// workdirColors are the ANSI foreground colors --color-by-workdir picks from
+// Normal and bright red, green, yellow, blue, magenta and cyan, no black or white
+var workdirColors = []int{31, 32, 33, 34, 35, 36, 91, 92, 93, 94, 95, 96}
+
+// validateColorMode checks the git-wmem log --color value
+func validateColorMode(mode string) error {
+	switch mode {
+	case "", "auto", "always", "never":
+		return nil
+	default:
+		return fmt.Errorf("invalid --color %q (auto, always or never)", mode)
+	}
+}
+
+// useColor tells whether colors are printed, auto colors a terminal (checked before the pager starts)
+func useColor(mode string) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	default:
+		return isTerminal(os.Stdout)
+	}
+}
+
+// colorizeWorkdir wraps text in the color of workdirName, the same name always gets the same color
+// Reference: docs/use-cases/git-wmem-log/basic.md#color-by-workdir
+func colorizeWorkdir(workdirName, text string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(workdirName))
+	color := workdirColors[hash.Sum32()%uint32(len(workdirColors))]
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, text)
+}
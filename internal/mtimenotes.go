@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// mtimeNotesRef is the notes ref --preserve-mtime-metadata records file mtimes of snapshot commits in
+const mtimeNotesRef = plumbing.ReferenceName("refs/notes/wmem-mtime")
+
+// recordMtimeNote attaches the mtimes of the workdir files in a snapshot tree to the snapshot commit
+// as a git note in refs/notes/wmem-mtime, one "<RFC 3339 time>\t<path>" line per file sorted by path
+// Reference: docs/data-structures.md#wmem-mtime-notes
+func recordMtimeNote(repo *git.Repository, commitHash, treeHash plumbing.Hash, workdirPath string, signature *object.Signature) error {
+	tree, err := repo.TreeObject(treeHash)
+	if err != nil {
+		return fmt.Errorf("failed to get snapshot tree: %w", err)
+	}
+
+	var lines []string
+	err = tree.Files().ForEach(func(file *object.File) error {
+		info, err := os.Lstat(filepath.Join(workdirPath, filepath.FromSlash(file.Name)))
+		if err != nil {
+			// e.g. the placeholder file of an empty directory
+			return nil
+		}
+		lines = append(lines, info.ModTime().UTC().Format(time.RFC3339Nano)+"\t"+file.Name)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk snapshot tree: %w", err)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return strings.SplitN(lines[i], "\t", 2)[1] < strings.SplitN(lines[j], "\t", 2)[1]
+	})
+
+	blobHash, err := storeNoteBlob(repo, strings.Join(lines, "\n")+"\n")
+	if err != nil {
+		return err
+	}
+	return addNote(repo, mtimeNotesRef, commitHash, blobHash, signature)
+}
+
+// storeNoteBlob stores the content of a note as a blob
+func storeNoteBlob(repo *git.Repository, content string) (plumbing.Hash, error) {
+	blob := repo.Storer.NewEncodedObject()
+	blob.SetType(plumbing.BlobObject)
+	writer, err := blob.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to create note blob: %w", err)
+	}
+	if _, err := writer.Write([]byte(content)); err != nil {
+		writer.Close()
+		return plumbing.ZeroHash, fmt.Errorf("failed to write note blob: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to write note blob: %w", err)
+	}
+	blobHash, err := repo.Storer.SetEncodedObject(blob)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to store note blob: %w", err)
+	}
+	return blobHash, nil
+}
+
+// addNote sets the note of a commit in a notes ref with a new notes commit
+// New notes are stored without fanout, git reads both layouts
+func addNote(repo *git.Repository, notesRef plumbing.ReferenceName, commitHash, blobHash plumbing.Hash, signature *object.Signature) error {
+	noteName := commitHash.String()
+	var entries []object.TreeEntry
+	var parents []plumbing.Hash
+
+	ref, err := repo.Reference(notesRef, true)
+	switch err {
+	case nil:
+		notesCommit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return fmt.Errorf("failed to get %s commit: %w", notesRef, err)
+		}
+		notesTree, err := notesCommit.Tree()
+		if err != nil {
+			return fmt.Errorf("failed to get %s tree: %w", notesRef, err)
+		}
+		for _, entry := range notesTree.Entries {
+			if entry.Name != noteName {
+				entries = append(entries, entry)
+			}
+		}
+		parents = []plumbing.Hash{ref.Hash()}
+	case plumbing.ErrReferenceNotFound:
+	default:
+		return fmt.Errorf("failed to get %s: %w", notesRef, err)
+	}
+
+	entries = append(entries, object.TreeEntry{Name: noteName, Mode: filemode.Regular, Hash: blobHash})
+	sort.Slice(entries, func(i, j int) bool {
+		return gitTreeSortKey(entries[i]) < gitTreeSortKey(entries[j])
+	})
+
+	treeObj := repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{Entries: entries}).Encode(treeObj); err != nil {
+		return fmt.Errorf("failed to encode notes tree: %w", err)
+	}
+	notesTreeHash, err := repo.Storer.SetEncodedObject(treeObj)
+	if err != nil {
+		return fmt.Errorf("failed to store notes tree: %w", err)
+	}
+
+	commit := &object.Commit{
+		Message:      fmt.Sprintf("Notes added by 'git-wmem commit' for %s\n", noteName),
+		TreeHash:     notesTreeHash,
+		ParentHashes: parents,
+		Author:       *signature,
+		Committer:    *signature,
+	}
+	commitObj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(commitObj); err != nil {
+		return fmt.Errorf("failed to encode notes commit: %w", err)
+	}
+	notesCommitHash, err := repo.Storer.SetEncodedObject(commitObj)
+	if err != nil {
+		return fmt.Errorf("failed to store notes commit: %w", err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(notesRef, notesCommitHash)); err != nil {
+		return fmt.Errorf("failed to update %s: %w", notesRef, err)
+	}
+	return nil
+}
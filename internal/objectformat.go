@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	formatcfg "github.com/go-git/go-git/v5/plumbing/format/config"
+)
+
+// supportedObjectFormat is the only object format git-wmem can snapshot
+// go-git v5 encodes indexes and parses the fetch protocol with SHA-1 object names only,
+// even when built with -tags sha256
+// Reference: docs/use-cases/git-wmem-commit/basic.md#object-format
+const supportedObjectFormat = formatcfg.SHA1
+
+// repoObjectFormat reads extensions.objectformat of a repository (sha1 when unset)
+func repoObjectFormat(repo *git.Repository) (formatcfg.ObjectFormat, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", fmt.Errorf("failed to read repository config: %w", err)
+	}
+	objectFormat := strings.ToLower(cfg.Raw.Section("extensions").Option("objectformat"))
+	if objectFormat == "" {
+		return formatcfg.SHA1, nil
+	}
+	return formatcfg.ObjectFormat(objectFormat), nil
+}
+
+// checkObjectFormat fails for a repository git-wmem can't snapshot
+func checkObjectFormat(repoPath string) error {
+	repo, err := git.PlainOpen(repoPath)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		// Missing workdirs are reported by the regular workdir checks
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open repository %s: %w", repoPath, err)
+	}
+	objectFormat, err := repoObjectFormat(repo)
+	if err != nil {
+		return err
+	}
+	if objectFormat != supportedObjectFormat {
+		return fmt.Errorf("%s uses the %s object format, git-wmem can only snapshot %s repositories", repoPath, objectFormat, supportedObjectFormat)
+	}
+	return nil
+}
+
+// abbrevHash shortens a hex object name to 12 characters for display
+// Works for SHA-1 and SHA-256 names and never panics on shorter strings
+func abbrevHash(hexHash string) string {
+	if len(hexHash) > 12 {
+		return hexHash[:12]
+	}
+	return hexHash
+}
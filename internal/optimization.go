@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
@@ -57,13 +56,12 @@ func hasFilesNewerThanLastWmemCommit(workdirPath, workdirName, currentBranchName
 
 // getLastWmemCommitTime gets the timestamp of the last wmem commit
 func getLastWmemCommitTime(workdirName, currentBranchName string) (time.Time, error) {
-	repoPath := filepath.Join("repos", workdirName+".git")
-	bareRepo, err := git.PlainOpen(repoPath)
+	bareRepo, err := openBareRepo(workdirName)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to open bare repository: %w", err)
 	}
 
-	wmemBranchName := fmt.Sprintf("wmem-br/%s", currentBranchName)
+	wmemBranchName := wmemBranchNameFor(currentBranchName)
 	wmemBranchRef := plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", wmemBranchName))
 
 	wmemBranchHashRef, err := bareRepo.Reference(wmemBranchRef, true)
@@ -145,14 +143,13 @@ func hasFilesDeletedSinceLastWmemCommit(workdirPath, workdirName, currentBranchN
 
 // hasFilesDeletedUsingTreeWalk uses tree-walking for deletion detection
 func hasFilesDeletedUsingTreeWalk(workdirPath, workdirName, currentBranchName string) (bool, error) {
-	repoPath := filepath.Join("repos", workdirName+".git")
-	bareRepo, err := git.PlainOpen(repoPath)
+	bareRepo, err := openBareRepo(workdirName)
 	if err != nil {
 		// If bare repo doesn't exist yet, no files to check for deletion
 		return false, nil
 	}
 
-	wmemBranchName := fmt.Sprintf("wmem-br/%s", currentBranchName)
+	wmemBranchName := wmemBranchNameFor(currentBranchName)
 	wmemBranchRef := plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", wmemBranchName))
 
 	wmemBranchHashRef, err := bareRepo.Reference(wmemBranchRef, true)
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// defaultPager is used when $PAGER is not set, same as git
+const defaultPager = "less -FRX"
+
+// stdoutIsTerminal tells whether the pager is used, tests override it
+var stdoutIsTerminal = func() bool { return isTerminal(os.Stdout) }
+
+// startPager redirects os.Stdout through $PAGER when stdout is a terminal
+// The returned function restores os.Stdout and waits for the pager to exit
+// Reference: docs/use-cases/git-wmem-log/basic.md#pager
+func startPager() (func(), error) {
+	noop := func() {}
+	if !stdoutIsTerminal() {
+		return noop, nil
+	}
+
+	pager, ok := os.LookupEnv("PAGER")
+	if !ok {
+		pager = defaultPager
+	}
+	if pager == "" || pager == "cat" {
+		return noop, nil
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return noop, fmt.Errorf("failed to create pager pipe: %w", err)
+	}
+
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = reader
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		reader.Close()
+		writer.Close()
+		return noop, fmt.Errorf("failed to start pager %q: %w", pager, err)
+	}
+	reader.Close()
+
+	origStdout := os.Stdout
+	os.Stdout = writer
+	return func() {
+		os.Stdout = origStdout
+		writer.Close()
+		cmd.Wait()
+	}, nil
+}
+
+// isTerminal checks if f is a character device (TTY)
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
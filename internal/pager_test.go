@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStartPager(t *testing.T) {
+	origTerminal := stdoutIsTerminal
+	defer func() { stdoutIsTerminal = origTerminal }()
+	stdoutIsTerminal = func() bool { return true }
+
+	// The pager prefixes every line and writes to a file, so its use is visible
+	paged := filepath.Join(t.TempDir(), "paged.txt")
+	t.Setenv("PAGER", "sed 's/^/PAGED: /' > "+paged)
+
+	origStdout := os.Stdout
+	restore, err := startPager()
+	if err != nil {
+		t.Fatalf("startPager failed: %v", err)
+	}
+	if os.Stdout == origStdout {
+		t.Fatalf("Expected os.Stdout to be redirected to the pager")
+	}
+	fmt.Println("wmem-line-1")
+	fmt.Println("wmem-line-2")
+	restore()
+	if os.Stdout != origStdout {
+		t.Errorf("Expected os.Stdout to be restored after the pager")
+	}
+
+	content, err := os.ReadFile(paged)
+	if err != nil {
+		t.Fatalf("Failed to read pager output: %v", err)
+	}
+	if got, want := string(content), "PAGED: wmem-line-1\nPAGED: wmem-line-2\n"; got != want {
+		t.Errorf("Expected pager output %q, got %q", want, got)
+	}
+}
+
+func TestStartPager_Disabled(t *testing.T) {
+	origTerminal := stdoutIsTerminal
+	defer func() { stdoutIsTerminal = origTerminal }()
+
+	tests := []struct {
+		name     string
+		terminal bool
+		pager    string
+	}{
+		{"no terminal", false, "sed 's/^/PAGED: /'"},
+		{"empty PAGER", true, ""},
+		{"cat PAGER", true, "cat"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdoutIsTerminal = func() bool { return tt.terminal }
+			t.Setenv("PAGER", tt.pager)
+
+			origStdout := os.Stdout
+			restore, err := startPager()
+			if err != nil {
+				t.Fatalf("startPager failed: %v", err)
+			}
+			defer restore()
+			if os.Stdout != origStdout {
+				t.Errorf("Expected os.Stdout not to be redirected")
+			}
+		})
+	}
+}
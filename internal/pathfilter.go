@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// pathFilter limits the files of a workdir snapshot to paths matching one of the --path-filter patterns
+// Patterns use .gitignore syntax relative to the workdir root, e.g. src/** or *.go, and ! excludes again
+// Reference: docs/use-cases/git-wmem-commit/basic.md#path-filter
+type pathFilter struct {
+	root    string
+	matcher gitignore.Matcher
+}
+
+// newPathFilter returns the filter of the workdir at root, nil (everything included) without patterns
+func newPathFilter(root string, patterns []string) *pathFilter {
+	if len(patterns) == 0 {
+		return nil
+	}
+	var parsed []gitignore.Pattern
+	for _, pattern := range patterns {
+		parsed = append(parsed, gitignore.ParsePattern(pattern, nil))
+	}
+	return &pathFilter{root: root, matcher: gitignore.NewMatcher(parsed)}
+}
+
+// validatePathFilters checks the git-wmem commit --path-filter patterns
+func validatePathFilters(opts CommitOptions) error {
+	for _, pattern := range opts.PathFilters {
+		if strings.TrimSpace(pattern) == "" || strings.HasPrefix(pattern, "#") {
+			return fmt.Errorf("invalid --path-filter %q", pattern)
+		}
+	}
+	if len(opts.PathFilters) > 0 && opts.SnapshotIndex {
+		return fmt.Errorf("--path-filter can't be combined with --snapshot-index")
+	}
+	return nil
+}
+
+// includes tells whether the file (or gitlink) at filePath belongs to the snapshot
+// A nil filter (no --path-filter) includes everything
+func (f *pathFilter) includes(filePath string) bool {
+	if f == nil {
+		return true
+	}
+	relPath, err := filepath.Rel(f.root, filePath)
+	if err != nil {
+		return false
+	}
+	return f.matcher.Match(strings.Split(filepath.ToSlash(relPath), "/"), false)
+}
+
+// filteredTreeDiffers builds the filtered snapshot tree of a workdir and compares it with the
+// wmem-br/<current-branch-name> tip tree (step 6 with --path-filter)
+func filteredTreeDiffers(ctx context.Context, workdirPath, workdirName, currentBranchName string, opts CommitOptions) (bool, error) {
+	bareRepo, err := openBareRepo(workdirName)
+	if err != nil {
+		return false, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+	wmemBranchRef := plumbing.ReferenceName("refs/heads/" + wmemBranchNameFor(currentBranchName))
+	tipRef, err := bareRepo.Reference(wmemBranchRef, true)
+	if err != nil {
+		return false, fmt.Errorf("failed to get wmem branch reference: %w", err)
+	}
+	tip, err := bareRepo.CommitObject(tipRef.Hash())
+	if err != nil {
+		return false, fmt.Errorf("failed to get wmem commit: %w", err)
+	}
+
+	treeHash, err := createTreeFromCurrentState(ctx, workdirPath, bareRepo, opts)
+	if err != nil {
+		return false, fmt.Errorf("failed to create filtered tree: %w", err)
+	}
+	fmt.Printf("Debug: Path filter: filtered tree %s, %s tree %s for %s\n", abbrevHash(treeHash.String()), wmemBranchNameFor(currentBranchName), abbrevHash(tip.TreeHash.String()), workdirPath)
+	return treeHash != tip.TreeHash, nil
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// remoteStatus is the wmem-wd remote of one wmem-wd-repo compared with its workdir-map entry
+type remoteStatus struct {
+	WorkdirName string
+	WorkdirPath string
+	ExpectedURL string
+	URL         string
+	Problem     string
+}
+
+// RemotesWmem lists the wmem-wd remote of each wmem-wd-repo and flags mismatches with workdir-map
+// Reference: docs/use-cases/git-wmem-remotes/basic.md
+func RemotesWmem(opts RemotesOptions) error {
+	if !isWmemRepo() {
+		return fmt.Errorf("not in a wmem repository (missing .git-wmem file). Run this command from a wmem-repo directory.")
+	}
+
+	workdirMap, err := readWorkdirMap()
+	if err != nil {
+		return fmt.Errorf("failed to read workdir map: %w", err)
+	}
+
+	workdirNames := make([]string, 0, len(workdirMap))
+	for workdirName := range workdirMap {
+		workdirNames = append(workdirNames, workdirName)
+	}
+	sort.Strings(workdirNames)
+
+	mismatches := 0
+	for _, workdirName := range workdirNames {
+		status, err := readRemoteStatus(workdirName, workdirMap[workdirName])
+		if err != nil {
+			return err
+		}
+
+		if status.Problem == "" {
+			fmt.Printf("%s: %s -> %s\n", status.WorkdirName, status.WorkdirPath, status.URL)
+			continue
+		}
+
+		if opts.Fix && status.URL != "" {
+			if err := setWorkdirRemoteURL(workdirName, status.ExpectedURL); err != nil {
+				return fmt.Errorf("failed to fix wmem-wd remote of repos/%s.git: %w", workdirName, err)
+			}
+			fmt.Printf("%s: %s -> %s (fixed, was %s)\n", status.WorkdirName, status.WorkdirPath, status.ExpectedURL, status.URL)
+			continue
+		}
+
+		mismatches++
+		fmt.Printf("%s: %s -> %s (%s)\n", status.WorkdirName, status.WorkdirPath, status.URL, status.Problem)
+	}
+
+	if mismatches > 0 {
+		printWarning("%d wmem-wd remote(s) don't match workdir-map\n", mismatches)
+	}
+	return nil
+}
+
+// readRemoteStatus reads the wmem-wd remote URL of a wmem-wd-repo and compares it with the mapped workdir path
+func readRemoteStatus(workdirName, workdirPath string) (remoteStatus, error) {
+	// createBareRepo stores the absolute workdir path as the remote URL
+	expectedURL, err := filepath.Abs(workdirPath)
+	if err != nil {
+		return remoteStatus{}, fmt.Errorf("failed to get absolute workdir path: %w", err)
+	}
+	status := remoteStatus{
+		WorkdirName: workdirName,
+		WorkdirPath: workdirPath,
+		ExpectedURL: expectedURL,
+	}
+
+	if _, err := os.Stat(filepath.Join("repos", workdirName+".git")); os.IsNotExist(err) {
+		status.Problem = "missing bare repo"
+		return status, nil
+	}
+
+	repo, err := openBareRepo(workdirName)
+	if err != nil {
+		status.Problem = fmt.Sprintf("can't open bare repo: %v", err)
+		return status, nil
+	}
+
+	remote, err := repo.Remote("wmem-wd")
+	if errors.Is(err, git.ErrRemoteNotFound) {
+		status.Problem = "no wmem-wd remote"
+		return status, nil
+	}
+	if err != nil {
+		return remoteStatus{}, fmt.Errorf("failed to get wmem-wd remote of repos/%s.git: %w", workdirName, err)
+	}
+
+	urls := remote.Config().URLs
+	if len(urls) > 0 {
+		status.URL = urls[0]
+	}
+	if status.URL != expectedURL {
+		status.Problem = fmt.Sprintf("mismatch, expected %s", expectedURL)
+	}
+	return status, nil
+}
+
+// setWorkdirRemoteURL points the wmem-wd remote of a wmem-wd-repo at url
+func setWorkdirRemoteURL(workdirName, url string) error {
+	repo, err := openBareRepo(workdirName)
+	if err != nil {
+		return fmt.Errorf("failed to open bare repository: %w", err)
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read repository config: %w", err)
+	}
+	remoteConfig, exists := cfg.Remotes["wmem-wd"]
+	if !exists {
+		return git.ErrRemoteNotFound
+	}
+	remoteConfig.URLs = []string{url}
+	return repo.SetConfig(cfg)
+}
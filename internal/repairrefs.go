@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// wmemHeadRefName is the wmem-br/head branch, which follows the last snapshotted wmem-br/<branch> (step 9)
+const wmemHeadRefName = plumbing.ReferenceName("refs/heads/wmem-br/head")
+
+// RepairRefsWmem resets wmem-br/head of every bare repo in repos/ that doesn't point at the tip of
+// any wmem-br/<branch> to the most recently committed wmem-br/<branch> tip, and reports the fixes
+// Reference: docs/use-cases/git-wmem-repair-refs/basic.md
+func RepairRefsWmem() error {
+	if !isWmemRepo() {
+		return fmt.Errorf("not in a wmem repository (missing .git-wmem file). Run this command from a wmem-repo directory.")
+	}
+
+	release, err := acquireWmemLock("repair-refs")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	repoNames, err := listBareRepoNames()
+	if err != nil {
+		return err
+	}
+
+	fixed, checked := 0, 0
+	for _, repoName := range repoNames {
+		repoPath := filepath.Join("repos", repoName+".git")
+		repo, err := openBareRepo(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", repoPath, err)
+		}
+
+		report, repaired, err := repairWmemHead(repo)
+		if err != nil {
+			return fmt.Errorf("failed to repair %s: %w", repoPath, err)
+		}
+		if report == "" {
+			// No wmem-br branches, e.g. repos/_shared.git
+			continue
+		}
+		checked++
+		if repaired {
+			fixed++
+		}
+		fmt.Printf("%s: %s\n", repoPath, report)
+	}
+
+	if fixed == 0 {
+		fmt.Printf("All %d bare repo(s) consistent\n", checked)
+	} else {
+		fmt.Printf("Fixed wmem-br/head of %d of %d bare repo(s)\n", fixed, checked)
+	}
+	return nil
+}
+
+// repairWmemHead checks wmem-br/head of one bare repo and resets it when needed
+// Returns the report line (empty without wmem-br/<branch> branches) and whether the ref was changed
+func repairWmemHead(repo *git.Repository) (string, bool, error) {
+	refs, err := listRefsWithPrefix(repo, "refs/heads/wmem-br/")
+	if err != nil {
+		return "", false, err
+	}
+	delete(refs, wmemHeadRefName)
+	// Index snapshots (--snapshot-worktree-and-index) never are the workdir state wmem-br/head follows
+	var indexRefs []plumbing.ReferenceName
+	for name := range refs {
+		base, isIndex := strings.CutSuffix(name.String(), "-index")
+		if _, hasBase := refs[plumbing.ReferenceName(base)]; isIndex && hasBase {
+			indexRefs = append(indexRefs, name)
+		}
+	}
+	for _, name := range indexRefs {
+		delete(refs, name)
+	}
+
+	// Tips whose commit is missing can't be dated or logged, they aren't candidates
+	type branchTip struct {
+		name string
+		hash plumbing.Hash
+		when int64
+	}
+	var tips []branchTip
+	for name, hash := range refs {
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			continue
+		}
+		tips = append(tips, branchTip{name: strings.TrimPrefix(name.String(), "refs/heads/"), hash: hash, when: commit.Committer.When.UnixNano()})
+	}
+	if len(tips) == 0 {
+		return "", false, nil
+	}
+	// Newest first, ties by branch name so the choice is stable
+	sort.Slice(tips, func(i, j int) bool {
+		if tips[i].when != tips[j].when {
+			return tips[i].when > tips[j].when
+		}
+		return tips[i].name < tips[j].name
+	})
+
+	var oldHead string
+	headRef, err := repo.Storer.Reference(wmemHeadRefName)
+	switch {
+	case err == plumbing.ErrReferenceNotFound:
+		// Step 9 creates it with the first snapshot commit, an unchanged workdir has none yet
+		return "ok (no wmem-br/head yet)", false, nil
+	case err != nil:
+		return "", false, fmt.Errorf("failed to read wmem-br/head: %w", err)
+	case headRef.Type() == plumbing.HashReference:
+		for _, tip := range tips {
+			if tip.hash == headRef.Hash() {
+				return fmt.Sprintf("ok (wmem-br/head at %s)", tip.name), false, nil
+			}
+		}
+		oldHead = abbrevHash(headRef.Hash().String())
+	default:
+		oldHead = "-> " + headRef.Target().String()
+	}
+
+	newest := tips[0]
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(wmemHeadRefName, newest.hash)); err != nil {
+		return "", false, fmt.Errorf("failed to update wmem-br/head: %w", err)
+	}
+	return fmt.Sprintf("fixed wmem-br/head %s -> %s (%s, the newest wmem-br tip)", oldHead, abbrevHash(newest.hash.String()), newest.name), true, nil
+}
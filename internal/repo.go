@@ -1,15 +1,33 @@
 package internal
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 
+	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
 )
 
+// sharedRepoName is the name of the bare repository in repos/ holding the object store
+// shared by all wmem-wd-repos when the wmem-repo was initialized with --bare-repos-shared
+// Reference: docs/data-structures.md#shared-object-store
+const sharedRepoName = "_shared"
+
+// sharedRepoMu serializes fetches into the shared object store
+var sharedRepoMu sync.Mutex
+
 // isWmemRepo checks if current directory is a wmem repository
 func isWmemRepo() bool {
 	_, err := os.Stat(".git-wmem")
@@ -17,36 +35,82 @@ func isWmemRepo() bool {
 }
 
 // initRepos implements the init-repos sub-operation
+// With opts.EmptyReposSkip, workdirs already in the workdir map are only checked for an existing
+// workdir directory and bare repo directory, their validation and bare repo check are skipped
 // Reference: docs/use-cases/git-wmem-commit/basic.md#uc-git-wmem-commit-init-repos
-func initRepos(workdirPaths []string) error {
+func initRepos(workdirPaths []string, opts CommitOptions) error {
 	// Read existing workdir map
 	workdirMap, err := readWorkdirMap()
 	if err != nil {
 		return fmt.Errorf("failed to read workdir map: %w", err)
 	}
+	// Index by path once, so each lookup doesn't scan the whole map
+	workdirNames := indexWorkdirMap(workdirMap)
 
+	skipped := 0
 	for _, workdirPath := range workdirPaths {
+		workdirName, exists := workdirNames[filepath.Clean(workdirPath)]
+		if exists && opts.EmptyReposSkip && isDir(workdirPath) && isDir(filepath.Join("repos", workdirName+".git")) {
+			skipped++
+			continue
+		}
+
 		// Validate the workdir path
 		if err := validateWorkdirPath(workdirPath); err != nil {
 			return fmt.Errorf("invalid workdir path %s: %w", workdirPath, err)
 		}
 
 		// Check if workdir is already in the map
-		if _, exists := FindWorkdirName(workdirPath, workdirMap); exists {
+		if exists {
+			if err := checkBareRepo(workdirName); err != nil {
+				if !errors.Is(err, git.ErrRepositoryNotExists) {
+					return fmt.Errorf("corrupt bare repo repos/%s.git for %s: %w. Move it away to let git-wmem commit recreate it (its snapshot history will start over)", workdirName, workdirPath, err)
+				}
+				// Missing bare repo is recreated, its history is gone anyway
+				printWarning("Bare repo repos/%s.git is missing, recreating it\n", workdirName)
+				if err := createBareRepo(workdirName, workdirPath); err != nil {
+					return fmt.Errorf("failed to create bare repo for %s: %w", workdirPath, err)
+				}
+			}
 			continue // Already initialized
 		}
 
 		// Generate workdir name
-		workdirName := generateWorkdirName(workdirPath, workdirMap)
+		workdirName = generateWorkdirName(workdirPath, workdirMap)
+
+		// Leftover of an interrupted init-repos, nothing references it yet
+		repoPath := filepath.Join("repos", workdirName+".git")
+		adopted := false
+		if _, err := os.Stat(repoPath); err == nil {
+			if checkErr := checkBareRepo(workdirName); checkErr != nil {
+				// Invalid, it has no snapshot history worth keeping
+				printWarning("Removing unreferenced bare repo %s left by an interrupted run (%v), recreating it\n", repoPath, checkErr)
+				if err := os.RemoveAll(repoPath); err != nil {
+					return fmt.Errorf("failed to remove unreferenced bare repo %s: %w", repoPath, err)
+				}
+			} else {
+				if err := adoptBareRepo(workdirName, workdirPath); err != nil {
+					return fmt.Errorf("unreferenced bare repo %s can't be used for %s: %w. Move it away to let git-wmem commit recreate it", repoPath, workdirPath, err)
+				}
+				printWarning("Adopting unreferenced bare repo %s left by an interrupted run\n", repoPath)
+				adopted = true
+			}
+		}
 
 		// Create bare repository
-		if err := createBareRepo(workdirName, workdirPath); err != nil {
-			return fmt.Errorf("failed to create bare repo for %s: %w", workdirPath, err)
+		if !adopted {
+			if err := createBareRepo(workdirName, workdirPath); err != nil {
+				return fmt.Errorf("failed to create bare repo for %s: %w", workdirPath, err)
+			}
 		}
 
 		// Update workdir map (name -> path mapping)
 		// Normalize path to ensure consistent handling of trailing slashes
-		workdirMap[workdirName] = filepath.Clean(workdirPath)
+		setWorkdirMapEntry(workdirMap, workdirName, filepath.Clean(workdirPath))
+		workdirNames[filepath.Clean(workdirPath)] = workdirName
+	}
+	if opts.EmptyReposSkip {
+		fmt.Printf("Debug: Skipped checks of %d already initialized workdir(s) (--empty-repos-skip)\n", skipped)
 	}
 
 	// Save updated workdir map
@@ -57,6 +121,219 @@ func initRepos(workdirPaths []string) error {
 	return nil
 }
 
+// wmemBranchTip returns the commit wmem-br/<branch-name> points to in the wmem-wd-repo
+func wmemBranchTip(workdirName, branchName string) (plumbing.Hash, error) {
+	repo, err := openBareRepo(workdirName)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+
+	ref, err := repo.Reference(plumbing.ReferenceName("refs/heads/"+wmemBranchNameFor(branchName)), true)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to get wmem branch reference: %w", err)
+	}
+	return ref.Hash(), nil
+}
+
+// openBareRepo opens repos/<workdir-name>.git
+// Alternates are resolved against the whole filesystem so objects in the shared store are found
+func openBareRepo(workdirName string) (*git.Repository, error) {
+	absRepoPath, err := filepath.Abs(filepath.Join("repos", workdirName+".git"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute repository path: %w", err)
+	}
+
+	if _, err := os.Stat(absRepoPath); err != nil {
+		return nil, git.ErrRepositoryNotExists
+	}
+
+	// Relative alternates (../../_shared.git/objects) are resolved from repos/
+	storage := filesystem.NewStorageWithOptions(osfs.New(absRepoPath), cache.NewObjectLRUDefault(), filesystem.Options{
+		AlternatesFS: osfs.New(filepath.Dir(absRepoPath)),
+	})
+	return git.Open(storage, nil)
+}
+
+// checkBareRepo checks that repos/<workdir-name>.git is a usable wmem-wd-repo
+// Returns git.ErrRepositoryNotExists if the directory is missing
+func checkBareRepo(workdirName string) error {
+	repoPath := filepath.Join("repos", workdirName+".git")
+	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+		return git.ErrRepositoryNotExists
+	}
+
+	repo, err := openBareRepo(workdirName)
+	if err != nil {
+		return fmt.Errorf("failed to open: %v", err)
+	}
+
+	if _, err := repo.Remote("wmem-wd"); err != nil {
+		return fmt.Errorf("missing wmem-wd remote: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(repoPath, "objects")); err != nil {
+		return fmt.Errorf("missing objects directory")
+	}
+	return nil
+}
+
+// isDir tells whether path exists and is a directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// isBareReposShared checks if wmem-wd-repos share objects via repos/_shared.git
+func isBareReposShared() bool {
+	_, err := os.Stat(filepath.Join("repos", sharedRepoName+".git"))
+	return err == nil
+}
+
+// createSharedRepo creates the shared object store used via git alternates
+func createSharedRepo() error {
+	_, err := git.PlainInit(filepath.Join("repos", sharedRepoName+".git"), true)
+	if err != nil {
+		return fmt.Errorf("failed to create shared bare repository: %w", err)
+	}
+	return nil
+}
+
+// addSharedAlternates points a wmem-wd-repo object store to the shared object store
+// The path is relative to the objects directory like git expects it, so the wmem-repo can be moved
+func addSharedAlternates(workdirName string) error {
+	sharedObjectsPath := path.Join("..", "..", sharedRepoName+".git", "objects")
+
+	infoDir := filepath.Join("repos", workdirName+".git", "objects", "info")
+	if err := os.MkdirAll(infoDir, 0755); err != nil {
+		return fmt.Errorf("failed to create objects info directory: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(infoDir, "alternates"), []byte(sharedObjectsPath+"\n"), 0644)
+}
+
+// fetchFromWorkdir fetches workdir branches into refs/remotes/wmem-wd/* of the wmem-wd-repo
+// With a shared object store the objects are fetched into repos/_shared.git instead
+// and only the refs are mirrored into the wmem-wd-repo
+func fetchFromWorkdir(ctx context.Context, repo *git.Repository, workdirName string) error {
+	remote, err := repo.Remote("wmem-wd")
+	if err != nil {
+		return fmt.Errorf("failed to get workdir remote: %w", err)
+	}
+
+	if !isBareReposShared() {
+		err = remote.FetchContext(ctx, &git.FetchOptions{})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return err
+		}
+		return nil
+	}
+
+	sharedRepoMu.Lock()
+	defer sharedRepoMu.Unlock()
+
+	sharedRepo, err := openBareRepo(sharedRepoName)
+	if err != nil {
+		return fmt.Errorf("failed to open shared bare repository: %w", err)
+	}
+
+	sharedRefPrefix := fmt.Sprintf("refs/wmem-shared/%s/", workdirName)
+	sharedRemote := git.NewRemote(sharedRepo.Storer, &config.RemoteConfig{
+		Name: "wmem-wd",
+		URLs: remote.Config().URLs,
+	})
+	err = sharedRemote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec("+refs/heads/*:" + sharedRefPrefix + "*")},
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	// Mirror fetched refs, objects are reachable through alternates
+	refs, err := sharedRepo.References()
+	if err != nil {
+		return fmt.Errorf("failed to list shared references: %w", err)
+	}
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || !strings.HasPrefix(ref.Name().String(), sharedRefPrefix) {
+			return nil
+		}
+		remoteRefName := plumbing.ReferenceName("refs/remotes/wmem-wd/" + strings.TrimPrefix(ref.Name().String(), sharedRefPrefix))
+		return repo.Storer.SetReference(plumbing.NewHashReference(remoteRefName, ref.Hash()))
+	})
+}
+
+// wmemBranchNameFor returns the wmem-br/<branch> name for a workdir branch
+// Reference: docs/validations.md#branch-name-requirements
+func wmemBranchNameFor(branchName string) string {
+	return "wmem-br/" + sanitizeBranchName(branchName)
+}
+
+// sanitizeBranchName makes a workdir branch name safe to use as a ref component
+// Invalid characters and sequences are replaced and a short hash of the original
+// name is appended so the result stays stable and unique for the original name.
+func sanitizeBranchName(branchName string) string {
+	var components []string
+	for _, component := range strings.Split(branchName, "/") {
+		if component == "" {
+			continue
+		}
+		components = append(components, sanitizeRefComponent(component))
+	}
+
+	sanitized := strings.Join(components, "/")
+	if sanitized == branchName {
+		return branchName
+	}
+
+	sum := sha1.Sum([]byte(branchName))
+	return sanitized + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// sanitizeRefComponent replaces everything git check-ref-format rejects in a single ref component
+func sanitizeRefComponent(component string) string {
+	var b strings.Builder
+	for _, r := range component {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			b.WriteRune('_')
+		case strings.ContainsRune(" ~^:?*[\\", r):
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	result := b.String()
+
+	// A run of dots like "..." still contains ".." after a single pass
+	for strings.Contains(result, "..") {
+		result = strings.ReplaceAll(result, "..", "_.")
+	}
+	result = strings.ReplaceAll(result, "@{", "@_")
+	if strings.HasPrefix(result, ".") {
+		result = "_" + result[1:]
+	}
+	if strings.HasSuffix(result, ".lock") {
+		result = strings.TrimSuffix(result, ".lock") + "_lock"
+	}
+	if strings.HasSuffix(result, ".") {
+		result = strings.TrimSuffix(result, ".") + "_"
+	}
+	if result == "@" {
+		result = "_"
+	}
+
+	return result
+}
+
+// workdirBranchNote records the original workdir branch in a wmem-br commit message
+// when the branch name had to be sanitized
+func workdirBranchNote(branchName string) string {
+	if sanitizeBranchName(branchName) == branchName {
+		return ""
+	}
+	return fmt.Sprintf("\n\nWorkdir branch: `%s`", branchName)
+}
+
 // createBareRepo creates a bare repository for the workdir
 func createBareRepo(workdirName, workdirPath string) error {
 	repoPath := filepath.Join("repos", workdirName+".git")
@@ -67,8 +344,14 @@ func createBareRepo(workdirName, workdirPath string) error {
 		return fmt.Errorf("failed to create bare repository: %w", err)
 	}
 
+	if isBareReposShared() {
+		if err := addSharedAlternates(workdirName); err != nil {
+			return fmt.Errorf("failed to set up shared object store: %w", err)
+		}
+	}
+
 	// Open the bare repository
-	repo, err := git.PlainOpen(repoPath)
+	repo, err := openBareRepo(workdirName)
 	if err != nil {
 		return fmt.Errorf("failed to open bare repository: %w", err)
 	}
@@ -90,13 +373,7 @@ func createBareRepo(workdirName, workdirPath string) error {
 	}
 
 	// Fetch from workdir
-	remote, err := repo.Remote("wmem-wd")
-	if err != nil {
-		return fmt.Errorf("failed to get remote: %w", err)
-	}
-
-	err = remote.Fetch(&git.FetchOptions{})
-	if err != nil && err != git.NoErrAlreadyUpToDate {
+	if err := fetchFromWorkdir(context.Background(), repo, workdirName); err != nil {
 		return fmt.Errorf("failed to fetch from workdir: %w", err)
 	}
 
@@ -108,6 +385,46 @@ func createBareRepo(workdirName, workdirPath string) error {
 	return nil
 }
 
+// adoptBareRepo reuses a valid bare repo missing from the workdir map, left by an interrupted init-repos
+// Its wmem-wd remote must point to the workdir, so another workdir's history is never taken over
+func adoptBareRepo(workdirName, workdirPath string) error {
+	repo, err := openBareRepo(workdirName)
+	if err != nil {
+		return fmt.Errorf("failed to open bare repository: %w", err)
+	}
+
+	absWorkdirPath, err := filepath.Abs(workdirPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute workdir path: %w", err)
+	}
+	remote, err := repo.Remote("wmem-wd")
+	if err != nil {
+		return fmt.Errorf("failed to get workdir remote: %w", err)
+	}
+	if urls := remote.Config().URLs; len(urls) == 0 || urls[0] != absWorkdirPath {
+		return fmt.Errorf("its wmem-wd remote %v doesn't point to %s", urls, absWorkdirPath)
+	}
+
+	if err := fetchFromWorkdir(context.Background(), repo, workdirName); err != nil {
+		return fmt.Errorf("failed to fetch from workdir: %w", err)
+	}
+
+	// The interrupted run may have stopped before creating wmem-br/<branch>
+	workdirRepo, err := git.PlainOpen(absWorkdirPath)
+	if err != nil {
+		return fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+	head, err := workdirRepo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get workdir HEAD: %w", err)
+	}
+	wmemBranchRef := plumbing.ReferenceName("refs/heads/" + wmemBranchNameFor(head.Name().Short()))
+	if _, err := repo.Reference(wmemBranchRef, false); err == nil {
+		return nil
+	}
+	return createWmemBranch(repo, absWorkdirPath)
+}
+
 // createWmemBranch creates wmem-br/<branch> from workdir's current branch
 func createWmemBranch(repo *git.Repository, workdirPath string) error {
 	// Open workdir repository to get current branch
@@ -123,7 +440,7 @@ func createWmemBranch(repo *git.Repository, workdirPath string) error {
 	}
 
 	branchName := head.Name().Short()
-	wmemBranchName := fmt.Sprintf("wmem-br/%s", branchName)
+	wmemBranchName := wmemBranchNameFor(branchName)
 
 	// Create wmem branch pointing to the same commit
 	wmemBranchRef := plumbing.NewHashReference(
@@ -141,13 +458,12 @@ func createWmemBranch(repo *git.Repository, workdirPath string) error {
 
 // ensureWmemBranchExists implements step 2 of UC: sync-workdir (Alternative 2b)
 func ensureWmemBranchExists(workdirName, currentBranchName, workdirPath string) error {
-	repoPath := filepath.Join("repos", workdirName+".git")
-	bareRepo, err := git.PlainOpen(repoPath)
+	bareRepo, err := openBareRepo(workdirName)
 	if err != nil {
 		return fmt.Errorf("failed to open bare repository: %w", err)
 	}
 
-	wmemBranchName := fmt.Sprintf("wmem-br/%s", currentBranchName)
+	wmemBranchName := wmemBranchNameFor(currentBranchName)
 	wmemBranchRef := plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", wmemBranchName))
 
 	// Check if wmem-br/<current-branch-name> branch exists
@@ -182,13 +498,12 @@ func ensureWmemBranchExists(workdirName, currentBranchName, workdirPath string)
 
 // ensureWmemHeadBranch implements step 3 of UC: sync-workdir
 func ensureWmemHeadBranch(workdirName, currentBranchName string) error {
-	repoPath := filepath.Join("repos", workdirName+".git")
-	bareRepo, err := git.PlainOpen(repoPath)
+	bareRepo, err := openBareRepo(workdirName)
 	if err != nil {
 		return fmt.Errorf("failed to open bare repository: %w", err)
 	}
 
-	wmemBranchName := fmt.Sprintf("wmem-br/%s", currentBranchName)
+	wmemBranchName := wmemBranchNameFor(currentBranchName)
 	wmemBranchRef := plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", wmemBranchName))
 
 	// Get wmem-br/<current-branch-name> reference
@@ -204,27 +519,152 @@ func ensureWmemHeadBranch(workdirName, currentBranchName string) error {
 		return fmt.Errorf("failed to set HEAD to wmem branch: %w", err)
 	}
 
-	fmt.Printf("Debug: Set HEAD to wmem-br/%s (%s)\n", currentBranchName, wmemBranchHashRef.Hash().String()[:12])
+	fmt.Printf("Debug: Set HEAD to %s (%s)\n", wmemBranchName, abbrevHash(wmemBranchHashRef.Hash().String()))
 	return nil
 }
 
 // fetchLatestChanges implements step 4 of UC: sync-workdir
-func fetchLatestChanges(workdirName string) error {
-	repoPath := filepath.Join("repos", workdirName+".git")
-	bareRepo, err := git.PlainOpen(repoPath)
+func fetchLatestChanges(ctx context.Context, workdirName string, opts CommitOptions) error {
+	bareRepo, err := openBareRepo(workdirName)
 	if err != nil {
 		return fmt.Errorf("failed to open bare repository: %w", err)
 	}
 
-	remote, err := bareRepo.Remote("wmem-wd")
+	if opts.NoFetch {
+		fetched, err := workdirHeadFetched(bareRepo)
+		if err != nil {
+			return err
+		}
+		if !fetched {
+			return errFetchNeeded
+		}
+	} else if err := fetchFromWorkdir(ctx, bareRepo, workdirName); err != nil {
+		return fmt.Errorf("failed to fetch latest changes: %w", err)
+	}
+
+	if opts.SnapshotTags {
+		if err := fetchWorkdirTags(ctx, bareRepo, workdirName); err != nil {
+			return fmt.Errorf("failed to fetch workdir tags: %w", err)
+		}
+	}
+
+	if opts.CaptureStash {
+		if err := captureWorkdirStash(ctx, bareRepo, workdirName); err != nil {
+			return fmt.Errorf("failed to capture workdir stash: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// errFetchNeeded marks workdirs skipped by --no-fetch because step 5 needs their new HEAD commit
+// Reference: docs/use-cases/git-wmem-commit/basic.md#no-fetch
+var errFetchNeeded = errors.New("its HEAD commit isn't in the wmem-wd-repo yet (--no-fetch), run without --no-fetch to snapshot it")
+
+// workdirHeadFetched tells whether the workdir HEAD commit is already in the wmem-wd-repo (--no-fetch)
+// Step 5 merges the HEAD commit, so only a workdir without new commits can skip the fetch
+// Reference: docs/use-cases/git-wmem-commit/basic.md#no-fetch
+func workdirHeadFetched(repo *git.Repository) (bool, error) {
+	remote, err := repo.Remote("wmem-wd")
+	if err != nil {
+		return false, fmt.Errorf("failed to get workdir remote: %w", err)
+	}
+	workdirRepo, err := git.PlainOpen(remote.Config().URLs[0])
+	if err != nil {
+		return false, fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+	head, err := workdirRepo.Head()
+	if err != nil {
+		return false, fmt.Errorf("failed to get workdir HEAD: %w", err)
+	}
+	if _, err := repo.CommitObject(head.Hash()); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// wmemTagsRefPrefix returns the refs/wmem-tags/<workdir-name>/ prefix of snapshotted workdir tags
+// Reference: docs/data-structures.md#wmem-tags
+func wmemTagsRefPrefix(workdirName string) string {
+	return fmt.Sprintf("refs/wmem-tags/%s/", workdirName)
+}
+
+// fetchWorkdirTags mirrors the workdir tags into refs/wmem-tags/<workdir-name>/* of the wmem-wd-repo (--snapshot-tags)
+// Tags deleted in the workdir are pruned, annotated tags keep their tag objects
+func fetchWorkdirTags(ctx context.Context, repo *git.Repository, workdirName string) error {
+	remote, err := repo.Remote("wmem-wd")
 	if err != nil {
 		return fmt.Errorf("failed to get workdir remote: %w", err)
 	}
 
-	err = remote.Fetch(&git.FetchOptions{})
+	tagsRefPrefix := wmemTagsRefPrefix(workdirName)
+	targetRepo := repo
+	if isBareReposShared() {
+		sharedRepoMu.Lock()
+		defer sharedRepoMu.Unlock()
+
+		targetRepo, err = openBareRepo(sharedRepoName)
+		if err != nil {
+			return fmt.Errorf("failed to open shared bare repository: %w", err)
+		}
+	}
+
+	tagsRemote := git.NewRemote(targetRepo.Storer, &config.RemoteConfig{
+		Name: "wmem-wd",
+		URLs: remote.Config().URLs,
+	})
+	err = tagsRemote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec("+refs/tags/*:" + tagsRefPrefix + "*")},
+		Tags:     git.NoTags,
+		Prune:    true,
+	})
 	if err != nil && err != git.NoErrAlreadyUpToDate {
-		return fmt.Errorf("failed to fetch latest changes: %w", err)
+		return err
+	}
+
+	tags, err := listRefsWithPrefix(targetRepo, tagsRefPrefix)
+	if err != nil {
+		return err
+	}
+	if targetRepo != repo {
+		// Mirror the tag refs, objects are reachable through alternates
+		existing, err := listRefsWithPrefix(repo, tagsRefPrefix)
+		if err != nil {
+			return err
+		}
+		for name := range existing {
+			if _, exists := tags[name]; !exists {
+				if err := repo.Storer.RemoveReference(name); err != nil {
+					return fmt.Errorf("failed to remove tag reference %s: %w", name, err)
+				}
+			}
+		}
+		for name, hash := range tags {
+			if err := repo.Storer.SetReference(plumbing.NewHashReference(name, hash)); err != nil {
+				return fmt.Errorf("failed to set tag reference %s: %w", name, err)
+			}
+		}
 	}
 
+	fmt.Printf("Debug: Snapshotted %d tag(s) of %s under %s\n", len(tags), workdirName, tagsRefPrefix)
 	return nil
 }
+
+// listRefsWithPrefix returns the hash references of a repository whose name starts with prefix
+func listRefsWithPrefix(repo *git.Repository, prefix string) (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	refs, err := repo.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references: %w", err)
+	}
+	result := make(map[plumbing.ReferenceName]plumbing.Hash)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference && strings.HasPrefix(ref.Name().String(), prefix) {
+			result[ref.Name()] = ref.Hash()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references: %w", err)
+	}
+	return result, nil
+}
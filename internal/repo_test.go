@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// TestWmemBranchNameFor_Sanitized checks that names git rejects as refs give valid wmem-br refs
+func TestWmemBranchNameFor_Sanitized(t *testing.T) {
+	tests := []struct {
+		branch string
+		prefix string
+	}{
+		{"main", "wmem-br/main"},
+		{"feature/login", "wmem-br/feature/login"},
+		{"weird.lock", "wmem-br/weird_lock-"},
+		{"a..b", "wmem-br/a_.b-"},
+		{"a...b", "wmem-br/a__.b-"},
+		{"a....b", "wmem-br/a_._.b-"},
+		{".hidden", "wmem-br/_hidden-"},
+		{"x@{1}", "wmem-br/x@_1}-"},
+	}
+	for _, tt := range tests {
+		name := wmemBranchNameFor(tt.branch)
+		if !strings.HasPrefix(name, tt.prefix) {
+			t.Errorf("wmemBranchNameFor(%q) = %q, expected prefix %q", tt.branch, name, tt.prefix)
+		}
+		if strings.Contains(name, "..") {
+			t.Errorf("wmemBranchNameFor(%q) = %q still contains \"..\"", tt.branch, name)
+		}
+		if err := plumbing.ReferenceName("refs/heads/" + name).Validate(); err != nil {
+			t.Errorf("wmemBranchNameFor(%q) = %q isn't a valid ref: %v", tt.branch, name, err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// CommitReportSchemaVersion is the version of the git-wmem commit --report document
+// Reference: docs/use-cases/git-wmem-commit/basic.md#run-report
+const CommitReportSchemaVersion = 1
+
+// Exit statuses of git-wmem commit --json-report, errors exit with 1
+// Reference: docs/use-cases/git-wmem-commit/basic.md#exit-status
+const (
+	CommitExitCommitted       = 0
+	CommitExitNothingToCommit = 3
+	CommitExitPartial         = 4
+)
+
+// Errors CommitWmem returns with --json-report for complete runs that didn't commit everything
+var (
+	ErrNothingToCommit = errors.New("nothing to commit")
+	ErrPartialCommit   = errors.New("some workdirs failed and were skipped (--keep-going)")
+)
+
+// CommitExitStatus maps the error returned by CommitWmem to the exit status of git-wmem commit
+func CommitExitStatus(err error) int {
+	switch {
+	case err == nil:
+		return CommitExitCommitted
+	case errors.Is(err, ErrNothingToCommit):
+		return CommitExitNothingToCommit
+	case errors.Is(err, ErrPartialCommit):
+		return CommitExitPartial
+	default:
+		return 1
+	}
+}
+
+// commitOutcome is how a git-wmem commit run ended, the outcome field of the run report
+type commitOutcome string
+
+const (
+	outcomeCommitted       commitOutcome = "committed"
+	outcomeNothingToCommit commitOutcome = "nothing-to-commit"
+	outcomePartial         commitOutcome = "partial"
+)
+
+// runOutcome tells the outcome of a run from its workdir results, failed workdirs (--keep-going) win
+func runOutcome(workdirResults []WorkdirCommitResult, wmemCommitCreated bool) commitOutcome {
+	for _, result := range workdirResults {
+		if strings.HasPrefix(result.SkipReason, "failed: ") {
+			return outcomePartial
+		}
+	}
+	if wmemCommitCreated {
+		return outcomeCommitted
+	}
+	return outcomeNothingToCommit
+}
+
+// commitReport is the JSON run report written by git-wmem commit --report and --json-report
+type commitReport struct {
+	SchemaVersion  int                   `json:"schemaVersion"`
+	StartTime      time.Time             `json:"startTime"`
+	EndTime        time.Time             `json:"endTime"`
+	Outcome        commitOutcome         `json:"outcome"`
+	WmemUID        string                `json:"wmemUid"`
+	WmemRepoCommit string                `json:"wmemRepoCommit"`
+	Workdirs       []WorkdirCommitResult `json:"workdirs"`
+	CacheStats     commitReportCache     `json:"cacheStats"`
+}
+
+type commitReportCache struct {
+	TouchedFiles int `json:"touchedFiles"`
+	TreeHash     int `json:"treeHash"`
+	DirState     int `json:"dirState"`
+	FileList     int `json:"fileList"`
+	WmemTree     int `json:"wmemTree"`
+}
+
+// writeCommitReport writes the JSON run report of a git-wmem-commit run to reportPath (--report)
+// and to jsonOut (--json-report), either can be empty/nil
+func writeCommitReport(reportPath string, jsonOut io.Writer, startTime time.Time, commitInfo *CommitInfo, workdirResults []WorkdirCommitResult, wmemCommitCreated bool) error {
+	report := commitReport{
+		SchemaVersion: CommitReportSchemaVersion,
+		StartTime:     startTime,
+		Outcome:       runOutcome(workdirResults, wmemCommitCreated),
+		WmemUID:       commitInfo.WmemUID,
+		Workdirs:      []WorkdirCommitResult{},
+	}
+
+	for _, result := range workdirResults {
+		if result.NewTip != "" && result.OldTip != "" && result.NewTip != result.OldTip {
+			filesChanged, err := countChangedFiles(result.WorkdirName, result.OldTip, result.NewTip)
+			if err != nil {
+				return fmt.Errorf("failed to count changed files for %s: %w", result.WorkdirName, err)
+			}
+			result.FilesChanged = filesChanged
+		}
+		report.Workdirs = append(report.Workdirs, result)
+	}
+
+	if wmemCommitCreated {
+		repo, err := git.PlainOpen(".")
+		if err != nil {
+			return fmt.Errorf("failed to open wmem repository: %w", err)
+		}
+		head, err := repo.Head()
+		if err != nil {
+			return fmt.Errorf("failed to get HEAD: %w", err)
+		}
+		report.WmemRepoCommit = head.Hash().String()
+	}
+
+	touchedCount, treeCount, dirStateCount, fileListCount, wmemTreeCount := globalCommitCache.getCacheStats()
+	report.CacheStats = commitReportCache{
+		TouchedFiles: touchedCount,
+		TreeHash:     treeCount,
+		DirState:     dirStateCount,
+		FileList:     fileListCount,
+		WmemTree:     wmemTreeCount,
+	}
+	report.EndTime = time.Now()
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	content = append(content, '\n')
+	if reportPath != "" {
+		if err := os.WriteFile(reportPath, content, 0644); err != nil {
+			return err
+		}
+	}
+	if jsonOut != nil {
+		if _, err := jsonOut.Write(content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countChangedFiles counts files that differ between two commits of a wmem-wd-repo
+func countChangedFiles(workdirName, oldCommitHash, newCommitHash string) (int, error) {
+	repo, err := openBareRepo(workdirName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+
+	oldCommit, err := repo.CommitObject(plumbing.NewHash(oldCommitHash))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get commit %s: %w", oldCommitHash, err)
+	}
+	newCommit, err := repo.CommitObject(plumbing.NewHash(newCommitHash))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get commit %s: %w", newCommitHash, err)
+	}
+
+	oldTree, err := oldCommit.Tree()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get tree of %s: %w", oldCommitHash, err)
+	}
+	newTree, err := newCommit.Tree()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get tree of %s: %w", newCommitHash, err)
+	}
+
+	changes, err := object.DiffTree(oldTree, newTree)
+	if err != nil {
+		return 0, fmt.Errorf("failed to diff trees: %w", err)
+	}
+	return len(changes), nil
+}
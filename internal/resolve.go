@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// resolveWmemUID resolves a full or partial wmem-uid, or a wmem-repo revision (tag, commit hash), to a full wmem-uid
+// Partial wmem-uids are prefixes (e.g. wmem-251016-10) and must match a single wmem-uid in the history of from
+// Reference: docs/data-structures.md#wmem-uid-references
+func resolveWmemUID(repo *git.Repository, from plumbing.Hash, ref string) (string, error) {
+	if strings.HasPrefix(ref, "wmem-") {
+		commitIter, err := repo.Log(&git.LogOptions{From: from})
+		if err != nil {
+			return "", fmt.Errorf("failed to get commit log: %w", err)
+		}
+
+		var matches []string
+		err = commitIter.ForEach(func(commit *object.Commit) error {
+			wmemUID := extractWmemUID(commit.Message)
+			if !strings.HasPrefix(wmemUID, ref) {
+				return nil
+			}
+			// Batch commits of one run share their wmem-uid
+			if len(matches) == 0 || matches[len(matches)-1] != wmemUID {
+				matches = append(matches, wmemUID)
+			}
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to process commits: %w", err)
+		}
+
+		switch len(matches) {
+		case 0:
+			return "", fmt.Errorf("unknown wmem-uid %s", ref)
+		case 1:
+			return matches[0], nil
+		default:
+			return "", fmt.Errorf("ambiguous wmem-uid %s matches %d wmem-uids (e.g. %s, %s)", ref, len(matches), matches[0], matches[1])
+		}
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return "", fmt.Errorf("unknown wmem-uid or revision %s: %w", ref, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit %s: %w", hash, err)
+	}
+	wmemUID := extractWmemUID(commit.Message)
+	if wmemUID == "" {
+		return "", fmt.Errorf("revision %s (%s) is not a wmem commit", ref, abbrevHash(hash.String()))
+	}
+	return wmemUID, nil
+}
+
+// untilWmemUIDIter stops a commit iterator before the first commit with the given wmem-uid
+type untilWmemUIDIter struct {
+	object.CommitIter
+	wmemUID string
+}
+
+func (iter *untilWmemUIDIter) Next() (*object.Commit, error) {
+	commit, err := iter.CommitIter.Next()
+	if err != nil {
+		return nil, err
+	}
+	if extractWmemUID(commit.Message) == iter.wmemUID {
+		return nil, io.EOF
+	}
+	return commit, nil
+}
+
+func (iter *untilWmemUIDIter) ForEach(cb func(*object.Commit) error) error {
+	defer iter.Close()
+	for {
+		commit, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := cb(commit); err != nil {
+			if err == storer.ErrStop {
+				return nil
+			}
+			return err
+		}
+	}
+}
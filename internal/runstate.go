@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// commitRunStatePath is the state of the running git-wmem commit, inside the .git directory of the
+// wmem-repo like the lock, removed once the run created its wmem-repo commit
+// Reference: docs/use-cases/git-wmem-commit/basic.md#resume
+var commitRunStatePath = filepath.Join(".git", "git-wmem-commit-run.json")
+
+// commitRunState is what an interrupted git-wmem commit left for --resume
+type commitRunState struct {
+	WmemUID string `json:"wmemUid"`
+	Message string `json:"message"`
+	// Done are the workdir paths whose snapshot step (7-9) finished in this run
+	Done []string `json:"done"`
+	// Pending are the results of done workdirs not in a wmem-repo commit (batch) yet
+	Pending []WorkdirCommitResult `json:"pending"`
+}
+
+// startCommitRun starts a new run state, or with resume loads the state of the interrupted run and
+// continues it: commitInfo gets its wmem-uid and message
+// The state is written once the first workdir is done, a run failing before that leaves nothing behind
+func startCommitRun(commitInfo *CommitInfo, resume bool) (*commitRunState, error) {
+	content, err := os.ReadFile(commitRunStatePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", commitRunStatePath, err)
+	}
+	interrupted := err == nil
+
+	if resume {
+		if !interrupted {
+			return nil, fmt.Errorf("no interrupted git-wmem commit run to resume (%s missing)", commitRunStatePath)
+		}
+		var state commitRunState
+		if err := json.Unmarshal(content, &state); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", commitRunStatePath, err)
+		}
+		commitInfo.WmemUID = state.WmemUID
+		commitInfo.Message = state.Message
+		fmt.Printf("Info: Resuming run %s, %d workdir(s) already done\n", state.WmemUID, len(state.Done))
+		return &state, nil
+	}
+
+	state := &commitRunState{WmemUID: commitInfo.WmemUID, Message: commitInfo.Message}
+	if interrupted {
+		// A state without done workdirs has nothing to resume
+		var previous commitRunState
+		if err := json.Unmarshal(content, &previous); err != nil || len(previous.Done) > 0 {
+			printWarning("Discarding the state of an interrupted git-wmem commit run (%s), use --resume to continue it\n", commitRunStatePath)
+		}
+		if err := state.finish(); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// remaining returns the workdir paths not done in this run yet
+func (state *commitRunState) remaining(workdirPaths []string) []string {
+	done := make(map[string]bool)
+	for _, path := range state.Done {
+		done[path] = true
+	}
+	var remaining []string
+	for _, path := range workdirPaths {
+		if done[path] {
+			fmt.Printf("Info: Skipping workdir %s, already done in run %s (--resume)\n", path, state.WmemUID)
+			continue
+		}
+		remaining = append(remaining, path)
+	}
+	return remaining
+}
+
+// workdirDone records a finished workdir and the results not in a wmem-repo commit yet
+func (state *commitRunState) workdirDone(workdirPath string, pending []WorkdirCommitResult) error {
+	state.Done = append(state.Done, workdirPath)
+	return state.recordPending(pending)
+}
+
+// recordPending records the results not in a wmem-repo commit yet, e.g. after a batch commit
+// Results of failed or skipped workdirs are left out, --resume checks those workdirs again
+func (state *commitRunState) recordPending(pending []WorkdirCommitResult) error {
+	done := make(map[string]bool, len(state.Done))
+	for _, path := range state.Done {
+		done[path] = true
+	}
+	state.Pending = nil
+	for _, result := range pending {
+		if done[result.WorkdirPath] {
+			state.Pending = append(state.Pending, result)
+		}
+	}
+	return state.save()
+}
+
+// save writes the run state atomically, an interruption keeps the previous state
+func (state *commitRunState) save() error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run state: %w", err)
+	}
+	if err := writeFileAtomically(commitRunStatePath, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", commitRunStatePath, err)
+	}
+	return nil
+}
+
+// discardIfNothingDone removes the run state when no workdir is done, e.g. a run failing before its first
+// snapshot, so the next run has nothing to resume or discard
+func (state *commitRunState) discardIfNothingDone() {
+	if len(state.Done) == 0 {
+		if err := state.finish(); err != nil {
+			printWarning("%v\n", err)
+		}
+	}
+}
+
+// finish removes the run state once the run created its wmem-repo commit or found nothing to commit
+func (state *commitRunState) finish() error {
+	if err := os.Remove(commitRunStatePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove %s: %w", commitRunStatePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// isSparseCheckout reports whether a workdir uses git sparse-checkout
+// `git sparse-checkout` writes core.sparseCheckout to config.worktree, so info/sparse-checkout is checked too
+func isSparseCheckout(workdirPath string) (bool, error) {
+	gitDir, err := workdirGitDir(workdirPath)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, "info", "sparse-checkout")); err == nil {
+		return true, nil
+	}
+
+	workdirRepo, err := git.PlainOpen(workdirPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+	cfg, err := workdirRepo.Config()
+	if err != nil {
+		return false, fmt.Errorf("failed to read workdir config: %w", err)
+	}
+	return strings.EqualFold(cfg.Raw.Section("core").Option("sparseCheckout"), "true"), nil
+}
+
+// applySparseCheckout adds files excluded by a sparse checkout to a snapshot tree (--respect-sparse-checkout)
+// Without it, files missing on disk because of the sparse cone would be recorded as deleted
+// Reference: docs/use-cases/git-wmem-commit/basic.md#sparse-checkout
+func applySparseCheckout(workdirPath string, repo *git.Repository, treeHash plumbing.Hash, opts CommitOptions) (plumbing.Hash, error) {
+	if !opts.RespectSparseCheckout {
+		return treeHash, nil
+	}
+
+	sparse, err := isSparseCheckout(workdirPath)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to detect sparse checkout: %w", err)
+	}
+	if !sparse {
+		return treeHash, nil
+	}
+
+	workdirRepo, err := git.PlainOpen(workdirPath)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+	idx, err := workdirRepo.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to read workdir index: %w", err)
+	}
+
+	// Skip-worktree entries missing on disk are the files outside the sparse cone
+	excluded := &indexTreeNode{children: make(map[string]*indexTreeNode)}
+	excludedCount := 0
+	for _, entry := range idx.Entries {
+		if !entry.SkipWorktree {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(workdirPath, filepath.FromSlash(entry.Name))); err == nil {
+			// Present on disk, the filesystem version is already in the tree
+			continue
+		}
+
+		if entry.Mode != filemode.Submodule {
+			if err := copyBlobObject(workdirRepo, repo, entry.Hash); err != nil {
+				return plumbing.ZeroHash, fmt.Errorf("failed to copy blob for %s: %w", entry.Name, err)
+			}
+		}
+
+		excluded.add(entry.Name, entry.Mode, entry.Hash)
+		excludedCount++
+	}
+
+	if excludedCount == 0 {
+		return treeHash, nil
+	}
+	fmt.Printf("Debug: Keeping %d file(s) outside the sparse checkout of %s\n", excludedCount, workdirPath)
+	return mergeIndexTreeNode(repo, treeHash, excluded)
+}
+
+// mergeIndexTreeNode adds the entries of node that are missing in the tree treeHash, returning the new tree hash
+// Entries already in the tree are kept as they are
+func mergeIndexTreeNode(repo *git.Repository, treeHash plumbing.Hash, node *indexTreeNode) (plumbing.Hash, error) {
+	tree, err := repo.TreeObject(treeHash)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to get tree %s: %w", treeHash, err)
+	}
+
+	treeEntries := append([]object.TreeEntry{}, tree.Entries...)
+	positions := make(map[string]int, len(treeEntries))
+	for i, entry := range treeEntries {
+		positions[entry.Name] = i
+	}
+
+	for _, entry := range node.entries {
+		if _, exists := positions[entry.Name]; !exists {
+			treeEntries = append(treeEntries, entry)
+		}
+	}
+
+	for name, child := range node.children {
+		pos, exists := positions[name]
+		if !exists {
+			childHash, err := writeIndexTreeNode(repo, child)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			treeEntries = append(treeEntries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: childHash})
+			continue
+		}
+		if treeEntries[pos].Mode != filemode.Dir {
+			// A file replaced the directory on disk, the filesystem wins
+			continue
+		}
+		childHash, err := mergeIndexTreeNode(repo, treeEntries[pos].Hash, child)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		treeEntries[pos].Hash = childHash
+	}
+
+	sort.Slice(treeEntries, func(i, j int) bool {
+		return gitTreeSortKey(treeEntries[i]) < gitTreeSortKey(treeEntries[j])
+	})
+
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.TreeObject)
+	if err := (&object.Tree{Entries: treeEntries}).Encode(obj); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to encode tree object: %w", err)
+	}
+	mergedHash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to store tree object: %w", err)
+	}
+	return mergedHash, nil
+}
@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// wmemStashRefPrefix returns the ref prefix under which --capture-stash keeps stash entries of a workdir
+func wmemStashRefPrefix(workdirName string) string {
+	return fmt.Sprintf("refs/wmem-stash/%s/", workdirName)
+}
+
+// captureWorkdirStash copies the stash entries of a workdir into refs/wmem-stash/<workdir-name>/<n>
+// of the wmem-wd-repo (--capture-stash), <n> is the stash@{<n>} index
+// Stash commits aren't reachable from any branch and git-upload-pack refuses to send them
+// by hash, so their objects are copied from the workdir object store
+// Reference: docs/data-structures.md#wmem-stash
+func captureWorkdirStash(ctx context.Context, repo *git.Repository, workdirName string) error {
+	remote, err := repo.Remote("wmem-wd")
+	if err != nil {
+		return fmt.Errorf("failed to get workdir remote: %w", err)
+	}
+	workdirPath := remote.Config().URLs[0]
+
+	workdirRepo, err := git.PlainOpen(workdirPath)
+	if err != nil {
+		return fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+	entries, err := readStashEntries(workdirRepo, workdirPath)
+	if err != nil {
+		return err
+	}
+
+	stashRefPrefix := wmemStashRefPrefix(workdirName)
+	targetRepo := repo
+	if isBareReposShared() {
+		sharedRepoMu.Lock()
+		defer sharedRepoMu.Unlock()
+
+		targetRepo, err = openBareRepo(sharedRepoName)
+		if err != nil {
+			return fmt.Errorf("failed to open shared bare repository: %w", err)
+		}
+	}
+
+	stashRefs := make(map[plumbing.ReferenceName]plumbing.Hash)
+	for i, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		copied, err := copyStashObjects(workdirRepo, targetRepo, entry)
+		if err != nil {
+			return fmt.Errorf("failed to copy stash@{%d} of %s: %w", i, workdirPath, err)
+		}
+		if !copied {
+			printWarning("Skipping stash@{%d} of %s: its base commit %s isn't on any workdir branch\n", i, workdirPath, abbrevHash(entry.String()))
+			continue
+		}
+		stashRefs[plumbing.ReferenceName(fmt.Sprintf("%s%d", stashRefPrefix, i))] = entry
+	}
+
+	repos := []*git.Repository{repo}
+	if targetRepo != repo {
+		// The shared repo keeps the stash objects reachable, the wmem-wd-repo sees them through alternates
+		repos = append(repos, targetRepo)
+	}
+	for _, r := range repos {
+		if err := replaceRefsWithPrefix(r, stashRefPrefix, stashRefs); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Debug: Captured %d stash(es) of %s under %s\n", len(stashRefs), workdirName, stashRefPrefix)
+	return nil
+}
+
+// readStashEntries returns the stash commits of a workdir, stash@{0} first
+// The entries come from the refs/stash reflog, refs/stash alone is used when there is none
+func readStashEntries(workdirRepo *git.Repository, workdirPath string) ([]plumbing.Hash, error) {
+	stashRef, err := workdirRepo.Reference(plumbing.ReferenceName("refs/stash"), true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refs/stash: %w", err)
+	}
+
+	gitDir, err := workdirGitDir(workdirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find workdir git directory: %w", err)
+	}
+	file, err := os.Open(filepath.Join(gitDir, "logs", "refs", "stash"))
+	if os.IsNotExist(err) {
+		return []plumbing.Hash{stashRef.Hash()}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stash reflog: %w", err)
+	}
+	defer file.Close()
+
+	// Reflog lines are "<old> <new> <ident> <time> <tz>\t<message>", the newest last
+	var entries []plumbing.Hash
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !plumbing.IsHash(fields[1]) {
+			continue
+		}
+		entries = append([]plumbing.Hash{plumbing.NewHash(fields[1])}, entries...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stash reflog: %w", err)
+	}
+	if len(entries) == 0 || entries[0] != stashRef.Hash() {
+		return []plumbing.Hash{stashRef.Hash()}, nil
+	}
+	return entries, nil
+}
+
+// copyStashObjects copies a stash commit, its index and untracked files commits and their trees
+// The first parent (HEAD when stashing) must already be fetched, false is returned otherwise
+func copyStashObjects(srcRepo, dstRepo *git.Repository, stashHash plumbing.Hash) (bool, error) {
+	stash, err := srcRepo.CommitObject(stashHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to get stash commit: %w", err)
+	}
+	if len(stash.ParentHashes) == 0 {
+		return false, fmt.Errorf("stash commit %s has no parents", stashHash)
+	}
+	if _, err := dstRepo.CommitObject(stash.ParentHashes[0]); err != nil {
+		return false, nil
+	}
+
+	for _, parentHash := range stash.ParentHashes[1:] {
+		parent, err := srcRepo.CommitObject(parentHash)
+		if err != nil {
+			return false, fmt.Errorf("failed to get stash parent commit: %w", err)
+		}
+		if err := copyTreeObjects(srcRepo, dstRepo, parent.TreeHash); err != nil {
+			return false, err
+		}
+		if err := copyObject(srcRepo, dstRepo, parentHash); err != nil {
+			return false, fmt.Errorf("failed to copy commit %s: %w", parentHash, err)
+		}
+	}
+	if err := copyTreeObjects(srcRepo, dstRepo, stash.TreeHash); err != nil {
+		return false, err
+	}
+	if err := copyObject(srcRepo, dstRepo, stashHash); err != nil {
+		return false, fmt.Errorf("failed to copy commit %s: %w", stashHash, err)
+	}
+	return true, nil
+}
+
+// replaceRefsWithPrefix makes the refs of a repository under prefix exactly refs
+func replaceRefsWithPrefix(repo *git.Repository, prefix string, refs map[plumbing.ReferenceName]plumbing.Hash) error {
+	existing, err := listRefsWithPrefix(repo, prefix)
+	if err != nil {
+		return err
+	}
+	for name := range existing {
+		if _, exists := refs[name]; !exists {
+			if err := repo.Storer.RemoveReference(name); err != nil {
+				return fmt.Errorf("failed to remove reference %s: %w", name, err)
+			}
+		}
+	}
+	for name, hash := range refs {
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(name, hash)); err != nil {
+			return fmt.Errorf("failed to set reference %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// workdirPendingChanges tells whether the next git-wmem commit would snapshot a workdir
+// Read-only: nothing is fetched or written to the wmem-wd-repo, the workdir tree is built in memory
+// Workdir commits fetched before (log --workdir-status --fetch) are counted
+// Returns "" when the workdir is up to date, otherwise the reason of the pending snapshot
+// Reference: docs/use-cases/git-wmem-log/basic.md#workdir-status
+func workdirPendingChanges(workdirPath, workdirName string) (string, error) {
+	resolvedPath, err := resolveWorkdirPath(workdirPath)
+	if err != nil {
+		return "", err
+	}
+
+	currentBranchName, err := getCurrentBranchName(resolvedPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get current branch name: %w", err)
+	}
+
+	bareRepo, err := openBareRepo(workdirName)
+	if err != nil {
+		return "", fmt.Errorf("failed to open bare repository: %w", err)
+	}
+	wmemBranchName := wmemBranchNameFor(currentBranchName)
+	wmemBranchHashRef, err := bareRepo.Reference(plumbing.ReferenceName("refs/heads/"+wmemBranchName), true)
+	if err != nil {
+		return fmt.Sprintf("no %s snapshot yet", wmemBranchName), nil
+	}
+	wmemCommit, err := bareRepo.CommitObject(wmemBranchHashRef.Hash())
+	if err != nil {
+		return "", fmt.Errorf("failed to get wmem commit: %w", err)
+	}
+
+	// Step 5 of the next commit: new workdir commits get merged
+	workdirRepo, err := git.PlainOpen(resolvedPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+	head, err := workdirRepo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to get workdir HEAD: %w", err)
+	}
+	if _, err := bareRepo.CommitObject(head.Hash()); err != nil {
+		// Not fetched yet, so not merged either
+		return "new workdir commits", nil
+	}
+	unmerged, err := countUnmergedCommits(bareRepo, head.Hash(), wmemCommit.Hash)
+	if err != nil {
+		return "", err
+	}
+	if unmerged > 0 {
+		return fmt.Sprintf("new workdir commits: %d fetched", unmerged), nil
+	}
+
+	// Step 6 of the next commit: the filesystem differs from the last snapshot
+	memRepo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to init in-memory repository: %w", err)
+	}
+	treeHash, err := createTreeFromFilesystem(context.Background(), memRepo, resolvedPath, nil, treeWalkOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create tree from filesystem: %w", err)
+	}
+	if treeHash != wmemCommit.TreeHash {
+		return "uncommitted changes", nil
+	}
+	return "", nil
+}
+
+// countUnmergedCommits counts the commits reachable from commitHash but not from the wmem-br tip targetHash
+// The history of targetHash is collected once, the walk from commitHash stops at it
+func countUnmergedCommits(repo *git.Repository, commitHash, targetHash plumbing.Hash) (int, error) {
+	commit, err := repo.CommitObject(commitHash)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get workdir commit: %w", err)
+	}
+	merged, err := reachableCommits(repo, targetHash)
+	if err != nil {
+		return 0, err
+	}
+
+	unmerged := object.CommitFilter(func(c *object.Commit) bool { return !merged[c.Hash] })
+	isMerged := object.CommitFilter(func(c *object.Commit) bool { return merged[c.Hash] })
+
+	count := 0
+	err = object.NewFilterCommitIter(commit, &unmerged, &isMerged).ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to walk workdir commits: %w", err)
+	}
+	return count, nil
+}
+
+// displayWorkdirStatus prints the git-wmem log --workdir-status banner, one line per workdir
+// With fetch (--fetch) new workdir commits are fetched into the wmem-wd-repos first (step 4 of git-wmem commit)
+// Reference: docs/use-cases/git-wmem-log/basic.md#workdir-status
+func displayWorkdirStatus(workdirMap WorkdirMap, fetch bool) error {
+	workdirPaths, err := readWorkdirPaths()
+	if err != nil {
+		return fmt.Errorf("failed to read workdir paths: %w", err)
+	}
+
+	fmt.Println("Workdir status:")
+	for _, workdirPath := range workdirPaths {
+		workdirName, exists := FindWorkdirName(workdirPath, workdirMap)
+		if !exists {
+			fmt.Printf("  %s: unknown (not in workdir map, run git-wmem commit)\n", workdirPath)
+			continue
+		}
+		if fetch {
+			if err := fetchLatestChanges(context.Background(), workdirName, CommitOptions{}); err != nil {
+				fmt.Printf("  %s: unknown (%v)\n", workdirPath, err)
+				continue
+			}
+		}
+		reason, err := workdirPendingChanges(workdirPath, workdirName)
+		switch {
+		case err != nil:
+			fmt.Printf("  %s: unknown (%v)\n", workdirPath, err)
+		case reason != "":
+			fmt.Printf("  %s: pending changes (%s)\n", workdirPath, reason)
+		default:
+			fmt.Printf("  %s: up to date\n", workdirPath)
+		}
+	}
+	fmt.Println()
+	return nil
+}
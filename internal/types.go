@@ -59,12 +59,261 @@ type wmemTreeCacheEntry struct {
 	cacheTime   time.Time
 }
 
+// WorkdirCommitKind tells what a git-wmem-commit run created in a wmem-wd-repo
+type WorkdirCommitKind string
+
+const (
+	// WorkdirCommitNone means no new commit (no changes, skipped or failed workdir)
+	WorkdirCommitNone WorkdirCommitKind = "none"
+	// WorkdirCommitMerge means only a merge commit of new workdir commits (step 5)
+	WorkdirCommitMerge WorkdirCommitKind = "merge"
+	// WorkdirCommitFastForward means wmem-br was fast-forwarded to new workdir commits (step 5, --post-merge-ff)
+	WorkdirCommitFastForward WorkdirCommitKind = "fast-forward"
+	// WorkdirCommitRegular means a regular snapshot commit of uncommitted changes (steps 7-8),
+	// possibly on top of a merge commit (see MergeCommit)
+	WorkdirCommitRegular WorkdirCommitKind = "regular"
+)
+
 // WorkdirCommitResult contains information about a workdir commit
+// It is also the per-workdir entry of the commit --report file
 type WorkdirCommitResult struct {
-	WorkdirName string
-	BranchName  string
-	CommitHash  string
-	HasChanges  bool
+	WorkdirName string `json:"workdirName"`
+	WorkdirPath string `json:"workdirPath"`
+	BranchName  string `json:"branch"`
+	// OldTip and NewTip are the wmem-br/<branch> commits before and after this run
+	OldTip string `json:"oldTip"`
+	NewTip string `json:"newTip"`
+	// CommitHash is the new regular snapshot commit, empty if none was created
+	CommitHash   string            `json:"commitHash"`
+	HasChanges   bool              `json:"hasChanges"`
+	MergeCommit  bool              `json:"mergeCommit"`
+	Kind         WorkdirCommitKind `json:"kind"`
+	FilesChanged int               `json:"filesChanged"`
+	SkipReason   string            `json:"skipReason,omitempty"`
+	// IndexCommitHash is the new wmem-br/<branch>-index snapshot of --snapshot-worktree-and-index
+	IndexCommitHash string `json:"indexCommitHash,omitempty"`
+	// Renames are the "<old> -> <new>" renames of the regular snapshot commit (--detect-moves)
+	Renames []string `json:"renames,omitempty"`
+	// Upstream is the branch the workdir branch tracked (--record-upstream), nil without one
+	Upstream *UpstreamStatus `json:"upstream,omitempty"`
+}
+
+// UpstreamStatus is the upstream (@{upstream}) of a workdir branch and how far the workdir HEAD was from it
+type UpstreamStatus struct {
+	// Ref is the short upstream name, e.g. origin/main
+	Ref    string `json:"ref"`
+	Ahead  int    `json:"ahead"`
+	Behind int    `json:"behind"`
+	// Gone is set when the upstream ref doesn't exist (anymore), Ahead and Behind are 0 then
+	Gone bool `json:"gone,omitempty"`
+}
+
+// RemotesOptions controls optional behaviour of git-wmem remotes
+type RemotesOptions struct {
+	// Fix points mismatched wmem-wd remotes at the workdir-map path
+	Fix bool
+}
+
+// GcOptions controls optional behaviour of git-wmem gc
+type GcOptions struct {
+	// Aggressive repacks all reachable objects of each bare repo into a single pack
+	Aggressive bool
+}
+
+// FsckOptions controls optional behaviour of git-wmem fsck
+type FsckOptions struct {
+	// Fix resets broken wmem-br/<branch> branches to their last good commit
+	Fix bool
+}
+
+// ExportAllOptions controls optional behaviour of git-wmem export-all
+type ExportAllOptions struct {
+	// Output is the tar archive to write, stdout when empty
+	Output string
+	// OutputDir writes the files to <OutputDir>/<wmem-uid>/ instead of a tar archive
+	OutputDir string
+	// HardlinkDedupe hardlinks identical files (same blob and mode) across the exported snapshots (--output-dir)
+	HardlinkDedupe bool
+}
+
+// InitOptions controls optional behaviour of git-wmem-init
+type InitOptions struct {
+	// BareReposShared stores objects of all wmem-wd-repos in repos/_shared.git via alternates
+	BareReposShared bool
+	// NoCommit skips the initial commit, the first git-wmem commit creates it
+	NoCommit bool
+	// GitignoreExtra patterns are appended to the default .gitignore of the wmem-repo
+	GitignoreExtra []string
+}
+
+// HistoryOptions controls optional behaviour of git-wmem-history
+type HistoryOptions struct {
+	// Branch is the workdir branch whose wmem-br/<branch> history is shown (empty = wmem-br/head)
+	Branch string
+	// Patch prints a unified diff to the previous version of the file for each snapshot
+	Patch bool
+}
+
+// LogOptions controls optional behaviour of git-wmem-log
+type LogOptions struct {
+	// JSON prints the log as a JSON document instead of the text format
+	JSON bool
+	// NoPager writes directly to stdout even when it is a terminal
+	NoPager bool
+	// UIDOnly prints only the wmem-uid of each commit, one per line
+	UIDOnly bool
+	// SinceUID shows only commits newer than this wmem-uid (full, partial or a wmem-repo revision)
+	SinceUID string
+	// Files lists the changed files of each workdir snapshot in a commit (expensive)
+	Files bool
+	// WorkdirStatus prints a banner telling which workdirs the next git-wmem commit would snapshot (expensive)
+	WorkdirStatus bool
+	// Parents prints the parent hashes of each workdir snapshot in a commit
+	Parents bool
+	// Check reports the commits skipped for lack of a valid wmem-uid line instead of printing the log
+	Check bool
+	// WorkdirPathStyle shows workdirs as the workdir-map path (rel, default), absolute path (abs) or workdir-name (name)
+	WorkdirPathStyle string
+	// Encoding is how messages with invalid UTF-8 or control characters are printed: escape (default), replace or raw
+	Encoding string
+	// StrictWorkdirs fails when a workdir in workdir-map has no openable bare repo instead of showing it as unknown
+	StrictWorkdirs bool
+	// Count prints a single line with the number of wmem commits, distinct workdirs and the date range instead of the log
+	Count bool
+	// Fetch fetches new workdir commits into the wmem-wd-repos before the WorkdirStatus banner
+	Fetch bool
+	// Pretty indents the JSON document, it is compact (one line) by default
+	Pretty bool
+	// DiffWmemRepo shows the diff of the wmem-repo's own files (md/, ...) of each commit against its parent
+	DiffWmemRepo bool
+	// WorkdirTreeSize shows the total blob size of each workdir snapshot tree, it walks every tree
+	WorkdirTreeSize bool
+	// Color is when to print colors: auto (terminal only, the default), always or never
+	Color string
+	// ColorByWorkdir prints each workdir in a color derived from its workdir-name
+	ColorByWorkdir bool
+	// WorkdirCount shows how many workdirs each commit snapshotted
+	WorkdirCount bool
+}
+
+// CommitOptions controls optional behaviour of git-wmem-commit
+type CommitOptions struct {
+	// FetchParallelism limits concurrent fetches in the fetch phase (0 = all workdirs at once)
+	FetchParallelism int
+	// CheckParallelism limits concurrent per-workdir checks (0 = all workdirs at once)
+	CheckParallelism int
+	// SnapshotIndex snapshots the workdir index (staged state) instead of the working tree
+	SnapshotIndex bool
+	// OnlyIfIdle skips workdirs with a merge, rebase, cherry-pick, ... in progress
+	OnlyIfIdle bool
+	// ReportPath writes a JSON run report to the given file
+	ReportPath string
+	// MaxFileCount aborts a workdir snapshot with more files than this (0 = unlimited)
+	MaxFileCount int
+	// Compress packs loose objects of changed wmem-wd-repos at the end of the run
+	Compress bool
+	// KeepEmptyDirs adds a placeholder file to empty directories so they persist in snapshots
+	KeepEmptyDirs bool
+	// VerifyAfter checks new commits of changed wmem-wd-repos for missing objects at the end of the run
+	VerifyAfter bool
+	// WorkdirTimeout is the deadline of each workdir fetch and check (0 = no deadline)
+	WorkdirTimeout time.Duration
+	// KeepGoing skips workdirs whose fetch or check failed instead of aborting the run
+	KeepGoing bool
+	// DedupeIdenticalTrees skips a snapshot commit whose tree equals the wmem-br/<branch> tip tree
+	DedupeIdenticalTrees bool
+	// RespectSparseCheckout keeps files outside a workdir's sparse-checkout cone instead of recording them as deleted
+	RespectSparseCheckout bool
+	// KeepCommitTimestamps gives merge commits the author/committer times of the merged workdir commit
+	KeepCommitTimestamps bool
+	// BatchSize creates a wmem-repo commit after every N workdirs instead of one at the end (0 = one commit)
+	BatchSize int
+	// TreatWarningsAsErrors fails the run after it completed if any warning was printed
+	TreatWarningsAsErrors bool
+	// ShallowTreeCompare skips the tree build for clean workdirs whose HEAD tree is the wmem-br tip tree
+	ShallowTreeCompare bool
+	// PostMergeFF fast-forwards wmem-br to new workdir commits instead of a merge commit when the workdir is clean
+	PostMergeFF bool
+	// IndexOnlyDetection detects workdir changes from the stat data of the workdir index, like git status
+	IndexOnlyDetection bool
+	// SnapshotTags mirrors workdir tags into refs/wmem-tags/<workdir-name>/* of the wmem-wd-repo
+	SnapshotTags bool
+	// AuthorDateFromSource dates the author of wmem-wd-repo commits from their source instead of the time of the run
+	AuthorDateFromSource bool
+	// CommitterDateFromSource dates the committer of wmem-wd-repo commits from their source instead of the time of the run
+	CommitterDateFromSource bool
+	// RefreshCache drops the persisted caches before the run, so everything is recomputed once
+	RefreshCache bool
+	// WorkdirOrder is the processing order of workdirs: config (as listed, default), alpha or mtime
+	WorkdirOrder string
+	// CaseConflictPolicy resolves names colliding case-insensitively: first, last, newest-mtime or error ("" keeps all)
+	CaseConflictPolicy string
+	// IncludeWmemRepo also snapshots the wmem-repo itself (without repos/) into repos/_wmem.git
+	IncludeWmemRepo bool
+	// ExcludeBranches skips workdirs whose current branch matches one of these patterns (with md/commit/branch-denylist)
+	ExcludeBranches []string
+	// AuthorRequired fails the run while md/commit/author or md/commit/committer is the git-wmem init placeholder
+	AuthorRequired bool
+	// FSMonitor asks the core.fsmonitor hook of each workdir which paths changed instead of the timestamp and status checks
+	FSMonitor bool
+	// NormalizeLineEndings stores CRLF as LF in snapshot blobs of text files, following .gitattributes text/binary
+	NormalizeLineEndings bool
+	// SkipCleanWorkdirsFast skips workdirs whose root directory and git files are older than their last check
+	SkipCleanWorkdirsFast bool
+	// CaptureStash copies workdir stash entries into refs/wmem-stash/<workdir-name>/<n> of the wmem-wd-repo
+	CaptureStash bool
+	// DumpTree prints the snapshot tree of this workdir path like git ls-tree -r -t instead of committing (debugging aid)
+	DumpTree string
+	// PreserveMtimeMetadata records the file mtimes of each snapshot in a refs/notes/wmem-mtime note of the snapshot commit
+	PreserveMtimeMetadata bool
+	// PathFilters limits snapshot trees to workdir files matching one of these .gitignore style patterns (empty = all files)
+	PathFilters []string
+	// AuthorFromWorkdirHead takes the author name and email of snapshot and merge commits from the workdir HEAD commit
+	AuthorFromWorkdirHead bool
+	// GroupByBranch groups the workdir bullets of the wmem-repo commit message into one section per branch
+	GroupByBranch bool
+	// SnapshotWorktreeAndIndex also snapshots the workdir index to wmem-br/<branch>-index
+	SnapshotWorktreeAndIndex bool
+	// DetectMoves records the file renames of regular snapshots in the wmem-repo commit message and the report
+	DetectMoves bool
+	// EmptyReposSkip skips init-repos checks of workdirs already mapped to an existing bare repo
+	EmptyReposSkip bool
+	// JSONReport prints the run report to stdout (progress goes to stderr) and enables the distinct exit statuses
+	JSONReport bool
+	// DedupeBlobsAcrossWorkdirs stores the snapshot blobs in repos/_shared.git instead of each wmem-wd-repo
+	DedupeBlobsAcrossWorkdirs bool
+	// AnnotateWmemUIDInWorkdir records the wmem-uid as a refs/notes/wmem note on the HEAD of snapshotted workdirs
+	AnnotateWmemUIDInWorkdir bool
+	// RequireCleanWmemRepo fails the run if the wmem-repo has uncommitted changes before it starts
+	RequireCleanWmemRepo bool
+	// NoFetch skips all workdir fetches, workdirs whose HEAD commit isn't in their wmem-wd-repo yet are skipped
+	NoFetch bool
+	// WorkdirFromStdin reads the workdir paths from stdin instead of md/commit-workdir-paths
+	WorkdirFromStdin bool
+	// IgnoreSubmoduleErrors omits nested repositories with an unborn or unreadable HEAD with a warning
+	IgnoreSubmoduleErrors bool
+	// SingleCommitPerRun records a new workdir HEAD and the uncommitted changes as one snapshot commit
+	SingleCommitPerRun bool
+	// AuthorEmailDomainCheck fails the run when the author or committer email isn't in a domain of md/commit/allowed-domains
+	AuthorEmailDomainCheck bool
+	// MaxTotalRuntime is the wall-clock budget of the run, no workdir starts after it (0 = no budget)
+	MaxTotalRuntime time.Duration
+	// VerifyWorkdirCleanAfter fails the run when a workdir's files or their mtimes changed during it
+	VerifyWorkdirCleanAfter bool
+	// BlobFilter is a command cleaning the content of files selected by md/commit/blob-filter-attributes
+	BlobFilter string
+	// Resume continues an interrupted run with its wmem-uid, skipping the workdirs it already snapshotted
+	Resume bool
+	// OnConflict is the policy for a workdir HEAD not merged into wmem-br yet: accept-workdir (merge) or skip
+	OnConflict string
+	// RecordUpstream records the upstream of each workdir branch and the ahead/behind counts in the report and the meta message
+	RecordUpstream bool
+	// DryRun lists the workdirs the run would snapshot and their changed files instead of committing
+	DryRun bool
+	// Diff adds the unified diff against the last snapshot tree to each workdir of DryRun
+	Diff bool
+	// MaxDepth skips directories nested deeper than this below a snapshot root with a warning (0 = unlimited)
+	MaxDepth int
 }
 
 // WorkdirMap represents the mapping of workdir paths to names
@@ -76,6 +325,10 @@ type CommitInfo struct {
 	Message   string
 	Author    string
 	Committer string
+	// Batch is "<n>/<count>" for the wmem-repo commits of a --batch-size run
+	Batch string
+	// GroupByBranch groups the workdir bullets of the wmem-repo commit message by branch (--group-by-branch)
+	GroupByBranch bool
 }
 
 // Global cache instance
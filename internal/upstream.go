@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// readWorkdirUpstream returns the upstream (@{upstream}) of branchName in the workdir and how far
+// HEAD is ahead of and behind it, nil for a branch without an upstream (--record-upstream)
+// Reference: docs/use-cases/git-wmem-commit/basic.md#record-upstream
+func readWorkdirUpstream(workdirPath, branchName string) (*UpstreamStatus, error) {
+	repo, err := git.PlainOpen(workdirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workdir config: %w", err)
+	}
+	branch, ok := cfg.Branches[branchName]
+	if !ok || branch.Remote == "" || branch.Merge == "" {
+		return nil, nil
+	}
+
+	// Like git, "." tracks a local branch and a remote branch is read from its remote-tracking ref
+	upstreamRef := branch.Merge
+	status := &UpstreamStatus{Ref: branch.Merge.Short()}
+	if branch.Remote != "." {
+		upstreamRef = plumbing.NewRemoteReferenceName(branch.Remote, branch.Merge.Short())
+		status.Ref = branch.Remote + "/" + branch.Merge.Short()
+	}
+	upstream, err := repo.Reference(upstreamRef, true)
+	if err == plumbing.ErrReferenceNotFound {
+		status.Gone = true
+		return status, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve upstream %s: %w", status.Ref, err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workdir HEAD: %w", err)
+	}
+
+	headCommits, err := reachableCommits(repo, head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	upstreamCommits, err := reachableCommits(repo, upstream.Hash())
+	if err != nil {
+		return nil, err
+	}
+	for hash := range headCommits {
+		if !upstreamCommits[hash] {
+			status.Ahead++
+		}
+	}
+	for hash := range upstreamCommits {
+		if !headCommits[hash] {
+			status.Behind++
+		}
+	}
+	return status, nil
+}
+
+// reachableCommits returns the commits reachable from tip, tip included
+func reachableCommits(repo *git.Repository, tip plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	commit, err := repo.CommitObject(tip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", abbrevHash(tip.String()), err)
+	}
+	commits := make(map[plumbing.Hash]bool)
+	err = object.NewCommitPreorderIter(commit, nil, nil).ForEach(func(c *object.Commit) error {
+		commits[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk history of %s: %w", abbrevHash(tip.String()), err)
+	}
+	return commits, nil
+}
+
+// String formats the status for the wmem-repo commit message, e.g. "origin/main ahead 2, behind 0"
+func (s *UpstreamStatus) String() string {
+	if s.Gone {
+		return s.Ref + " gone"
+	}
+	return fmt.Sprintf("%s ahead %d, behind %d", s.Ref, s.Ahead, s.Behind)
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"fmt"
+)
+
+// ValidatePathsWmem runs the workdir-path validation of git-wmem commit over md/commit-workdir-paths
+// Read-only: no bare repos are created and workdir-map isn't touched
+// Reference: docs/use-cases/git-wmem-validate-paths/basic.md
+func ValidatePathsWmem() error {
+	if !isWmemRepo() {
+		return fmt.Errorf("not in a wmem repository (missing .git-wmem file). Run this command from a wmem-repo directory.")
+	}
+
+	workdirPaths, err := readWorkdirPaths()
+	if err != nil {
+		return fmt.Errorf("failed to read workdir paths: %w", err)
+	}
+	if len(workdirPaths) == 0 {
+		fmt.Println("No workdir paths in md/commit-workdir-paths")
+		return nil
+	}
+
+	failed := 0
+	for _, workdirPath := range workdirPaths {
+		if err := validateWorkdirPath(workdirPath); err != nil {
+			failed++
+			fmt.Printf("%s: invalid (%v)\n", workdirPath, err)
+			continue
+		}
+		fmt.Printf("%s: ok\n", workdirPath)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d workdir path(s) failed validation", failed, len(workdirPaths))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// verifyChangedBareRepos checks the new commits of the wmem-wd-repos changed in this run for missing objects
+// Reference: docs/validations.md#verify-after-commit
+func verifyChangedBareRepos(workdirResults []WorkdirCommitResult) error {
+	for _, result := range workdirResults {
+		if result.NewTip == "" || result.NewTip == result.OldTip {
+			continue
+		}
+
+		repo, err := openBareRepo(result.WorkdirName)
+		if err != nil {
+			return fmt.Errorf("failed to open bare repository repos/%s.git: %w", result.WorkdirName, err)
+		}
+
+		objectCount, err := verifyCommitObjects(repo, plumbing.NewHash(result.NewTip))
+		if err != nil {
+			return fmt.Errorf("verify failed for repos/%s.git (workdir %s): %w", result.WorkdirName, result.WorkdirPath, err)
+		}
+		fmt.Printf("Info: Verified %d object(s) of %s in repos/%s.git\n", objectCount, abbrevHash(result.NewTip), result.WorkdirName)
+	}
+	return nil
+}
+
+// verifyCommitObjects checks that a commit, its parents and all trees and blobs of its tree exist
+// Returns the number of checked objects
+func verifyCommitObjects(repo *git.Repository, commitHash plumbing.Hash) (int, error) {
+	return verifyCommitObjectsSeen(repo, commitHash, make(map[plumbing.Hash]bool))
+}
+
+// verifyCommitObjectsSeen is verifyCommitObjects skipping the trees and blobs in visited and adding
+// the checked ones, so the commits of a history share the work
+// After an error visited may hold objects whose subtrees weren't checked, it must not be reused
+func verifyCommitObjectsSeen(repo *git.Repository, commitHash plumbing.Hash, visited map[plumbing.Hash]bool) (int, error) {
+	commit, err := repo.CommitObject(commitHash)
+	if err != nil {
+		return 0, fmt.Errorf("missing commit %s: %w", commitHash, err)
+	}
+	for _, parentHash := range commit.ParentHashes {
+		if _, err := repo.Storer.EncodedObject(plumbing.CommitObject, parentHash); err != nil {
+			return 0, fmt.Errorf("commit %s: missing parent commit %s: %w", commitHash, parentHash, err)
+		}
+	}
+
+	type pendingTree struct {
+		hash plumbing.Hash
+		path string
+	}
+
+	objectCount := 1 + len(commit.ParentHashes)
+	stack := []pendingTree{{hash: commit.TreeHash, path: ""}}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[current.hash] {
+			continue
+		}
+		visited[current.hash] = true
+		objectCount++
+
+		tree, err := object.GetTree(repo.Storer, current.hash)
+		if err != nil {
+			return objectCount, fmt.Errorf("commit %s: missing tree %s (%s): %w", commitHash, current.hash, displayTreePath(current.path), err)
+		}
+
+		for _, entry := range tree.Entries {
+			entryPath := path.Join(current.path, entry.Name)
+			switch entry.Mode {
+			case filemode.Dir:
+				stack = append(stack, pendingTree{hash: entry.Hash, path: entryPath})
+			case filemode.Submodule:
+				// Gitlinks point to commits of other repositories
+			default:
+				if visited[entry.Hash] {
+					continue
+				}
+				visited[entry.Hash] = true
+				objectCount++
+				if _, err := repo.Storer.EncodedObject(plumbing.BlobObject, entry.Hash); err != nil {
+					return objectCount, fmt.Errorf("commit %s: missing blob %s (%s): %w", commitHash, entry.Hash, entryPath, err)
+				}
+			}
+		}
+	}
+	return objectCount, nil
+}
+
+// displayTreePath returns a tree path for messages, "/" for the root tree
+func displayTreePath(treePath string) string {
+	if treePath == "" {
+		return "/"
+	}
+	return treePath
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// storeTestCommit stores a commit of the given tree and returns its hash
+func storeTestCommit(t *testing.T, repo *git.Repository, treeHash plumbing.Hash) plumbing.Hash {
+	t.Helper()
+	signature := object.Signature{Name: "Test", Email: "test@example.com", When: time.Unix(0, 0)}
+	commit := &object.Commit{Author: signature, Committer: signature, Message: "test", TreeHash: treeHash}
+	obj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		t.Fatalf("failed to encode commit: %v", err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("failed to store commit: %v", err)
+	}
+	return hash
+}
+
+// TestVerifyCommitObjects_Complete verifies a commit with all objects present
+func TestVerifyCommitObjects_Complete(t *testing.T) {
+	repo := newTestMemoryRepo(t)
+
+	blobHash := storeTestBlob(t, repo, "content")
+	subTreeHash := storeTestTree(t, repo, []object.TreeEntry{{Name: "file.txt", Mode: filemode.Regular, Hash: blobHash}})
+	rootTreeHash := storeTestTree(t, repo, []object.TreeEntry{
+		{Name: "a", Mode: filemode.Dir, Hash: subTreeHash},
+		{Name: "b", Mode: filemode.Dir, Hash: subTreeHash},
+		{Name: "nested-repo", Mode: filemode.Submodule, Hash: plumbing.NewHash("1111111111111111111111111111111111111111")},
+	})
+	commitHash := storeTestCommit(t, repo, rootTreeHash)
+
+	objectCount, err := verifyCommitObjects(repo, commitHash)
+	if err != nil {
+		t.Fatalf("verifyCommitObjects failed: %v", err)
+	}
+	// commit, root tree, shared subtree, blob
+	if objectCount != 4 {
+		t.Errorf("expected 4 verified objects, got %d", objectCount)
+	}
+}
+
+// TestVerifyCommitObjects_MissingBlob fails on a tree referencing a blob that was never stored
+func TestVerifyCommitObjects_MissingBlob(t *testing.T) {
+	repo := newTestMemoryRepo(t)
+
+	missingBlob := plumbing.NewHash("2222222222222222222222222222222222222222")
+	subTreeHash := storeTestTree(t, repo, []object.TreeEntry{{Name: "lost.txt", Mode: filemode.Regular, Hash: missingBlob}})
+	rootTreeHash := storeTestTree(t, repo, []object.TreeEntry{{Name: "dir", Mode: filemode.Dir, Hash: subTreeHash}})
+	commitHash := storeTestCommit(t, repo, rootTreeHash)
+
+	_, err := verifyCommitObjects(repo, commitHash)
+	if err == nil {
+		t.Fatalf("expected verifyCommitObjects to fail on a missing blob")
+	}
+	if !strings.Contains(err.Error(), "missing blob "+missingBlob.String()+" (dir/lost.txt)") {
+		t.Errorf("expected error naming the missing blob and its path, got: %v", err)
+	}
+}
+
+// TestVerifyCommitObjects_MissingTree fails on a tree referencing a subtree that was never stored
+func TestVerifyCommitObjects_MissingTree(t *testing.T) {
+	repo := newTestMemoryRepo(t)
+
+	missingTree := plumbing.NewHash("3333333333333333333333333333333333333333")
+	rootTreeHash := storeTestTree(t, repo, []object.TreeEntry{{Name: "subdir", Mode: filemode.Dir, Hash: missingTree}})
+	commitHash := storeTestCommit(t, repo, rootTreeHash)
+
+	_, err := verifyCommitObjects(repo, commitHash)
+	if err == nil {
+		t.Fatalf("expected verifyCommitObjects to fail on a missing tree")
+	}
+	if !strings.Contains(err.Error(), "missing tree "+missingTree.String()+" (subdir)") {
+		t.Errorf("expected error naming the missing tree and its path, got: %v", err)
+	}
+}
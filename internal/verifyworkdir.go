@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// workdirFingerprint hashes the path, mode, size and mtime of every file and directory of a workdir,
+// .git directories excluded (fetches read them, --annotate-wmem-uid-in-workdir writes notes there)
+// Reference: docs/validations.md#verify-workdir-clean-after
+func workdirFingerprint(workdirPath string) (string, error) {
+	hash := sha256.New()
+	err := filepath.WalkDir(workdirPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return fs.SkipDir
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(workdirPath, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\t%v\t%d\t%d\n", filepath.ToSlash(relPath), info.Mode(), info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to walk workdir %s: %w", workdirPath, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// recordWorkdirFingerprints fingerprints the workdirs before the run (--verify-workdir-clean-after)
+// Workdirs that can't be read are left out, the run reports them anyway
+func recordWorkdirFingerprints(workdirPaths []string) map[string]string {
+	fingerprints := make(map[string]string)
+	for _, workdirPath := range workdirPaths {
+		resolvedPath, err := resolveWorkdirPath(workdirPath)
+		if err != nil {
+			continue
+		}
+		fingerprint, err := workdirFingerprint(resolvedPath)
+		if err != nil {
+			continue
+		}
+		fingerprints[workdirPath] = fingerprint
+	}
+	return fingerprints
+}
+
+// verifyWorkdirFingerprints fails when a workdir fingerprint changed during the run
+func verifyWorkdirFingerprints(before map[string]string, workdirPaths []string) error {
+	verified := 0
+	for _, workdirPath := range workdirPaths {
+		fingerprint, ok := before[workdirPath]
+		if !ok {
+			continue
+		}
+		resolvedPath, err := resolveWorkdirPath(workdirPath)
+		if err != nil {
+			return fmt.Errorf("failed to verify workdir %s: %w", workdirPath, err)
+		}
+		after, err := workdirFingerprint(resolvedPath)
+		if err != nil {
+			return fmt.Errorf("failed to verify workdir %s: %w", workdirPath, err)
+		}
+		if after != fingerprint {
+			return fmt.Errorf("workdir %s changed during the run (--verify-workdir-clean-after): file list or mtimes differ, fingerprint %s -> %s", workdirPath, abbrevHash(fingerprint), abbrevHash(after))
+		}
+		verified++
+	}
+	fmt.Printf("Info: Verified %d workdir(s) unchanged by the run (--verify-workdir-clean-after)\n", verified)
+	return nil
+}
@@ -0,0 +1,15 @@
+package internal
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// warningCount counts the warnings printed by printWarning in this process
+var warningCount atomic.Int64
+
+// printWarning prints a "Warning:" line and counts it for git-wmem commit --treat-warnings-as-errors
+func printWarning(format string, args ...any) {
+	warningCount.Add(1)
+	fmt.Printf("Warning: "+format, args...)
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// wmemNotesRef is the notes ref of a workdir-repo --annotate-wmem-uid-in-workdir records wmem-uids in
+const wmemNotesRef = plumbing.ReferenceName("refs/notes/wmem")
+
+// annotateWorkdirHeads attaches the wmem-uid of this run as a git note in refs/notes/wmem of the
+// workdir-repo to the HEAD commit of each snapshotted workdir (--annotate-wmem-uid-in-workdir)
+// A HEAD snapshotted by several runs gets all their wmem-uids, one per line, oldest first
+// Failures are warnings, the snapshots are already committed
+// Reference: docs/use-cases/git-wmem-commit/basic.md#annotate-wmem-uid-in-workdir
+func annotateWorkdirHeads(commitInfo *CommitInfo, workdirResults []WorkdirCommitResult) error {
+	signature, err := parseSignature(commitInfo.Committer)
+	if err != nil {
+		return fmt.Errorf("failed to parse committer: %w", err)
+	}
+
+	annotated := 0
+	for _, result := range workdirResults {
+		if result.Kind == WorkdirCommitNone && result.IndexCommitHash == "" {
+			continue
+		}
+		if err := annotateWorkdirHead(result.WorkdirPath, commitInfo.WmemUID, signature); err != nil {
+			printWarning("Failed to annotate HEAD of workdir %s with %s: %v\n", result.WorkdirPath, commitInfo.WmemUID, err)
+			continue
+		}
+		annotated++
+	}
+	fmt.Printf("Info: Annotated HEAD of %d workdir(s) with %s in %s\n", annotated, commitInfo.WmemUID, wmemNotesRef)
+	return nil
+}
+
+// annotateWorkdirHead adds wmemUID to the refs/notes/wmem note of the workdir HEAD commit
+// Only the notes ref and its objects are written, the workdir branches, index and files stay untouched
+func annotateWorkdirHead(workdirPath, wmemUID string, signature *object.Signature) error {
+	expandedPath, err := expandWorkdirPath(workdirPath)
+	if err != nil {
+		return err
+	}
+	workdirRepo, err := git.PlainOpen(expandedPath)
+	if err != nil {
+		return fmt.Errorf("failed to open workdir repository: %w", err)
+	}
+	head, err := workdirRepo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		// No commit to attach a note to yet
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	note, err := readNote(workdirRepo, wmemNotesRef, head.Hash())
+	if err != nil {
+		return err
+	}
+	uids := strings.Fields(note)
+	for _, uid := range uids {
+		if uid == wmemUID {
+			return nil
+		}
+	}
+	uids = append(uids, wmemUID)
+
+	blobHash, err := storeNoteBlob(workdirRepo, strings.Join(uids, "\n")+"\n")
+	if err != nil {
+		return err
+	}
+	return addNote(workdirRepo, wmemNotesRef, head.Hash(), blobHash, signature)
+}
+
+// readNote returns the note of a commit in a notes ref, empty without one
+// Only notes stored without fanout are found, like addNote writes them
+func readNote(repo *git.Repository, notesRef plumbing.ReferenceName, commitHash plumbing.Hash) (string, error) {
+	ref, err := repo.Reference(notesRef, true)
+	if err == plumbing.ErrReferenceNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s: %w", notesRef, err)
+	}
+	notesCommit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s commit: %w", notesRef, err)
+	}
+	notesTree, err := notesCommit.Tree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s tree: %w", notesRef, err)
+	}
+	entry, err := notesTree.FindEntry(commitHash.String())
+	if err == object.ErrEntryNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find note of %s: %w", commitHash, err)
+	}
+	blob, err := repo.BlobObject(entry.Hash)
+	if err != nil {
+		return "", fmt.Errorf("failed to get note blob: %w", err)
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return "", fmt.Errorf("failed to read note blob: %w", err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to read note blob: %w", err)
+	}
+	return string(content), nil
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// wmemRepoName is the name of the bare repository in repos/ holding snapshots of the wmem-repo itself
+// Reference: docs/use-cases/git-wmem-commit/basic.md#including-the-wmem-repo
+const wmemRepoName = "_wmem"
+
+// isReservedRepoName tells whether a name in repos/ is taken by git-wmem itself
+func isReservedRepoName(name string) bool {
+	return name == sharedRepoName || name == wmemRepoName
+}
+
+// snapshotWmemRepo snapshots the wmem-repo (without repos/) into wmem-br/<branch> of repos/_wmem.git
+// Like a regular workdir snapshot, but only regular commits: the wmem-repo history isn't merged
+// Returns false when the wmem-repo didn't change since the last snapshot
+// Reference: docs/use-cases/git-wmem-commit/basic.md#including-the-wmem-repo
+func snapshotWmemRepo(commitInfo *CommitInfo, opts CommitOptions) (bool, error) {
+	bareRepo, err := openBareRepo(wmemRepoName)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		if _, err := git.PlainInit(filepath.Join("repos", wmemRepoName+".git"), true); err != nil {
+			return false, fmt.Errorf("failed to create bare repository: %w", err)
+		}
+		bareRepo, err = openBareRepo(wmemRepoName)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open bare repository: %w", err)
+	}
+
+	wmemRoot, err := filepath.Abs(".")
+	if err != nil {
+		return false, fmt.Errorf("failed to get absolute wmem-repo path: %w", err)
+	}
+	currentBranchName, err := getCurrentBranchName(wmemRoot)
+	if err != nil {
+		return false, fmt.Errorf("failed to get current branch name: %w", err)
+	}
+
+	walk, err := newTreeWalkOptions(opts, wmemRoot)
+	if err != nil {
+		return false, err
+	}
+	// --path-filter selects files of workdirs, the wmem-repo snapshot is always complete
+	walk.pathFilter = nil
+	treeHash, err := createTreeFromFilesystem(context.Background(), bareRepo, wmemRoot, &fileCountLimit{max: opts.MaxFileCount}, walk)
+	if err != nil {
+		return false, fmt.Errorf("failed to create tree from wmem-repo: %w", err)
+	}
+	// repos/ is ignored by the .gitignore of git-wmem init, but never snapshot bare repos into a bare repo
+	treeHash, err = withoutRootEntry(bareRepo, treeHash, "repos")
+	if err != nil {
+		return false, err
+	}
+
+	wmemBranchRef := plumbing.ReferenceName("refs/heads/" + wmemBranchNameFor(currentBranchName))
+	var parentHashes []plumbing.Hash
+	if tipRef, err := bareRepo.Reference(wmemBranchRef, true); err == nil {
+		tip, err := bareRepo.CommitObject(tipRef.Hash())
+		if err != nil {
+			return false, fmt.Errorf("failed to get %s commit: %w", wmemBranchRef.Short(), err)
+		}
+		if tip.TreeHash == treeHash {
+			return false, nil
+		}
+		parentHashes = []plumbing.Hash{tip.Hash}
+	}
+
+	author, committer, err := parseCommitSignatures(commitInfo, time.Time{}, time.Time{}, opts)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse commit signatures: %w", err)
+	}
+	commit := &object.Commit{
+		Message:      commitInfo.Message + workdirBranchNote(currentBranchName),
+		TreeHash:     treeHash,
+		ParentHashes: parentHashes,
+		Author:       *author,
+		Committer:    *committer,
+	}
+	obj := bareRepo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return false, fmt.Errorf("failed to encode commit: %w", err)
+	}
+	commitHash, err := bareRepo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return false, fmt.Errorf("failed to store commit: %w", err)
+	}
+
+	if err := setWmemBranchTips(bareRepo, wmemBranchRef, commitHash); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// withoutRootEntry returns the hash of the tree without its top-level entry name
+func withoutRootEntry(repo *git.Repository, treeHash plumbing.Hash, name string) (plumbing.Hash, error) {
+	tree, err := repo.TreeObject(treeHash)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to get tree %s: %w", treeHash, err)
+	}
+
+	var entries []object.TreeEntry
+	for _, entry := range tree.Entries {
+		if entry.Name != name {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == len(tree.Entries) {
+		return treeHash, nil
+	}
+
+	obj := repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{Entries: entries}).Encode(obj); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to encode tree: %w", err)
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
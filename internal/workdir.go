@@ -3,10 +3,13 @@ package internal
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-git/go-git/v5"
@@ -23,20 +26,103 @@ func readWorkdirPaths() ([]string, error) {
 		}
 		return nil, err
 	}
+	return parseWorkdirPaths(string(content), "md/commit-workdir-paths")
+}
+
+// readWorkdirPathsFrom reads the workdir paths from r, one path per line (--workdir-from-stdin)
+// Reference: docs/use-cases/git-wmem-commit/basic.md#workdir-paths-from-stdin
+func readWorkdirPathsFrom(r io.Reader) ([]string, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseWorkdirPaths(string(content), "stdin")
+}
 
-	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+// parseWorkdirPaths parses the workdir path lines of source, empty lines are skipped
+func parseWorkdirPaths(content, source string) ([]string, error) {
+	lines := strings.Split(strings.TrimSpace(content), "\n")
 	var paths []string
+	seen := make(map[string]string)
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if line != "" {
 			// Don't normalize path during reading - validation should check original format
-			paths = append(paths, line)
+			// Only paths using ~ or environment variables are expanded and normalized
+			expanded, err := expandWorkdirPath(line)
+			if err != nil {
+				return nil, err
+			}
+
+			// The same workdir listed twice (e.g. ../x and ../x/) is processed once
+			// Reference: docs/validations.md#unique-workdir-paths
+			if first, exists := seen[filepath.Clean(expanded)]; exists {
+				printWarning("Duplicate workdir path %s in %s (same as %s), ignoring it\n", line, source, first)
+				continue
+			}
+			seen[filepath.Clean(expanded)] = line
+			paths = append(paths, expanded)
 		}
 	}
 
 	return paths, nil
 }
 
+// allowAbsoluteWorkdirPathsPath opts in to workdir paths expanding to an absolute path (e.g. ~/project)
+// Reference: docs/validations.md#path-expansion
+const allowAbsoluteWorkdirPathsPath = "md/allow-absolute-workdir-paths"
+
+// expandWorkdirPath expands a leading ~ and $VAR/${VAR} references in a workdir path
+// An expanded absolute path is an error unless md/allow-absolute-workdir-paths exists, it is then made
+// relative to the wmem-repo
+// Reference: docs/validations.md#path-expansion
+func expandWorkdirPath(workdirPath string) (string, error) {
+	hasHome := workdirPath == "~" || strings.HasPrefix(workdirPath, "~/")
+	if !hasHome && !strings.Contains(workdirPath, "$") {
+		return workdirPath, nil
+	}
+
+	expanded := workdirPath
+	if hasHome {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to expand ~ in workdir path %s: %w", workdirPath, err)
+		}
+		expanded = homeDir + strings.TrimPrefix(expanded, "~")
+	}
+
+	var undefinedVar string
+	expanded = os.Expand(expanded, func(name string) string {
+		value, found := os.LookupEnv(name)
+		if !found && undefinedVar == "" {
+			undefinedVar = name
+		}
+		return value
+	})
+	if undefinedVar != "" {
+		return "", fmt.Errorf("undefined environment variable $%s in workdir path %s", undefinedVar, workdirPath)
+	}
+
+	expanded = filepath.Clean(expanded)
+	if filepath.IsAbs(expanded) {
+		if _, err := os.Stat(allowAbsoluteWorkdirPathsPath); err != nil {
+			return "", fmt.Errorf("workdir path %s expands to the absolute path %s, use a ../ path or create %s to allow it", workdirPath, expanded, allowAbsoluteWorkdirPathsPath)
+		}
+		wmemRepoPath, err := filepath.Abs(".")
+		if err != nil {
+			return "", fmt.Errorf("failed to get wmem-repo path: %w", err)
+		}
+		expanded, err = filepath.Rel(wmemRepoPath, expanded)
+		if err != nil {
+			return "", fmt.Errorf("failed to make workdir path %s relative: %w", workdirPath, err)
+		}
+	}
+
+	expanded = filepath.ToSlash(expanded)
+	fmt.Printf("Debug: Expanded workdir path %s to %s\n", workdirPath, expanded)
+	return expanded, nil
+}
+
 // validateWorkdirPath validates a workdir path according to the rules
 // Reference: docs/validations.md#workdir-path-requirements
 func validateWorkdirPath(workdirPath string) error {
@@ -104,11 +190,111 @@ func validateWorkdirPath(workdirPath string) error {
 	return nil
 }
 
+// resolveWorkdirPath resolves symlinks in a workdir-path so the tree walk and go-git
+// operate on the same canonical directory
+// Paths without symlinks are returned unchanged (still relative), so messages keep the configured form
+// Reference: docs/validations.md#symlinked-workdirs
+func resolveWorkdirPath(workdirPath string) (string, error) {
+	resolvedPath, err := filepath.EvalSymlinks(workdirPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve workdir path %s: %w", workdirPath, err)
+	}
+	return filepath.Clean(resolvedPath), nil
+}
+
+// workdirGitDir returns the git directory of a workdir
+// Supports `.git` files with a `gitdir:` line (linked worktrees, submodules)
+func workdirGitDir(workdirPath string) (string, error) {
+	gitPath := filepath.Join(workdirPath, ".git")
+	info, err := os.Stat(gitPath)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return gitPath, nil
+	}
+
+	content, err := os.ReadFile(gitPath)
+	if err != nil {
+		return "", err
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(content)), "gitdir:"))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(workdirPath, gitDir)
+	}
+	return gitDir, nil
+}
+
+// isWorkdirIndexLocked checks for .git/index.lock left by a running (or crashed) git process
+// Reference: docs/validations.md#workdir-index-lock
+func isWorkdirIndexLocked(workdirPath string) (bool, error) {
+	gitDir, err := workdirGitDir(workdirPath)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(filepath.Join(gitDir, "index.lock"))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// gitOperationMarkers maps files and directories in the git directory to the operation they indicate
+var gitOperationMarkers = []struct {
+	name      string
+	operation string
+}{
+	{"MERGE_HEAD", "merge"},
+	{"rebase-merge", "rebase"},
+	{"rebase-apply", "rebase or am"},
+	{"CHERRY_PICK_HEAD", "cherry-pick"},
+	{"REVERT_HEAD", "revert"},
+	{"BISECT_LOG", "bisect"},
+}
+
+// workdirGitOperationInProgress returns the git operation in progress in a workdir, or "" when idle
+// Reference: docs/validations.md#idle-workdirs
+func workdirGitOperationInProgress(workdirPath string) (string, error) {
+	gitDir, err := workdirGitDir(workdirPath)
+	if err != nil {
+		return "", err
+	}
+
+	for _, marker := range gitOperationMarkers {
+		if _, err := os.Stat(filepath.Join(gitDir, marker.name)); err == nil {
+			return fmt.Sprintf("%s in progress (%s present)", marker.operation, marker.name), nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// indexWorkdirMap returns the workdir names of a workdir map by normalized path
+// It replaces repeated FindWorkdirName calls when many paths are looked up
+func indexWorkdirMap(workdirMap WorkdirMap) map[string]string {
+	workdirMapMu.RLock()
+	defer workdirMapMu.RUnlock()
+
+	index := make(map[string]string, len(workdirMap))
+	for name, path := range workdirMap {
+		index[filepath.Clean(path)] = name
+	}
+	return index
+}
+
 // FindWorkdirName searches for a workdir name by path in the map
 func FindWorkdirName(workdirPath string, workdirMap WorkdirMap) (string, bool) {
 	// Normalize the input path to handle trailing slashes consistently
 	normalizedWorkdirPath := filepath.Clean(workdirPath)
 
+	workdirMapMu.RLock()
+	defer workdirMapMu.RUnlock()
+
 	for name, path := range workdirMap {
 		// Normalize the stored path for comparison
 		normalizedStoredPath := filepath.Clean(path)
@@ -119,52 +305,182 @@ func FindWorkdirName(workdirPath string, workdirMap WorkdirMap) (string, bool) {
 	return "", false
 }
 
+// validateWorkdirOrder checks the git-wmem commit --workdir-order value
+func validateWorkdirOrder(order string) error {
+	switch order {
+	case "", "config", "alpha", "mtime":
+		return nil
+	default:
+		return fmt.Errorf("invalid --workdir-order %q (config, alpha or mtime)", order)
+	}
+}
+
+// validateOnConflict checks the git-wmem commit --on-conflict value
+func validateOnConflict(policy string) error {
+	switch policy {
+	case "", "accept-workdir", "skip":
+		return nil
+	default:
+		return fmt.Errorf("invalid --on-conflict %q (accept-workdir or skip)", policy)
+	}
+}
+
+// orderWorkdirPaths returns the workdir paths in the processing order of --workdir-order
+// config keeps md/commit-workdir-paths order, alpha sorts by workdir name,
+// mtime puts the most recently modified workdir directory first (missing workdirs last)
+// Reference: docs/use-cases/git-wmem-commit/basic.md#workdir-order
+func orderWorkdirPaths(workdirPaths []string, workdirMap WorkdirMap, order string) []string {
+	ordered := append([]string(nil), workdirPaths...)
+	switch order {
+	case "alpha":
+		names := make(map[string]string, len(ordered))
+		for _, workdirPath := range ordered {
+			name, exists := FindWorkdirName(workdirPath, workdirMap)
+			if !exists {
+				name = filepath.Base(workdirPath)
+			}
+			names[workdirPath] = name
+		}
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return names[ordered[i]] < names[ordered[j]]
+		})
+	case "mtime":
+		mtimes := make(map[string]time.Time, len(ordered))
+		for _, workdirPath := range ordered {
+			if info, err := os.Stat(workdirPath); err == nil {
+				mtimes[workdirPath] = info.ModTime()
+			}
+		}
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return mtimes[ordered[i]].After(mtimes[ordered[j]])
+		})
+	}
+	return ordered
+}
+
 // generateWorkdirName generates a unique workdir name from path
 func generateWorkdirName(workdirPath string, existingMap WorkdirMap) string {
 	baseName := filepath.Base(workdirPath)
 
-	// Check if base name is already used
-	for existingName := range existingMap {
-		if existingName == baseName {
-			// Find a unique name with suffix
-			counter := 2
-			for {
-				candidate := fmt.Sprintf("%s-%d", baseName, counter)
-				if _, exists := existingMap[candidate]; !exists {
-					return candidate
-				}
-				counter++
-			}
+	// Check if base name is already used or reserved (shared object store, wmem-repo snapshots)
+	if _, used := existingMap[baseName]; !used && !isReservedRepoName(baseName) {
+		return baseName
+	}
+	// Find a unique name with suffix
+	counter := 2
+	for {
+		candidate := fmt.Sprintf("%s-%d", baseName, counter)
+		if _, exists := existingMap[candidate]; !exists {
+			return candidate
 		}
+		counter++
 	}
-
-	return baseName
 }
 
+// workdirMapPath is the workdir map file of the wmem-repo
+const workdirMapPath = "md-internal/workdir-map.json"
+
 // readWorkdirMap reads the workdir map from md-internal/workdir-map.json
 func readWorkdirMap() (WorkdirMap, error) {
-	content, err := os.ReadFile("md-internal/workdir-map.json")
+	content, err := os.ReadFile(workdirMapPath)
 	if err != nil {
 		return nil, err
 	}
 
-	var workdirMap WorkdirMap
-	err = json.Unmarshal(content, &workdirMap)
-	if err != nil {
-		return nil, err
-	}
+	return decodeWorkdirMap(content)
+}
 
-	return workdirMap, nil
+// workdirMapMu guards workdir maps read by parallel workdir checks (FindWorkdirName) while
+// init-repos adds entries (setWorkdirMapEntry) or saves them (saveWorkdirMap)
+var workdirMapMu sync.RWMutex
+
+// setWorkdirMapEntry adds or updates the name -> path entry of a workdir map
+func setWorkdirMapEntry(workdirMap WorkdirMap, workdirName, workdirPath string) {
+	workdirMapMu.Lock()
+	defer workdirMapMu.Unlock()
+	workdirMap[workdirName] = workdirPath
 }
 
 // saveWorkdirMap saves the workdir map to md-internal/workdir-map.json
+// The file is replaced atomically, readers never see and a crash never leaves a truncated map
 func saveWorkdirMap(workdirMap WorkdirMap) error {
-	content, err := json.MarshalIndent(workdirMap, "", "  ")
+	workdirMapMu.Lock()
+	defer workdirMapMu.Unlock()
+
+	content, err := encodeWorkdirMap(workdirMap)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile("md-internal/workdir-map.json", content, 0644)
+	return writeFileAtomically(workdirMapPath, content, 0644)
+}
+
+// encodeWorkdirMap is the one serialization of workdir-map.json: two-space indent, sorted keys, final newline
+// Reference: docs/data-structures.md#workdir-map
+func encodeWorkdirMap(workdirMap WorkdirMap) ([]byte, error) {
+	if workdirMap == nil {
+		workdirMap = WorkdirMap{}
+	}
+	content, err := json.MarshalIndent(workdirMap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+// decodeWorkdirMap parses workdir-map.json in any layout (compact or indented)
+// A hand-edited map with // comments or trailing commas is accepted too
+func decodeWorkdirMap(content []byte) (WorkdirMap, error) {
+	var workdirMap WorkdirMap
+	if err := json.Unmarshal(content, &workdirMap); err != nil {
+		if relaxedErr := json.Unmarshal(stripJSONCommentsAndTrailingCommas(content), &workdirMap); relaxedErr != nil {
+			return nil, fmt.Errorf("failed to parse workdir map: %w", err)
+		}
+	}
+	if workdirMap == nil {
+		workdirMap = WorkdirMap{}
+	}
+	return workdirMap, nil
+}
+
+// stripJSONCommentsAndTrailingCommas drops // line comments and commas before } or ] outside of strings
+func stripJSONCommentsAndTrailingCommas(content []byte) []byte {
+	var out []byte
+	inString := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if inString {
+			out = append(out, c)
+			if c == '\\' && i+1 < len(content) {
+				i++
+				out = append(out, content[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(content) && content[i+1] == '/':
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			i--
+			continue
+		case c == ',':
+			next := i + 1
+			for next < len(content) && strings.ContainsRune(" \t\r\n", rune(content[next])) {
+				next++
+			}
+			if next < len(content) && (content[next] == '}' || content[next] == ']') {
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+	return out
 }
 
 // getCurrentBranchName implements step 1 of UC: sync-workdir
@@ -238,15 +554,14 @@ func getTrackedFilesFromWmemTree(workdirName, currentBranchName string) ([]strin
 
 	// Open repo once
 	startRepoOpen := time.Now()
-	repoPath := filepath.Join("repos", workdirName+".git")
-	bareRepo, err := git.PlainOpen(repoPath)
+	bareRepo, err := openBareRepo(workdirName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open bare repository: %w", err)
 	}
-	fmt.Printf("Debug: git.PlainOpen took %v for %s\n", time.Since(startRepoOpen), workdirName)
+	fmt.Printf("Debug: openBareRepo took %v for %s\n", time.Since(startRepoOpen), workdirName)
 
 	startBranchRef := time.Now()
-	wmemBranchName := fmt.Sprintf("wmem-br/%s", currentBranchName)
+	wmemBranchName := wmemBranchNameFor(currentBranchName)
 	wmemBranchRef := plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", wmemBranchName))
 
 	wmemBranchHashRef, err := bareRepo.Reference(wmemBranchRef, true)
@@ -269,7 +584,7 @@ func getTrackedFilesFromWmemTree(workdirName, currentBranchName string) ([]strin
 	}
 
 	if hasCached {
-		fmt.Printf("Debug: wmem tree cache MISS - commit hash changed for %s (was %s, now %s)\n", workdirName, cachedEntry.commitHash[:8], currentCommitHash[:8])
+		fmt.Printf("Debug: wmem tree cache MISS - commit hash changed for %s (was %s, now %s)\n", workdirName, abbrevHash(cachedEntry.commitHash), abbrevHash(currentCommitHash))
 	} else {
 		fmt.Printf("Debug: wmem tree cache MISS - no cached entry for %s\n", workdirName)
 	}
@@ -279,7 +594,7 @@ func getTrackedFilesFromWmemTree(workdirName, currentBranchName string) ([]strin
 	if err != nil {
 		return nil, fmt.Errorf("failed to get wmem commit: %w", err)
 	}
-	fmt.Printf("Debug: bareRepo.CommitObject took %v for %s\n", time.Since(startCommitObject), wmemBranchHashRef.Hash().String()[:8])
+	fmt.Printf("Debug: bareRepo.CommitObject took %v for %s\n", time.Since(startCommitObject), abbrevHash(wmemBranchHashRef.Hash().String()))
 
 	startTreeObject := time.Now()
 	wmemTree, err := wmemCommit.Tree()
@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+)
+
+// TestWorkdirMap_RoundTrip decodes maps in different layouts and checks they are all written the same way
+func TestWorkdirMap_RoundTrip(t *testing.T) {
+	const expected = "{\n  \"my-projectA\": \"../my-projectA\",\n  \"my-projectB\": \"../my-projectB\"\n}\n"
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"compact", `{"my-projectB":"../my-projectB","my-projectA":"../my-projectA"}`},
+		{"indented", expected},
+		{"four-space indent", "{\n    \"my-projectA\": \"../my-projectA\",\n    \"my-projectB\": \"../my-projectB\"\n}"},
+		{"trailing comma", "{\n  \"my-projectA\": \"../my-projectA\",\n  \"my-projectB\": \"../my-projectB\",\n}\n"},
+		{"comments", "{\n  // first clone\n  \"my-projectA\": \"../my-projectA\", // still used\n  \"my-projectB\": \"../my-projectB\"\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workdirMap, err := decodeWorkdirMap([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("decodeWorkdirMap failed: %v", err)
+			}
+			content, err := encodeWorkdirMap(workdirMap)
+			if err != nil {
+				t.Fatalf("encodeWorkdirMap failed: %v", err)
+			}
+			if string(content) != expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", expected, content)
+			}
+
+			// Writing what was read back gives the same bytes
+			again, err := decodeWorkdirMap(content)
+			if err != nil {
+				t.Fatalf("decodeWorkdirMap of encoded map failed: %v", err)
+			}
+			if againContent, _ := encodeWorkdirMap(again); string(againContent) != expected {
+				t.Errorf("Expected a stable encoding, got:\n%s", againContent)
+			}
+		})
+	}
+}
+
+// TestWorkdirMap_Empty checks that the empty map of git-wmem init uses the same serialization
+func TestWorkdirMap_Empty(t *testing.T) {
+	for _, content := range []string{"{}", "{}\n", "{\n}\n", "null"} {
+		workdirMap, err := decodeWorkdirMap([]byte(content))
+		if err != nil {
+			t.Fatalf("decodeWorkdirMap(%q) failed: %v", content, err)
+		}
+		encoded, err := encodeWorkdirMap(workdirMap)
+		if err != nil {
+			t.Fatalf("encodeWorkdirMap failed: %v", err)
+		}
+		if string(encoded) != "{}\n" {
+			t.Errorf("Expected %q for %q, got %q", "{}\n", content, encoded)
+		}
+	}
+}
+
+// TestWorkdirMap_StringsKeepSlashesAndCommas checks that the relaxed parsing leaves string content alone
+func TestWorkdirMap_StringsKeepSlashesAndCommas(t *testing.T) {
+	content := "{\n  \"odd\": \"//server/share,}\\\"x\",\n}\n"
+	workdirMap, err := decodeWorkdirMap([]byte(content))
+	if err != nil {
+		t.Fatalf("decodeWorkdirMap failed: %v", err)
+	}
+	if workdirMap["odd"] != `//server/share,}"x` {
+		t.Errorf("Expected the string unchanged, got %q", workdirMap["odd"])
+	}
+}
+
+// TestWorkdirMap_ConcurrentSave looks up and re-reads a workdir map while entries are added and saved
+// Run with -race to check the guarded access, every read of the file must be a complete map
+func TestWorkdirMap_ConcurrentSave(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("md-internal", 0755); err != nil {
+		t.Fatal(err)
+	}
+	workdirMap := WorkdirMap{"my-projectA": "../my-projectA"}
+	if err := saveWorkdirMap(workdirMap); err != nil {
+		t.Fatalf("saveWorkdirMap failed: %v", err)
+	}
+
+	const saves = 50
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, exists := FindWorkdirName("../my-projectA/", workdirMap); !exists {
+					t.Error("Expected my-projectA to be found during saves")
+					return
+				}
+				saved, err := readWorkdirMap()
+				if err != nil {
+					t.Errorf("Expected a complete workdir map file, got: %v", err)
+					return
+				}
+				if saved["my-projectA"] != "../my-projectA" {
+					t.Errorf("Expected my-projectA in the saved map, got %v", saved)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < saves; i++ {
+		name := fmt.Sprintf("project-%02d", i)
+		setWorkdirMapEntry(workdirMap, name, "../"+name)
+		if err := saveWorkdirMap(workdirMap); err != nil {
+			t.Errorf("saveWorkdirMap failed: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	saved, err := readWorkdirMap()
+	if err != nil {
+		t.Fatalf("readWorkdirMap failed: %v", err)
+	}
+	if len(saved) != saves+1 {
+		t.Errorf("Expected %d entries, got %d", saves+1, len(saved))
+	}
+	entries, err := os.ReadDir("md-internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only workdir-map.json in md-internal, got %d files", len(entries))
+	}
+}
+
+// TestWorkdirMap_InterruptedSave fails a save partway through and checks the saved map is kept intact
+func TestWorkdirMap_InterruptedSave(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("md-internal", 0755); err != nil {
+		t.Fatal(err)
+	}
+	workdirMap := WorkdirMap{"my-projectA": "../my-projectA", "my-projectB": "../my-projectB"}
+	if err := saveWorkdirMap(workdirMap); err != nil {
+		t.Fatalf("saveWorkdirMap failed: %v", err)
+	}
+	original, err := os.ReadFile(workdirMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workdirMap["my-projectC"] = "../my-projectC"
+	content, err := encodeWorkdirMap(workdirMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errInterrupted := errors.New("interrupted")
+	err = replaceFileAtomically(workdirMapPath, 0644, func(w io.Writer) error {
+		if _, err := w.Write(content[:len(content)/2]); err != nil {
+			return err
+		}
+		return errInterrupted
+	})
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("Expected the interrupted write to fail, got: %v", err)
+	}
+
+	after, err := os.ReadFile(workdirMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(original) {
+		t.Errorf("Expected the original map to be kept, got:\n%s", after)
+	}
+	if _, err := readWorkdirMap(); err != nil {
+		t.Errorf("Expected the kept map to be readable, got: %v", err)
+	}
+	entries, err := os.ReadDir("md-internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected the temporary file to be removed, got %d files in md-internal", len(entries))
+	}
+}
+
+// TestExpandWorkdirPath_AbsoluteNeedsOptIn rejects ~/outside unless md/allow-absolute-workdir-paths exists
+func TestExpandWorkdirPath_AbsoluteNeedsOptIn(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	wmemDir := home + "/work/wmem"
+	if err := os.MkdirAll(wmemDir+"/md", 0755); err != nil {
+		t.Fatalf("failed to create md: %v", err)
+	}
+	t.Chdir(wmemDir)
+
+	if expanded, err := expandWorkdirPath("~/outside"); err == nil {
+		t.Errorf("Expected ~/outside to be rejected by default, got %s", expanded)
+	}
+	if expanded, err := expandWorkdirPath("$HOME/outside"); err == nil {
+		t.Errorf("Expected $HOME/outside to be rejected by default, got %s", expanded)
+	}
+	t.Setenv("WMEM_TEST_WORKSPACE", "../../work")
+	if expanded, err := expandWorkdirPath("$WMEM_TEST_WORKSPACE/../outside"); err != nil || expanded != "../../outside" {
+		t.Errorf("Expected a relative expansion to be allowed, got %q (%v)", expanded, err)
+	}
+
+	if err := os.WriteFile(allowAbsoluteWorkdirPathsPath, nil, 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", allowAbsoluteWorkdirPathsPath, err)
+	}
+	if expanded, err := expandWorkdirPath("~/outside"); err != nil || expanded != "../../outside" {
+		t.Errorf("Expected ~/outside to expand to ../../outside with the opt-in, got %q (%v)", expanded, err)
+	}
+}
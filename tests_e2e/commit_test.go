@@ -2,10 +2,14 @@ package e2e
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // setupBasicWmemRepo creates a basic wmem repository for testing
@@ -20,6 +24,24 @@ func setupBasicWmemRepo(h *TestHelper) string {
 	return wmemDir
 }
 
+// slowUploadPack makes fetches from workdirs whose path contains match take delay longer
+// git-wmem fetches through git-upload-pack found in PATH, a wrapper sleeps before running the real one
+// The sleep doesn't hold the output of git-wmem, so a killed wrapper doesn't keep the command running
+func slowUploadPack(h *TestHelper, match, delay string) {
+	execPath, err := h.RunGit("--exec-path")
+	h.AssertCommandSuccess(execPath, err, "git --exec-path")
+
+	shimDir := filepath.Join(h.TempDir(), "slow-upload-pack")
+	h.MkdirAll(shimDir)
+	h.WriteFile(filepath.Join(shimDir, "git-upload-pack"), fmt.Sprintf(
+		"#!/bin/sh\ncase \"$*\" in *%s*) sleep %s </dev/null >/dev/null 2>&1 ;; esac\nexec %s \"$@\"\n",
+		match, delay, filepath.Join(strings.TrimSpace(execPath), "git-upload-pack")))
+	if err := os.Chmod(filepath.Join(shimDir, "git-upload-pack"), 0755); err != nil {
+		h.t.Fatalf("Failed to make git-upload-pack wrapper executable: %v", err)
+	}
+	h.SetEnv("PATH", shimDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
 // setupTestProjects creates test projects as described in use cases
 // Reference: docs/use-cases/user-sh-cmds/wds-setup-basic.md#main-scenario
 func setupTestProjects(h *TestHelper) (string, string) {
@@ -161,6 +183,160 @@ func TestGitWmemCommit_WithFileChanges(t *testing.T) {
 	}
 }
 
+// TestGitWmemCommit_SnapshotIndex tests that --snapshot-index captures the staged tree only
+// Reference: docs/use-cases/git-wmem-commit/basic.md#alternatives 6c
+func TestGitWmemCommit_SnapshotIndex(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	// Stage some changes, leave others unstaged or untracked
+	h.SetWorkDir(projectA)
+	h.MkdirAll("staged-dir")
+	h.WriteFile("staged-dir/new.txt", "staged new file")
+	h.WriteFile("fileA.txt", "staged content A")
+	_, err = h.RunGit("add", "staged-dir/new.txt", "fileA.txt")
+	h.AssertCommandSuccess("", err, "git add staged files")
+	h.WriteFile("fileA.txt", "unstaged content A")
+	h.WriteFile("untracked.txt", "untracked file")
+
+	stagedTree, err := h.RunGit("write-tree")
+	h.AssertCommandSuccess(stagedTree, err, "git write-tree")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--snapshot-index")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --snapshot-index")
+
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	snapshotTree, err := h.RunGit("rev-parse", "wmem-br/main^{tree}")
+	h.AssertCommandSuccess(snapshotTree, err, "git rev-parse wmem-br/main^{tree}")
+	if strings.TrimSpace(snapshotTree) != strings.TrimSpace(stagedTree) {
+		t.Errorf("Expected snapshot tree %s to match staged tree %s", strings.TrimSpace(snapshotTree), strings.TrimSpace(stagedTree))
+	}
+
+	output, err = h.RunGit("show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show fileA.txt")
+	h.AssertOutputContains(output, "staged content A")
+
+	output, err = h.RunGit("log", "-1", "--format=%B", "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "git log wmem-br/main")
+	h.AssertOutputContains(output, "Snapshot of workdir index")
+
+	// Nothing new staged - no new snapshot
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--snapshot-index")
+	h.AssertCommandSuccess(output, err, "second git-wmem commit --snapshot-index")
+	h.AssertOutputContains(output, "No modified files in workdir ../my-projectA")
+
+	// Workdir index must be left untouched
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("status", "--porcelain")
+	h.AssertCommandSuccess(output, err, "git status")
+	h.AssertOutputContains(output, "MM fileA.txt")
+	h.AssertOutputContains(output, "?? untracked.txt")
+}
+
+// TestGitWmemCommit_Report tests that --report entries match the committed snapshots
+// Reference: docs/use-cases/git-wmem-commit/basic.md#run-report
+func TestGitWmemCommit_Report(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	// projectA: uncommitted change (regular commit), projectB: new git commit (merge commit)
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB2.txt", "new file B2")
+	_, err = h.RunGit("add", "fileB2.txt")
+	h.AssertCommandSuccess("", err, "git add fileB2.txt")
+	_, err = h.RunGit("commit", "-m", "Add fileB2")
+	h.AssertCommandSuccess("", err, "git commit fileB2")
+
+	h.SetWorkDir(wmemDir)
+	reportPath := filepath.Join(h.TempDir(), "report.json")
+	output, err = h.RunGitWmem("commit", "--report", reportPath)
+	h.AssertCommandSuccess(output, err, "git-wmem commit --report")
+
+	content, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var report struct {
+		SchemaVersion  int    `json:"schemaVersion"`
+		StartTime      string `json:"startTime"`
+		EndTime        string `json:"endTime"`
+		WmemUID        string `json:"wmemUid"`
+		WmemRepoCommit string `json:"wmemRepoCommit"`
+		Workdirs       []struct {
+			WorkdirName  string `json:"workdirName"`
+			Branch       string `json:"branch"`
+			OldTip       string `json:"oldTip"`
+			NewTip       string `json:"newTip"`
+			CommitHash   string `json:"commitHash"`
+			MergeCommit  bool   `json:"mergeCommit"`
+			FilesChanged int    `json:"filesChanged"`
+		} `json:"workdirs"`
+	}
+	if err := json.Unmarshal(content, &report); err != nil {
+		t.Fatalf("Failed to parse report: %v\n%s", err, content)
+	}
+
+	if report.SchemaVersion != 1 || report.StartTime == "" || report.EndTime == "" {
+		t.Errorf("Unexpected report metadata: %s", content)
+	}
+
+	wmemHead, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(wmemHead, err, "git rev-parse HEAD")
+	if report.WmemRepoCommit != strings.TrimSpace(wmemHead) {
+		t.Errorf("Expected wmemRepoCommit %s, got %s", strings.TrimSpace(wmemHead), report.WmemRepoCommit)
+	}
+	output, err = h.RunGit("log", "-1", "--format=%B")
+	h.AssertCommandSuccess(output, err, "git log -1")
+	h.AssertOutputContains(output, report.WmemUID)
+
+	if len(report.Workdirs) != 2 {
+		t.Fatalf("Expected 2 workdir entries, got %d: %s", len(report.Workdirs), content)
+	}
+	for _, entry := range report.Workdirs {
+		h.SetWorkDir(filepath.Join(wmemDir, "repos", entry.WorkdirName+".git"))
+		tip, err := h.RunGit("rev-parse", "wmem-br/main")
+		h.AssertCommandSuccess(tip, err, "git rev-parse wmem-br/main")
+		if entry.NewTip != strings.TrimSpace(tip) {
+			t.Errorf("%s: expected newTip %s, got %s", entry.WorkdirName, strings.TrimSpace(tip), entry.NewTip)
+		}
+		if entry.Branch != "main" || entry.OldTip == "" || entry.OldTip == entry.NewTip {
+			t.Errorf("%s: unexpected entry %+v", entry.WorkdirName, entry)
+		}
+
+		switch entry.WorkdirName {
+		case "my-projectA":
+			if entry.CommitHash != entry.NewTip || entry.MergeCommit || entry.FilesChanged != 1 {
+				t.Errorf("my-projectA: expected regular commit with 1 file changed, got %+v", entry)
+			}
+		case "my-projectB":
+			if entry.CommitHash != "" || !entry.MergeCommit || entry.FilesChanged != 1 {
+				t.Errorf("my-projectB: expected merge commit with 1 file changed, got %+v", entry)
+			}
+		}
+	}
+}
+
 // TestGitWmemCommit_WithGitCommands tests commit with git commands in workdirs
 // Reference: docs/use-cases/user-sh-cmds/wds-git-cmds.md
 func TestGitWmemCommit_WithGitCommands(t *testing.T) {
@@ -253,6 +429,48 @@ func TestGitWmemCommit_ErrorNotInWmemRepo(t *testing.T) {
 	h.AssertCommandError(output, err, ".git-wmem", "git-wmem-commit outside wmem repo")
 }
 
+// TestGitWmemCommit_DirFlag tests running commit with -C from an unrelated directory
+// Reference: cmd/git-wmem/git-wmem.md#command-line-options
+func TestGitWmemCommit_DirFlag(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	_, _ = setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+
+	// Run from an unrelated directory
+	otherDir := filepath.Join(h.TempDir(), "unrelated")
+	h.MkdirAll(otherDir)
+	h.SetWorkDir(otherDir)
+
+	output, err := h.RunGitWmem("-C", wmemDir, "commit")
+	h.AssertCommandSuccess(output, err, "git-wmem -C <wmem-repo> commit")
+
+	h.AssertFileExists(filepath.Join(wmemDir, "repos", "my-projectA.git", "HEAD"))
+	h.AssertFileExists(filepath.Join(wmemDir, "repos", "my-projectB.git", "HEAD"))
+
+	output, err = h.RunGitWmem("--dir", wmemDir, "log")
+	h.AssertCommandSuccess(output, err, "git-wmem --dir <wmem-repo> log")
+	h.AssertOutputContains(output, "wmem-")
+
+	// Nothing may be created in the unrelated directory
+	entries, err := os.ReadDir(otherDir)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", otherDir, err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected %s to stay empty, found %d entries", otherDir, len(entries))
+	}
+
+	// -C pointing to a non wmem-repo fails for commit
+	output, err = h.RunGitWmem("-C", otherDir, "commit")
+	h.AssertCommandError(output, err, "is not a wmem repository", "git-wmem -C <non-wmem-dir> commit")
+}
+
 // TestGitWmemCommit_SkipsSubdirectoriesWithGitRepos tests that subdirectories with .git are handled as gitlinks
 // Reference: docs/use-cases/git-wmem-commit/basic.md step 7 detail - should work "like git add -A"
 func TestGitWmemCommit_SkipsSubdirectoriesWithGitRepos(t *testing.T) {
@@ -606,3 +824,2734 @@ func TestCommitWorkdir_NoChangesDetection(t *testing.T) {
 		t.Errorf("Expected 1 commit on wmem-br/main when no changes, got: %s", wmemBrCommitCount)
 	}
 }
+
+// countLooseAndPackedObjects returns the loose object count and pack count of a bare repo
+func countLooseAndPackedObjects(h *TestHelper, repoPath string) (int, int) {
+	h.t.Helper()
+	output, err := h.RunGit("--git-dir", repoPath, "count-objects", "-v")
+	h.AssertCommandSuccess(output, err, "git count-objects -v")
+
+	counts := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		key, value, found := strings.Cut(line, ": ")
+		if !found {
+			continue
+		}
+		var n int
+		fmt.Sscanf(value, "%d", &n)
+		counts[key] = n
+	}
+	return counts["count"], counts["packs"]
+}
+
+// TestGitWmemCommit_Compress tests that --compress packs loose objects of changed bare repos only
+// Reference: docs/use-cases/git-wmem-commit/basic.md#compression
+func TestGitWmemCommit_Compress(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A before first run")
+	h.SetWorkDir(wmemDir)
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	repoA := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	repoB := filepath.Join(wmemDir, "repos", "my-projectB.git")
+	looseA, _ := countLooseAndPackedObjects(h, repoA)
+	if looseA == 0 {
+		t.Fatalf("Expected loose objects in my-projectA.git after a commit without --compress")
+	}
+	looseBBefore, packsBBefore := countLooseAndPackedObjects(h, repoB)
+
+	// Only projectA changes
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A for compress")
+	h.WriteFile("newA.txt", "new file A")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--compress")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --compress")
+	h.AssertOutputContains(output, "Packed")
+
+	looseA, packsA := countLooseAndPackedObjects(h, repoA)
+	if looseA != 0 {
+		t.Errorf("Expected no loose objects in my-projectA.git after --compress, got %d", looseA)
+	}
+	if packsA == 0 {
+		t.Errorf("Expected at least one pack in my-projectA.git after --compress")
+	}
+
+	output, err = h.RunGit("--git-dir", repoA, "fsck", "--full", "--strict")
+	h.AssertCommandSuccess(output, err, "git fsck my-projectA.git after --compress")
+
+	content, err := h.RunGit("--git-dir", repoA, "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(content, err, "read fileA.txt from packed snapshot")
+	if strings.TrimSpace(content) != "changed A for compress" {
+		t.Errorf("Expected packed snapshot content 'changed A for compress', got %q", content)
+	}
+
+	// Unchanged projectB is not repacked
+	looseBAfter, packsBAfter := countLooseAndPackedObjects(h, repoB)
+	if looseBAfter != looseBBefore || packsBAfter != packsBBefore {
+		t.Errorf("Expected my-projectB.git untouched (loose %d, packs %d), got loose %d, packs %d",
+			looseBBefore, packsBBefore, looseBAfter, packsBAfter)
+	}
+}
+
+// TestGitWmemCommit_PruneEmptyDirs tests that empty directories are left out by default
+// and kept with a placeholder with --prune-empty-dirs=false
+// Reference: docs/use-cases/git-wmem-commit/basic.md#empty-directories
+func TestGitWmemCommit_PruneEmptyDirs(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	h.MkdirAll(filepath.Join(projectA, "empty-dir", "nested-empty"))
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A with empty dir")
+
+	// Default: empty directories are not part of the snapshot
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	tree, err := h.RunGit("--git-dir", bareRepo, "ls-tree", "-r", "-t", "--name-only", "wmem-br/main")
+	h.AssertCommandSuccess(tree, err, "git ls-tree wmem-br/main")
+	if strings.Contains(tree, "empty-dir") {
+		t.Errorf("Expected empty-dir absent from default snapshot, got:\n%s", tree)
+	}
+
+	// --prune-empty-dirs=false: empty directories persist with a placeholder
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A again with empty dir")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--prune-empty-dirs=false")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --prune-empty-dirs=false")
+
+	tree, err = h.RunGit("--git-dir", bareRepo, "ls-tree", "-r", "--name-only", "wmem-br/main")
+	h.AssertCommandSuccess(tree, err, "git ls-tree wmem-br/main")
+	h.AssertOutputContains(tree, "empty-dir/nested-empty/.gitkeep")
+	if strings.Contains(tree, "empty-dir/.gitkeep") {
+		t.Errorf("Expected no placeholder in non-empty empty-dir, got:\n%s", tree)
+	}
+
+	placeholder, err := h.RunGit("--git-dir", bareRepo, "cat-file", "-s", "wmem-br/main:empty-dir/nested-empty/.gitkeep")
+	h.AssertCommandSuccess(placeholder, err, "git cat-file placeholder")
+	if strings.TrimSpace(placeholder) != "0" {
+		t.Errorf("Expected empty placeholder blob, got size %s", placeholder)
+	}
+
+	output, err = h.RunGit("--git-dir", bareRepo, "fsck", "--strict")
+	h.AssertCommandSuccess(output, err, "git fsck after --prune-empty-dirs=false")
+}
+
+// TestGitWmemCommit_ResultKind tests the per-workdir kind of a run: merge, regular or none
+// Reference: docs/use-cases/git-wmem-commit/basic.md#run-report
+func TestGitWmemCommit_ResultKind(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	// projectA: uncommitted change (regular), projectB: new git commit only (merge)
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "uncommitted A")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "committed B")
+	_, err = h.RunGit("commit", "-am", "Change fileB")
+	h.AssertCommandSuccess("", err, "git commit fileB")
+
+	h.SetWorkDir(wmemDir)
+	reportPath := filepath.Join(h.TempDir(), "report-kind.json")
+	output, err = h.RunGitWmem("commit", "--report", reportPath)
+	h.AssertCommandSuccess(output, err, "git-wmem commit --report")
+	h.AssertOutputContains(output, "Info: Workdir snapshots: 1 regular, 1 merge, 0 unchanged")
+
+	content, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var report struct {
+		Workdirs []struct {
+			WorkdirName string `json:"workdirName"`
+			Kind        string `json:"kind"`
+			NewTip      string `json:"newTip"`
+		} `json:"workdirs"`
+	}
+	if err := json.Unmarshal(content, &report); err != nil {
+		t.Fatalf("Failed to parse report: %v\n%s", err, content)
+	}
+
+	kinds := make(map[string]string)
+	newTips := make(map[string]string)
+	for _, workdir := range report.Workdirs {
+		kinds[workdir.WorkdirName] = workdir.Kind
+		newTips[workdir.WorkdirName] = workdir.NewTip
+	}
+	if kinds["my-projectA"] != "regular" {
+		t.Errorf("Expected kind regular for my-projectA, got %q", kinds["my-projectA"])
+	}
+	if kinds["my-projectB"] != "merge" {
+		t.Errorf("Expected kind merge for my-projectB, got %q", kinds["my-projectB"])
+	}
+
+	// The wmem-repo commit message lists the merge-only workdir with its merge commit
+	message, err := h.RunGit("log", "-1", "--format=%B")
+	h.AssertCommandSuccess(message, err, "git log -1")
+	h.AssertOutputContains(message, "- `my-projectB` `main` `"+newTips["my-projectB"][:12]+"` (merge)")
+
+	// Nothing changed: both workdirs are none
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "unchanged git-wmem-commit")
+	h.AssertOutputContains(output, "Info: Workdir snapshots: 0 regular, 0 merge, 2 unchanged")
+}
+
+// TestGitWmemCommit_RespectSparseCheckout tests that files outside the sparse cone aren't recorded as deleted
+func TestGitWmemCommit_RespectSparseCheckout(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(projectA)
+	h.MkdirAll("docs")
+	h.MkdirAll("src")
+	h.WriteFile("docs/guide.txt", "guide")
+	h.WriteFile("src/main.txt", "main")
+	output, err := h.RunGit("add", ".")
+	h.AssertCommandSuccess(output, err, "git add")
+	output, err = h.RunGit("commit", "-m", "Add docs and src")
+	h.AssertCommandSuccess(output, err, "git commit")
+
+	// Only src/ (and top-level files) stay on disk, docs/ is outside the cone
+	output, err = h.RunGit("sparse-checkout", "set", "src")
+	h.AssertCommandSuccess(output, err, "git sparse-checkout set")
+	if _, err := os.Stat(filepath.Join(projectA, "docs", "guide.txt")); !os.IsNotExist(err) {
+		t.Fatalf("Expected docs/guide.txt to be removed by sparse-checkout, got %v", err)
+	}
+	h.WriteFile("src/main.txt", "main uncommitted")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err = h.RunGitWmem("commit", "--respect-sparse-checkout")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --respect-sparse-checkout")
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	files, err := h.RunGit("--git-dir", bareRepo, "ls-tree", "-r", "--name-only", "wmem-br/main")
+	h.AssertCommandSuccess(files, err, "git ls-tree wmem-br/main")
+	h.AssertOutputContains(files, "docs/guide.txt")
+	h.AssertOutputContains(files, "fileA.txt")
+
+	content, err := h.RunGit("--git-dir", bareRepo, "show", "wmem-br/main:src/main.txt")
+	h.AssertCommandSuccess(content, err, "git show src/main.txt")
+	if strings.TrimSpace(content) != "main uncommitted" {
+		t.Errorf("Expected snapshot of src/main.txt with the uncommitted change, got %q", content)
+	}
+
+	// Without the flag the excluded files are recorded as deleted
+	h.SetWorkDir(projectA)
+	h.WriteFile("src/main.txt", "main uncommitted again")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit without --respect-sparse-checkout")
+	files, err = h.RunGit("--git-dir", bareRepo, "ls-tree", "-r", "--name-only", "wmem-br/main")
+	h.AssertCommandSuccess(files, err, "git ls-tree wmem-br/main")
+	if strings.Contains(files, "docs/guide.txt") {
+		t.Errorf("Expected docs/guide.txt to be dropped without --respect-sparse-checkout, got:\n%s", files)
+	}
+}
+
+// TestGitWmemCommit_OrphanBranch tests snapshots of a workdir on an orphan branch with unrelated history
+// Reference: docs/use-cases/git-wmem-commit/basic.md#alg-wmem-merge
+func TestGitWmemCommit_OrphanBranch(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	// Orphan branch with its own commit and an uncommitted change
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("checkout", "--orphan", "orphan")
+	h.AssertCommandSuccess(output, err, "git checkout --orphan")
+	output, err = h.RunGit("rm", "-rf", "--quiet", ".")
+	h.AssertCommandSuccess(output, err, "git rm")
+	h.WriteFile("orphan.txt", "orphan content")
+	output, err = h.RunGit("add", "orphan.txt")
+	h.AssertCommandSuccess(output, err, "git add orphan.txt")
+	output, err = h.RunGit("commit", "-m", "Orphan root")
+	h.AssertCommandSuccess(output, err, "git commit orphan root")
+	h.WriteFile("orphan.txt", "orphan uncommitted")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit on orphan branch")
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	files, err := h.RunGit("--git-dir", bareRepo, "ls-tree", "-r", "--name-only", "wmem-br/orphan")
+	h.AssertCommandSuccess(files, err, "git ls-tree wmem-br/orphan")
+	if strings.TrimSpace(files) != "orphan.txt" {
+		t.Errorf("Expected only orphan.txt in wmem-br/orphan, got:\n%s", files)
+	}
+	content, err := h.RunGit("--git-dir", bareRepo, "show", "wmem-br/orphan:orphan.txt")
+	h.AssertCommandSuccess(content, err, "git show wmem-br/orphan:orphan.txt")
+	if strings.TrimSpace(content) != "orphan uncommitted" {
+		t.Errorf("Expected the uncommitted orphan.txt in the snapshot, got %q", content)
+	}
+
+	// main reset to the orphan history: unrelated to wmem-br/main
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("checkout", "-q", "-f", "main")
+	h.AssertCommandSuccess(output, err, "git checkout main")
+	output, err = h.RunGit("reset", "-q", "--hard", "orphan")
+	h.AssertCommandSuccess(output, err, "git reset --hard orphan")
+	h.WriteFile("orphan.txt", "main uncommitted")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit with unrelated histories")
+	h.AssertOutputContains(output, "Created merge commit for workdir")
+
+	files, err = h.RunGit("--git-dir", bareRepo, "ls-tree", "-r", "--name-only", "wmem-br/main")
+	h.AssertCommandSuccess(files, err, "git ls-tree wmem-br/main")
+	if strings.TrimSpace(files) != "orphan.txt" {
+		t.Errorf("Expected only orphan.txt in wmem-br/main, got:\n%s", files)
+	}
+	content, err = h.RunGit("--git-dir", bareRepo, "show", "wmem-br/main:orphan.txt")
+	h.AssertCommandSuccess(content, err, "git show wmem-br/main:orphan.txt")
+	if strings.TrimSpace(content) != "main uncommitted" {
+		t.Errorf("Expected the uncommitted orphan.txt in the main snapshot, got %q", content)
+	}
+	output, err = h.RunGit("--git-dir", bareRepo, "fsck", "--no-dangling")
+	h.AssertCommandSuccess(output, err, "git fsck")
+}
+
+// TestGitWmemCommit_KeepCommitTimestamps tests that merge commits carry the workdir commit times
+// Reference: docs/use-cases/git-wmem-commit/basic.md#alg-wmem-merge
+func TestGitWmemCommit_KeepCommitTimestamps(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	// Workdir commits made in the past
+	h.SetEnv("GIT_AUTHOR_DATE", "2020-01-02T03:04:05+00:00")
+	h.SetEnv("GIT_COMMITTER_DATE", "2020-01-03T04:05:06+00:00")
+	commitTimes := func(rev string, gitArgs ...string) string {
+		args := append(gitArgs, "log", "-1", "--format=%at %ct", rev)
+		times, err := h.RunGit(args...)
+		h.AssertCommandSuccess(times, err, "git log --format=%at %ct "+rev)
+		return strings.TrimSpace(times)
+	}
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "committed A 1")
+	output, err = h.RunGit("commit", "-am", "Workdir commit 1")
+	h.AssertCommandSuccess(output, err, "git commit 1")
+	workdirTimes := commitTimes("HEAD")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--keep-commit-timestamps")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --keep-commit-timestamps")
+	h.AssertOutputContains(output, "Created merge commit for workdir")
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	if mergeTimes := commitTimes("wmem-br/main", "--git-dir", bareRepo); mergeTimes != workdirTimes {
+		t.Errorf("Expected merge commit times %q of the workdir commit, got %q", workdirTimes, mergeTimes)
+	}
+
+	// Without the option the merge gets the time of the run
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "committed A 2")
+	output, err = h.RunGit("commit", "-am", "Workdir commit 2")
+	h.AssertCommandSuccess(output, err, "git commit 2")
+	workdirTimes = commitTimes("HEAD")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+	if mergeTimes := commitTimes("wmem-br/main", "--git-dir", bareRepo); mergeTimes == workdirTimes {
+		t.Errorf("Expected merge commit times of the run without --keep-commit-timestamps, got the workdir times %q", mergeTimes)
+	}
+}
+
+// TestGitWmemCommit_BatchSize tests that --batch-size creates one wmem-repo commit per batch of workdirs
+// Reference: docs/use-cases/git-wmem-commit/basic.md#batches
+func TestGitWmemCommit_BatchSize(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+
+	projectNames := []string{"my-project1", "my-project2", "my-project3", "my-project4", "my-project5"}
+	for _, name := range projectNames {
+		projectDir := filepath.Join(h.TempDir(), name)
+		h.MkdirAll(projectDir)
+		h.SetWorkDir(projectDir)
+		output, err := h.RunGit("init", "-b", "main")
+		h.AssertCommandSuccess(output, err, "git init "+name)
+		h.WriteFile("file.txt", "committed "+name)
+		output, err = h.RunGit("add", "file.txt")
+		h.AssertCommandSuccess(output, err, "git add "+name)
+		output, err = h.RunGit("commit", "-m", "Initial commit in "+name)
+		h.AssertCommandSuccess(output, err, "git commit "+name)
+		h.WriteFile("file.txt", "uncommitted "+name)
+
+		h.SetWorkDir(wmemDir)
+		h.AppendToFile("md/commit-workdir-paths", "../"+name)
+	}
+
+	headBefore, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(headBefore, err, "git rev-parse HEAD")
+
+	output, err := h.RunGitWmem("commit", "--batch-size", "2")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --batch-size 2")
+
+	expectedBatches := []struct {
+		label    string
+		workdirs []string
+	}{
+		{"(batch 1/3)", []string{"my-project1", "my-project2"}},
+		{"(batch 2/3)", []string{"my-project3", "my-project4"}},
+		{"(batch 3/3)", []string{"my-project5"}},
+	}
+
+	hashes, err := h.RunGit("rev-list", "--reverse", strings.TrimSpace(headBefore)+"..HEAD")
+	h.AssertCommandSuccess(hashes, err, "git rev-list")
+	commits := strings.Fields(hashes)
+	if len(commits) != len(expectedBatches) {
+		t.Fatalf("Expected %d wmem-repo commits, got %d", len(expectedBatches), len(commits))
+	}
+
+	var wmemUIDs []string
+	for i, batch := range expectedBatches {
+		message, err := h.RunGit("log", "-1", "--format=%B", commits[i])
+		h.AssertCommandSuccess(message, err, "git log "+commits[i])
+		h.AssertOutputContains(message, "Meta wmem-commit of workdir commits "+batch.label)
+		for _, name := range projectNames {
+			listed := strings.Contains(message, "- `"+name+"` `main` `")
+			expected := false
+			for _, batchName := range batch.workdirs {
+				expected = expected || batchName == name
+			}
+			if listed != expected {
+				t.Errorf("Batch %s: expected %s listed=%v, got message:\n%s", batch.label, name, expected, message)
+			}
+		}
+		wmemUIDs = append(wmemUIDs, extractWmemUID(t, message, "batch "+batch.label))
+	}
+	for _, wmemUID := range wmemUIDs[1:] {
+		if wmemUID != wmemUIDs[0] {
+			t.Errorf("Expected all batch commits to share wmem-uid %s, got %s", wmemUIDs[0], wmemUID)
+		}
+	}
+}
+
+// TestGitWmemCommit_ShallowTreeCompare tests the clean-workdir fast path and the full check of a dirty workdir
+// Reference: docs/use-cases/git-wmem-commit/basic.md#shallow-tree-compare
+func TestGitWmemCommit_ShallowTreeCompare(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	tipBefore, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(tipBefore, err, "git rev-parse wmem-br/main")
+
+	// A newer mtime defeats the timestamp check, the content is unchanged
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(projectA, "fileA.txt"), future, future); err != nil {
+		t.Fatalf("Failed to touch fileA.txt: %v", err)
+	}
+
+	output, err = h.RunGitWmem("commit", "--shallow-tree-compare")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --shallow-tree-compare on a clean workdir")
+	h.AssertOutputContains(output, "Shallow tree compare: clean worktree at wmem-br/main tree - no changes")
+	if strings.Contains(output, "Timestamp check took") {
+		t.Errorf("Expected the fast path to skip the timestamp and tree checks, got:\n%s", output)
+	}
+	tipAfter, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(tipAfter, err, "git rev-parse wmem-br/main")
+	if tipAfter != tipBefore {
+		t.Errorf("Expected no snapshot of a clean workdir, wmem-br/main moved to %s", strings.TrimSpace(tipAfter))
+	}
+
+	// A dirty workdir still gets the full check and a snapshot
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "dirty A")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--shallow-tree-compare")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --shallow-tree-compare on a dirty workdir")
+	h.AssertOutputContains(output, "Shallow tree compare: worktree dirty or HEAD moved, proceeding with full check")
+	h.AssertOutputContains(output, "Workdir snapshots: 1 regular")
+
+	content, err := h.RunGit("--git-dir", bareRepo, "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(content, err, "git show wmem-br/main:fileA.txt")
+	if strings.TrimSpace(content) != "dirty A" {
+		t.Errorf("Expected the dirty fileA.txt in the snapshot, got %q", content)
+	}
+}
+
+// TestGitWmemCommit_PostMergeFF tests that --post-merge-ff fast-forwards wmem-br instead of creating a merge commit
+// Reference: docs/use-cases/git-wmem-commit/basic.md#alg-wmem-merge
+func TestGitWmemCommit_PostMergeFF(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	// The workdir only advances by commits
+	h.SetWorkDir(projectA)
+	for i := 1; i <= 2; i++ {
+		h.WriteFile("fileA.txt", fmt.Sprintf("committed A %d", i))
+		output, err = h.RunGit("commit", "-am", fmt.Sprintf("Workdir commit %d", i))
+		h.AssertCommandSuccess(output, err, "git commit")
+	}
+	workdirHead, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(workdirHead, err, "git rev-parse HEAD")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--post-merge-ff")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --post-merge-ff")
+	h.AssertOutputContains(output, "Info: Fast-forwarded wmem-br/main to workdir HEAD")
+	h.AssertOutputContains(output, "Info: Workdir snapshots: 0 regular, 0 merge, 0 unchanged, 1 fast-forward")
+	if strings.Contains(output, "Created merge commit") {
+		t.Errorf("Expected no merge commit with --post-merge-ff, got:\n%s", output)
+	}
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	for _, branch := range []string{"wmem-br/main", "wmem-br/head"} {
+		tip, err := h.RunGit("--git-dir", bareRepo, "rev-parse", branch)
+		h.AssertCommandSuccess(tip, err, "git rev-parse "+branch)
+		if tip != workdirHead {
+			t.Errorf("Expected %s at workdir HEAD %s, got %s", branch, strings.TrimSpace(workdirHead), strings.TrimSpace(tip))
+		}
+	}
+	parents, err := h.RunGit("--git-dir", bareRepo, "log", "-1", "--format=%P", "wmem-br/main")
+	h.AssertCommandSuccess(parents, err, "git log --format=%P")
+	if len(strings.Fields(parents)) != 1 {
+		t.Errorf("Expected a single-parent wmem-br/main tip, got parents %q", strings.TrimSpace(parents))
+	}
+
+	// A dirty workdir still gets the merge commit and a snapshot on top
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "committed A 3")
+	output, err = h.RunGit("commit", "-am", "Workdir commit 3")
+	h.AssertCommandSuccess(output, err, "git commit 3")
+	h.WriteFile("fileA.txt", "uncommitted A")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--post-merge-ff")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --post-merge-ff with a dirty workdir")
+	h.AssertOutputContains(output, "Created merge commit for workdir")
+	h.AssertOutputContains(output, "Info: Workdir snapshots: 1 regular, 0 merge, 0 unchanged")
+}
+
+// TestGitWmemCommit_IndexOnlyDetection tests that --index-only-detection agrees with git status --porcelain
+// Reference: docs/use-cases/git-wmem-commit/basic.md#index-only-detection
+func TestGitWmemCommit_IndexOnlyDetection(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(projectA)
+	h.WriteFile(".gitignore", "*.log\n")
+	output, err := h.RunGit("add", ".gitignore")
+	h.AssertCommandSuccess(output, err, "git add .gitignore")
+	output, err = h.RunGit("commit", "-m", "Ignore logs")
+	h.AssertCommandSuccess(output, err, "git commit .gitignore")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	cases := []struct {
+		name   string
+		change func()
+	}{
+		{"clean", func() {}},
+		{"touched", func() {
+			future := time.Now().Add(time.Hour)
+			if err := os.Chtimes(filepath.Join(projectA, "fileA.txt"), future, future); err != nil {
+				t.Fatalf("Failed to touch fileA.txt: %v", err)
+			}
+		}},
+		{"ignored", func() { h.WriteFile("debug.log", "log line") }},
+		{"added untracked", func() { h.WriteFile("new.txt", "new file") }},
+		{"added staged", func() {
+			h.WriteFile("new.txt", "new file")
+			output, err := h.RunGit("add", "new.txt")
+			h.AssertCommandSuccess(output, err, "git add new.txt")
+		}},
+		{"modified", func() { h.WriteFile("fileA.txt", "modified A") }},
+		{"deleted", func() {
+			if err := os.Remove(filepath.Join(projectA, "fileA.txt")); err != nil {
+				t.Fatalf("Failed to delete fileA.txt: %v", err)
+			}
+		}},
+	}
+
+	for _, tc := range cases {
+		h.SetWorkDir(projectA)
+		tc.change()
+		status, err := h.RunGit("status", "--porcelain")
+		h.AssertCommandSuccess(status, err, "git status --porcelain ("+tc.name+")")
+		gitChanged := strings.TrimSpace(status) != ""
+
+		h.SetWorkDir(wmemDir)
+		output, err = h.RunGitWmem("commit", "--index-only-detection")
+		h.AssertCommandSuccess(output, err, "git-wmem commit --index-only-detection ("+tc.name+")")
+		expected := fmt.Sprintf("Index detection: changed=%v for", gitChanged)
+		if !strings.Contains(output, expected) {
+			t.Errorf("Case %s: expected %q to agree with git status %q, got:\n%s", tc.name, expected, strings.TrimSpace(status), output)
+		}
+		if strings.Contains(output, "Timestamp check took") {
+			t.Errorf("Case %s: expected the index detection to replace the timestamp check, got:\n%s", tc.name, output)
+		}
+
+		// Back to the committed state for the next case
+		h.SetWorkDir(projectA)
+		output, err = h.RunGit("reset", "-q", "--hard")
+		h.AssertCommandSuccess(output, err, "git reset --hard")
+		output, err = h.RunGit("clean", "-fdxq")
+		h.AssertCommandSuccess(output, err, "git clean")
+	}
+}
+
+// TestGitWmemCommit_SnapshotTags tests that --snapshot-tags mirrors workdir tags into refs/wmem-tags/<workdir-name>/*
+// Reference: docs/data-structures.md#wmem-tags
+func TestGitWmemCommit_SnapshotTags(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(projectA)
+	output, err := h.RunGit("tag", "v1.0")
+	h.AssertCommandSuccess(output, err, "git tag v1.0")
+	h.WriteFile("fileA.txt", "release A")
+	output, err = h.RunGit("commit", "-am", "Release")
+	h.AssertCommandSuccess(output, err, "git commit")
+	output, err = h.RunGit("tag", "-a", "v2.0", "-m", "Release 2.0")
+	h.AssertCommandSuccess(output, err, "git tag -a v2.0")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err = h.RunGitWmem("commit", "--snapshot-tags")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --snapshot-tags")
+	h.AssertOutputContains(output, "Snapshotted 2 tag(s) of my-projectA under refs/wmem-tags/my-projectA/")
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	for _, tag := range []string{"v1.0", "v2.0"} {
+		expected, err := h.RunGit("-C", projectA, "rev-parse", tag+"^{commit}")
+		h.AssertCommandSuccess(expected, err, "git rev-parse "+tag+" in workdir")
+		actual, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "refs/wmem-tags/my-projectA/"+tag+"^{commit}")
+		h.AssertCommandSuccess(actual, err, "git rev-parse wmem tag "+tag)
+		if actual != expected {
+			t.Errorf("Expected wmem tag %s at %s, got %s", tag, strings.TrimSpace(expected), strings.TrimSpace(actual))
+		}
+	}
+
+	// The tagged release commit is part of the snapshot history
+	output, err = h.RunGit("--git-dir", bareRepo, "merge-base", "--is-ancestor", "refs/wmem-tags/my-projectA/v2.0", "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "wmem tag v2.0 is an ancestor of wmem-br/main")
+
+	tagType, err := h.RunGit("--git-dir", bareRepo, "cat-file", "-t", "refs/wmem-tags/my-projectA/v2.0")
+	h.AssertCommandSuccess(tagType, err, "git cat-file -t wmem tag v2.0")
+	if strings.TrimSpace(tagType) != "tag" {
+		t.Errorf("Expected the annotated tag object to be kept, got %q", strings.TrimSpace(tagType))
+	}
+
+	// Deleted workdir tags are pruned
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("tag", "-d", "v1.0")
+	h.AssertCommandSuccess(output, err, "git tag -d v1.0")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--snapshot-tags")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --snapshot-tags after deleting a tag")
+	h.AssertOutputContains(output, "Snapshotted 1 tag(s) of my-projectA")
+	refs, err := h.RunGit("--git-dir", bareRepo, "for-each-ref", "--format=%(refname)", "refs/wmem-tags/")
+	h.AssertCommandSuccess(refs, err, "git for-each-ref refs/wmem-tags/")
+	if strings.TrimSpace(refs) != "refs/wmem-tags/my-projectA/v2.0" {
+		t.Errorf("Expected only refs/wmem-tags/my-projectA/v2.0, got:\n%s", refs)
+	}
+}
+
+// TestGitWmemCommit_AuthorDateFromSource tests that --author-date-now=false separates the author and committer dates
+// Reference: docs/use-cases/git-wmem-commit/basic.md#commit-dates
+func TestGitWmemCommit_AuthorDateFromSource(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	// The edit happened two days before the snapshot
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "edited A")
+	edited := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filepath.Join(projectA, "fileA.txt"), edited, edited); err != nil {
+		t.Fatalf("Failed to set mtime of fileA.txt: %v", err)
+	}
+
+	// The timestamp check can't see an edit older than the last snapshot, the index can
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--author-date-now=false", "--index-only-detection")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --author-date-now=false")
+	h.AssertOutputContains(output, "Workdir snapshots: 1 regular")
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	dates, err := h.RunGit("--git-dir", bareRepo, "log", "-1", "--format=%at %ct", "wmem-br/main")
+	h.AssertCommandSuccess(dates, err, "git log --format=%at %ct")
+	var authorTime, committerTime int64
+	if _, err := fmt.Sscan(dates, &authorTime, &committerTime); err != nil {
+		t.Fatalf("Failed to parse commit dates %q: %v", dates, err)
+	}
+	if authorTime != edited.Unix() {
+		t.Errorf("Expected the author date of the edit %d, got %d", edited.Unix(), authorTime)
+	}
+	if time.Since(time.Unix(committerTime, 0)) > time.Hour {
+		t.Errorf("Expected the committer date of the snapshot moment, got %s", time.Unix(committerTime, 0))
+	}
+}
+
+// TestGitWmemCommit_ObjectFormat tests that SHA-256 workdirs are rejected cleanly and hash abbreviation doesn't panic
+// Reference: docs/use-cases/git-wmem-commit/basic.md#object-format
+func TestGitWmemCommit_ObjectFormat(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	projectC := filepath.Join(filepath.Dir(projectA), "my-projectC")
+	h.MkdirAll(projectC)
+	h.SetWorkDir(projectC)
+	output, err := h.RunGit("init", "--object-format=sha256")
+	h.AssertCommandSuccess(output, err, "git init --object-format=sha256")
+	h.WriteFile("fileC.txt", "file C content")
+	output, err = h.RunGit("add", "fileC.txt")
+	h.AssertCommandSuccess(output, err, "git add fileC.txt")
+	output, err = h.RunGit("commit", "-m", "Initial commit in my-projectC")
+	h.AssertCommandSuccess(output, err, "git commit projectC")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit of a SHA-1 workdir")
+
+	// A SHA-256 workdir fails the run before its bare repo is created
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectC")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandError(output, err, "../my-projectC uses the sha256 object format, git-wmem can only snapshot sha1 repositories", "git-wmem commit with a SHA-256 workdir")
+	if strings.Contains(output, "panic:") {
+		t.Errorf("Expected a clean error, got:\n%s", output)
+	}
+	if _, err := os.Stat(filepath.Join(wmemDir, "repos", "my-projectC.git")); !os.IsNotExist(err) {
+		t.Errorf("Expected no bare repo for the SHA-256 workdir")
+	}
+
+	output, err = h.RunGitWmem("log", "--no-pager", "--workdir-status")
+	h.AssertCommandSuccess(output, err, "git-wmem log after the rejected workdir")
+	if strings.Contains(output, "panic:") {
+		t.Errorf("Expected log without a panic, got:\n%s", output)
+	}
+	h.AssertOutputContains(output, "  ../my-projectA: up to date")
+}
+
+// TestGitWmemCommit_RefreshCache tests that --refresh-cache drops the persisted caches before the run
+// Reference: docs/use-cases/git-wmem-commit/basic.md#refresh-cache
+func TestGitWmemCommit_RefreshCache(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	// Files older than the last wmem commit get past the timestamp check to the cached deletion check
+	past := time.Now().Add(-10 * time.Minute)
+	if err := os.Chtimes(filepath.Join(projectA, "fileA.txt"), past, past); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+	h.AssertOutputContains(output, "Debug: No file cache found for ../my-projectA")
+
+	cacheFile := filepath.Join(wmemDir, "cache", "git-wmem-cache-my-projectA.json")
+	if _, err := os.Stat(cacheFile); err != nil {
+		t.Fatalf("Expected the on-disk cache %s: %v", cacheFile, err)
+	}
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit with a cache")
+	h.AssertOutputContains(output, "Debug: Directory mtime unchanged (file cache)")
+
+	output, err = h.RunGitWmem("commit", "--refresh-cache")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --refresh-cache")
+	h.AssertOutputContains(output, "Info: Cleared in-memory and on-disk caches (--refresh-cache)")
+	h.AssertOutputContains(output, "Debug: No file cache found for ../my-projectA")
+	if strings.Contains(output, "(file cache)") || strings.Contains(output, "CACHE HIT") {
+		t.Errorf("Expected only cache misses after --refresh-cache, got:\n%s", output)
+	}
+	if _, err := os.Stat(cacheFile); err != nil {
+		t.Errorf("Expected the on-disk cache to be rewritten: %v", err)
+	}
+}
+
+// TestGitWmemCommit_WorkdirOrder tests that --workdir-order controls the processing order of workdirs
+// Reference: docs/use-cases/git-wmem-commit/basic.md#workdir-order
+func TestGitWmemCommit_WorkdirOrder(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	projectC := filepath.Join(filepath.Dir(projectA), "my-projectC")
+	h.MkdirAll(projectC)
+	h.SetWorkDir(projectC)
+	output, err := h.RunGit("init")
+	h.AssertCommandSuccess(output, err, "git init projectC")
+	h.WriteFile("fileC.txt", "file C content")
+	output, err = h.RunGit("add", "fileC.txt")
+	h.AssertCommandSuccess(output, err, "git add fileC.txt")
+	output, err = h.RunGit("commit", "-m", "Initial commit in my-projectC")
+	h.AssertCommandSuccess(output, err, "git commit projectC")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectC")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	// Directory mtimes for --workdir-order=mtime: B newest, then C, then A
+	now := time.Now()
+	dirMtimes := map[string]time.Time{
+		projectA: now.Add(-3 * time.Minute),
+		projectB: now.Add(-1 * time.Minute),
+		projectC: now.Add(-2 * time.Minute),
+	}
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{"config", []string{"../my-projectC", "../my-projectA", "../my-projectB"}},
+		{"alpha", []string{"../my-projectA", "../my-projectB", "../my-projectC"}},
+		{"mtime", []string{"../my-projectB", "../my-projectC", "../my-projectA"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			for _, project := range []string{projectA, projectB, projectC} {
+				h.SetWorkDir(project)
+				h.WriteFile("order.txt", "modified for "+tt.order)
+				if err := os.Chtimes(project, dirMtimes[project], dirMtimes[project]); err != nil {
+					t.Fatalf("Failed to set directory mtime: %v", err)
+				}
+			}
+
+			h.SetWorkDir(wmemDir)
+			output, err := h.RunGitWmem("commit", "--workdir-order="+tt.order)
+			h.AssertCommandSuccess(output, err, "git-wmem commit --workdir-order="+tt.order)
+
+			lastIndex := -1
+			for _, workdirPath := range tt.expected {
+				index := strings.Index(output, "Info: Successfully committed changes in workdir "+workdirPath+" ")
+				if index == -1 {
+					t.Fatalf("Expected a snapshot of %s, got:\n%s", workdirPath, output)
+				}
+				if index < lastIndex {
+					t.Errorf("Expected workdirs processed in order %v, got:\n%s", tt.expected, output)
+				}
+				lastIndex = index
+			}
+			if tt.order != "config" {
+				h.AssertOutputContains(output, "Info: Workdir order ("+tt.order+"): "+strings.Join(tt.expected, ", "))
+			}
+		})
+	}
+
+	output, err = h.RunGitWmem("commit", "--workdir-order=random")
+	h.AssertCommandError(output, err, `invalid --workdir-order "random"`, "git-wmem commit --workdir-order=random")
+}
+
+// TestGitWmemCommit_IgnoreCaseConflicts tests the policies for names differing only in case
+// Reference: docs/use-cases/git-wmem-commit/basic.md#case-conflicts
+func TestGitWmemCommit_IgnoreCaseConflicts(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	// readme.md is the newer one although README.md comes first in byte order
+	h.SetWorkDir(projectA)
+	h.WriteFile("README.md", "older upper-case readme")
+	h.WriteFile("readme.md", "newer lower-case readme")
+	older := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(filepath.Join(projectA, "README.md"), older, older); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--ignore-case-conflicts=error")
+	h.AssertCommandError(output, err, "README.md, readme.md (--ignore-case-conflicts=error)", "git-wmem commit --ignore-case-conflicts=error")
+
+	output, err = h.RunGitWmem("commit", "--ignore-case-conflicts=newest-mtime")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --ignore-case-conflicts=newest-mtime")
+	h.AssertOutputContains(output, "keeping readme.md of README.md, readme.md (--ignore-case-conflicts=newest-mtime)")
+
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	output, err = h.RunGit("ls-tree", "--name-only", "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "git ls-tree wmem-br/main")
+	if strings.Contains(output, "README.md") || !strings.Contains(output, "readme.md") {
+		t.Errorf("Expected only readme.md in the snapshot, got:\n%s", output)
+	}
+	output, err = h.RunGit("show", "wmem-br/main:readme.md")
+	h.AssertCommandSuccess(output, err, "git show wmem-br/main:readme.md")
+	h.AssertOutputContains(output, "newer lower-case readme")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--ignore-case-conflicts=random")
+	h.AssertCommandError(output, err, `invalid --ignore-case-conflicts "random"`, "git-wmem commit --ignore-case-conflicts=random")
+}
+
+// TestGitWmemCommit_IncludeWmemRepo tests that --include-wmem-repo snapshots md/ changes into repos/_wmem.git without repos/
+// Reference: docs/use-cases/git-wmem-commit/basic.md#including-the-wmem-repo
+func TestGitWmemCommit_IncludeWmemRepo(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit", "--include-wmem-repo")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --include-wmem-repo")
+	h.AssertOutputContains(output, "Info: Snapshotted wmem-repo into repos/_wmem.git")
+
+	wmemBareDir := filepath.Join(wmemDir, "repos", "_wmem.git")
+	h.SetWorkDir(wmemBareDir)
+	output, err = h.RunGit("ls-tree", "-r", "--name-only", "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "git ls-tree wmem-br/main")
+	h.AssertOutputContains(output, "md/commit-workdir-paths")
+	h.AssertOutputContains(output, "md-internal/workdir-map.json")
+	if strings.Contains(output, "repos/") {
+		t.Errorf("Expected no repos/ in the wmem-repo snapshot, got:\n%s", output)
+	}
+
+	// An md/ change gets a new snapshot on top of the previous one
+	h.SetWorkDir(wmemDir)
+	h.WriteFile("md/commit/msg-prefix", "[wmem] ")
+	output, err = h.RunGitWmem("commit", "--include-wmem-repo")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --include-wmem-repo after an md/ change")
+	h.AssertOutputContains(output, "Info: Snapshotted wmem-repo into repos/_wmem.git")
+
+	h.SetWorkDir(wmemBareDir)
+	output, err = h.RunGit("show", "wmem-br/main:md/commit/msg-prefix")
+	h.AssertCommandSuccess(output, err, "git show wmem-br/main:md/commit/msg-prefix")
+	h.AssertOutputContains(output, "[wmem]")
+	output, err = h.RunGit("rev-list", "--count", "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "git rev-list --count wmem-br/main")
+	if strings.TrimSpace(output) != "2" {
+		t.Errorf("Expected 2 wmem-repo snapshots, got %s", output)
+	}
+	output, err = h.RunGit("rev-parse", "wmem-br/main", "wmem-br/head")
+	h.AssertCommandSuccess(output, err, "git rev-parse wmem-br/main wmem-br/head")
+	if hashes := strings.Fields(output); len(hashes) != 2 || hashes[0] != hashes[1] {
+		t.Errorf("Expected wmem-br/head at wmem-br/main, got %v", hashes)
+	}
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--include-wmem-repo")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --include-wmem-repo without changes")
+	h.AssertOutputContains(output, "Info: No changes in wmem-repo since its last snapshot in repos/_wmem.git")
+}
+
+// TestGitWmemCommit_BranchDenylist tests that workdirs on denylisted branches are skipped
+// Reference: docs/use-cases/git-wmem-commit/basic.md#branch-denylist
+func TestGitWmemCommit_BranchDenylist(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	h.WriteFile("md/commit/branch-denylist", "# scratch work\ntmp/*\n")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("checkout", "-b", "tmp/experiment")
+	h.AssertCommandSuccess(output, err, "git checkout -b tmp/experiment")
+	h.WriteFile("fileA.txt", "experiment")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "modified B")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--treat-warnings-as-errors")
+	h.AssertCommandSuccess(output, err, "git-wmem commit with a denylisted branch")
+	h.AssertOutputContains(output, "Info: Skipping workdir ../my-projectA: branch tmp/experiment matches the branch denylist pattern tmp/*")
+	h.AssertOutputContains(output, "Info: Successfully committed changes in workdir ../my-projectB")
+
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	output, err = h.RunGit("branch", "--list", "wmem-br/*")
+	h.AssertCommandSuccess(output, err, "git branch --list")
+	if strings.Contains(output, "tmp/experiment") {
+		t.Errorf("Expected no wmem-br branch for the denylisted branch, got:\n%s", output)
+	}
+
+	// --exclude-branch adds patterns for one run
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "modified B again")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--exclude-branch=main")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --exclude-branch=main")
+	h.AssertOutputContains(output, "Info: Skipping workdir ../my-projectB: branch main matches the branch denylist pattern main")
+	h.AssertOutputContains(output, "Info: Skipping workdir ../my-projectA: branch tmp/experiment")
+
+	output, err = h.RunGitWmem("commit", "--exclude-branch=[")
+	h.AssertCommandError(output, err, `invalid branch pattern "["`, "git-wmem commit --exclude-branch=[")
+}
+
+// TestGitWmemCommit_FSMonitor tests git-wmem commit --fsmonitor with a stub core.fsmonitor hook
+// Reference: docs/use-cases/git-wmem-commit/basic.md#fsmonitor
+func TestGitWmemCommit_FSMonitor(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	// The stub hook prints a token and the NUL separated paths of fsmonitor.out, or fails when fsmonitor.fail exists
+	stubDir := filepath.Dir(wmemDir)
+	stub := filepath.Join(stubDir, "fsmonitor-stub")
+	stubOut := filepath.Join(stubDir, "fsmonitor.out")
+	stubFail := filepath.Join(stubDir, "fsmonitor.fail")
+	script := fmt.Sprintf("#!/bin/sh\n[ -f %q ] && exit 1\nprintf 'token\\0'\ncat %q\n", stubFail, stubOut)
+	if err := os.WriteFile(stub, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fsmonitor stub: %v", err)
+	}
+	report := func(paths ...string) {
+		content := ""
+		for _, p := range paths {
+			content += p + "\x00"
+		}
+		if err := os.WriteFile(stubOut, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write fsmonitor stub output: %v", err)
+		}
+	}
+	report()
+
+	// An uncommitted file makes the wmem-br/main tip a snapshot on top of the workdir HEAD
+	h.SetWorkDir(projectA)
+	h.WriteFile("notes.txt", "notes")
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	// Without core.fsmonitor the regular checks are used
+	output, err = h.RunGitWmem("commit", "--fsmonitor")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --fsmonitor without a hook")
+	h.AssertOutputContains(output, "Debug: fsmonitor unavailable, falling back to timestamp and status checks for ../my-projectA: fsmonitor unavailable: core.fsmonitor not set")
+
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("config", "core.fsmonitor", stub)
+	h.AssertCommandSuccess(output, err, "git config core.fsmonitor")
+	output, err = h.RunGit("config", "core.fsmonitorHookVersion", "2")
+	h.AssertCommandSuccess(output, err, "git config core.fsmonitorHookVersion")
+
+	// The hook is trusted: a change it doesn't report isn't snapshotted
+	h.WriteFile("fileA.txt", "modified A")
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(projectA, "fileA.txt"), future, future); err != nil {
+		t.Fatalf("Failed to touch fileA.txt: %v", err)
+	}
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--fsmonitor")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --fsmonitor with nothing reported")
+	h.AssertOutputContains(output, "Debug: fsmonitor reported 0 changed path(s) for ../my-projectA")
+	h.AssertOutputContains(output, "Info: No changes detected in any workdir or metadata")
+	if strings.Contains(output, "Timestamp check took") {
+		t.Errorf("Expected the fsmonitor to replace the timestamp check, got:\n%s", output)
+	}
+
+	// A reported change is snapshotted
+	report("fileA.txt", "gone.txt")
+	output, err = h.RunGitWmem("commit", "--fsmonitor")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --fsmonitor with fileA.txt reported")
+	h.AssertOutputContains(output, "Debug: fsmonitor reported 2 changed path(s) for ../my-projectA")
+	h.AssertOutputContains(output, "Debug: fsmonitor detection: changed=true for ../my-projectA")
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	output, err = h.RunGit("show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show wmem-br/main:fileA.txt")
+	if strings.TrimSpace(output) != "modified A" {
+		t.Errorf("Expected the snapshot of fileA.txt to be %q, got %q", "modified A", output)
+	}
+
+	// A reported but unchanged path doesn't count
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--fsmonitor")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --fsmonitor with an unchanged path reported")
+	h.AssertOutputContains(output, "Debug: fsmonitor detection: changed=false for ../my-projectA")
+	h.AssertOutputContains(output, "Info: No changes detected in any workdir or metadata")
+
+	// A failing hook falls back to the regular checks
+	if err := os.WriteFile(stubFail, nil, 0644); err != nil {
+		t.Fatalf("Failed to make the fsmonitor stub fail: %v", err)
+	}
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "modified A again")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--fsmonitor")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --fsmonitor with a failing hook")
+	h.AssertOutputContains(output, "Debug: fsmonitor unavailable, falling back to timestamp and status checks for ../my-projectA")
+	h.AssertOutputContains(output, "Info: Successfully committed changes in workdir ../my-projectA")
+}
+
+// TestGitWmemCommit_NormalizeLineEndings tests that --normalize-line-endings stores text files with LF and leaves binaries alone
+// Reference: docs/use-cases/git-wmem-commit/basic.md#line-endings
+func TestGitWmemCommit_NormalizeLineEndings(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	binary := "GIF89a\r\n\x00\x01\r\nend\r\n"
+	h.SetWorkDir(projectA)
+	h.WriteFile("crlf.txt", "line 1\r\nline 2\r\n")
+	h.WriteFile("image.gif", binary)
+	h.WriteFile("keep.bat", "@echo off\r\n")
+	h.WriteFile(".gitattributes", "*.bat -text\n")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit", "--normalize-line-endings")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --normalize-line-endings")
+
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	expected := map[string]string{
+		"crlf.txt":  "line 1\nline 2\n",
+		"image.gif": binary,
+		"keep.bat":  "@echo off\r\n",
+	}
+	for file, content := range expected {
+		output, err := h.RunGit("cat-file", "blob", "wmem-br/main:"+file)
+		h.AssertCommandSuccess(output, err, "git cat-file blob "+file)
+		if output != content {
+			t.Errorf("Expected snapshot of %s to be %q, got %q", file, content, output)
+		}
+	}
+
+	// The workdir file keeps its CRLF line endings
+	content, err := os.ReadFile(filepath.Join(projectA, "crlf.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read crlf.txt: %v", err)
+	}
+	if string(content) != "line 1\r\nline 2\r\n" {
+		t.Errorf("Expected the workdir file untouched, got %q", content)
+	}
+}
+
+// TestGitWmemCommit_SkipCleanWorkdirsFast tests that --skip-clean-workdirs-fast skips untouched workdirs before they are opened
+// Reference: docs/use-cases/git-wmem-commit/basic.md#skip-clean-workdirs-fast
+func TestGitWmemCommit_SkipCleanWorkdirsFast(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+
+	// The first run checks all workdirs and records when
+	output, err := h.RunGitWmem("commit", "--skip-clean-workdirs-fast")
+	h.AssertCommandSuccess(output, err, "first git-wmem commit --skip-clean-workdirs-fast")
+	if strings.Contains(output, "(--skip-clean-workdirs-fast)") {
+		t.Errorf("Expected no workdir skipped without recorded check times, got:\n%s", output)
+	}
+	h.AssertFileExists(filepath.Join(wmemDir, "cache", "git-wmem-fast-skip.json"))
+
+	// A new top-level file changes the root directory mtime of my-projectA only
+	h.SetWorkDir(projectA)
+	h.WriteFile("new.txt", "new file")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--skip-clean-workdirs-fast")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --skip-clean-workdirs-fast")
+	h.AssertOutputContains(output, "Info: Skipping workdir ../my-projectB: unchanged since")
+	h.AssertOutputContains(output, "Info: Processing single workdir ../my-projectA")
+	h.AssertOutputContains(output, "Info: Successfully committed changes in workdir ../my-projectA")
+
+	// A commit in the workdir updates its git files
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("add", "new.txt")
+	h.AssertCommandSuccess(output, err, "git add new.txt")
+	output, err = h.RunGit("commit", "-m", "Add new.txt")
+	h.AssertCommandSuccess(output, err, "git commit")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--skip-clean-workdirs-fast")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --skip-clean-workdirs-fast after a workdir commit")
+	h.AssertOutputContains(output, "Info: Skipping workdir ../my-projectB: unchanged since")
+	h.AssertOutputContains(output, "Info: Processing single workdir ../my-projectA")
+
+	// Nothing changed, nothing is opened
+	output, err = h.RunGitWmem("commit", "--skip-clean-workdirs-fast")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --skip-clean-workdirs-fast without changes")
+	h.AssertOutputContains(output, "Info: Skipping workdir ../my-projectA: unchanged since")
+	h.AssertOutputContains(output, "Info: Skipping workdir ../my-projectB: unchanged since")
+	h.AssertOutputContains(output, "Info: No workdirs left to check")
+}
+
+// TestGitWmemCommit_CaptureStash tests that --capture-stash keeps workdir stash entries in the wmem-wd-repo
+// Reference: docs/use-cases/git-wmem-commit/basic.md#capture-stash
+func TestGitWmemCommit_CaptureStash(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "parked change")
+	output, err := h.RunGit("stash")
+	h.AssertCommandSuccess(output, err, "git stash")
+	h.WriteFile("untracked.txt", "parked untracked file")
+	output, err = h.RunGit("stash", "-u")
+	h.AssertCommandSuccess(output, err, "git stash -u")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit without --capture-stash")
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	refs, err := h.RunGit("--git-dir", bareRepo, "for-each-ref", "--format=%(refname)", "refs/wmem-stash/")
+	h.AssertCommandSuccess(refs, err, "git for-each-ref refs/wmem-stash/")
+	if strings.TrimSpace(refs) != "" {
+		t.Errorf("Expected no stash refs without --capture-stash, got:\n%s", refs)
+	}
+
+	output, err = h.RunGitWmem("commit", "--capture-stash")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --capture-stash")
+	h.AssertOutputContains(output, "Captured 2 stash(es) of my-projectA under refs/wmem-stash/my-projectA/")
+
+	for n := 0; n < 2; n++ {
+		expected, err := h.RunGit("-C", projectA, "rev-parse", fmt.Sprintf("stash@{%d}", n))
+		h.AssertCommandSuccess(expected, err, "git rev-parse stash entry in workdir")
+		actual, err := h.RunGit("--git-dir", bareRepo, "rev-parse", fmt.Sprintf("refs/wmem-stash/my-projectA/%d", n))
+		h.AssertCommandSuccess(actual, err, "git rev-parse wmem stash ref")
+		if actual != expected {
+			t.Errorf("Expected refs/wmem-stash/my-projectA/%d at %s, got %s", n, strings.TrimSpace(expected), strings.TrimSpace(actual))
+		}
+	}
+
+	// The stashed content is readable from the wmem-wd-repo alone
+	content, err := h.RunGit("--git-dir", bareRepo, "show", "refs/wmem-stash/my-projectA/1:fileA.txt")
+	h.AssertCommandSuccess(content, err, "git show stashed fileA.txt")
+	if strings.TrimSpace(content) != "parked change" {
+		t.Errorf("Expected stashed fileA.txt content 'parked change', got %q", content)
+	}
+	content, err = h.RunGit("--git-dir", bareRepo, "show", "refs/wmem-stash/my-projectA/0^3:untracked.txt")
+	h.AssertCommandSuccess(content, err, "git show stashed untracked.txt")
+	if strings.TrimSpace(content) != "parked untracked file" {
+		t.Errorf("Expected stashed untracked.txt content 'parked untracked file', got %q", content)
+	}
+	output, err = h.RunGit("--git-dir", bareRepo, "fsck", "--connectivity-only")
+	h.AssertCommandSuccess(output, err, "git fsck of the wmem-wd-repo")
+
+	// Dropped stash entries are removed
+	output, err = h.RunGit("-C", projectA, "stash", "drop")
+	h.AssertCommandSuccess(output, err, "git stash drop")
+	output, err = h.RunGitWmem("commit", "--capture-stash")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --capture-stash after dropping an entry")
+	h.AssertOutputContains(output, "Captured 1 stash(es) of my-projectA")
+	refs, err = h.RunGit("--git-dir", bareRepo, "for-each-ref", "--format=%(refname) %(objectname)", "refs/wmem-stash/")
+	h.AssertCommandSuccess(refs, err, "git for-each-ref refs/wmem-stash/ after drop")
+	expected, err := h.RunGit("-C", projectA, "rev-parse", "stash@{0}")
+	h.AssertCommandSuccess(expected, err, "git rev-parse stash@{0} after drop")
+	if strings.TrimSpace(refs) != "refs/wmem-stash/my-projectA/0 "+strings.TrimSpace(expected) {
+		t.Errorf("Expected only refs/wmem-stash/my-projectA/0 at %s, got:\n%s", strings.TrimSpace(expected), refs)
+	}
+}
+
+// TestGitWmemCommit_DumpTree tests that --dump-tree prints the same tree as git ls-tree -r -t
+// for file and directory names whose git tree order differs from a plain name sort
+// Reference: docs/use-cases/git-wmem-commit/basic.md#dump-tree
+func TestGitWmemCommit_DumpTree(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	// Same names as the tree sorting compatibility fixture
+	h.SetWorkDir(projectA)
+	for _, name := range []string{
+		"README.md", "LICENSE", "Makefile",
+		"a-file.txt", "a/info.txt", "a.txt", "aa/nested.txt",
+		"b.txt", "b/data.txt", "bb.txt",
+		"cmd-extra.txt", "cmd/main.go", "cmd.txt",
+		"z-last.txt", "00-first.txt", "~weird.txt",
+		"deep/nested/file.txt", "deep/another.txt", "deep.txt",
+		"Case-Sensitive.txt", "case-sensitive.txt", "special-chars_file.txt",
+	} {
+		h.WriteFile(name, "content of "+name+"\n")
+	}
+	output, err := h.RunGit("add", ".")
+	h.AssertCommandSuccess(output, err, "git add")
+	output, err = h.RunGit("commit", "-m", "Tree sorting fixture")
+	h.AssertCommandSuccess(output, err, "git commit")
+	expected, err := h.RunGit("ls-tree", "-r", "-t", "HEAD")
+	h.AssertCommandSuccess(expected, err, "git ls-tree -r -t HEAD")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--dump-tree", "../my-projectA")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --dump-tree")
+	if output != expected {
+		t.Errorf("Expected --dump-tree output to equal git ls-tree -r -t HEAD\nexpected:\n%s\ngot:\n%s", expected, output)
+	}
+
+	// Nothing was committed
+	if _, err := os.Stat(filepath.Join(wmemDir, "repos", "my-projectA.git")); !os.IsNotExist(err) {
+		t.Errorf("Expected no bare repo to be created by --dump-tree, stat error: %v", err)
+	}
+	log, err := h.RunGit("log", "--oneline")
+	h.AssertCommandSuccess(log, err, "git log of the wmem-repo")
+	if lines := strings.Split(strings.TrimSpace(log), "\n"); len(lines) != 1 {
+		t.Errorf("Expected only the initial wmem-repo commit, got:\n%s", log)
+	}
+
+	output, err = h.RunGitWmem("commit", "--dump-tree", "../does-not-exist")
+	h.AssertCommandError(output, err, "failed to resolve workdir path ../does-not-exist", "git-wmem commit --dump-tree of a missing workdir")
+}
+
+// TestGitWmemCommit_PreserveMtimeMetadata tests that --preserve-mtime-metadata records the file mtimes
+// of a snapshot in a refs/notes/wmem-mtime note of the snapshot commit
+// Reference: docs/use-cases/git-wmem-commit/basic.md#preserve-mtimes
+func TestGitWmemCommit_PreserveMtimeMetadata(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A")
+	h.WriteFile("dir/fileC.txt", "new C")
+	// Newer than the initial snapshot, so the change detection of step 6 sees the files
+	base := time.Now().UTC().Truncate(time.Second).Add(time.Hour)
+	mtimes := map[string]time.Time{
+		"fileA.txt":     base,
+		"dir/fileC.txt": base.Add(90*time.Minute + 500*time.Millisecond),
+	}
+	for name, mtime := range mtimes {
+		if err := os.Chtimes(filepath.Join(projectA, name), mtime, mtime); err != nil {
+			t.Fatalf("Failed to set mtime of %s: %v", name, err)
+		}
+	}
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--preserve-mtime-metadata")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --preserve-mtime-metadata")
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	note, err := h.RunGit("--git-dir", bareRepo, "notes", "--ref", "wmem-mtime", "show", "wmem-br/main")
+	h.AssertCommandSuccess(note, err, "git notes show of the snapshot commit")
+	expected := mtimes["dir/fileC.txt"].Format(time.RFC3339Nano) + "\tdir/fileC.txt\n" +
+		mtimes["fileA.txt"].Format(time.RFC3339Nano) + "\tfileA.txt\n"
+	if !strings.HasPrefix(note, expected) {
+		t.Errorf("Expected the note to start with:\n%s\ngot:\n%s", expected, note)
+	}
+	firstSnapshot, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(firstSnapshot, err, "git rev-parse wmem-br/main")
+
+	// The recorded mtimes can be reapplied to a restored copy of the snapshot
+	restoreDir := filepath.Join(h.TempDir(), "restored")
+	output, err = h.RunGit("--git-dir", bareRepo, "worktree", "add", "--detach", restoreDir, "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "git worktree add of the snapshot")
+	for _, line := range strings.Split(strings.TrimSpace(note), "\n") {
+		fields := strings.SplitN(line, "\t", 2)
+		mtime, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			t.Fatalf("Failed to parse note line %q: %v", line, err)
+		}
+		if err := os.Chtimes(filepath.Join(restoreDir, fields[1]), mtime, mtime); err != nil {
+			t.Fatalf("Failed to reapply mtime of %s: %v", fields[1], err)
+		}
+	}
+	for name, mtime := range mtimes {
+		info, err := os.Stat(filepath.Join(restoreDir, name))
+		if err != nil {
+			t.Fatalf("Failed to stat restored %s: %v", name, err)
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("Expected restored %s to have mtime %s, got %s", name, mtime, info.ModTime().UTC())
+		}
+	}
+
+	// Snapshots without the option get no note, earlier notes are kept
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A again")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit without --preserve-mtime-metadata")
+	output, err = h.RunGit("--git-dir", bareRepo, "notes", "--ref", "wmem-mtime", "show", "wmem-br/main")
+	if err == nil {
+		t.Errorf("Expected no note without --preserve-mtime-metadata, got:\n%s", output)
+	}
+	output, err = h.RunGit("--git-dir", bareRepo, "notes", "--ref", "wmem-mtime", "show", strings.TrimSpace(firstSnapshot))
+	h.AssertCommandSuccess(output, err, "git notes show of the earlier snapshot commit")
+	if output != note {
+		t.Errorf("Expected the earlier note to be kept, got:\n%s", output)
+	}
+}
+
+// TestGitWmemCommit_PathFilter tests that --path-filter snapshots only matching workdir files
+// Reference: docs/use-cases/git-wmem-commit/basic.md#path-filter
+func TestGitWmemCommit_PathFilter(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("src/main.go", "package main")
+	h.WriteFile("src/lib/util.go", "package lib")
+	h.WriteFile("docs/readme.md", "docs")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit", "--path-filter", "src/**")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --path-filter src/**")
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	files, err := h.RunGit("--git-dir", bareRepo, "ls-tree", "-r", "--name-only", "wmem-br/main")
+	h.AssertCommandSuccess(files, err, "git ls-tree wmem-br/main")
+	if strings.TrimSpace(files) != "src/lib/util.go\nsrc/main.go" {
+		t.Errorf("Expected only src/ files in wmem-br/main, got:\n%s", files)
+	}
+
+	// Changes outside the filter don't create a snapshot
+	tip, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(tip, err, "git rev-parse wmem-br/main")
+	h.SetWorkDir(projectA)
+	h.WriteFile("docs/readme.md", "changed docs")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--path-filter", "src/**")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --path-filter after a change outside the filter")
+	newTip, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(newTip, err, "git rev-parse wmem-br/main")
+	if newTip != tip {
+		t.Errorf("Expected no snapshot for a change outside the filter, wmem-br/main moved from %s to %s", strings.TrimSpace(tip), strings.TrimSpace(newTip))
+	}
+
+	// Changes inside the filter do, negated patterns exclude again
+	h.SetWorkDir(projectA)
+	h.WriteFile("src/main.go", "package main // changed")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--path-filter", "src/**", "--path-filter", "!src/lib/**")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --path-filter with a negated pattern")
+	files, err = h.RunGit("--git-dir", bareRepo, "ls-tree", "-r", "--name-only", "wmem-br/main")
+	h.AssertCommandSuccess(files, err, "git ls-tree wmem-br/main")
+	if strings.TrimSpace(files) != "src/main.go" {
+		t.Errorf("Expected only src/main.go in wmem-br/main, got:\n%s", files)
+	}
+	content, err := h.RunGit("--git-dir", bareRepo, "show", "wmem-br/main:src/main.go")
+	h.AssertCommandSuccess(content, err, "git show wmem-br/main:src/main.go")
+	if content != "package main // changed" {
+		t.Errorf("Expected the changed src/main.go, got %q", content)
+	}
+
+	output, err = h.RunGitWmem("commit", "--path-filter", "src/**", "--snapshot-index")
+	h.AssertCommandError(output, err, "--path-filter can't be combined with --snapshot-index", "git-wmem commit --path-filter --snapshot-index")
+}
+
+// TestGitWmemCommit_AuthorFromWorkdirHeadAlways tests that --author-from-workdir-head-always authors
+// regular snapshots as the workdir HEAD commit
+// Reference: docs/use-cases/git-wmem-commit/basic.md#author-from-workdir-head
+func TestGitWmemCommit_AuthorFromWorkdirHeadAlways(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "committed by Jane")
+	output, err := h.RunGit("add", "fileA.txt")
+	h.AssertCommandSuccess(output, err, "git add fileA.txt")
+	output, err = h.RunGit("-c", "user.name=Jane Doe", "-c", "user.email=jane@example.com", "commit", "-m", "Jane's change")
+	h.AssertCommandSuccess(output, err, "git commit as Jane Doe")
+	h.WriteFile("fileA.txt", "uncommitted change")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err = h.RunGitWmem("commit", "--author-from-workdir-head-always")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --author-from-workdir-head-always")
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	subject, err := h.RunGit("--git-dir", bareRepo, "log", "-1", "--format=%s", "wmem-br/main")
+	h.AssertCommandSuccess(subject, err, "git log wmem-br/main")
+	if strings.TrimSpace(subject) == "Jane's change" {
+		t.Fatalf("Expected a regular snapshot on top of the workdir commit, got the workdir commit itself")
+	}
+	author, err := h.RunGit("--git-dir", bareRepo, "log", "-1", "--format=%an <%ae>", "wmem-br/main")
+	h.AssertCommandSuccess(author, err, "git log wmem-br/main")
+	if strings.TrimSpace(author) != "Jane Doe <jane@example.com>" {
+		t.Errorf("Expected the regular snapshot authored by the workdir HEAD author, got %q", author)
+	}
+	content, err := h.RunGit("--git-dir", bareRepo, "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(content, err, "git show wmem-br/main:fileA.txt")
+	if content != "uncommitted change" {
+		t.Errorf("Expected the uncommitted change in the snapshot, got %q", content)
+	}
+}
+
+// TestGitWmemCommit_CacheNeverCommitted tests that the persisted caches in cache/ are never part of
+// a wmem-repo commit, also in wmem-repos whose .gitignore doesn't list cache/
+// Reference: docs/use-cases/git-wmem-commit/basic.md#refresh-cache
+func TestGitWmemCommit_CacheNeverCommitted(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	setupTestProjects(h)
+
+	// A wmem-repo created before cache/ was ignored by default
+	h.SetWorkDir(wmemDir)
+	h.WriteFile(".gitignore", "repos/\n")
+	output, err := h.RunGit("commit", "-am", "Old default .gitignore")
+	h.AssertCommandSuccess(output, err, "git commit .gitignore")
+
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.WriteFile("cache/git-wmem-cache-my-projectA.json", "\"2024-01-01T00:00:00Z\"")
+	output, err = h.RunGitWmem("commit", "--skip-clean-workdirs-fast")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	files, err := h.RunGit("log", "--name-only", "--format=", "HEAD")
+	h.AssertCommandSuccess(files, err, "git log --name-only")
+	if strings.Contains(files, "cache/") {
+		t.Errorf("Expected no cache/ files in wmem-repo commits, got:\n%s", files)
+	}
+	h.AssertOutputContains(files, "md/commit-workdir-paths")
+}
+
+// TestGitWmemCommit_GroupByBranch tests that --group-by-branch groups the workdirs of the wmem-repo
+// commit message by branch and that git-wmem log still reads them
+// Reference: docs/data-structures.md#commit-message-generation-example
+func TestGitWmemCommit_GroupByBranch(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(projectB)
+	output, err := h.RunGit("checkout", "-b", "feature/X2")
+	h.AssertCommandSuccess(output, err, "git checkout -b feature/X2")
+	h.WriteFile("fileB.txt", "changed B on feature/X2")
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A on main")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err = h.RunGitWmem("commit", "--group-by-branch")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --group-by-branch")
+
+	message, err := h.RunGit("log", "-1", "--format=%B")
+	h.AssertCommandSuccess(message, err, "git log -1")
+	h.AssertOutputContains(message, "wmem-uid: wmem-")
+	h.AssertOutputContains(message, "Meta wmem-commit of workdir commits\n\nBranch `main`:\n- `my-projectA` `main` `")
+	h.AssertOutputContains(message, "\n\nBranch `feature/X2`:\n- `my-projectB` `feature/X2` `")
+
+	// Workdirs on the same branch share a section
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A")
+	h.SetWorkDir(projectB)
+	output, err = h.RunGit("checkout", "fileB.txt")
+	h.AssertCommandSuccess(output, err, "git checkout fileB.txt")
+	output, err = h.RunGit("checkout", "main")
+	h.AssertCommandSuccess(output, err, "git checkout main")
+	h.WriteFile("fileB.txt", "changed B on main")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--group-by-branch")
+	h.AssertCommandSuccess(output, err, "second git-wmem commit --group-by-branch")
+	message, err = h.RunGit("log", "-1", "--format=%B")
+	h.AssertCommandSuccess(message, err, "git log -1")
+	if strings.Count(message, "Branch `") != 1 {
+		t.Errorf("Expected a single branch section, got:\n%s", message)
+	}
+
+	output, err = h.RunGitWmem("log", "--count")
+	h.AssertCommandSuccess(output, err, "git-wmem log --count")
+	h.AssertOutputContains(output, "over 2 workdir(s)")
+}
+
+// TestGitWmemCommit_SnapshotWorktreeAndIndex tests that --snapshot-worktree-and-index records the working
+// tree on wmem-br/<branch> and the index on wmem-br/<branch>-index
+// Reference: docs/use-cases/git-wmem-commit/basic.md#worktree-and-index
+func TestGitWmemCommit_SnapshotWorktreeAndIndex(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "staged content")
+	output, err := h.RunGit("add", "fileA.txt")
+	h.AssertCommandSuccess(output, err, "git add fileA.txt")
+	h.WriteFile("fileA.txt", "unstaged content")
+	h.WriteFile("untracked.txt", "untracked")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err = h.RunGitWmem("commit", "--snapshot-worktree-and-index")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --snapshot-worktree-and-index")
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	show := func(rev string) string {
+		content, err := h.RunGit("--git-dir", bareRepo, "show", rev)
+		if err != nil {
+			return "<missing>"
+		}
+		return content
+	}
+	if got := show("wmem-br/main:fileA.txt"); got != "unstaged content" {
+		t.Errorf("Expected the working tree fileA.txt on wmem-br/main, got %q", got)
+	}
+	if got := show("wmem-br/main:untracked.txt"); got != "untracked" {
+		t.Errorf("Expected untracked.txt on wmem-br/main, got %q", got)
+	}
+	if got := show("wmem-br/main-index:fileA.txt"); got != "staged content" {
+		t.Errorf("Expected the staged fileA.txt on wmem-br/main-index, got %q", got)
+	}
+	if got := show("wmem-br/main-index:untracked.txt"); got != "<missing>" {
+		t.Errorf("Expected no untracked.txt on wmem-br/main-index, got %q", got)
+	}
+	message, err := h.RunGit("log", "-1", "--format=%B")
+	h.AssertCommandSuccess(message, err, "git log -1")
+	h.AssertOutputContains(message, "` (index)")
+
+	// Staging everything changes only the index
+	tip, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(tip, err, "git rev-parse wmem-br/main")
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("add", "-A")
+	h.AssertCommandSuccess(output, err, "git add -A")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--snapshot-worktree-and-index")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --snapshot-worktree-and-index after git add -A")
+	newTip, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(newTip, err, "git rev-parse wmem-br/main")
+	if newTip != tip {
+		t.Errorf("Expected wmem-br/main to stay at %s, got %s", strings.TrimSpace(tip), strings.TrimSpace(newTip))
+	}
+	trees, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main^{tree}", "wmem-br/main-index^{tree}")
+	h.AssertCommandSuccess(trees, err, "git rev-parse trees")
+	if lines := strings.Fields(trees); len(lines) != 2 || lines[0] != lines[1] {
+		t.Errorf("Expected the fully staged index to match the working tree snapshot, got:\n%s", trees)
+	}
+	count, err := h.RunGit("--git-dir", bareRepo, "rev-list", "--count", "wmem-br/main..wmem-br/main-index")
+	h.AssertCommandSuccess(count, err, "git rev-list --count")
+	if strings.TrimSpace(count) != "2" {
+		t.Errorf("Expected 2 index snapshots on top of wmem-br/main, got %s", strings.TrimSpace(count))
+	}
+
+	output, err = h.RunGitWmem("commit", "--snapshot-worktree-and-index", "--snapshot-index")
+	h.AssertCommandError(output, err, "can't be combined with --snapshot-index", "git-wmem commit --snapshot-worktree-and-index --snapshot-index")
+
+	// wmem-br/main-index of a workdir branch main-index would mix with the index snapshots of main
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("branch", "main-index")
+	h.AssertCommandSuccess(output, err, "git branch main-index")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--snapshot-worktree-and-index")
+	h.AssertCommandError(output, err, "workdir ../my-projectA has a branch main-index, wmem-br/main-index can't also hold the index snapshots of main", "git-wmem commit --snapshot-worktree-and-index with a main-index branch")
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("checkout", "main-index")
+	h.AssertCommandSuccess(output, err, "git checkout main-index")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--snapshot-worktree-and-index")
+	h.AssertCommandError(output, err, "workdir ../my-projectA has a branch main, wmem-br/main-index can't also hold the working tree snapshots of main-index", "git-wmem commit --snapshot-worktree-and-index on the main-index branch")
+}
+
+// TestGitWmemCommit_DetectMoves tests that --detect-moves reports a renamed workdir file as a rename
+// Reference: docs/use-cases/git-wmem-commit/basic.md#detect-moves
+func TestGitWmemCommit_DetectMoves(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("docs/guide.md", strings.Repeat("A line of the guide\n", 20))
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	h.SetWorkDir(projectA)
+	if err := os.Rename(filepath.Join(projectA, "docs", "guide.md"), filepath.Join(projectA, "docs", "user-guide.md")); err != nil {
+		t.Fatalf("Failed to rename docs/guide.md: %v", err)
+	}
+	h.SetWorkDir(wmemDir)
+	reportPath := filepath.Join(h.TempDir(), "report.json")
+	output, err = h.RunGitWmem("commit", "--detect-moves", "--report", reportPath)
+	h.AssertCommandSuccess(output, err, "git-wmem commit --detect-moves")
+
+	message, err := h.RunGit("log", "-1", "--format=%B")
+	h.AssertCommandSuccess(message, err, "git log -1")
+	h.AssertOutputContains(message, "\n  renamed: docs/guide.md -> docs/user-guide.md")
+	if strings.Count(message, "renamed:") != 1 {
+		t.Errorf("Expected a single rename, got:\n%s", message)
+	}
+
+	content, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var report struct {
+		Workdirs []struct {
+			WorkdirName string   `json:"workdirName"`
+			Renames     []string `json:"renames"`
+		} `json:"workdirs"`
+	}
+	if err := json.Unmarshal(content, &report); err != nil {
+		t.Fatalf("Failed to parse report: %v\n%s", err, content)
+	}
+	if len(report.Workdirs) != 1 || len(report.Workdirs[0].Renames) != 1 || report.Workdirs[0].Renames[0] != "docs/guide.md -> docs/user-guide.md" {
+		t.Errorf("Expected the rename in the report, got:\n%s", content)
+	}
+
+	// The workdir line is still read by git-wmem log
+	output, err = h.RunGitWmem("log", "--count")
+	h.AssertCommandSuccess(output, err, "git-wmem log --count")
+	h.AssertOutputContains(output, "over 1 workdir(s)")
+}
+
+// TestGitWmemCommit_EmptyReposSkip tests that --empty-repos-skip skips the init-repos checks of
+// already initialized workdirs and never re-creates their bare repos
+// Reference: docs/use-cases/git-wmem-commit/basic.md#alternatives (1.1b)
+func TestGitWmemCommit_EmptyReposSkip(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	const workdirCount = 100
+	wmemDir := setupBasicWmemRepo(h)
+	for i := 1; i <= workdirCount+1; i++ {
+		project := filepath.Join(h.TempDir(), fmt.Sprintf("project-%03d", i))
+		h.MkdirAll(project)
+		h.SetWorkDir(project)
+		output, err := h.RunGit("init", "-q")
+		h.AssertCommandSuccess(output, err, "git init")
+		h.WriteFile("file.txt", fmt.Sprintf("project %d", i))
+		output, err = h.RunGit("add", "file.txt")
+		h.AssertCommandSuccess(output, err, "git add file.txt")
+		output, err = h.RunGit("commit", "-q", "-m", "Initial commit")
+		h.AssertCommandSuccess(output, err, "git commit")
+		if i <= workdirCount {
+			h.SetWorkDir(wmemDir)
+			h.AppendToFile("md/commit-workdir-paths", fmt.Sprintf("../project-%03d", i))
+		}
+	}
+
+	h.SetWorkDir(wmemDir)
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	// Markers disappear if a bare repo is re-created
+	for i := 1; i <= workdirCount; i++ {
+		h.WriteFile(fmt.Sprintf("repos/project-%03d.git/test-marker", i), "kept")
+	}
+	h.AppendToFile("md/commit-workdir-paths", fmt.Sprintf("../project-%03d", workdirCount+1))
+	start := time.Now()
+	output, err = h.RunGitWmem("commit", "--empty-repos-skip")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --empty-repos-skip")
+	t.Logf("git-wmem commit --empty-repos-skip with %d workdirs took %v", workdirCount+1, time.Since(start))
+	h.AssertOutputContains(output, fmt.Sprintf("Skipped checks of %d already initialized workdir(s) (--empty-repos-skip)", workdirCount))
+
+	for i := 1; i <= workdirCount; i++ {
+		h.AssertFileEquals(fmt.Sprintf("repos/project-%03d.git/test-marker", i), "kept")
+	}
+	h.AssertDirExists(fmt.Sprintf("repos/project-%03d.git", workdirCount+1))
+	h.AssertFileContains("md-internal/workdir-map.json", fmt.Sprintf("\"project-%03d\": \"../project-%03d\"", workdirCount+1, workdirCount+1))
+}
+
+// commandExitCode returns the exit status of a command run by the TestHelper
+func commandExitCode(t *testing.T, err error) int {
+	t.Helper()
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Expected the command to run, got: %v", err)
+	}
+	return exitErr.ExitCode()
+}
+
+// TestGitWmemCommit_JSONReportExitStatus tests the exit statuses and the report of --json-report
+// Reference: docs/use-cases/git-wmem-commit/basic.md#exit-status
+func TestGitWmemCommit_JSONReportExitStatus(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	output, err = h.RunGitWmem("commit", "--json-report")
+	if code := commandExitCode(t, err); code != 3 {
+		t.Errorf("Expected exit status 3 for a clean wmem-repo, got %d", code)
+	}
+	h.AssertOutputContains(output, `"outcome": "nothing-to-commit"`)
+	if strings.Contains(output, "Error:") {
+		t.Errorf("Expected no error for a clean wmem-repo, got: %s", output)
+	}
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A for json report")
+	h.SetWorkDir(wmemDir)
+	reportPath := filepath.Join(h.TempDir(), "report.json")
+	output, err = h.RunGitWmem("commit", "--json-report", "--report", reportPath)
+	if code := commandExitCode(t, err); code != 0 {
+		t.Errorf("Expected exit status 0 for a snapshot, got %d", code)
+	}
+	h.AssertOutputContains(output, `"outcome": "committed"`)
+	var report struct {
+		Outcome        string `json:"outcome"`
+		WmemRepoCommit string `json:"wmemRepoCommit"`
+	}
+	content, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	if err := json.Unmarshal(content, &report); err != nil {
+		t.Fatalf("Failed to parse report: %v", err)
+	}
+	if report.Outcome != "committed" || report.WmemRepoCommit == "" {
+		t.Errorf("Expected a committed outcome with a wmem-repo commit, got %+v", report)
+	}
+
+	// stdout carries only the report
+	cmd := exec.Command("git-wmem", "commit", "--json-report")
+	cmd.Dir = wmemDir
+	stdout, err := cmd.Output()
+	if code := commandExitCode(t, err); code != 3 {
+		t.Errorf("Expected exit status 3 for a clean wmem-repo, got %d", code)
+	}
+	if err := json.Unmarshal(stdout, &report); err != nil {
+		t.Errorf("Expected stdout to be the JSON report, got %q: %v", stdout, err)
+	}
+
+	// A failed workdir skipped by --keep-going makes the run partial
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "changed B for json report")
+	slowUploadPack(h, "my-projectB", "30")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--json-report", "--keep-going", "--workdir-timeout", "500ms")
+	if code := commandExitCode(t, err); code != 4 {
+		t.Errorf("Expected exit status 4 for a partial run, got %d", code)
+	}
+	h.AssertOutputContains(output, `"outcome": "partial"`)
+}
+
+// TestGitWmemCommit_DedupeBlobsAcrossWorkdirs tests that an identical uncommitted file of two workdirs
+// is stored once in repos/_shared.git with --dedupe-blobs-across-workdirs
+// Reference: docs/use-cases/git-wmem-commit/basic.md#dedupe-blobs-across-workdirs
+func TestGitWmemCommit_DedupeBlobsAcrossWorkdirs(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.SetWorkDir(setupBasicWmemRepo(h))
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit", "--dedupe-blobs-across-workdirs")
+	h.AssertCommandError(output, err, "--dedupe-blobs-across-workdirs requires a wmem-repo created with git-wmem init --bare-repos-shared", "git-wmem commit --dedupe-blobs-across-workdirs without a shared object store")
+
+	h.SetWorkDir(h.TempDir())
+	output, err = h.RunGitWmem("init", "--bare-repos-shared", "my-wmem2")
+	h.AssertCommandSuccess(output, err, "git-wmem init --bare-repos-shared my-wmem2")
+	sharedWmemDir := filepath.Join(h.TempDir(), "my-wmem2")
+	projectA, projectB := setupTestProjects(h)
+
+	content := strings.Repeat("large identical content\n", 1000)
+	for _, project := range []string{projectA, projectB} {
+		h.SetWorkDir(project)
+		h.WriteFile("dataset.txt", content)
+	}
+	blobHash, err := h.RunGit("hash-object", "dataset.txt")
+	h.AssertCommandSuccess(blobHash, err, "git hash-object dataset.txt")
+	blobHash = strings.TrimSpace(blobHash)
+	looseBlob := filepath.Join("objects", blobHash[:2], blobHash[2:])
+
+	h.SetWorkDir(sharedWmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err = h.RunGitWmem("commit", "--dedupe-blobs-across-workdirs")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --dedupe-blobs-across-workdirs")
+
+	h.AssertFileExists(filepath.Join("repos", "_shared.git", looseBlob))
+
+	// The deduped blobs are reachable from refs/wmem-blobs/ of repos/_shared.git, a plain git gc keeps them
+	sharedRepoPath := filepath.Join(sharedWmemDir, "repos", "_shared.git")
+	for _, workdirName := range []string{"my-projectA", "my-projectB"} {
+		output, err = h.RunGit("--git-dir", sharedRepoPath, "show", "refs/wmem-blobs/"+workdirName+"/main:dataset.txt")
+		h.AssertCommandSuccess(output, err, "read dataset.txt from refs/wmem-blobs/"+workdirName+"/main")
+	}
+	output, err = h.RunGit("--git-dir", sharedRepoPath, "gc", "--prune=now")
+	h.AssertCommandSuccess(output, err, "git gc --prune=now in repos/_shared.git")
+
+	for _, workdirName := range []string{"my-projectA", "my-projectB"} {
+		repoPath := filepath.Join(sharedWmemDir, "repos", workdirName+".git")
+		if _, err := os.Stat(filepath.Join(repoPath, looseBlob)); err == nil {
+			t.Errorf("Expected the blob of dataset.txt not to be stored in %s", repoPath)
+		}
+		snapshot, err := h.RunGit("--git-dir", repoPath, "show", "wmem-br/main:dataset.txt")
+		h.AssertCommandSuccess(snapshot, err, "read dataset.txt from the "+workdirName+" snapshot")
+		if snapshot != content {
+			t.Errorf("Expected the %s snapshot to contain dataset.txt, got %d bytes", workdirName, len(snapshot))
+		}
+		output, err = h.RunGit("--git-dir", repoPath, "fsck", "--connectivity-only")
+		h.AssertCommandSuccess(output, err, "git fsck "+workdirName)
+	}
+}
+
+// TestGitWmemCommit_AnnotateWmemUIDInWorkdir tests that --annotate-wmem-uid-in-workdir adds the wmem-uid
+// to a refs/notes/wmem note on the workdir HEAD and leaves the workdir history and files alone
+// Reference: docs/use-cases/git-wmem-commit/basic.md#annotate-wmem-uid-in-workdir
+func TestGitWmemCommit_AnnotateWmemUIDInWorkdir(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A for the note")
+	headBefore, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(headBefore, err, "git rev-parse HEAD")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--annotate-wmem-uid-in-workdir")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --annotate-wmem-uid-in-workdir")
+	h.AssertOutputContains(output, "Annotated HEAD of 1 workdir(s)")
+	uids, err := h.RunGitWmem("log", "--uid-only")
+	h.AssertCommandSuccess(uids, err, "git-wmem log --uid-only")
+	wmemUID := strings.Split(strings.TrimSpace(uids), "\n")[0]
+
+	h.SetWorkDir(projectA)
+	note, err := h.RunGit("notes", "--ref", "wmem", "show", "HEAD")
+	h.AssertCommandSuccess(note, err, "git notes --ref wmem show HEAD")
+	if strings.TrimSpace(note) != wmemUID {
+		t.Errorf("Expected the note of the workdir HEAD to be %q, got %q", wmemUID, note)
+	}
+	headAfter, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(headAfter, err, "git rev-parse HEAD")
+	if headAfter != headBefore {
+		t.Errorf("Expected the workdir HEAD to stay at %s, got %s", headBefore, headAfter)
+	}
+	status, err := h.RunGit("status", "--porcelain")
+	h.AssertCommandSuccess(status, err, "git status")
+	if strings.TrimSpace(status) != "M fileA.txt" {
+		t.Errorf("Expected only the uncommitted fileA.txt change in the workdir, got %q", status)
+	}
+
+	// A second snapshot of the same HEAD appends its wmem-uid
+	h.WriteFile("fileA.txt", "changed A again")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--annotate-wmem-uid-in-workdir")
+	h.AssertCommandSuccess(output, err, "second git-wmem commit --annotate-wmem-uid-in-workdir")
+	h.SetWorkDir(projectA)
+	note, err = h.RunGit("notes", "--ref", "wmem", "show", "HEAD")
+	h.AssertCommandSuccess(note, err, "git notes --ref wmem show HEAD")
+	if lines := strings.Split(strings.TrimSpace(note), "\n"); len(lines) != 2 || lines[0] != wmemUID {
+		t.Errorf("Expected two wmem-uids starting with %s, got %q", wmemUID, note)
+	}
+
+	// The unchanged workdir isn't annotated
+	h.SetWorkDir(projectB)
+	if output, err := h.RunGit("notes", "--ref", "wmem", "list"); err == nil && strings.TrimSpace(output) != "" {
+		t.Errorf("Expected no notes in the unchanged workdir, got %q", output)
+	}
+}
+
+// TestGitWmemCommit_RequireCleanWmemRepo tests that --require-clean-wmem-repo refuses to fold pre-existing
+// md/ edits into the wmem-repo commit
+// Reference: docs/use-cases/git-wmem-commit/basic.md#require-clean-wmem-repo
+func TestGitWmemCommit_RequireCleanWmemRepo(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	output, err = h.RunGitWmem("commit", "--require-clean-wmem-repo")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --require-clean-wmem-repo on a clean wmem-repo")
+
+	headBefore, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(headBefore, err, "git rev-parse HEAD")
+	h.WriteFile("md/commit/msg-prefix", "half-finished prefix")
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A with a dirty wmem-repo")
+	h.SetWorkDir(wmemDir)
+
+	output, err = h.RunGitWmem("commit", "--require-clean-wmem-repo")
+	h.AssertCommandError(output, err, "wmem-repo has uncommitted changes from before this run (--require-clean-wmem-repo)", "git-wmem commit --require-clean-wmem-repo with md/ edits")
+	headAfter, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(headAfter, err, "git rev-parse HEAD")
+	if headAfter != headBefore {
+		t.Errorf("Expected no wmem-repo commit, HEAD moved from %s to %s", headBefore, headAfter)
+	}
+	output, err = h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", "my-projectA.git"), "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "read fileA.txt from snapshot")
+	if strings.TrimSpace(output) == "changed A with a dirty wmem-repo" {
+		t.Errorf("Expected no workdir snapshot after the failed run")
+	}
+}
+
+// TestGitWmemCommit_NoFetch tests that --no-fetch never fetches: workdirs without new commits are snapshotted
+// from their files, workdirs with a new HEAD commit are skipped with a warning
+// Reference: docs/use-cases/git-wmem-commit/basic.md#no-fetch
+func TestGitWmemCommit_NoFetch(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	// A branch created without a new HEAD commit isn't fetched
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("branch", "feature")
+	h.AssertCommandSuccess(output, err, "git branch feature")
+	h.WriteFile("fileA.txt", "modified A")
+
+	// A new HEAD commit needs a fetch, the workdir is skipped
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "committed B")
+	output, err = h.RunGit("commit", "-q", "-am", "Update B")
+	h.AssertCommandSuccess(output, err, "git commit")
+	output, err = h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(output, err, "git rev-parse HEAD")
+	headB := strings.TrimSpace(output)
+
+	h.SetWorkDir(wmemDir)
+	start := time.Now()
+	output, err = h.RunGitWmem("commit", "--no-fetch")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --no-fetch")
+	t.Logf("git-wmem commit --no-fetch took %v", time.Since(start))
+	h.AssertOutputContains(output, "Warning: Skipping workdir ../my-projectB: its HEAD commit isn't in the wmem-wd-repo yet (--no-fetch), run without --no-fetch to snapshot it")
+	if strings.Contains(output, "Skipping workdir ../my-projectA") {
+		t.Errorf("Expected my-projectA to be snapshotted, got:\n%s", output)
+	}
+
+	output, err = h.RunGit("--git-dir", "repos/my-projectA.git", "rev-parse", "--verify", "-q", "refs/remotes/wmem-wd/feature")
+	if err == nil {
+		t.Errorf("Expected the feature branch not to be fetched with --no-fetch, got %s", output)
+	}
+	output, err = h.RunGit("--git-dir", "repos/my-projectA.git", "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show wmem-br/main:fileA.txt")
+	if strings.TrimSpace(output) != "modified A" {
+		t.Errorf("Expected the snapshot of fileA.txt to be 'modified A', got %q", output)
+	}
+	output, err = h.RunGit("--git-dir", "repos/my-projectB.git", "cat-file", "-e", headB)
+	if err == nil {
+		t.Errorf("Expected the new HEAD commit of my-projectB not to be fetched with --no-fetch")
+	}
+	output, err = h.RunGitWmem("commit", "--no-fetch", "--treat-warnings-as-errors")
+	h.AssertCommandError(output, err, "Skipping workdir ../my-projectB", "git-wmem commit --no-fetch --treat-warnings-as-errors")
+
+	// Without --no-fetch every branch is fetched again
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "modified A again")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+	output, err = h.RunGit("--git-dir", "repos/my-projectA.git", "rev-parse", "--verify", "-q", "refs/remotes/wmem-wd/feature")
+	h.AssertCommandSuccess(output, err, "feature branch fetched")
+	output, err = h.RunGit("--git-dir", "repos/my-projectB.git", "merge-base", "--is-ancestor", headB, "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "workdir HEAD merged into wmem-br/main")
+}
+
+// TestGitWmemCommit_WorkdirFromStdin tests reading the workdir paths from stdin
+// Reference: docs/use-cases/git-wmem-commit/basic.md#workdir-paths-from-stdin
+func TestGitWmemCommit_WorkdirFromStdin(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "modified A")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "modified B")
+
+	h.SetWorkDir(wmemDir)
+	output, err := h.RunCommandWithStdin("../my-projectA\n\n../my-projectB\n", "git-wmem", "commit", "--workdir-from-stdin")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --workdir-from-stdin")
+	h.AssertOutputContains(output, "Created wmem-repo commit with changes from 2 workdir(s)")
+
+	h.AssertFileEquals("md/commit-workdir-paths", "")
+	h.AssertFileContains("md-internal/workdir-map.json", "\"my-projectA\": \"../my-projectA\"")
+	h.AssertFileContains("md-internal/workdir-map.json", "\"my-projectB\": \"../my-projectB\"")
+	for _, snapshot := range []struct{ repo, file, content string }{
+		{"my-projectA", "fileA.txt", "modified A"},
+		{"my-projectB", "fileB.txt", "modified B"},
+	} {
+		output, err = h.RunGit("--git-dir", "repos/"+snapshot.repo+".git", "show", "wmem-br/main:"+snapshot.file)
+		h.AssertCommandSuccess(output, err, "git show "+snapshot.file)
+		if strings.TrimSpace(output) != snapshot.content {
+			t.Errorf("Expected the snapshot of %s in %s to be %q, got %q", snapshot.file, snapshot.repo, snapshot.content, output)
+		}
+	}
+
+	// Without stdin input (the test runs it with an empty stdin) nothing is committed
+	output, err = h.RunGitWmem("commit", "--workdir-from-stdin")
+	h.AssertCommandError(output, err, "No workdir paths on stdin", "git-wmem commit --workdir-from-stdin with empty stdin")
+}
+
+// TestGitWmemCommit_IgnoreSubmoduleErrors tests that a nested repository without commits fails the
+// snapshot by default and is omitted with --ignore-submodule-errors
+// Reference: docs/use-cases/git-wmem-commit/basic.md#submodule-errors
+func TestGitWmemCommit_IgnoreSubmoduleErrors(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	// A nested repository with an unborn HEAD
+	h.SetWorkDir(projectA)
+	h.MkdirAll("vendor/lib")
+	h.WriteFile("vendor/lib/lib.txt", "library")
+	h.SetWorkDir(filepath.Join(projectA, "vendor", "lib"))
+	output, err = h.RunGit("init", "-q")
+	h.AssertCommandSuccess(output, err, "git init nested repository")
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "modified A")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandError(output, err, "failed to get HEAD of nested git repository", "git-wmem commit with an unborn nested repository")
+
+	output, err = h.RunGitWmem("commit", "--ignore-submodule-errors")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --ignore-submodule-errors")
+	h.AssertOutputContains(output, "Warning: Skipping nested git repository (--ignore-submodule-errors): failed to get HEAD of nested git repository")
+	if count := strings.Count(output, "Warning: Skipping nested git repository"); count != 1 {
+		t.Errorf("Expected one warning for the nested repository, got %d", count)
+	}
+
+	output, err = h.RunGit("--git-dir", "repos/my-projectA.git", "ls-tree", "-r", "--name-only", "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "git ls-tree wmem-br/main")
+	if strings.Contains(output, "vendor") {
+		t.Errorf("Expected the nested repository to be omitted, got:\n%s", output)
+	}
+	output, err = h.RunGit("--git-dir", "repos/my-projectA.git", "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show wmem-br/main:fileA.txt")
+	if strings.TrimSpace(output) != "modified A" {
+		t.Errorf("Expected the snapshot of fileA.txt to be 'modified A', got %q", output)
+	}
+}
+
+func TestGitWmemCommit_SingleCommitPerRun(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	// Snapshot a feature branch, then switch back to main
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("checkout", "-q", "-b", "feature")
+	h.AssertCommandSuccess(output, err, "git checkout -b feature")
+	h.WriteFile("feature.txt", "feature")
+	output, err = h.RunGit("add", "feature.txt")
+	h.AssertCommandSuccess(output, err, "git add feature.txt")
+	output, err = h.RunGit("commit", "-q", "-m", "Add feature.txt")
+	h.AssertCommandSuccess(output, err, "git commit on feature")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit on feature")
+	featureTip, err := h.RunGit("--git-dir", "repos/my-projectA.git", "rev-parse", "wmem-br/feature")
+	h.AssertCommandSuccess(featureTip, err, "git rev-parse wmem-br/feature")
+	mainTip, err := h.RunGit("--git-dir", "repos/my-projectA.git", "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(mainTip, err, "git rev-parse wmem-br/main")
+
+	// A new commit on main plus uncommitted changes
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("checkout", "-q", "main")
+	h.AssertCommandSuccess(output, err, "git checkout main")
+	h.WriteFile("fileA2.txt", "A2")
+	output, err = h.RunGit("add", "fileA2.txt")
+	h.AssertCommandSuccess(output, err, "git add fileA2.txt")
+	output, err = h.RunGit("commit", "-q", "-m", "Add fileA2.txt")
+	h.AssertCommandSuccess(output, err, "git commit on main")
+	workdirHead, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(workdirHead, err, "git rev-parse HEAD")
+	h.WriteFile("fileA.txt", "uncommitted A")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--single-commit-per-run")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --single-commit-per-run")
+
+	output, err = h.RunGit("--git-dir", "repos/my-projectA.git", "rev-list", "--first-parent", strings.TrimSpace(mainTip)+"..wmem-br/main")
+	h.AssertCommandSuccess(output, err, "git rev-list wmem-br/main")
+	if commits := strings.Fields(output); len(commits) != 1 {
+		t.Fatalf("Expected exactly one new snapshot commit on wmem-br/main, got %d:\n%s", len(commits), output)
+	}
+	output, err = h.RunGit("--git-dir", "repos/my-projectA.git", "rev-parse", "wmem-br/main^1", "wmem-br/main^2")
+	h.AssertCommandSuccess(output, err, "git rev-parse wmem-br/main parents")
+	expectedParents := strings.TrimSpace(mainTip) + "\n" + strings.TrimSpace(workdirHead)
+	if strings.TrimSpace(output) != expectedParents {
+		t.Errorf("Expected parents previous wmem-br/main tip and workdir HEAD:\n%s\ngot:\n%s", expectedParents, output)
+	}
+	output, err = h.RunGit("--git-dir", "repos/my-projectA.git", "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show wmem-br/main:fileA.txt")
+	if strings.TrimSpace(output) != "uncommitted A" {
+		t.Errorf("Expected the snapshot of fileA.txt to be 'uncommitted A', got %q", output)
+	}
+	output, err = h.RunGit("--git-dir", "repos/my-projectA.git", "log", "-1", "--format=%B", "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "git log wmem-br/main")
+	h.AssertOutputContains(output, "Merges workdir commit "+strings.TrimSpace(workdirHead)+" (--single-commit-per-run)")
+
+	output, err = h.RunGit("--git-dir", "repos/my-projectA.git", "rev-parse", "wmem-br/feature")
+	h.AssertCommandSuccess(output, err, "git rev-parse wmem-br/feature")
+	if output != featureTip {
+		t.Errorf("Expected wmem-br/feature to stay at %s, got %s", featureTip, output)
+	}
+}
+
+func TestGitWmemCommit_AuthorEmailDomainCheck(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.WriteFile("md/commit/allowed-domains", "# corp wmem-repo\nExample.com\n")
+	h.WriteFile("md/commit/author", "Me <me@example.com>\n")
+	h.WriteFile("md/commit/committer", "Me <me@EXAMPLE.com>\n")
+	output, err := h.RunGitWmem("commit", "--author-email-domain-check")
+	h.AssertCommandSuccess(output, err, "git-wmem commit with an allowed domain")
+
+	tip, err := h.RunGit("--git-dir", "repos/my-projectA.git", "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(tip, err, "git rev-parse wmem-br/main")
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "modified A")
+	h.SetWorkDir(wmemDir)
+	h.WriteFile("md/commit/author", "Me <me@gmail.com>\n")
+	output, err = h.RunGitWmem("commit", "--author-email-domain-check")
+	h.AssertCommandError(output, err, `author email "me@gmail.com" is not in an allowed domain of md/commit/allowed-domains (--author-email-domain-check): example.com`, "git-wmem commit with a disallowed domain")
+
+	output, err = h.RunGit("--git-dir", "repos/my-projectA.git", "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "git rev-parse wmem-br/main")
+	if output != tip {
+		t.Errorf("Expected no new snapshot with a disallowed domain, wmem-br/main moved from %s to %s", tip, output)
+	}
+}
+
+func TestGitWmemCommit_BlobFilter(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	filter := "sed 's/token=.*/token=REDACTED/'"
+	output, err = h.RunGitWmem("commit", "--blob-filter", filter)
+	h.AssertCommandError(output, err, "--blob-filter needs the files to clean in md/commit/blob-filter-attributes", "git-wmem commit --blob-filter without attributes")
+
+	secret := "name=projectA\ntoken=s3cr3t-t0k3n\n"
+	h.SetWorkDir(projectA)
+	h.WriteFile("local.env", secret)
+	h.WriteFile("fileA.txt", "token=kept in other files")
+
+	h.SetWorkDir(wmemDir)
+	h.WriteFile("md/commit/blob-filter-attributes", "# secrets\n*.env wmem-blob-filter\n")
+	output, err = h.RunGitWmem("commit", "--blob-filter", filter)
+	h.AssertCommandSuccess(output, err, "git-wmem commit --blob-filter")
+
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	output, err = h.RunGit("--git-dir", bareRepo, "show", "wmem-br/main:local.env")
+	h.AssertCommandSuccess(output, err, "git show wmem-br/main:local.env")
+	if output != "name=projectA\ntoken=REDACTED\n" {
+		t.Errorf("Expected the filtered content in the snapshot blob, got %q", output)
+	}
+	output, err = h.RunGit("--git-dir", bareRepo, "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show wmem-br/main:fileA.txt")
+	if output != "token=kept in other files" {
+		t.Errorf("Expected fileA.txt not to be filtered, got %q", output)
+	}
+
+	h.SetWorkDir(projectA)
+	h.AssertFileEquals("local.env", secret)
+
+	h.WriteFile("local.env", secret+"more=1\n")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--blob-filter", "echo filter broke >&2; exit 3")
+	h.AssertCommandError(output, err, "blob filter failed for local.env: exit status 3: filter broke", "git-wmem commit with a failing blob filter")
+}
+
+func TestGitWmemCommit_Resume(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	projects := []string{"my-projectA", "my-projectB", "my-projectC", "my-projectD"}
+	files := []string{"fileA.txt", "fileB.txt", "fileC.txt", "fileD.txt"}
+	for i, project := range projects[2:] {
+		projectDir := filepath.Join(filepath.Dir(projectA), project)
+		h.MkdirAll(projectDir)
+		h.SetWorkDir(projectDir)
+		output, err := h.RunGit("init")
+		h.AssertCommandSuccess(output, err, "git init "+project)
+		h.WriteFile(files[i+2], "initial content")
+		output, err = h.RunGit("add", files[i+2])
+		h.AssertCommandSuccess(output, err, "git add "+files[i+2])
+		output, err = h.RunGit("commit", "-m", "Initial commit in "+project)
+		h.AssertCommandSuccess(output, err, "git commit "+project)
+	}
+
+	h.SetWorkDir(wmemDir)
+	for _, project := range projects {
+		h.AppendToFile("md/commit-workdir-paths", "../"+project)
+	}
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+	for i, project := range projects {
+		h.SetWorkDir(filepath.Join(filepath.Dir(projectA), project))
+		h.WriteFile(files[i], "resumed change")
+	}
+
+	h.SetWorkDir(wmemDir)
+	wmemLog, err := h.RunGit("log", "--oneline")
+	h.AssertCommandSuccess(wmemLog, err, "git log")
+	commitsBefore := len(strings.Split(strings.TrimSpace(wmemLog), "\n"))
+
+	output, err = h.RunGitWmem("commit", "--resume")
+	h.AssertCommandError(output, err, "no interrupted git-wmem commit run to resume", "git-wmem commit --resume without an interrupted run")
+
+	// The blob filter fails the check of my-projectA (skipped with --keep-going) and kills
+	// git-wmem in the snapshot step of my-projectC, once my-projectB got its snapshot
+	filter := filepath.Join(h.TempDir(), "interrupting-filter.sh")
+	h.WriteFile(filter, fmt.Sprintf(`case "$GIT_WMEM_BLOB_FILTER_PATH" in
+fileA.txt) exit 3 ;;
+fileC.txt)
+	if [ "$(git --git-dir %s show wmem-br/main:fileB.txt 2>/dev/null)" = "resumed change" ]; then
+		kill -9 "$(cut -d' ' -f1 %s)"
+		exit 1
+	fi ;;
+esac
+cat
+`, filepath.Join(wmemDir, "repos", "my-projectB.git"), filepath.Join(wmemDir, ".git", "git-wmem.lock")))
+	h.WriteFile("md/commit/blob-filter-attributes", "file*.txt wmem-blob-filter\n")
+	output, err = h.RunGitWmem("commit", "--keep-going", "--blob-filter", "sh "+filter)
+	if err == nil || !strings.Contains(err.Error(), "killed") {
+		t.Fatalf("Expected the git-wmem commit to be killed, got %v:\n%s", err, output)
+	}
+	h.AssertOutputContains(output, "Warning: Skipping failed workdir ../my-projectA")
+	if err := os.Remove(filepath.Join(wmemDir, "md", "commit", "blob-filter-attributes")); err != nil {
+		t.Fatalf("Failed to remove blob filter attributes: %v", err)
+	}
+
+	snapshotContent := func(i int) string {
+		content, err := h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", projects[i]+".git"), "show", "wmem-br/main:"+files[i])
+		h.AssertCommandSuccess(content, err, "git show "+files[i])
+		return content
+	}
+	for i := range projects {
+		if snapshotted := snapshotContent(i) == "resumed change"; snapshotted != (i == 1) {
+			t.Errorf("Expected only my-projectB snapshotted by the interrupted run, %s snapshotted: %v", projects[i], snapshotted)
+		}
+	}
+
+	output, err = h.RunGitWmem("commit", "--resume")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --resume")
+	h.AssertOutputContains(output, "1 workdir(s) already done")
+	h.AssertOutputContains(output, "Info: Skipping workdir ../my-projectB, already done in run")
+	if strings.Contains(output, "Skipping workdir ../my-projectA, already done") {
+		t.Errorf("Expected the skipped my-projectA to be checked again by --resume:\n%s", output)
+	}
+	h.AssertOutputContains(output, "Info: Created wmem-repo commit with changes from 4 workdir(s)")
+	for i := range projects {
+		if content := snapshotContent(i); content != "resumed change" {
+			t.Errorf("Expected %s snapshotted after --resume, got %q", projects[i], content)
+		}
+	}
+
+	wmemLog, err = h.RunGit("log", "--oneline")
+	h.AssertCommandSuccess(wmemLog, err, "git log")
+	if commitsAfter := len(strings.Split(strings.TrimSpace(wmemLog), "\n")); commitsAfter != commitsBefore+1 {
+		t.Errorf("Expected one wmem-repo commit for the interrupted and resumed run, got %d -> %d", commitsBefore, commitsAfter)
+	}
+	message, err := h.RunGit("log", "-1", "--format=%B")
+	h.AssertCommandSuccess(message, err, "git log -1")
+	_, wmemUID, _ := strings.Cut(message, "wmem-uid: ")
+	wmemUID = strings.Fields(wmemUID)[0]
+	for _, project := range projects {
+		h.AssertOutputContains(message, "`"+project+"`")
+		snapshotMessage, err := h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", project+".git"), "log", "-1", "--format=%B", "wmem-br/main")
+		h.AssertCommandSuccess(snapshotMessage, err, "git log -1 wmem-br/main of "+project)
+		h.AssertOutputContains(snapshotMessage, "wmem-uid: "+wmemUID)
+	}
+	if _, err := os.Stat(filepath.Join(wmemDir, ".git", "git-wmem-commit-run.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected the run state to be removed after the resumed run, got %v", err)
+	}
+}
+
+// TestGitWmemCommit_FailedRunLeavesNoState tests that a run failing before any snapshot leaves no run state
+// Reference: docs/use-cases/git-wmem-commit/basic.md#resume
+func TestGitWmemCommit_FailedRunLeavesNoState(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "changed B")
+
+	h.SetWorkDir(wmemDir)
+	h.WriteFile("md/commit/blob-filter-attributes", "fileA.txt wmem-blob-filter\n")
+	output, err = h.RunGitWmem("commit", "--blob-filter", "exit 3")
+	h.AssertCommandError(output, err, "failed to check workdir ../my-projectA", "git-wmem commit with a failing blob filter")
+	statePath := filepath.Join(wmemDir, ".git", "git-wmem-commit-run.json")
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Errorf("Expected no run state after a run that snapshotted nothing, got %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(wmemDir, "md", "commit", "blob-filter-attributes")); err != nil {
+		t.Fatalf("Failed to remove blob filter attributes: %v", err)
+	}
+	output, err = h.RunGitWmem("commit", "--treat-warnings-as-errors")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --treat-warnings-as-errors after a failed run")
+	if strings.Contains(output, "Discarding the state") {
+		t.Errorf("Expected no warning about an interrupted run:\n%s", output)
+	}
+	h.AssertOutputContains(output, "Info: Created wmem-repo commit with changes from 2 workdir(s)")
+}
+
+func TestGitWmemCommit_OnConflict(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	// A snapshot commit on wmem-br/main, then a new workdir commit
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "snapshotted A")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit of uncommitted changes")
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "committed A")
+	output, err = h.RunGit("commit", "-q", "-am", "Change fileA.txt")
+	h.AssertCommandSuccess(output, err, "git commit in workdir")
+	workdirHead, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(workdirHead, err, "git rev-parse HEAD")
+	workdirHead = strings.TrimSpace(workdirHead)
+
+	h.SetWorkDir(wmemDir)
+	wmemTip := func() string {
+		tip, err := h.RunGit("--git-dir", "repos/my-projectA.git", "rev-parse", "wmem-br/main")
+		h.AssertCommandSuccess(tip, err, "git rev-parse wmem-br/main")
+		return strings.TrimSpace(tip)
+	}
+	tipBefore := wmemTip()
+
+	output, err = h.RunGitWmem("commit", "--on-conflict=bogus")
+	h.AssertCommandError(output, err, `invalid --on-conflict "bogus"`, "git-wmem commit --on-conflict=bogus")
+
+	output, err = h.RunGitWmem("commit", "--on-conflict=skip")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --on-conflict=skip")
+	h.AssertOutputContains(output, "Warning: Skipping workdir ../my-projectA: workdir HEAD "+workdirHead[:12]+" isn't merged into wmem-br/main (--on-conflict=skip)")
+	if tip := wmemTip(); tip != tipBefore {
+		t.Errorf("Expected wmem-br/main to stay at %s with --on-conflict=skip, got %s", tipBefore, tip)
+	}
+	if output, err := h.RunGit("--git-dir", "repos/my-projectA.git", "merge-base", "--is-ancestor", workdirHead, "wmem-br/main"); err == nil {
+		t.Errorf("Expected workdir HEAD not merged into wmem-br/main with --on-conflict=skip: %s", output)
+	}
+
+	output, err = h.RunGitWmem("commit", "--on-conflict=accept-workdir")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --on-conflict=accept-workdir")
+	h.AssertOutputContains(output, "Info: Created merge commit for workdir ../my-projectA into wmem-br/main")
+	parents, err := h.RunGit("--git-dir", "repos/my-projectA.git", "log", "-1", "--format=%P", "wmem-br/main")
+	h.AssertCommandSuccess(parents, err, "git log -1 --format=%P wmem-br/main")
+	if fields := strings.Fields(parents); len(fields) != 2 || fields[0] != tipBefore || fields[1] != workdirHead {
+		t.Errorf("Expected the merge of %s into %s, got parents %q", workdirHead, tipBefore, parents)
+	}
+	content, err := h.RunGit("--git-dir", "repos/my-projectA.git", "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(content, err, "git show wmem-br/main:fileA.txt")
+	if content != "committed A" {
+		t.Errorf("Expected the workdir tree accepted by the merge, got fileA.txt %q", content)
+	}
+}
+
+// TestGitWmemCommit_RecordUpstream tests that --record-upstream records how far a workdir is ahead of its upstream
+func TestGitWmemCommit_RecordUpstream(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	// projectA tracks origin/main and is 2 commits ahead of it
+	upstreamDir := filepath.Join(h.TempDir(), "upstreamA.git")
+	h.SetWorkDir(projectA)
+	output, err := h.RunGit("init", "-q", "--bare", upstreamDir)
+	h.AssertCommandSuccess(output, err, "git init --bare")
+	output, err = h.RunGit("remote", "add", "origin", upstreamDir)
+	h.AssertCommandSuccess(output, err, "git remote add origin")
+	output, err = h.RunGit("push", "-q", "-u", "origin", "main")
+	h.AssertCommandSuccess(output, err, "git push -u origin main")
+	for _, content := range []string{"ahead 1", "ahead 2"} {
+		h.WriteFile("fileA.txt", content)
+		output, err = h.RunGit("commit", "-q", "-am", content)
+		h.AssertCommandSuccess(output, err, "git commit "+content)
+	}
+	h.WriteFile("fileA.txt", "uncommitted A")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	reportPath := filepath.Join(h.TempDir(), "report.json")
+	output, err = h.RunGitWmem("commit", "--record-upstream", "--report", reportPath)
+	h.AssertCommandSuccess(output, err, "git-wmem commit --record-upstream")
+
+	message, err := h.RunGit("log", "-1", "--format=%B")
+	h.AssertCommandSuccess(message, err, "git log -1")
+	h.AssertOutputContains(message, "\n  upstream: origin/main ahead 2, behind 0")
+
+	content, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var report struct {
+		Workdirs []struct {
+			Upstream *struct {
+				Ref    string `json:"ref"`
+				Ahead  int    `json:"ahead"`
+				Behind int    `json:"behind"`
+			} `json:"upstream"`
+		} `json:"workdirs"`
+	}
+	if err := json.Unmarshal(content, &report); err != nil {
+		t.Fatalf("Failed to parse report: %v\n%s", err, content)
+	}
+	if len(report.Workdirs) != 1 || report.Workdirs[0].Upstream == nil {
+		t.Fatalf("Expected the upstream in the report, got:\n%s", content)
+	}
+	if upstream := report.Workdirs[0].Upstream; upstream.Ref != "origin/main" || upstream.Ahead != 2 || upstream.Behind != 0 {
+		t.Errorf("Expected origin/main ahead 2, behind 0 in the report, got %+v", *upstream)
+	}
+
+	// Without the option nothing is recorded
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "uncommitted again")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+	message, err = h.RunGit("log", "-1", "--format=%B")
+	h.AssertCommandSuccess(message, err, "git log -1")
+	if strings.Contains(message, "upstream:") {
+		t.Errorf("Expected no upstream line without --record-upstream, got:\n%s", message)
+	}
+}
+
+// TestGitWmemCommit_DryRunDiff tests that --dry-run --diff shows the content diff of a workdir without creating refs
+func TestGitWmemCommit_DryRunDiff(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+
+	refs := func() string {
+		var all []string
+		for _, gitDir := range []string{".git", "repos/my-projectA.git"} {
+			out, err := h.RunGit("--git-dir", gitDir, "for-each-ref")
+			h.AssertCommandSuccess(out, err, "git for-each-ref "+gitDir)
+			all = append(all, out)
+		}
+		return strings.Join(all, "\n")
+	}
+	refsBefore := refs()
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "edited A\n")
+	h.WriteFile("new.txt", "new file\n")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "edited B\n")
+	h.SetWorkDir(wmemDir)
+
+	output, err = h.RunGitWmem("commit", "--diff")
+	h.AssertCommandError(output, err, "--diff requires --dry-run", "git-wmem commit --diff")
+
+	output, err = h.RunGitWmem("commit", "--dry-run", "--diff")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --dry-run --diff")
+	h.AssertOutputContains(output, "Would snapshot workdir ../my-projectA (wmem-br/main):\n  ~ fileA.txt\n  + new.txt\n")
+	h.AssertOutputContains(output, "    --- a/fileA.txt\n    +++ b/fileA.txt\n")
+	h.AssertOutputContains(output, "\n    -file A content\n")
+	h.AssertOutputContains(output, "\n    +edited A\n")
+	h.AssertOutputContains(output, "    +new file\n")
+	// Not snapshotted yet, diffed against its HEAD tree
+	h.AssertOutputContains(output, "Would snapshot workdir ../my-projectB (wmem-br/main):\n  ~ fileB.txt\n")
+	h.AssertOutputContains(output, "Info: 2 of 2 workdir(s) would get a snapshot")
+
+	if refsAfter := refs(); refsAfter != refsBefore {
+		t.Errorf("Expected no refs changed by --dry-run, before:\n%s\nafter:\n%s", refsBefore, refsAfter)
+	}
+	if _, err := os.Stat(filepath.Join(wmemDir, "repos", "my-projectB.git")); !os.IsNotExist(err) {
+		t.Errorf("Expected no bare repo created by --dry-run, got %v", err)
+	}
+
+	// Plain --dry-run lists the files only
+	output, err = h.RunGitWmem("commit", "--dry-run")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --dry-run")
+	h.AssertOutputContains(output, "  ~ fileA.txt\n")
+	if strings.Contains(output, "diff --git") {
+		t.Errorf("Expected no diff without --diff, got:\n%s", output)
+	}
+}
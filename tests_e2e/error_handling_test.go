@@ -1,6 +1,7 @@
 package e2e
 
 import (
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -156,3 +157,95 @@ func TestBareRepoIntegrity_AfterCommit(t *testing.T) {
 		})
 	}
 }
+
+// TestBareRepoIntegrity_InvalidBareRepo tests handling of present-but-invalid repos/<name>.git
+// Reference: docs/validations.md#bare-repo-integrity
+func TestBareRepoIntegrity_InvalidBareRepo(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	_, _ = setupTestProjects(h)
+
+	// Interrupted init-repos left an empty directory behind - auto-repair
+	h.SetWorkDir(wmemDir)
+	h.MkdirAll("repos/my-projectA.git")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit with leftover empty bare repo")
+	h.AssertOutputContains(output, "Removing unreferenced bare repo")
+
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	output, err = h.RunGit("rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "git rev-parse wmem-br/main after repair")
+
+	// Known workdir with a broken bare repo - clear diagnostic
+	h.SetWorkDir(wmemDir)
+	if err := os.RemoveAll(filepath.Join(wmemDir, "repos", "my-projectA.git")); err != nil {
+		t.Fatalf("Failed to remove bare repo: %v", err)
+	}
+	h.MkdirAll("repos/my-projectA.git")
+	h.WriteFile("repos/my-projectA.git/HEAD", "garbage")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandError(output, err, "corrupt bare repo repos/my-projectA.git", "git-wmem-commit with corrupt bare repo")
+
+	// Moving it away lets the next run recreate it
+	if err := os.Rename(filepath.Join(wmemDir, "repos", "my-projectA.git"), filepath.Join(h.TempDir(), "broken.git")); err != nil {
+		t.Fatalf("Failed to move bare repo away: %v", err)
+	}
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit after moving broken bare repo away")
+	h.AssertOutputContains(output, "is missing, recreating it")
+}
+
+// TestBareRepoIntegrity_UnreferencedValidBareRepo tests that a valid repos/<name>.git missing
+// from workdir-map is adopted, never removed
+// Reference: docs/validations.md#bare-repo-integrity
+func TestBareRepoIntegrity_UnreferencedValidBareRepo(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "snapshotted change")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit with a change")
+	snapshot, err := h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", "my-projectA.git"), "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(snapshot, err, "git rev-parse wmem-br/main")
+
+	// An interrupted init-repos created the bare repo but didn't save workdir-map
+	workdirMap := filepath.Join(wmemDir, "md-internal", "workdir-map.json")
+	if err := os.WriteFile(workdirMap, []byte("{}\n"), 0644); err != nil {
+		t.Fatalf("Failed to reset workdir-map: %v", err)
+	}
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit with an unreferenced valid bare repo")
+	h.AssertOutputContains(output, "Adopting unreferenced bare repo repos/my-projectA.git")
+	h.AssertFileContains(workdirMap, "my-projectA")
+	output, err = h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", "my-projectA.git"), "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "git rev-parse wmem-br/main after adopting")
+	if strings.TrimSpace(output) != strings.TrimSpace(snapshot) {
+		t.Errorf("Expected the adopted bare repo to keep its snapshot history %s, got %s", snapshot, output)
+	}
+
+	// A valid bare repo of another workdir is never taken over
+	if err := os.WriteFile(workdirMap, []byte("{}\n"), 0644); err != nil {
+		t.Fatalf("Failed to reset workdir-map: %v", err)
+	}
+	h.MkdirAll(filepath.Join(h.TempDir(), "other"))
+	if err := os.Rename(projectB, filepath.Join(h.TempDir(), "other", "my-projectA")); err != nil {
+		t.Fatalf("Failed to move projectB: %v", err)
+	}
+	h.WriteFile("md/commit-workdir-paths", "../other/my-projectA\n")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandError(output, err, "unreferenced bare repo repos/my-projectA.git can't be used", "git-wmem-commit with a bare repo of another workdir")
+	h.AssertOutputContains(output, "Move it away")
+	h.AssertDirExists(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+}
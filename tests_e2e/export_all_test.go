@@ -0,0 +1,162 @@
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestGitWmemExportAll_Basic tests that export-all archives every workdir at a wmem-uid, including
+// workdirs unchanged by that run, together with the manifest
+// Reference: docs/use-cases/git-wmem-export-all/basic.md#main-scenario
+func TestGitWmemExportAll_Basic(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "snapshot 1 of A")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "snapshot 1 of B")
+	h.MkdirAll(filepath.Join(projectB, "bin"))
+	h.WriteFile("bin/run.sh", "#!/bin/sh\necho run\n")
+	if err := os.Chmod(filepath.Join(projectB, "bin", "run.sh"), 0755); err != nil {
+		t.Fatalf("Failed to chmod run.sh: %v", err)
+	}
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "first git-wmem commit")
+	tipB, err := h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", "my-projectB.git"), "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(tipB, err, "rev-parse my-projectB wmem-br/main")
+
+	// Only my-projectA changes in the second run
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "snapshot 2 of A")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "second git-wmem commit")
+	tipA, err := h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", "my-projectA.git"), "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(tipA, err, "rev-parse my-projectA wmem-br/main")
+
+	uids, err := h.RunGitWmem("log", "--uid-only")
+	h.AssertCommandSuccess(uids, err, "git-wmem log --uid-only")
+	uidLines := strings.Split(strings.TrimSpace(uids), "\n")
+	newestUID, firstUID := uidLines[0], uidLines[1]
+
+	archive := filepath.Join(h.TempDir(), "snapshot.tar")
+	output, err = h.RunGitWmem("export-all", "--output", archive, newestUID)
+	h.AssertCommandSuccess(output, err, "git-wmem export-all")
+	h.AssertOutputContains(output, fmt.Sprintf("Exported 2 workdir(s) of %s", newestUID))
+
+	extractDir := filepath.Join(h.TempDir(), "extracted")
+	h.MkdirAll(extractDir)
+	output, err = h.RunCommand("tar", "-xf", archive, "-C", extractDir)
+	h.AssertCommandSuccess(output, err, "tar -xf")
+	h.AssertFileEquals(filepath.Join(extractDir, "my-projectA", "fileA.txt"), "snapshot 2 of A")
+	h.AssertFileEquals(filepath.Join(extractDir, "my-projectB", "fileB.txt"), "snapshot 1 of B")
+	info, err := os.Stat(filepath.Join(extractDir, "my-projectB", "bin", "run.sh"))
+	if err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Expected an executable my-projectB/bin/run.sh, got %v (err=%v)", info, err)
+	}
+
+	manifest, err := os.ReadFile(filepath.Join(extractDir, "wmem-export-manifest.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read the manifest: %v", err)
+	}
+	expectedManifest := fmt.Sprintf("# git-wmem export-all %s\nmy-projectA\t%s\tmain\t%s\nmy-projectB\t%s\tmain\t%s\n",
+		newestUID, strings.TrimSpace(tipA), newestUID, strings.TrimSpace(tipB), firstUID)
+	if string(manifest) != expectedManifest {
+		t.Errorf("Expected manifest:\n%s\ngot:\n%s", expectedManifest, manifest)
+	}
+
+	// An older wmem-uid exports the older state
+	output, err = h.RunGitWmem("export-all", "--output", archive, firstUID)
+	h.AssertCommandSuccess(output, err, "git-wmem export-all of the first wmem-uid")
+	h.MkdirAll(filepath.Join(h.TempDir(), "extracted-first"))
+	output, err = h.RunCommand("tar", "-xf", archive, "-C", filepath.Join(h.TempDir(), "extracted-first"))
+	h.AssertCommandSuccess(output, err, "tar -xf first")
+	h.AssertFileEquals(filepath.Join(h.TempDir(), "extracted-first", "my-projectA", "fileA.txt"), "snapshot 1 of A")
+
+	output, err = h.RunGitWmem("export-all", "--output", archive, "wmem-000000")
+	h.AssertCommandError(output, err, "unknown wmem-uid wmem-000000", "git-wmem export-all of an unknown wmem-uid")
+}
+
+// TestGitWmemExportAll_OutputDirHardlinkDedupe tests that export-all --output-dir writes each wmem-uid to
+// its own directory and --hardlink-dedupe hardlinks files the snapshots share
+// Reference: docs/use-cases/git-wmem-export-all/basic.md#output-directory
+func TestGitWmemExportAll_OutputDirHardlinkDedupe(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "snapshot 1 of A")
+	h.WriteFile("shared.txt", "identical in both snapshots")
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "first git-wmem commit")
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "snapshot 2 of A")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "second git-wmem commit")
+
+	uids, err := h.RunGitWmem("log", "--uid-only")
+	h.AssertCommandSuccess(uids, err, "git-wmem log --uid-only")
+	uidLines := strings.Split(strings.TrimSpace(uids), "\n")
+	newestUID, firstUID := uidLines[0], uidLines[1]
+
+	inode := func(path string) uint64 {
+		t.Helper()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", path, err)
+		}
+		return info.Sys().(*syscall.Stat_t).Ino
+	}
+
+	for _, hardlink := range []bool{false, true} {
+		outDir := filepath.Join(h.TempDir(), fmt.Sprintf("restored-%v", hardlink))
+		args := []string{"--output-dir", outDir}
+		if hardlink {
+			args = append(args, "--hardlink-dedupe")
+		}
+		output, err = h.RunGitWmem("export-all", append(args, firstUID, newestUID)...)
+		h.AssertCommandSuccess(output, err, "git-wmem export-all "+strings.Join(args, " "))
+		h.AssertOutputContains(output, fmt.Sprintf("Exported 1 workdir(s) of %s to %s", firstUID, filepath.Join(outDir, firstUID)))
+
+		first := filepath.Join(outDir, firstUID, "my-projectA")
+		newest := filepath.Join(outDir, newestUID, "my-projectA")
+		h.AssertFileEquals(filepath.Join(first, "fileA.txt"), "snapshot 1 of A")
+		h.AssertFileEquals(filepath.Join(newest, "fileA.txt"), "snapshot 2 of A")
+		h.AssertFileEquals(filepath.Join(newest, "shared.txt"), "identical in both snapshots")
+		h.AssertFileExists(filepath.Join(outDir, newestUID, "wmem-export-manifest.txt"))
+
+		if linked := inode(filepath.Join(first, "shared.txt")) == inode(filepath.Join(newest, "shared.txt")); linked != hardlink {
+			t.Errorf("Expected shared.txt hardlinked across the snapshots: %v, got %v", hardlink, linked)
+		}
+		if inode(filepath.Join(first, "fileA.txt")) == inode(filepath.Join(newest, "fileA.txt")) {
+			t.Errorf("Expected the changed fileA.txt not to be hardlinked")
+		}
+		if hardlink {
+			h.AssertOutputContains(output, "Hardlinked 1 identical file(s)")
+		}
+	}
+
+	output, err = h.RunGitWmem("export-all", "--output-dir", filepath.Join(h.TempDir(), "restored-true"), firstUID)
+	h.AssertCommandError(output, err, "already exists", "git-wmem export-all --output-dir into an existing snapshot directory")
+	output, err = h.RunGitWmem("export-all", "--hardlink-dedupe", firstUID)
+	h.AssertCommandError(output, err, "Usage: git-wmem export-all", "git-wmem export-all --hardlink-dedupe without --output-dir")
+}
@@ -0,0 +1,85 @@
+package e2e
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGitWmemFsck_FixMissingTree tests that git-wmem fsck finds a snapshot with a missing tree and
+// --fix resets the branch to the last good commit, leaving a clean git fsck
+// Reference: docs/use-cases/git-wmem-fsck/basic.md
+func TestGitWmemFsck_FixMissingTree(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+	for _, content := range []string{"first change", "second change"} {
+		h.SetWorkDir(projectA)
+		h.WriteFile("fileA.txt", content)
+		h.SetWorkDir(wmemDir)
+		output, err = h.RunGitWmem("commit")
+		h.AssertCommandSuccess(output, err, "git-wmem commit")
+	}
+
+	output, err = h.RunGitWmem("fsck")
+	h.AssertCommandSuccess(output, err, "git-wmem fsck on consistent repos")
+	h.AssertOutputContains(output, "repos/my-projectA.git: wmem-br/main ok (3 commit(s))")
+	h.AssertOutputContains(output, "All 2 wmem-br branch(es) consistent")
+
+	// Drop the loose root tree of the newest snapshot
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	tip, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(tip, err, "git rev-parse wmem-br/main")
+	lastGood, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main~1")
+	h.AssertCommandSuccess(lastGood, err, "git rev-parse wmem-br/main~1")
+	tree, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main^{tree}")
+	h.AssertCommandSuccess(tree, err, "git rev-parse wmem-br/main^{tree}")
+	tree = strings.TrimSpace(tree)
+	if err := os.Remove(filepath.Join(bareRepo, "objects", tree[:2], tree[2:])); err != nil {
+		t.Fatalf("Failed to remove the tree object: %v", err)
+	}
+	output, err = h.RunGit("--git-dir", bareRepo, "fsck")
+	if err == nil {
+		t.Fatalf("Expected git fsck to fail with a missing tree, got:\n%s", output)
+	}
+
+	output, err = h.RunGitWmem("fsck")
+	h.AssertCommandError(output, err, "found 1 broken of 2 wmem-br branch(es), run git-wmem fsck --fix", "git-wmem fsck with a missing tree")
+	h.AssertOutputContains(output, "repos/my-projectA.git: wmem-br/main broken: commit "+strings.TrimSpace(tip)+": missing tree "+tree)
+
+	output, err = h.RunGitWmem("fsck", "--fix")
+	h.AssertCommandSuccess(output, err, "git-wmem fsck --fix")
+	h.AssertOutputContains(output, "repos/my-projectA.git: wmem-br/main reset "+strings.TrimSpace(tip)[:12]+" -> "+strings.TrimSpace(lastGood)[:12]+" (last good commit, dropped 1 snapshot(s))")
+	h.AssertOutputContains(output, "Fixed 1 of 2 wmem-br branch(es)")
+
+	main, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(main, err, "git rev-parse wmem-br/main")
+	if main != lastGood {
+		t.Errorf("Expected wmem-br/main at %s, got %s", strings.TrimSpace(lastGood), strings.TrimSpace(main))
+	}
+	head, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/head")
+	h.AssertCommandSuccess(head, err, "git rev-parse wmem-br/head")
+	if head != lastGood {
+		t.Errorf("Expected wmem-br/head at %s, got %s", strings.TrimSpace(lastGood), strings.TrimSpace(head))
+	}
+	output, err = h.RunGit("--git-dir", bareRepo, "fsck")
+	h.AssertCommandSuccess(output, err, "git fsck after git-wmem fsck --fix")
+
+	// The next commit snapshots the workdir on top of the last good commit
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit after fsck --fix")
+	output, err = h.RunGit("--git-dir", bareRepo, "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show wmem-br/main:fileA.txt")
+	if strings.TrimSpace(output) != "second change" {
+		t.Errorf("Expected the new snapshot of fileA.txt to be 'second change', got %q", output)
+	}
+}
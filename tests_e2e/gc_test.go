@@ -0,0 +1,109 @@
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestGitWmemGc_Aggressive tests the object count and size report of git-wmem gc --aggressive and the integrity after it
+// Reference: docs/use-cases/git-wmem-gc/basic.md#alternatives
+func TestGitWmemGc_Aggressive(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	for i := 1; i <= 3; i++ {
+		h.SetWorkDir(projectA)
+		h.WriteFile("fileA.txt", fmt.Sprintf("modified A %d", i))
+		h.SetWorkDir(wmemDir)
+		output, err := h.RunGitWmem("commit")
+		h.AssertCommandSuccess(output, err, "git-wmem commit")
+	}
+
+	output, err := h.RunGitWmem("gc", "--aggressive")
+	h.AssertCommandSuccess(output, err, "git-wmem gc --aggressive")
+	reportRe := regexp.MustCompile(`(?m)^repos/my-projectA\.git: (\d+) objects, [0-9.]+ (B|KiB) -> (\d+) objects, [0-9.]+ (B|KiB) \(repacked\)$`)
+	match := reportRe.FindStringSubmatch(output)
+	if match == nil {
+		t.Fatalf("Expected a before/after report for repos/my-projectA.git, got:\n%s", output)
+	}
+	if match[1] == "0" || match[3] == "0" {
+		t.Errorf("Expected objects before and after gc, got:\n%s", output)
+	}
+	h.AssertOutputContains(output, "repos/my-projectB.git: ")
+	h.AssertOutputContains(output, "Total: ")
+
+	// Everything is in a single pack and intact
+	bareRepoA := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	output, err = h.RunGit("--git-dir", bareRepoA, "count-objects", "-v")
+	h.AssertCommandSuccess(output, err, "git count-objects")
+	h.AssertOutputContains(output, "count: 0\n")
+	h.AssertOutputContains(output, "packs: 1\n")
+	output, err = h.RunGit("--git-dir", bareRepoA, "fsck", "--full")
+	h.AssertCommandSuccess(output, err, "git fsck after gc --aggressive")
+	output, err = h.RunGit("--git-dir", bareRepoA, "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show wmem-br/main:fileA.txt")
+	if strings.TrimSpace(output) != "modified A 3" {
+		t.Errorf("Expected the last snapshot of fileA.txt after gc, got %q", output)
+	}
+
+	// Snapshots continue on top of the repacked repo
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "modified A after gc")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit after gc")
+	h.AssertOutputContains(output, "Info: Successfully committed changes in workdir ../my-projectA")
+}
+
+// TestGitWmemGc_Lock tests that git-wmem gc and commit don't run while another git-wmem holds the wmem-repo lock
+// Reference: docs/validations.md#wmem-repo-lock
+func TestGitWmemGc_Lock(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	// The test process stands in for a running git-wmem commit
+	lockPath := filepath.Join(wmemDir, ".git", "git-wmem.lock")
+	if err := os.WriteFile(lockPath, []byte(fmt.Sprintf("%d commit\n", os.Getpid())), 0644); err != nil {
+		t.Fatalf("Failed to write lock: %v", err)
+	}
+	output, err = h.RunGitWmem("gc")
+	h.AssertCommandError(output, err, fmt.Sprintf("another git-wmem commit is running (pid %d", os.Getpid()), "git-wmem gc while locked")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandError(output, err, "another git-wmem commit is running", "git-wmem commit while locked")
+
+	// A lock of a process that exited is stale
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Fatalf("Failed to run true: %v", err)
+	}
+	if err := os.WriteFile(lockPath, []byte(fmt.Sprintf("%d gc\n", exited.Process.Pid)), 0644); err != nil {
+		t.Fatalf("Failed to write lock: %v", err)
+	}
+	output, err = h.RunGitWmem("gc")
+	h.AssertCommandSuccess(output, err, "git-wmem gc with a stale lock")
+	h.AssertOutputContains(output, "Warning: Removing stale .git/git-wmem.lock left by git-wmem gc")
+	h.AssertOutputContains(output, "repos/my-projectA.git: ")
+
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the lock to be released after gc, got err=%v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package e2e
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGitWmemHistory_Basic tests that exactly the snapshots changing a file are listed, with diffs in order
+// Reference: docs/use-cases/git-wmem-history/basic.md#main-scenario
+func TestGitWmemHistory_Basic(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+
+	for _, content := range []string{"version 1\n", "version 2\n", "version 3\n"} {
+		h.SetWorkDir(projectA)
+		h.WriteFile("fileA.txt", content)
+		h.SetWorkDir(wmemDir)
+		output, err := h.RunGitWmem("commit")
+		h.AssertCommandSuccess(output, err, "git-wmem commit "+strings.TrimSpace(content))
+	}
+
+	// Snapshots touching only fileB.txt aren't listed
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "B changed\n")
+	h.SetWorkDir(wmemDir)
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit fileB.txt change")
+
+	// Initial workdir commit and the three snapshots changing the content
+	output, err = h.RunGitWmem("history", "my-projectA", "fileA.txt")
+	h.AssertCommandSuccess(output, err, "git-wmem history")
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected exactly 4 history lines, got %d:\n%s", len(lines), output)
+	}
+	if !strings.HasPrefix(lines[0], "- ") {
+		t.Errorf("Expected the initial workdir commit without wmem-uid first, got %q", lines[0])
+	}
+	for _, line := range lines[1:] {
+		if !strings.HasPrefix(line, "wmem-") {
+			t.Errorf("Expected a wmem-uid snapshot line, got %q", line)
+		}
+	}
+	if strings.Contains(output, "diff --git") {
+		t.Errorf("Expected no diffs without --patch, got:\n%s", output)
+	}
+
+	output, err = h.RunGitWmem("history", "--patch", "my-projectA", "fileA.txt")
+	h.AssertCommandSuccess(output, err, "git-wmem history --patch")
+
+	// Each diff replaces the previous version, oldest snapshot first
+	expectedDiffs := []string{
+		"+version 1",
+		"-version 1\n+version 2",
+		"-version 2\n+version 3",
+	}
+	lastPos := -1
+	for _, diff := range expectedDiffs {
+		pos := strings.Index(output, diff)
+		if pos == -1 {
+			t.Fatalf("Expected diff %q in history output:\n%s", diff, output)
+		}
+		if pos <= lastPos {
+			t.Errorf("Expected diff %q after the previous one in history output:\n%s", diff, output)
+		}
+		lastPos = pos
+	}
+	if count := strings.Count(output, "diff --git a/fileA.txt b/fileA.txt"); count != 4 {
+		t.Errorf("Expected 4 diffs of fileA.txt, got %d:\n%s", count, output)
+	}
+	if strings.Contains(output, "fileB.txt") {
+		t.Errorf("Expected only fileA.txt diffs, got:\n%s", output)
+	}
+
+	// Unknown workdir
+	output, err = h.RunGitWmem("history", "my-projectX", "fileA.txt")
+	h.AssertCommandError(output, err, "unknown workdir my-projectX", "git-wmem history with unknown workdir")
+}
+
+// TestGitWmemHistory_Rename tests that history follows a file renamed in a workdir commit
+// Reference: docs/use-cases/git-wmem-history/basic.md#renames
+func TestGitWmemHistory_Rename(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "line 1\nline 2\nline 3\nline 4\n")
+	h.SetWorkDir(wmemDir)
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	// Rename with a small content change, committed in the workdir
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("mv", "fileA.txt", "renamed.txt")
+	h.AssertCommandSuccess(output, err, "git mv")
+	h.WriteFile("renamed.txt", "line 1\nline 2\nline 3\nline 4\nline 5\n")
+	output, err = h.RunGit("commit", "-am", "Rename fileA.txt")
+	h.AssertCommandSuccess(output, err, "git commit rename")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit after rename")
+
+	output, err = h.RunGitWmem("history", "my-projectA", "renamed.txt")
+	h.AssertCommandSuccess(output, err, "git-wmem history renamed.txt")
+	h.AssertOutputContains(output, "(renamed from fileA.txt)")
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 3 {
+		t.Errorf("Expected the rename and the two fileA.txt versions, got %d lines:\n%s", len(lines), output)
+	}
+}
@@ -0,0 +1,50 @@
+package e2e
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGitWmemInfo tests the workdir count and the last commit time of git-wmem info
+// Reference: docs/use-cases/git-wmem-info/basic.md
+func TestGitWmemInfo(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	output, err := h.RunGitWmem("info")
+	h.AssertCommandSuccess(output, err, "git-wmem info before the first commit")
+	h.AssertOutputContains(output, "Workdirs: 0")
+	h.AssertOutputContains(output, "Last commit: none yet")
+
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A for info")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	lastDate, err := h.RunGit("log", "-1", "--format=%ci")
+	h.AssertCommandSuccess(lastDate, err, "git log -1 --format=%ci")
+	lastMessage, err := h.RunGit("log", "-1", "--format=%B")
+	h.AssertCommandSuccess(lastMessage, err, "git log -1 --format=%B")
+	_, wmemUID, found := strings.Cut(lastMessage, "wmem-uid: ")
+	if !found {
+		t.Fatalf("Expected a wmem-uid in the last wmem-repo commit, got:\n%s", lastMessage)
+	}
+	wmemUID = strings.Fields(wmemUID)[0]
+
+	output, err = h.RunGitWmem("info")
+	h.AssertCommandSuccess(output, err, "git-wmem info")
+	h.AssertOutputContains(output, "Workdirs: 2")
+	h.AssertOutputContains(output, "Snapshots: 1 in 2 bare repo(s)")
+	h.AssertOutputContains(output, "Last commit: "+strings.TrimSpace(lastDate)+" "+wmemUID)
+	h.AssertOutputContains(output, "Size of repos/: ")
+	h.AssertOutputContains(output, "Author: ")
+}
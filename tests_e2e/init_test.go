@@ -1,7 +1,9 @@
 package e2e
 
 import (
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -113,3 +115,183 @@ func TestGitWmemInit_ErrorDirectoryExists(t *testing.T) {
 	output, err := h.RunGitWmem("init", "my-wmem1")
 	h.AssertCommandError(output, err, "Please specify an empty directory", "git-wmem-init on existing non-empty directory")
 }
+
+// TestGitWmemInit_BareReposShared tests that wmem-wd-repos share objects via alternates
+// Reference: docs/data-structures.md#shared-object-store
+func TestGitWmemInit_BareReposShared(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.SetWorkDir(h.TempDir())
+	output, err := h.RunGitWmem("init", "--bare-repos-shared", "my-wmem1")
+	h.AssertCommandSuccess(output, err, "git-wmem init --bare-repos-shared my-wmem1")
+
+	wmemDir := filepath.Join(h.TempDir(), "my-wmem1")
+	h.SetWorkDir(wmemDir)
+	h.AssertDirExists("repos/_shared.git")
+
+	// Two clones of the same upstream
+	upstream := filepath.Join(h.TempDir(), "upstream")
+	h.MkdirAll(upstream)
+	h.SetWorkDir(upstream)
+	_, err = h.RunGit("init")
+	h.AssertCommandSuccess("", err, "git init upstream")
+	h.WriteFile("common.txt", "common content")
+	_, err = h.RunGit("add", "common.txt")
+	h.AssertCommandSuccess("", err, "git add common.txt")
+	_, err = h.RunGit("commit", "-m", "Upstream commit")
+	h.AssertCommandSuccess("", err, "git commit upstream")
+
+	for _, clone := range []string{"cloneA", "cloneB"} {
+		h.SetWorkDir(h.TempDir())
+		output, err = h.RunGit("clone", "--no-local", upstream, clone)
+		h.AssertCommandSuccess(output, err, "git clone "+clone)
+	}
+	h.SetWorkDir(filepath.Join(h.TempDir(), "cloneA"))
+	h.WriteFile("common.txt", "changed in cloneA")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../cloneA")
+	h.AppendToFile("md/commit-workdir-paths", "../cloneB")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	// Fetched packs land in the shared object store only
+	sharedPacks, _ := filepath.Glob(filepath.Join(wmemDir, "repos/_shared.git/objects/pack/*.pack"))
+	if len(sharedPacks) == 0 {
+		t.Errorf("Expected packs in repos/_shared.git, found none")
+	}
+
+	for _, name := range []string{"cloneA", "cloneB"} {
+		repoDir := filepath.Join(wmemDir, "repos", name+".git")
+		h.AssertFileEquals(filepath.Join(repoDir, "objects/info/alternates"), "../../_shared.git/objects\n")
+
+		packs, _ := filepath.Glob(filepath.Join(repoDir, "objects/pack/*.pack"))
+		if len(packs) != 0 {
+			t.Errorf("Expected no packs in %s, found %v", repoDir, packs)
+		}
+
+		h.SetWorkDir(repoDir)
+		output, err = h.RunGit("fsck", "--no-dangling")
+		h.AssertCommandSuccess(output, err, "git fsck in "+name)
+		output, err = h.RunGit("log", "--oneline", "wmem-br/main")
+		h.AssertCommandSuccess(output, err, "git log wmem-br/main in "+name)
+		h.AssertOutputContains(output, "Upstream commit")
+	}
+
+	// Second commit fetches again through the shared store
+	h.SetWorkDir(filepath.Join(h.TempDir(), "cloneB"))
+	h.WriteFile("common.txt", "changed in cloneB")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit (second)")
+
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "cloneB.git"))
+	output, err = h.RunGit("show", "wmem-br/main:common.txt")
+	h.AssertCommandSuccess(output, err, "git show wmem-br/main:common.txt")
+	h.AssertOutputContains(output, "changed in cloneB")
+
+	// The relative alternates survive moving the wmem-repo
+	movedDir := filepath.Join(h.TempDir(), "my-wmem1-moved")
+	if err := os.Rename(wmemDir, movedDir); err != nil {
+		t.Fatalf("Failed to move the wmem-repo: %v", err)
+	}
+	h.SetWorkDir(filepath.Join(h.TempDir(), "cloneA"))
+	h.WriteFile("common.txt", "changed after the move")
+	h.SetWorkDir(movedDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit in the moved wmem-repo")
+	for _, name := range []string{"cloneA", "cloneB"} {
+		h.SetWorkDir(filepath.Join(movedDir, "repos", name+".git"))
+		output, err = h.RunGit("fsck", "--no-dangling")
+		h.AssertCommandSuccess(output, err, "git fsck in moved "+name)
+	}
+	output, err = h.RunGit("--git-dir", filepath.Join(movedDir, "repos", "cloneA.git"), "show", "wmem-br/main:common.txt")
+	h.AssertCommandSuccess(output, err, "git show wmem-br/main:common.txt after the move")
+	h.AssertOutputContains(output, "changed after the move")
+}
+
+// TestGitWmemInit_NoCommit tests that --no-commit defers the first commit to git-wmem commit
+// Reference: docs/use-cases/git-wmem-init/basic.md#alternatives (4b)
+func TestGitWmemInit_NoCommit(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.SetWorkDir(h.TempDir())
+	output, err := h.RunGitWmem("init", "--no-commit", "my-wmem1")
+	h.AssertCommandSuccess(output, err, "git-wmem init --no-commit my-wmem1")
+
+	wmemDir := filepath.Join(h.TempDir(), "my-wmem1")
+	h.SetWorkDir(wmemDir)
+	h.AssertFileExists(".git-wmem")
+	h.AssertFileExists("md/commit-workdir-paths")
+
+	output, err = h.RunGit("rev-parse", "--verify", "HEAD")
+	if err == nil {
+		t.Fatalf("Expected no commit after init --no-commit, got HEAD %s", strings.TrimSpace(output))
+	}
+
+	// Seed md/ before the first commit
+	h.WriteFile("md/commit/msg-prefix", "seeded prefix")
+	setupTestProjects(h)
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "first git-wmem commit after init --no-commit")
+
+	count, err := h.RunGit("rev-list", "--count", "HEAD")
+	h.AssertCommandSuccess(count, err, "git rev-list --count HEAD")
+	if strings.TrimSpace(count) != "1" {
+		t.Errorf("Expected exactly 1 commit, got %s", strings.TrimSpace(count))
+	}
+	message, err := h.RunGit("log", "-1", "--format=%B")
+	h.AssertCommandSuccess(message, err, "git log -1")
+	h.AssertOutputContains(message, "seeded prefix")
+	files, err := h.RunGit("ls-tree", "-r", "--name-only", "HEAD")
+	h.AssertCommandSuccess(files, err, "git ls-tree HEAD")
+	h.AssertOutputContains(files, ".git-wmem")
+	h.AssertOutputContains(files, "md/commit-workdir-paths")
+
+	status, err := h.RunGit("status", "--porcelain")
+	h.AssertCommandSuccess(status, err, "git status")
+	if strings.TrimSpace(status) != "" {
+		t.Errorf("Expected a clean wmem-repo after the first commit, got:\n%s", status)
+	}
+}
+
+// TestGitWmemInit_GitignoreExtra tests that the default .gitignore ignores cache/ and that
+// --gitignore-extra appends patterns to it
+// Reference: docs/use-cases/git-wmem-init/basic.md#alternatives (3c)
+func TestGitWmemInit_GitignoreExtra(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.SetWorkDir(h.TempDir())
+	output, err := h.RunGitWmem("init", "--gitignore-extra", "*.tmp", "--gitignore-extra", "scratch/", "my-wmem1")
+	h.AssertCommandSuccess(output, err, "git-wmem init --gitignore-extra my-wmem1")
+
+	wmemDir := filepath.Join(h.TempDir(), "my-wmem1")
+	h.AssertFileEquals(filepath.Join(wmemDir, ".gitignore"), "repos/\ncache/\n*.tmp\nscratch/\n")
+
+	// The persisted caches and the extra patterns stay out of wmem-repo commits
+	setupTestProjects(h)
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.WriteFile("notes.tmp", "temporary")
+	h.WriteFile("scratch/draft.txt", "draft")
+	h.WriteFile("cache/git-wmem-cache-my-projectA.json", "{}")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+	files, err := h.RunGit("ls-tree", "-r", "--name-only", "HEAD")
+	h.AssertCommandSuccess(files, err, "git ls-tree HEAD")
+	for _, ignored := range []string{"cache/", "notes.tmp", "scratch/"} {
+		if strings.Contains(files, ignored) {
+			t.Errorf("Expected %s to be ignored, got:\n%s", ignored, files)
+		}
+	}
+
+	h.SetWorkDir(h.TempDir())
+	output, err = h.RunGitWmem("init", "--gitignore-extra", "", "my-wmem2")
+	h.AssertCommandError(output, err, "invalid --gitignore-extra", "git-wmem init --gitignore-extra ''")
+}
@@ -1,8 +1,15 @@
 package e2e
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 // TestGitWmemLog_Basic tests basic git-wmem-log functionality
@@ -161,3 +168,859 @@ func TestGitWmemLog_ErrorNotInWmemRepo(t *testing.T) {
 	output, err := h.RunGitWmem("log")
 	h.AssertCommandError(output, err, ".git-wmem", "git-wmem-log outside wmem repo")
 }
+
+// logJSONSchemaVersion mirrors internal.LogJSONSchemaVersion
+const logJSONSchemaVersion = 1
+
+// TestGitWmemLog_JSONSchemaVersion tests that log --json carries the current schemaVersion
+// Reference: docs/use-cases/git-wmem-log/basic.md#json-output
+func TestGitWmemLog_JSONSchemaVersion(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	_, _ = setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit")
+
+	output, err = h.RunGitWmem("log", "--json")
+	h.AssertCommandSuccess(output, err, "git-wmem log --json")
+
+	var doc struct {
+		SchemaVersion *int `json:"schemaVersion"`
+		Commits       []struct {
+			WmemUID  string `json:"wmemUid"`
+			Hash     string `json:"hash"`
+			Workdirs []struct {
+				Name   string `json:"name"`
+				Commit string `json:"commit"`
+			} `json:"workdirs"`
+		} `json:"commits"`
+	}
+	if err := json.Unmarshal([]byte(output), &doc); err != nil {
+		t.Fatalf("Failed to parse log --json output: %v\n%s", err, output)
+	}
+
+	if doc.SchemaVersion == nil {
+		t.Fatalf("Expected schemaVersion in log --json output: %s", output)
+	}
+	if *doc.SchemaVersion != logJSONSchemaVersion {
+		t.Errorf("Expected schemaVersion %d, got %d", logJSONSchemaVersion, *doc.SchemaVersion)
+	}
+
+	if len(doc.Commits) == 0 {
+		t.Fatalf("Expected at least one commit in log --json output: %s", output)
+	}
+	if !strings.HasPrefix(doc.Commits[0].WmemUID, "wmem-") || len(doc.Commits[0].Hash) != 40 {
+		t.Errorf("Unexpected latest commit entry: %+v", doc.Commits[0])
+	}
+	if len(doc.Commits[0].Workdirs) != 2 || doc.Commits[0].Workdirs[0].Name != "my-projectA" {
+		t.Errorf("Expected sorted workdirs my-projectA and my-projectB, got %+v", doc.Commits[0].Workdirs)
+	}
+}
+
+// TestGitWmemLog_NoPager tests that --no-pager writes directly to stdout without spawning $PAGER
+// Reference: docs/use-cases/git-wmem-log/basic.md#pager
+func TestGitWmemLog_NoPager(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	_, _ = setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit")
+
+	// Pager leaves a marker and prefixes every line, so its use is visible
+	marker := filepath.Join(h.TempDir(), "pager-used")
+	h.SetEnv("PAGER", "touch "+marker+"; sed 's/^/PAGED: /'")
+
+	output, err = h.RunGitWmem("log", "--no-pager")
+	h.AssertCommandSuccess(output, err, "git-wmem log --no-pager")
+	h.AssertOutputContains(output, "wmem-")
+	if strings.Contains(output, "PAGED: ") {
+		t.Errorf("Expected direct output with --no-pager, got: %s", output)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("Expected no pager to be spawned with --no-pager")
+	}
+
+	// Stdout isn't a terminal here, so no pager is used without --no-pager either
+	// (the pager itself is covered by TestStartPager in internal/)
+	output, err = h.RunGitWmem("log")
+	h.AssertCommandSuccess(output, err, "git-wmem log without a terminal")
+	h.AssertOutputContains(output, "wmem-")
+	if strings.Contains(output, "PAGED: ") {
+		t.Errorf("Expected direct output without a terminal, got: %s", output)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("Expected no pager to be spawned without a terminal")
+	}
+}
+
+// TestGitWmemLog_UIDOnly tests that --uid-only prints exactly the wmem-uids, newest first
+// Reference: docs/use-cases/git-wmem-log/basic.md#uid-only-output
+func TestGitWmemLog_UIDOnly(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "first git-wmem-commit")
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "second content")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "second git-wmem-commit")
+
+	// Expected uids from the wmem-repo history, newest first
+	output, err = h.RunGit("log", "--format=%B")
+	h.AssertCommandSuccess(output, err, "git log")
+	var expected []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "wmem-uid: ") {
+			expected = append(expected, strings.TrimPrefix(line, "wmem-uid: "))
+		}
+	}
+	if len(expected) < 2 {
+		t.Fatalf("Expected at least 2 wmem-uids in git log, got %v", expected)
+	}
+
+	output, err = h.RunGitWmem("log", "--uid-only")
+	h.AssertCommandSuccess(output, err, "git-wmem log --uid-only")
+	want := strings.Join(expected, "\n") + "\n"
+	if output != want {
+		t.Errorf("Expected --uid-only output:\n%q\ngot:\n%q", want, output)
+	}
+}
+
+// TestGitWmemLog_Files tests that --files lists added, modified and deleted files per workdir snapshot
+// Reference: docs/use-cases/git-wmem-log/basic.md#changed-files
+func TestGitWmemLog_Files(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	h.SetWorkDir(projectA)
+	h.WriteFile("extra.txt", "extra file to be deleted")
+	h.SetWorkDir(wmemDir)
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "first git-wmem-commit")
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "modified A")
+	h.WriteFile("new.txt", "new file")
+	if err := os.Remove(filepath.Join(projectA, "extra.txt")); err != nil {
+		t.Fatalf("Failed to delete extra.txt: %v", err)
+	}
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "second git-wmem-commit")
+
+	output, err = h.RunGitWmem("log", "--files", "--no-pager")
+	h.AssertCommandSuccess(output, err, "git-wmem log --files")
+
+	// The newest commit is the first block of the log
+	newest := strings.SplitN(output, "\n\n", 2)[0]
+	for _, line := range []string{"  ../my-projectA files (", "    ~ fileA.txt", "    + new.txt", "    - extra.txt"} {
+		if !strings.Contains(newest, line) {
+			t.Errorf("Expected newest commit to contain %q, got:\n%s", line, newest)
+		}
+	}
+	if strings.Contains(newest, "../my-projectB files") {
+		t.Errorf("Expected unchanged my-projectB not to be listed, got:\n%s", newest)
+	}
+
+	output, err = h.RunGitWmem("log", "--files", "--json")
+	h.AssertCommandError(output, err, "--files can't be combined", "git-wmem log --files --json")
+}
+
+// TestGitWmemLog_SinceUID tests that --since-uid shows only commits newer than the given wmem-uid
+// Reference: docs/use-cases/git-wmem-log/basic.md#since-a-wmem-uid
+func TestGitWmemLog_SinceUID(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	for i := 1; i <= 4; i++ {
+		h.SetWorkDir(projectA)
+		h.WriteFile("fileA.txt", fmt.Sprintf("content %d", i))
+		h.SetWorkDir(wmemDir)
+		output, err := h.RunGitWmem("commit")
+		h.AssertCommandSuccess(output, err, fmt.Sprintf("git-wmem commit %d", i))
+	}
+
+	// Newest first
+	output, err := h.RunGitWmem("log", "--uid-only")
+	h.AssertCommandSuccess(output, err, "git-wmem log --uid-only")
+	uids := strings.Fields(output)
+	if len(uids) != 4 {
+		t.Fatalf("Expected 4 wmem-uids, got %v", uids)
+	}
+	want := uids[0] + "\n" + uids[1] + "\n"
+
+	output, err = h.RunGitWmem("log", "--uid-only", "--since-uid", uids[2])
+	h.AssertCommandSuccess(output, err, "git-wmem log --since-uid")
+	if output != want {
+		t.Errorf("Expected the 2 commits after %s:\n%q\ngot:\n%q", uids[2], want, output)
+	}
+
+	// Text output stops at the same commit
+	output, err = h.RunGitWmem("log", "--no-pager", "--since-uid", uids[2])
+	h.AssertCommandSuccess(output, err, "git-wmem log --since-uid text")
+	h.AssertOutputContains(output, uids[0]+":")
+	h.AssertOutputContains(output, uids[1]+":")
+	for _, older := range uids[2:] {
+		if strings.Contains(output, older) {
+			t.Errorf("Expected %s not to be shown, got:\n%s", older, output)
+		}
+	}
+
+	// Partial wmem-uid
+	output, err = h.RunGitWmem("log", "--uid-only", "--since-uid", uids[2][:len(uids[2])-3])
+	h.AssertCommandSuccess(output, err, "git-wmem log --since-uid partial")
+	if output != want {
+		t.Errorf("Expected the 2 commits after partial %s:\n%q\ngot:\n%q", uids[2], want, output)
+	}
+
+	// Tag on the wmem-repo commit
+	hash, err := h.RunGit("log", "--format=%H", "--grep", "wmem-uid: "+uids[2])
+	h.AssertCommandSuccess(hash, err, "git log --grep")
+	output, err = h.RunGit("tag", "reviewed", strings.TrimSpace(hash))
+	h.AssertCommandSuccess(output, err, "git tag reviewed")
+	output, err = h.RunGitWmem("log", "--uid-only", "--since-uid", "reviewed")
+	h.AssertCommandSuccess(output, err, "git-wmem log --since-uid tag")
+	if output != want {
+		t.Errorf("Expected the 2 commits after tag reviewed:\n%q\ngot:\n%q", want, output)
+	}
+
+	output, err = h.RunGitWmem("log", "--uid-only", "--since-uid", "wmem-")
+	h.AssertCommandError(output, err, "ambiguous wmem-uid wmem-", "git-wmem log --since-uid ambiguous")
+	output, err = h.RunGitWmem("log", "--uid-only", "--since-uid", "wmem-000101")
+	h.AssertCommandError(output, err, "unknown wmem-uid wmem-000101", "git-wmem log --since-uid unknown")
+}
+
+// TestGitWmemLog_WorkdirStatus tests that --workdir-status flags workdirs the next commit would snapshot
+// Reference: docs/use-cases/git-wmem-log/basic.md#workdir-status
+func TestGitWmemLog_WorkdirStatus(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit")
+
+	output, err = h.RunGitWmem("log", "--workdir-status", "--no-pager")
+	h.AssertCommandSuccess(output, err, "git-wmem log --workdir-status on clean workdirs")
+	h.AssertOutputContains(output, "Workdir status:\n  ../my-projectA: up to date\n  ../my-projectB: up to date\n\nwmem-")
+
+	// projectA gets a dirty file, projectB a new commit
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "dirty A")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "committed B")
+	output, err = h.RunGit("commit", "-am", "New commit in my-projectB")
+	h.AssertCommandSuccess(output, err, "git commit in projectB")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("log", "--workdir-status", "--no-pager")
+	h.AssertCommandSuccess(output, err, "git-wmem log --workdir-status on changed workdirs")
+	h.AssertOutputContains(output, "  ../my-projectA: pending changes (uncommitted changes)")
+	h.AssertOutputContains(output, "  ../my-projectB: pending changes (new workdir commits)")
+
+	// The banner only reads, the next commit snapshots both workdirs
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit after the banner")
+	h.AssertOutputContains(output, "Workdir snapshots: 1 regular, 1 merge, 0 unchanged")
+
+	output, err = h.RunGitWmem("log", "--workdir-status", "--uid-only")
+	h.AssertCommandError(output, err, "--workdir-status can't be combined", "git-wmem log --workdir-status --uid-only")
+}
+
+// TestGitWmemLog_Parents tests that --parents shows two parents for merge snapshots and one for regular ones
+// Reference: docs/use-cases/git-wmem-log/basic.md#parents
+func TestGitWmemLog_Parents(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit")
+
+	// projectA gets a regular snapshot, projectB a merge snapshot
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "dirty A")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "committed B")
+	output, err = h.RunGit("commit", "-am", "New commit in my-projectB")
+	h.AssertCommandSuccess(output, err, "git commit in projectB")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit with changes")
+	h.AssertOutputContains(output, "Workdir snapshots: 1 regular, 1 merge, 0 unchanged")
+
+	parentsOf := func(workdirName string) (string, []string) {
+		h.SetWorkDir(filepath.Join(wmemDir, "repos", workdirName+".git"))
+		defer h.SetWorkDir(wmemDir)
+		output, err := h.RunGit("rev-list", "--parents", "-n", "1", "wmem-br/main")
+		h.AssertCommandSuccess(output, err, "git rev-list --parents wmem-br/main")
+		var hashes []string
+		for _, hash := range strings.Fields(output) {
+			hashes = append(hashes, hash[:12])
+		}
+		return hashes[0], hashes[1:]
+	}
+
+	tipA, parentsA := parentsOf("my-projectA")
+	if len(parentsA) != 1 {
+		t.Fatalf("Expected a regular snapshot with one parent in my-projectA, got %v", parentsA)
+	}
+	tipB, parentsB := parentsOf("my-projectB")
+	if len(parentsB) != 2 {
+		t.Fatalf("Expected a merge snapshot with two parents in my-projectB, got %v", parentsB)
+	}
+
+	output, err = h.RunGitWmem("log", "--parents", "--no-pager")
+	h.AssertCommandSuccess(output, err, "git-wmem log --parents")
+	h.AssertOutputContains(output, "  ../my-projectA parents ("+tipA+"): "+parentsA[0]+"\n")
+	h.AssertOutputContains(output, "  ../my-projectB parents ("+tipB+"): "+parentsB[0]+" "+parentsB[1]+"\n")
+
+	output, err = h.RunGitWmem("log", "--parents", "--json")
+	h.AssertCommandError(output, err, "--parents can't be combined", "git-wmem log --parents --json")
+}
+
+// TestGitWmemLog_Check tests that --check reports wmem-repo commits without a valid wmem-uid line
+// Reference: docs/use-cases/git-wmem-log/basic.md#check
+func TestGitWmemLog_Check(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit")
+
+	output, err = h.RunGitWmem("log", "--check", "--no-pager")
+	h.AssertCommandSuccess(output, err, "git-wmem log --check on a clean history")
+	h.AssertOutputContains(output, "Check: all 2 wmem-repo commit(s) have a valid wmem-uid line")
+
+	// Hand-crafted commits: one without a wmem-uid line, one with a malformed one
+	output, err = h.RunGit("commit", "--allow-empty", "-m", "manual fix")
+	h.AssertCommandSuccess(output, err, "git commit manual fix")
+	output, err = h.RunGit("commit", "--allow-empty", "-m", "broken template\n\nwmem-uid: wmem-bogus")
+	h.AssertCommandSuccess(output, err, "git commit broken template")
+
+	output, err = h.RunGitWmem("log", "--no-pager")
+	h.AssertCommandSuccess(output, err, "git-wmem log")
+	if strings.Contains(output, "manual fix") || strings.Contains(output, "broken template") {
+		t.Errorf("Expected the log to skip commits without a valid wmem-uid, got:\n%s", output)
+	}
+
+	output, err = h.RunGitWmem("log", "--check", "--no-pager")
+	h.AssertCommandError(output, err, "2 of 4 wmem-repo commit(s) have no valid wmem-uid line", "git-wmem log --check")
+	h.AssertOutputContains(output, `"manual fix": no wmem-uid line`)
+	h.AssertOutputContains(output, `"broken template": malformed wmem-uid line "wmem-uid: wmem-bogus"`)
+
+	output, err = h.RunGitWmem("log", "--check", "--json")
+	h.AssertCommandError(output, err, "--check can only be combined", "git-wmem log --check --json")
+}
+
+// TestGitWmemLog_WorkdirPathStyle tests that --workdir-path-style renders workdirs as path, absolute path or name
+// Reference: docs/use-cases/git-wmem-log/basic.md#workdir-path-style
+func TestGitWmemLog_WorkdirPathStyle(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit")
+
+	absProjectA, err := filepath.EvalSymlinks(projectA)
+	if err != nil {
+		t.Fatalf("Failed to resolve %s: %v", projectA, err)
+	}
+
+	tests := []struct {
+		style    string
+		expected string
+	}{
+		{"rel", "\n  ../my-projectA: "},
+		{"abs", "\n  " + absProjectA + ": "},
+		{"name", "\n  my-projectA: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.style, func(t *testing.T) {
+			output, err := h.RunGitWmem("log", "--no-pager", "--workdir-path-style="+tt.style)
+			h.AssertCommandSuccess(output, err, "git-wmem log --workdir-path-style="+tt.style)
+			h.AssertOutputContains(output, tt.expected)
+		})
+	}
+
+	output, err = h.RunGitWmem("log", "--no-pager", "--workdir-path-style=url")
+	h.AssertCommandError(output, err, `invalid --workdir-path-style "url"`, "git-wmem log --workdir-path-style=url")
+}
+
+// TestGitWmemLog_Encoding tests that invalid UTF-8 and control characters of messages don't reach the terminal raw
+// Reference: docs/use-cases/git-wmem-log/basic.md#message-encoding
+func TestGitWmemLog_Encoding(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.WriteFile("md/commit/msg-prefix", "build \x1b[31mfailed\xff\x07")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit")
+
+	tests := []struct {
+		encoding string
+		expected string
+	}{
+		{"escape", `build \x1b[31mfailed\xff\x07`},
+		{"replace", "build \uFFFD[31mfailed\uFFFD\uFFFD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			output, err := h.RunGitWmem("log", "--no-pager", "--encoding="+tt.encoding)
+			h.AssertCommandSuccess(output, err, "git-wmem log --encoding="+tt.encoding)
+			h.AssertOutputContains(output, tt.expected)
+			if strings.ContainsAny(output, "\x1b\x07") || !utf8.ValidString(output) {
+				t.Errorf("Expected no raw control characters or invalid UTF-8, got %q", output)
+			}
+		})
+	}
+
+	output, err = h.RunGitWmem("log", "--no-pager", "--encoding=raw")
+	h.AssertCommandSuccess(output, err, "git-wmem log --encoding=raw")
+	h.AssertOutputContains(output, "build \x1b[31mfailed\xff\x07")
+
+	// JSON strings are always escaped
+	output, err = h.RunGitWmem("log", "--no-pager", "--json")
+	h.AssertCommandSuccess(output, err, "git-wmem log --json")
+	var doc struct {
+		Commits []struct {
+			Message string `json:"message"`
+		} `json:"commits"`
+	}
+	if err := json.Unmarshal([]byte(output), &doc); err != nil {
+		t.Fatalf("Expected valid JSON, got %v:\n%s", err, output)
+	}
+	if strings.ContainsAny(output, "\x1b\x07") || !utf8.ValidString(output) {
+		t.Errorf("Expected no raw control characters or invalid UTF-8 in JSON, got %q", output)
+	}
+	if len(doc.Commits) == 0 || !strings.HasPrefix(doc.Commits[0].Message, "build \x1b[31mfailed\uFFFD\x07") {
+		t.Errorf("Expected the decoded JSON message to keep the control characters, got %+v", doc.Commits)
+	}
+
+	output, err = h.RunGitWmem("log", "--no-pager", "--json", "--encoding=raw")
+	h.AssertCommandError(output, err, "--encoding can't be combined with --json", "git-wmem log --json --encoding=raw")
+	output, err = h.RunGitWmem("log", "--no-pager", "--encoding=utf16")
+	h.AssertCommandError(output, err, `invalid --encoding "utf16"`, "git-wmem log --encoding=utf16")
+}
+
+// TestGitWmemLog_WorkdirMissingOK tests that a deleted bare repo is shown as unknown by default
+// and fails the log with --workdir-missing-ok=false
+// Reference: docs/use-cases/git-wmem-log/basic.md#missing-workdirs
+func TestGitWmemLog_WorkdirMissingOK(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA\n../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit")
+
+	output, err = h.RunGitWmem("log", "--no-pager", "--workdir-missing-ok=false")
+	h.AssertCommandSuccess(output, err, "git-wmem log --workdir-missing-ok=false with all bare repos")
+
+	if err := os.RemoveAll(filepath.Join(wmemDir, "repos", "my-projectA.git")); err != nil {
+		t.Fatalf("Failed to remove bare repo: %v", err)
+	}
+
+	output, err = h.RunGitWmem("log", "--no-pager")
+	h.AssertCommandSuccess(output, err, "git-wmem log with a missing bare repo")
+	h.AssertOutputContains(output, "../my-projectA: unknown")
+	h.AssertOutputContains(output, "../my-projectB: ")
+
+	output, err = h.RunGitWmem("log", "--json", "--workdir-missing-ok=false")
+	h.AssertCommandError(output, err, "workdir my-projectA has no usable bare repo repos/my-projectA.git (--workdir-missing-ok=false)", "git-wmem log --json --workdir-missing-ok=false")
+
+	output, err = h.RunGitWmem("log", "--no-pager", "--workdir-missing-ok=false")
+	h.AssertCommandError(output, err, "workdir my-projectA has no usable bare repo repos/my-projectA.git (--workdir-missing-ok=false)", "git-wmem log --workdir-missing-ok=false")
+}
+
+// TestGitWmemLog_Count tests that --count prints the totals of a known history instead of the log
+// Reference: docs/use-cases/git-wmem-log/basic.md#count
+func TestGitWmemLog_Count(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	output, err := h.RunGitWmem("log", "--no-pager", "--count")
+	h.AssertCommandSuccess(output, err, "git-wmem log --count without snapshots")
+	if strings.TrimSpace(output) != "0 wmem snapshot(s)" {
+		t.Errorf("Expected '0 wmem snapshot(s)', got %q", output)
+	}
+
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "first git-wmem-commit")
+	uids, err := h.RunGitWmem("log", "--no-pager", "--uid-only")
+	h.AssertCommandSuccess(uids, err, "git-wmem log --uid-only")
+	firstUID := strings.TrimSpace(uids)
+
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "second git-wmem-commit")
+
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "changed B")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "third git-wmem-commit")
+
+	countRe := regexp.MustCompile(`^3 wmem snapshot\(s\) over 2 workdir\(s\), \d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} \.\. \d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\n$`)
+	output, err = h.RunGitWmem("log", "--no-pager", "--count")
+	h.AssertCommandSuccess(output, err, "git-wmem log --count")
+	if !countRe.MatchString(output) {
+		t.Errorf("Expected the totals of 3 snapshots over 2 workdirs, got %q", output)
+	}
+
+	output, err = h.RunGitWmem("log", "--no-pager", "--count", "--since-uid", firstUID)
+	h.AssertCommandSuccess(output, err, "git-wmem log --count --since-uid")
+	if !strings.HasPrefix(output, "2 wmem snapshot(s) over 2 workdir(s), ") {
+		t.Errorf("Expected 2 snapshots over 2 workdirs since %s, got %q", firstUID, output)
+	}
+
+	output, err = h.RunGitWmem("log", "--no-pager", "--count", "--json")
+	h.AssertCommandError(output, err, "--count can only be combined with --since-uid and --no-pager", "git-wmem log --count --json")
+}
+
+// TestGitWmemLog_WorkdirStatusFetch tests that --fetch makes the workdir status banner count
+// workdir commits pushed into a workdir branch
+// Reference: docs/use-cases/git-wmem-log/basic.md#workdir-status
+func TestGitWmemLog_WorkdirStatusFetch(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	// Push two commits from a clone into the checked-out workdir branch
+	h.SetWorkDir(projectA)
+	output, err = h.RunGit("config", "receive.denyCurrentBranch", "updateInstead")
+	h.AssertCommandSuccess(output, err, "git config receive.denyCurrentBranch")
+	h.SetWorkDir(h.TempDir())
+	output, err = h.RunGit("clone", projectA, "clone-of-projectA")
+	h.AssertCommandSuccess(output, err, "git clone projectA")
+	h.SetWorkDir(filepath.Join(h.TempDir(), "clone-of-projectA"))
+	for i := 1; i <= 2; i++ {
+		h.WriteFile("pushed.txt", fmt.Sprintf("pushed %d", i))
+		output, err = h.RunGit("add", "pushed.txt")
+		h.AssertCommandSuccess(output, err, "git add pushed.txt")
+		output, err = h.RunGit("commit", "-m", fmt.Sprintf("Pushed commit %d", i))
+		h.AssertCommandSuccess(output, err, "git commit in the clone")
+	}
+	output, err = h.RunGit("push", "origin", "main")
+	h.AssertCommandSuccess(output, err, "git push into projectA")
+
+	h.SetWorkDir(wmemDir)
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	tip, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(tip, err, "git rev-parse wmem-br/main")
+
+	output, err = h.RunGitWmem("log", "--workdir-status", "--no-pager")
+	h.AssertCommandSuccess(output, err, "git-wmem log --workdir-status")
+	h.AssertOutputContains(output, "  ../my-projectA: pending changes (new workdir commits)\n")
+
+	output, err = h.RunGitWmem("log", "--workdir-status", "--fetch", "--no-pager")
+	h.AssertCommandSuccess(output, err, "git-wmem log --workdir-status --fetch")
+	h.AssertOutputContains(output, "  ../my-projectA: pending changes (new workdir commits: 2 fetched)\n")
+
+	// Only fetched, the next commit merges them
+	newTip, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(newTip, err, "git rev-parse wmem-br/main")
+	if newTip != tip {
+		t.Errorf("Expected --fetch to leave wmem-br/main at %s, got %s", strings.TrimSpace(tip), strings.TrimSpace(newTip))
+	}
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit after --fetch")
+	h.AssertOutputContains(output, "Workdir snapshots: 0 regular, 1 merge, 0 unchanged")
+
+	output, err = h.RunGitWmem("log", "--fetch")
+	h.AssertCommandError(output, err, "--fetch requires --workdir-status", "git-wmem log --fetch")
+}
+
+// TestGitWmemLog_JSONPretty tests that log --json is compact and --json --pretty indents the same document
+// Reference: docs/use-cases/git-wmem-log/basic.md#json-output
+func TestGitWmemLog_JSONPretty(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	compact, err := h.RunGitWmem("log", "--json")
+	h.AssertCommandSuccess(compact, err, "git-wmem log --json")
+	if strings.Count(strings.TrimSpace(compact), "\n") != 0 {
+		t.Errorf("Expected log --json on a single line, got:\n%s", compact)
+	}
+
+	pretty, err := h.RunGitWmem("log", "--json", "--pretty")
+	h.AssertCommandSuccess(pretty, err, "git-wmem log --json --pretty")
+	h.AssertOutputContains(pretty, "{\n  \"schemaVersion\": ")
+	h.AssertOutputContains(pretty, "\n    {\n      \"wmemUid\": \"wmem-")
+
+	var compactDoc, prettyDoc interface{}
+	if err := json.Unmarshal([]byte(compact), &compactDoc); err != nil {
+		t.Fatalf("Failed to parse log --json output: %v\n%s", err, compact)
+	}
+	if err := json.Unmarshal([]byte(pretty), &prettyDoc); err != nil {
+		t.Fatalf("Failed to parse log --json --pretty output: %v\n%s", err, pretty)
+	}
+	if !reflect.DeepEqual(compactDoc, prettyDoc) {
+		t.Errorf("Expected the same document with and without --pretty, got:\n%s\n%s", compact, pretty)
+	}
+
+	output, err = h.RunGitWmem("log", "--pretty")
+	h.AssertCommandError(output, err, "--pretty requires --json", "git-wmem log --pretty")
+}
+
+// TestGitWmemLog_DiffWmemRepo tests that --diff-wmem-repo shows the md/ changes of the commit that recorded them
+// Reference: docs/use-cases/git-wmem-log/basic.md#wmem-repo-diff
+func TestGitWmemLog_DiffWmemRepo(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	h.WriteFile("md/commit/msg-prefix", "nightly snapshot")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit with a new msg-prefix")
+
+	output, err = h.RunGitWmem("log", "--diff-wmem-repo")
+	h.AssertCommandSuccess(output, err, "git-wmem log --diff-wmem-repo")
+	entries := strings.Split(strings.TrimSpace(output), "\n\n")
+	if len(entries) < 2 {
+		t.Fatalf("Expected at least two log entries, got:\n%s", output)
+	}
+	newest := entries[0]
+	h.AssertOutputContains(newest, "nightly snapshot\n")
+	h.AssertOutputContains(newest, "  wmem-repo diff:\n")
+	h.AssertOutputContains(newest, "    diff --git a/md/commit/msg-prefix b/md/commit/msg-prefix\n")
+	h.AssertOutputContains(newest, "    +nightly snapshot\n")
+	if strings.Contains(newest, "commit-workdir-paths") {
+		t.Errorf("Expected only the msg-prefix change in the newest entry, got:\n%s", newest)
+	}
+	h.AssertOutputContains(entries[1], "    +../my-projectA\n")
+
+	output, err = h.RunGitWmem("log", "--diff-wmem-repo", "--json")
+	h.AssertCommandError(output, err, "--diff-wmem-repo can't be combined with --uid-only or --json", "git-wmem log --diff-wmem-repo --json")
+}
+
+// TestGitWmemLog_WorkdirTreeSize tests that --workdir-tree-size reports the sum of the snapshot file sizes
+// Reference: docs/use-cases/git-wmem-log/basic.md#workdir-tree-size
+func TestGitWmemLog_WorkdirTreeSize(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	files := map[string]string{
+		"fileA.txt":        "changed A for the size",
+		"docs/readme.md":   "# Readme\n\nSome text.\n",
+		"data/values.json": "{\"values\": [1, 2, 3]}\n",
+	}
+	h.SetWorkDir(projectA)
+	h.MkdirAll("docs")
+	h.MkdirAll("data")
+	expectedSize := 0
+	for name, content := range files {
+		h.WriteFile(name, content)
+		expectedSize += len(content)
+	}
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit")
+
+	tip, err := h.RunGit("--git-dir", "repos/my-projectA.git", "rev-parse", "--short=12", "wmem-br/main")
+	h.AssertCommandSuccess(tip, err, "git rev-parse wmem-br/main")
+
+	output, err = h.RunGitWmem("log", "--no-pager", "--workdir-tree-size")
+	h.AssertCommandSuccess(output, err, "git-wmem log --workdir-tree-size")
+	h.AssertOutputContains(output, fmt.Sprintf("../my-projectA tree size (%s): %d bytes in %d file(s)", strings.TrimSpace(tip), expectedSize, len(files)))
+
+	output, err = h.RunGitWmem("log", "--workdir-tree-size", "--json")
+	h.AssertCommandError(output, err, "--workdir-tree-size can't be combined with --uid-only or --json", "git-wmem log --workdir-tree-size --json")
+}
+
+// TestGitWmemLog_ColorByWorkdir tests that --color-by-workdir keeps the color of a workdir across commits
+// Reference: docs/use-cases/git-wmem-log/basic.md#color-by-workdir
+func TestGitWmemLog_ColorByWorkdir(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+	for i := 1; i <= 2; i++ {
+		h.SetWorkDir(projectA)
+		h.WriteFile("fileA.txt", fmt.Sprintf("change A %d", i))
+		h.SetWorkDir(projectB)
+		h.WriteFile("fileB.txt", fmt.Sprintf("change B %d", i))
+		h.SetWorkDir(wmemDir)
+		output, err = h.RunGitWmem("commit")
+		h.AssertCommandSuccess(output, err, "git-wmem commit")
+	}
+
+	output, err = h.RunGitWmem("log", "--no-pager", "--color=always", "--color-by-workdir")
+	h.AssertCommandSuccess(output, err, "git-wmem log --color=always --color-by-workdir")
+
+	workdirLineRe := regexp.MustCompile(`(?m)^  \x1b\[(\d+)m(\.\./my-project[AB])\x1b\[0m: `)
+	colors := make(map[string]map[string]bool)
+	for _, match := range workdirLineRe.FindAllStringSubmatch(output, -1) {
+		if colors[match[2]] == nil {
+			colors[match[2]] = make(map[string]bool)
+		}
+		colors[match[2]][match[1]] = true
+	}
+	for _, workdirPath := range []string{"../my-projectA", "../my-projectB"} {
+		if len(colors[workdirPath]) != 1 {
+			t.Errorf("Expected one color for %s across commits, got %v", workdirPath, colors[workdirPath])
+		}
+	}
+	if count := len(workdirLineRe.FindAllString(output, -1)); count < 6 {
+		t.Errorf("Expected colored workdir lines in all 3 commits, got %d:\n%s", count, output)
+	}
+
+	output, err = h.RunGitWmem("log", "--no-pager", "--color=never", "--color-by-workdir")
+	h.AssertCommandSuccess(output, err, "git-wmem log --color=never --color-by-workdir")
+	if strings.Contains(output, "\x1b[") {
+		t.Errorf("Expected no color codes with --color=never, got:\n%q", output)
+	}
+	h.AssertOutputContains(output, "  ../my-projectA: ")
+}
+
+// TestGitWmemLog_WorkdirCount tests that --workdir-count shows the number of changed workdirs of each commit
+// Reference: docs/use-cases/git-wmem-log/basic.md#workdir-count
+func TestGitWmemLog_WorkdirCount(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	// Newest first: only A changed, then A and B changed
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "A changed with B")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "B changed with A")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit of A and B")
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "A changed alone")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit of A")
+
+	output, err = h.RunGitWmem("log", "--no-pager", "--workdir-count")
+	h.AssertCommandSuccess(output, err, "git-wmem log --workdir-count")
+	var counts []string
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "wmem-") && i+1 < len(lines) {
+			counts = append(counts, strings.TrimSpace(lines[i+1]))
+		}
+	}
+	if len(counts) < 2 || counts[0] != "1 workdir(s) changed" || counts[1] != "2 workdir(s) changed" {
+		t.Errorf("Expected the newest commits to show 1 and 2 changed workdirs, got %q:\n%s", counts, output)
+	}
+
+	output, err = h.RunGitWmem("log", "--workdir-count", "--uid-only")
+	h.AssertCommandError(output, err, "--workdir-count can't be combined with --uid-only or --json", "git-wmem log --workdir-count --uid-only")
+}
@@ -179,3 +179,76 @@ func TestPerformance_FileSystemStateComparison(t *testing.T) {
 
 	t.Logf("SUCCESS: Filesystem state changes correctly detected and committed")
 }
+
+// TestPerformance_ParallelFetch tests that --parallel-fetch fetches workdirs concurrently
+// in a dedicated phase before the per-workdir checks
+func TestPerformance_ParallelFetch(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	// Setup wmem repo and three test projects
+	wmemDir := setupBasicWmemRepo(h)
+	projects := []string{"fetch-projectA", "fetch-projectB", "fetch-projectC"}
+	for _, project := range projects {
+		projectPath := filepath.Join(h.TempDir(), project)
+		h.MkdirAll(projectPath)
+		h.SetWorkDir(projectPath)
+
+		_, err := h.RunGit("init")
+		h.AssertCommandSuccess("", err, "git init "+project)
+		h.WriteFile("file.txt", "content of "+project)
+		_, err = h.RunGit("add", "file.txt")
+		h.AssertCommandSuccess("", err, "git add "+project)
+		_, err = h.RunGit("commit", "-m", "Initial commit in "+project)
+		h.AssertCommandSuccess("", err, "git commit "+project)
+
+		h.SetWorkDir(wmemDir)
+		h.AppendToFile("md/commit-workdir-paths", "../"+project)
+	}
+
+	// Initial commit creates bare repos before the remotes get slow
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	// Slow remotes: every fetch from a workdir takes fetchDelay longer
+	const fetchDelay = 600 * time.Millisecond
+	slowUploadPack(h, "fetch-project", "0.6")
+
+	// Sequential fetches take at least the sum of all delays
+	for _, project := range projects {
+		h.WriteFile(filepath.Join(h.TempDir(), project, "sequential.txt"), "sequential run")
+	}
+	start := time.Now()
+	output, err = h.RunGitWmem("commit", "--parallel-fetch", "1")
+	sequentialTime := time.Since(start)
+	h.AssertCommandSuccess(output, err, "git-wmem-commit --parallel-fetch 1")
+	h.AssertOutputContains(output, "Created wmem-repo commit with changes from 3 workdir(s)")
+
+	// Concurrent fetches take roughly a single delay
+	for _, project := range projects {
+		h.WriteFile(filepath.Join(h.TempDir(), project, "parallel.txt"), "parallel run")
+	}
+	start = time.Now()
+	output, err = h.RunGitWmem("commit", "--parallel-fetch", "3", "--parallel", "1")
+	parallelTime := time.Since(start)
+	h.AssertCommandSuccess(output, err, "git-wmem-commit --parallel-fetch 3")
+	h.AssertOutputContains(output, "Created wmem-repo commit with changes from 3 workdir(s)")
+
+	t.Logf("Sequential fetch run took: %v, parallel fetch run took: %v", sequentialTime, parallelTime)
+
+	if sequentialTime < 3*fetchDelay {
+		t.Errorf("Expected --parallel-fetch 1 to take at least %v, took %v", 3*fetchDelay, sequentialTime)
+	}
+	if parallelTime >= 2*fetchDelay {
+		t.Errorf("Expected --parallel-fetch 3 to fetch concurrently (< %v), took %v", 2*fetchDelay, parallelTime)
+	}
+
+	// Every workdir snapshot must contain the files from both runs
+	for _, project := range projects {
+		h.SetWorkDir(filepath.Join(wmemDir, "repos", project+".git"))
+		output, err = h.RunGit("ls-tree", "--name-only", "wmem-br/main")
+		h.AssertCommandSuccess(output, err, "git ls-tree "+project)
+		h.AssertOutputContains(output, "sequential.txt")
+		h.AssertOutputContains(output, "parallel.txt")
+	}
+}
@@ -0,0 +1,54 @@
+package e2e
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGitWmemRemotes_Basic tests listing, flagging and fixing wmem-wd remotes
+// Reference: docs/use-cases/git-wmem-remotes/basic.md#main-scenario
+func TestGitWmemRemotes_Basic(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit")
+
+	// The listing shows the absolute workdir path set by createBareRepo
+	output, err = h.RunGitWmem("remotes")
+	h.AssertCommandSuccess(output, err, "git-wmem remotes")
+	h.AssertOutputContains(output, "my-projectA: ../my-projectA -> "+projectA+"\n")
+	h.AssertOutputContains(output, "my-projectB: ../my-projectB -> "+projectB+"\n")
+	if strings.Contains(output, "mismatch") || strings.Contains(output, "Warning:") {
+		t.Errorf("Expected no mismatches, got:\n%s", output)
+	}
+
+	// A remote pointing elsewhere is flagged
+	elsewhere := filepath.Join(h.TempDir(), "moved-projectB")
+	bareRepoB := filepath.Join(wmemDir, "repos", "my-projectB.git")
+	_, err = h.RunGit("--git-dir", bareRepoB, "remote", "set-url", "wmem-wd", elsewhere)
+	h.AssertCommandSuccess("", err, "git remote set-url")
+
+	output, err = h.RunGitWmem("remotes")
+	h.AssertCommandSuccess(output, err, "git-wmem remotes with mismatch")
+	h.AssertOutputContains(output, "my-projectB: ../my-projectB -> "+elsewhere+" (mismatch, expected "+projectB+")")
+	h.AssertOutputContains(output, "Warning: 1 wmem-wd remote(s) don't match workdir-map")
+
+	// --fix points it back at the workdir-map path
+	output, err = h.RunGitWmem("remotes", "--fix")
+	h.AssertCommandSuccess(output, err, "git-wmem remotes --fix")
+	h.AssertOutputContains(output, "(fixed, was "+elsewhere+")")
+
+	url, err := h.RunGit("--git-dir", bareRepoB, "remote", "get-url", "wmem-wd")
+	h.AssertCommandSuccess(url, err, "git remote get-url")
+	if strings.TrimSpace(url) != projectB {
+		t.Errorf("Expected fixed remote URL %s, got %s", projectB, url)
+	}
+}
@@ -0,0 +1,86 @@
+package e2e
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGitWmemRepairRefs tests that git-wmem repair-refs resets a wmem-br/head matching no wmem-br/<branch> tip
+// Reference: docs/use-cases/git-wmem-repair-refs/basic.md
+func TestGitWmemRepairRefs(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "first git-wmem commit")
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "modified A")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "second git-wmem commit")
+
+	output, err = h.RunGitWmem("repair-refs")
+	h.AssertCommandSuccess(output, err, "git-wmem repair-refs on consistent repos")
+	h.AssertOutputContains(output, "repos/my-projectA.git: ok (wmem-br/head at wmem-br/main)")
+	// my-projectB never changed, so it got no snapshot commit and no wmem-br/head
+	h.AssertOutputContains(output, "repos/my-projectB.git: ok (no wmem-br/head yet)")
+	h.AssertOutputContains(output, "All 2 bare repo(s) consistent")
+
+	// Point wmem-br/head of my-projectA at an older snapshot
+	bareRepo := filepath.Join(wmemDir, "repos", "my-projectA.git")
+	oldSnapshot, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "--short=12", "wmem-br/main~1")
+	h.AssertCommandSuccess(oldSnapshot, err, "git rev-parse wmem-br/main~1")
+	output, err = h.RunGit("--git-dir", bareRepo, "update-ref", "refs/heads/wmem-br/head", "wmem-br/main~1")
+	h.AssertCommandSuccess(output, err, "corrupt wmem-br/head of my-projectA")
+
+	output, err = h.RunGitWmem("repair-refs")
+	h.AssertCommandSuccess(output, err, "git-wmem repair-refs")
+	h.AssertOutputContains(output, "repos/my-projectA.git: fixed wmem-br/head "+strings.TrimSpace(oldSnapshot)+" -> ")
+	h.AssertOutputContains(output, "(wmem-br/main, the newest wmem-br tip)")
+	h.AssertOutputContains(output, "Fixed wmem-br/head of 1 of 2 bare repo(s)")
+
+	head, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/head")
+	h.AssertCommandSuccess(head, err, "git rev-parse wmem-br/head")
+	main, err := h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(main, err, "git rev-parse wmem-br/main")
+	if head != main {
+		t.Errorf("Expected wmem-br/head at wmem-br/main %s, got %s", strings.TrimSpace(main), strings.TrimSpace(head))
+	}
+	output, err = h.RunGit("--git-dir", bareRepo, "log", "--oneline", "wmem-br/head")
+	h.AssertCommandSuccess(output, err, "git log wmem-br/head")
+
+	output, err = h.RunGitWmem("history", "my-projectA", "fileA.txt")
+	h.AssertCommandSuccess(output, err, "git-wmem history after repair-refs")
+
+	output, err = h.RunGitWmem("repair-refs")
+	h.AssertCommandSuccess(output, err, "git-wmem repair-refs after the repair")
+	h.AssertOutputContains(output, "All 2 bare repo(s) consistent")
+
+	// A newer index snapshot (--snapshot-worktree-and-index) isn't a wmem-br/head candidate
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "staged A")
+	output, err = h.RunGit("add", "fileA.txt")
+	h.AssertCommandSuccess(output, err, "git add fileA.txt")
+	h.WriteFile("fileA.txt", "modified A")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--snapshot-worktree-and-index")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --snapshot-worktree-and-index")
+	output, err = h.RunGit("--git-dir", bareRepo, "update-ref", "refs/heads/wmem-br/head", "wmem-br/main-index")
+	h.AssertCommandSuccess(output, err, "point wmem-br/head of my-projectA at the index snapshot")
+
+	output, err = h.RunGitWmem("repair-refs")
+	h.AssertCommandSuccess(output, err, "git-wmem repair-refs with an index snapshot")
+	h.AssertOutputContains(output, "(wmem-br/main, the newest wmem-br tip)")
+	head, err = h.RunGit("--git-dir", bareRepo, "rev-parse", "wmem-br/head")
+	h.AssertCommandSuccess(head, err, "git rev-parse wmem-br/head")
+	if head != main {
+		t.Errorf("Expected wmem-br/head at wmem-br/main %s, got %s", strings.TrimSpace(main), strings.TrimSpace(head))
+	}
+}
@@ -15,6 +15,7 @@ type TestHelper struct {
 	t       *testing.T
 	tempDir string
 	workDir string
+	env     []string
 }
 
 // NewTestHelper creates a new test helper with temporary directory
@@ -54,10 +55,26 @@ func (h *TestHelper) SetWorkDir(dir string) {
 	h.workDir = dir
 }
 
+// SetEnv sets an environment variable for subsequent commands
+func (h *TestHelper) SetEnv(key, value string) {
+	h.env = append(h.env, key+"="+value)
+}
+
 // RunCommand executes a command in the current working directory
 func (h *TestHelper) RunCommand(name string, args ...string) (string, error) {
+	return h.RunCommandWithStdin("", name, args...)
+}
+
+// RunCommandWithStdin executes a command in the current working directory with stdin as its input
+func (h *TestHelper) RunCommandWithStdin(stdin string, name string, args ...string) (string, error) {
 	cmd := exec.Command(name, args...)
 	cmd.Dir = h.workDir
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	if len(h.env) > 0 {
+		cmd.Env = append(os.Environ(), h.env...)
+	}
 
 	output, err := cmd.CombinedOutput()
 	h.t.Logf("Command: %s %s", name, strings.Join(args, " "))
@@ -0,0 +1,52 @@
+package e2e
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestGitWmemValidatePaths_Basic tests the per-path report and exit code of git-wmem validate-paths
+// Reference: docs/use-cases/git-wmem-validate-paths/basic.md#main-scenario
+func TestGitWmemValidatePaths_Basic(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	_, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	output, err := h.RunGitWmem("validate-paths")
+	h.AssertCommandSuccess(output, err, "git-wmem validate-paths without paths")
+	h.AssertOutputContains(output, "No workdir paths in md/commit-workdir-paths")
+
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err = h.RunGitWmem("validate-paths")
+	h.AssertCommandSuccess(output, err, "git-wmem validate-paths with valid paths")
+	h.AssertOutputContains(output, "../my-projectA: ok\n")
+	h.AssertOutputContains(output, "../my-projectB: ok\n")
+
+	h.AppendToFile("md/commit-workdir-paths", projectB)
+	h.AppendToFile("md/commit-workdir-paths", "../missing-project")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA/../../etc")
+	output, err = h.RunGitWmem("validate-paths")
+	h.AssertCommandError(output, err, "3 of 5 workdir path(s) failed validation", "git-wmem validate-paths with invalid paths")
+	h.AssertOutputContains(output, "../my-projectA: ok\n")
+	h.AssertOutputContains(output, "../my-projectB: ok\n")
+	h.AssertOutputContains(output, projectB+": invalid (Absolute paths not allowed)")
+	h.AssertOutputContains(output, "../missing-project: invalid (workdir path not accessible")
+	h.AssertOutputContains(output, "../my-projectA/../../etc: invalid (path traversal not allowed)")
+
+	// Nothing was created
+	if _, err := os.Stat(filepath.Join(wmemDir, "repos", "my-projectA.git")); !os.IsNotExist(err) {
+		t.Errorf("Expected no bare repo for my-projectA, got err=%v", err)
+	}
+	workdirMap, err := os.ReadFile(filepath.Join(wmemDir, "md-internal", "workdir-map.json"))
+	if err != nil {
+		t.Fatalf("Failed to read workdir-map.json: %v", err)
+	}
+	if string(workdirMap) != "{}\n" {
+		t.Errorf("Expected an untouched empty workdir map, got:\n%s", workdirMap)
+	}
+}
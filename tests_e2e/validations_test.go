@@ -1,9 +1,12 @@
 package e2e
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestValidations_WorkdirPathRequirements tests workdir path validation rules
@@ -190,6 +193,79 @@ func TestValidations_BranchNameRequirements(t *testing.T) {
 	}
 }
 
+// TestValidations_BranchNameSanitization tests that branch names invalid as ref components
+// are sanitized when composing wmem-br/<branch> refs
+// Reference: docs/validations.md#branch-name-requirements
+func TestValidations_BranchNameSanitization(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	// Setup wmem repo and test project
+	wmemDir := setupBasicWmemRepo(h)
+	testProjectDir := filepath.Join(h.TempDir(), "test-project")
+	h.MkdirAll(testProjectDir)
+	h.SetWorkDir(testProjectDir)
+
+	_, err := h.RunGit("init")
+	h.AssertCommandSuccess("", err, "git init")
+
+	h.WriteFile("file.txt", "content")
+	_, err = h.RunGit("add", "file.txt")
+	h.AssertCommandSuccess("", err, "git add")
+
+	_, err = h.RunGit("commit", "-m", "Initial commit")
+	h.AssertCommandSuccess("", err, "git commit")
+
+	// Point HEAD to a branch whose name git itself refuses as a ref (ends with .lock)
+	headHash, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(headHash, err, "git rev-parse HEAD")
+	h.WriteFile(".git/refs/heads/weird.lock", strings.TrimSpace(headHash)+"\n")
+	h.WriteFile(".git/HEAD", "ref: refs/heads/weird.lock\n")
+
+	// Setup wmem to track this project
+	h.SetWorkDir(wmemDir)
+	h.WriteFile("md/commit-workdir-paths", "../test-project")
+
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "first git-wmem-commit")
+
+	// Snapshot uncommitted changes on the weird branch
+	h.SetWorkDir(testProjectDir)
+	h.WriteFile("file2.txt", "uncommitted content")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "second git-wmem-commit")
+
+	bareRepoDir := filepath.Join(wmemDir, "repos", "test-project.git")
+	h.SetWorkDir(bareRepoDir)
+
+	output, err = h.RunGit("for-each-ref", "--format=%(refname:short)", "refs/heads/wmem-br/")
+	h.AssertCommandSuccess(output, err, "git for-each-ref")
+
+	var wmemBranch string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if strings.HasPrefix(line, "wmem-br/weird_lock-") {
+			wmemBranch = line
+		}
+		if strings.HasSuffix(line, ".lock") {
+			t.Errorf("Unsanitized wmem branch found: %s", line)
+		}
+	}
+	if wmemBranch == "" {
+		t.Fatalf("Expected sanitized wmem-br/weird_lock-<hash> branch, got: %s", output)
+	}
+
+	// The snapshot must be readable by native git and record the original branch name
+	output, err = h.RunGit("show", "--stat", "--format=%B", wmemBranch)
+	h.AssertCommandSuccess(output, err, "git show sanitized wmem branch")
+	h.AssertOutputContains(output, "file2.txt")
+	h.AssertOutputContains(output, "Workdir branch: `weird.lock`")
+
+	output, err = h.RunGit("fsck")
+	h.AssertCommandSuccess(output, err, "git fsck")
+}
+
 // TestValidations_WmemRepoDetection tests detection of wmem-repo subdirectories
 // Reference: docs/validations.md#workdir-path-requirements
 func TestValidations_WmemRepoDetection(t *testing.T) {
@@ -211,3 +287,639 @@ func TestValidations_WmemRepoDetection(t *testing.T) {
 	output, err = h.RunGitWmem("commit")
 	h.AssertCommandError(output, err, "wmem-repo", "Cannot point to wmem-repo subdirs")
 }
+
+// TestValidations_WorkdirIndexLock tests that a workdir with index.lock is skipped with a warning
+// Reference: docs/validations.md#workdir-index-lock
+func TestValidations_WorkdirIndexLock(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	// Simulate a git operation in progress in projectA
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "modified A while locked")
+	h.WriteFile(".git/index.lock", "")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "modified B")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit with index.lock")
+	h.AssertOutputContains(output, "Warning: Skipping workdir ../my-projectA: index.lock present")
+
+	// projectB is still snapshotted, projectA is not
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectB.git"))
+	output, err = h.RunGit("show", "wmem-br/main:fileB.txt")
+	h.AssertCommandSuccess(output, err, "git show fileB.txt")
+	h.AssertOutputContains(output, "modified B")
+
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	output, err = h.RunGit("show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show fileA.txt")
+	if strings.Contains(output, "modified A while locked") {
+		t.Errorf("Expected locked workdir to be skipped, got snapshot content: %s", output)
+	}
+
+	// Once the lock is gone the workdir is picked up again
+	if err := os.Remove(filepath.Join(projectA, ".git", "index.lock")); err != nil {
+		t.Fatalf("Failed to remove index.lock: %v", err)
+	}
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit after lock removal")
+
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	output, err = h.RunGit("show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show fileA.txt after lock removal")
+	h.AssertOutputContains(output, "modified A while locked")
+}
+
+// TestValidations_OnlyIfIdle tests that --only-if-idle skips a workdir with a merge in progress
+// Reference: docs/validations.md#idle-workdirs
+func TestValidations_OnlyIfIdle(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	// Fake a merge in progress in projectA
+	h.SetWorkDir(projectA)
+	headHash, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(headHash, err, "git rev-parse HEAD")
+	h.WriteFile(".git/MERGE_HEAD", headHash)
+	h.WriteFile("fileA.txt", "modified A during merge")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "modified B")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--only-if-idle")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --only-if-idle")
+	h.AssertOutputContains(output, "Warning: Skipping workdir ../my-projectA: merge in progress (MERGE_HEAD present)")
+
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectB.git"))
+	output, err = h.RunGit("show", "wmem-br/main:fileB.txt")
+	h.AssertCommandSuccess(output, err, "git show fileB.txt")
+	h.AssertOutputContains(output, "modified B")
+
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	output, err = h.RunGit("show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show fileA.txt")
+	if strings.Contains(output, "modified A during merge") {
+		t.Errorf("Expected workdir with merge in progress to be skipped, got: %s", output)
+	}
+
+	// Without --only-if-idle the workdir is snapshotted as usual
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit without --only-if-idle")
+
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	output, err = h.RunGit("show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show fileA.txt after regular commit")
+	h.AssertOutputContains(output, "modified A during merge")
+}
+
+// TestValidations_SymlinkedWorkdir tests snapshotting a workdir-path that is a symlink to the repo
+// Reference: docs/validations.md#symlinked-workdirs
+func TestValidations_SymlinkedWorkdir(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+
+	// Real repo lives elsewhere, ../my-projectA is a relative symlink to it
+	realDir := filepath.Join(h.TempDir(), "real", "my-projectA")
+	h.MkdirAll(realDir)
+	h.SetWorkDir(realDir)
+	_, err := h.RunGit("init")
+	h.AssertCommandSuccess("", err, "git init")
+	h.WriteFile("fileA.txt", "file A content")
+	h.WriteFile(".gitignore", "ignored.txt\n")
+	_, err = h.RunGit("add", "fileA.txt", ".gitignore")
+	h.AssertCommandSuccess("", err, "git add")
+	_, err = h.RunGit("commit", "-m", "Initial commit in real my-projectA")
+	h.AssertCommandSuccess("", err, "git commit")
+
+	if err := os.Symlink(filepath.Join("real", "my-projectA"), filepath.Join(h.TempDir(), "my-projectA")); err != nil {
+		t.Fatalf("Failed to create workdir symlink: %v", err)
+	}
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	// Uncommitted changes seen through the symlink
+	h.SetWorkDir(realDir)
+	h.MkdirAll("sub")
+	h.WriteFile("sub/new.txt", "new file via symlinked workdir")
+	h.WriteFile("fileA.txt", "changed A")
+	h.WriteFile("ignored.txt", "must not be snapshotted")
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem-commit with symlinked workdir")
+
+	h.AssertFileContains("md-internal/workdir-map.json", "../my-projectA")
+
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	output, err = h.RunGit("ls-tree", "-r", "--name-only", "wmem-br/main")
+	h.AssertCommandSuccess(output, err, "git ls-tree wmem-br/main")
+	files := strings.Fields(output)
+	expected := []string{".gitignore", "fileA.txt", "sub/new.txt"}
+	if strings.Join(files, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected snapshot files %v, got %v", expected, files)
+	}
+
+	output, err = h.RunGit("show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(output, err, "git show fileA.txt")
+	h.AssertOutputContains(output, "changed A")
+
+	output, err = h.RunGit("fsck", "--no-dangling")
+	h.AssertCommandSuccess(output, err, "git fsck")
+}
+
+// TestValidations_MaxFileCount tests that --max-file-count aborts without a partial snapshot
+// Reference: docs/validations.md#max-file-count
+func TestValidations_MaxFileCount(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	wmemHeadBefore, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(wmemHeadBefore, err, "git rev-parse HEAD")
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	branchBefore, err := h.RunGit("rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(branchBefore, err, "git rev-parse wmem-br/main")
+
+	// 1 tracked + 10 untracked files
+	h.SetWorkDir(projectA)
+	h.MkdirAll("many")
+	for i := 0; i < 10; i++ {
+		h.WriteFile(filepath.Join("many", fmt.Sprintf("file%02d.txt", i)), fmt.Sprintf("content %d", i))
+	}
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--max-file-count", "5")
+	h.AssertCommandError(output, err, "has more than 5 files (--max-file-count)", "git-wmem commit --max-file-count 5")
+
+	// No partial snapshot
+	wmemHeadAfter, err := h.RunGit("rev-parse", "HEAD")
+	h.AssertCommandSuccess(wmemHeadAfter, err, "git rev-parse HEAD")
+	if wmemHeadAfter != wmemHeadBefore {
+		t.Errorf("Expected no new wmem-repo commit, HEAD moved from %s to %s", wmemHeadBefore, wmemHeadAfter)
+	}
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	branchAfter, err := h.RunGit("rev-parse", "wmem-br/main")
+	h.AssertCommandSuccess(branchAfter, err, "git rev-parse wmem-br/main")
+	if branchAfter != branchBefore {
+		t.Errorf("Expected wmem-br/main unchanged, moved from %s to %s", branchBefore, branchAfter)
+	}
+
+	// A limit above the file count commits normally
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--max-file-count", "100")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --max-file-count 100")
+	h.SetWorkDir(filepath.Join(wmemDir, "repos", "my-projectA.git"))
+	output, err = h.RunGit("show", "wmem-br/main:many/file09.txt")
+	h.AssertCommandSuccess(output, err, "git show many/file09.txt")
+}
+
+// TestValidations_VerifyAfter tests that --verify-after checks only changed bare repos
+// Reference: docs/validations.md#verify-after-commit
+func TestValidations_VerifyAfter(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A for verify")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--verify-after")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --verify-after")
+	h.AssertOutputContains(output, "in repos/my-projectA.git")
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "Info: Verified") && strings.Contains(line, "my-projectB.git") {
+			t.Errorf("Expected unchanged my-projectB.git not to be verified, got: %s", line)
+		}
+	}
+}
+
+// TestValidations_WorkdirTimeout tests that a hung workdir times out while the others are committed
+// Reference: docs/validations.md#workdir-timeout
+func TestValidations_WorkdirTimeout(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A with timeout")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "changed B with timeout")
+
+	// The fetch of my-projectB hangs far beyond the deadline
+	slowUploadPack(h, "my-projectB", "30")
+	h.SetWorkDir(wmemDir)
+
+	start := time.Now()
+	output, err = h.RunGitWmem("commit", "--workdir-timeout", "500ms")
+	h.AssertCommandError(output, err, "workdir timed out", "git-wmem commit --workdir-timeout without --keep-going")
+	h.AssertOutputContains(output, "my-projectB")
+
+	wmemLog, err := h.RunGit("log", "--oneline")
+	h.AssertCommandSuccess(wmemLog, err, "git log")
+	commitsBefore := len(strings.Split(strings.TrimSpace(wmemLog), "\n"))
+
+	output, err = h.RunGitWmem("commit", "--workdir-timeout", "500ms", "--keep-going")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --workdir-timeout --keep-going")
+	h.AssertOutputContains(output, "Warning: Skipping failed workdir ../my-projectB")
+	if elapsed := time.Since(start); elapsed > 20*time.Second {
+		t.Errorf("Expected the hung workdir to be cut off by --workdir-timeout, runs took %v", elapsed)
+	}
+
+	wmemLog, err = h.RunGit("log", "--oneline")
+	h.AssertCommandSuccess(wmemLog, err, "git log")
+	if commitsAfter := len(strings.Split(strings.TrimSpace(wmemLog), "\n")); commitsAfter != commitsBefore+1 {
+		t.Errorf("Expected one new wmem-repo commit, got %d -> %d", commitsBefore, commitsAfter)
+	}
+
+	contentA, err := h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", "my-projectA.git"), "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(contentA, err, "read fileA.txt from snapshot")
+	if strings.TrimSpace(contentA) != "changed A with timeout" {
+		t.Errorf("Expected my-projectA snapshot to be committed, got %q", contentA)
+	}
+
+	contentB, err := h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", "my-projectB.git"), "show", "wmem-br/main:fileB.txt")
+	h.AssertCommandSuccess(contentB, err, "read fileB.txt from snapshot")
+	if strings.TrimSpace(contentB) == "changed B with timeout" {
+		t.Errorf("Expected timed out my-projectB not to be committed")
+	}
+}
+
+// TestValidations_MaxTotalRuntime tests that no workdir check starts after the run budget runs out
+// while the workdirs checked by then are committed
+// Reference: docs/validations.md#max-total-runtime
+func TestValidations_MaxTotalRuntime(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectB")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A with budget")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "changed B with budget")
+
+	// One check at a time, each slower than the budget: the first checked workdir uses it up
+	// The blob filter runs while a check builds the workdir tree, sleeping makes the check slow
+	h.SetWorkDir(wmemDir)
+	h.WriteFile("md/commit/blob-filter-attributes", "file*.txt wmem-blob-filter\n")
+	wmemLog, err := h.RunGit("log", "--oneline")
+	h.AssertCommandSuccess(wmemLog, err, "git log")
+	commitsBefore := len(strings.Split(strings.TrimSpace(wmemLog), "\n"))
+
+	start := time.Now()
+	output, err = h.RunGitWmem("commit", "--parallel", "1", "--max-total-runtime", "1s", "--blob-filter", "sleep 1.5; cat")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --max-total-runtime")
+	h.AssertOutputContains(output, "check not started: --max-total-runtime exceeded (1s)")
+	// One slow check and the snapshot of its workdir, the second check would add another 1.5s
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("Expected the second workdir check not to start, the run took %v", elapsed)
+	}
+
+	wmemLog, err = h.RunGit("log", "--oneline")
+	h.AssertCommandSuccess(wmemLog, err, "git log")
+	if commitsAfter := len(strings.Split(strings.TrimSpace(wmemLog), "\n")); commitsAfter != commitsBefore+1 {
+		t.Errorf("Expected one new wmem-repo commit, got %d -> %d", commitsBefore, commitsAfter)
+	}
+
+	// Checks race for the single slot, so either workdir may be the committed one
+	committed := 0
+	for _, project := range []struct{ name, file, content string }{
+		{"my-projectA", "fileA.txt", "changed A with budget"},
+		{"my-projectB", "fileB.txt", "changed B with budget"},
+	} {
+		content, err := h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", project.name+".git"), "show", "wmem-br/main:"+project.file)
+		h.AssertCommandSuccess(content, err, "read "+project.file+" from snapshot")
+		if strings.TrimSpace(content) == project.content {
+			committed++
+		} else {
+			h.AssertOutputContains(output, "Warning: Skipping workdir ../"+project.name+": check not started")
+		}
+	}
+	if committed != 1 {
+		t.Errorf("Expected exactly one workdir committed within the budget, got %d:\n%s", committed, output)
+	}
+}
+
+// TestValidations_MaxTotalRuntime_SingleWorkdir tests that the budget also applies to a run with one workdir
+// Reference: docs/validations.md#max-total-runtime
+func TestValidations_MaxTotalRuntime_SingleWorkdir(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem-commit")
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A with budget")
+
+	// The fetch started within the budget but finished after it, so the check doesn't start
+	slowUploadPack(h, "my-projectA", "1.5")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--max-total-runtime", "1s")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --max-total-runtime with a single workdir")
+	h.AssertOutputContains(output, "Info: Processing single workdir ../my-projectA")
+	h.AssertOutputContains(output, "Warning: Skipping workdir ../my-projectA: check not started: --max-total-runtime exceeded (1s)")
+
+	content, err := h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", "my-projectA.git"), "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(content, err, "read fileA.txt from snapshot")
+	if strings.TrimSpace(content) != "file A content" {
+		t.Errorf("Expected no snapshot of the skipped workdir, got %q", content)
+	}
+}
+
+// TestValidations_PathExpansion tests ~ and environment variable expansion in workdir paths
+// Reference: docs/validations.md#path-expansion
+func TestValidations_PathExpansion(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, projectB := setupTestProjects(h)
+
+	h.SetEnv("WMEM_TEST_WORKSPACE", "../"+filepath.Base(wmemDir))
+	h.SetEnv("HOME", h.TempDir())
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "$WMEM_TEST_WORKSPACE/../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "~/my-projectB")
+
+	// ~ expands to an absolute path, rejected without the opt-in
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandError(output, err, "workdir path ~/my-projectB expands to the absolute path "+projectB, "git-wmem commit with a ~ workdir path")
+	output, err = h.RunGitWmem("validate-paths")
+	h.AssertCommandError(output, err, "create md/allow-absolute-workdir-paths to allow it", "git-wmem validate-paths with a ~ workdir path")
+
+	h.WriteFile("md/allow-absolute-workdir-paths", "")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit with expanded workdir paths")
+
+	// The workdir map stores the expanded relative paths
+	h.AssertFileContains("md-internal/workdir-map.json", `"../my-projectA"`)
+	h.AssertFileContains("md-internal/workdir-map.json", `"../my-projectB"`)
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A via env path")
+	h.SetWorkDir(projectB)
+	h.WriteFile("fileB.txt", "changed B via home path")
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "second git-wmem commit with expanded workdir paths")
+
+	contentA, err := h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", "my-projectA.git"), "show", "wmem-br/main:fileA.txt")
+	h.AssertCommandSuccess(contentA, err, "read fileA.txt from snapshot")
+	if strings.TrimSpace(contentA) != "changed A via env path" {
+		t.Errorf("Expected snapshot of env var workdir path, got %q", contentA)
+	}
+	contentB, err := h.RunGit("--git-dir", filepath.Join(wmemDir, "repos", "my-projectB.git"), "show", "wmem-br/main:fileB.txt")
+	h.AssertCommandSuccess(contentB, err, "read fileB.txt from snapshot")
+	if strings.TrimSpace(contentB) != "changed B via home path" {
+		t.Errorf("Expected snapshot of ~ workdir path, got %q", contentB)
+	}
+
+	// Undefined variables are an error
+	h.AppendToFile("md/commit-workdir-paths", "$WMEM_TEST_UNDEFINED/my-projectC")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandError(output, err, "undefined environment variable $WMEM_TEST_UNDEFINED", "git-wmem commit with undefined variable")
+}
+
+// TestValidations_UniqueWorkdirPaths tests that the same workdir listed twice is processed once
+// Reference: docs/validations.md#unique-workdir-paths
+func TestValidations_UniqueWorkdirPaths(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA/")
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A")
+	h.SetWorkDir(wmemDir)
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit with a duplicate workdir path")
+	h.AssertOutputContains(output, "Warning: Duplicate workdir path ../my-projectA/ in md/commit-workdir-paths (same as ../my-projectA)")
+	h.AssertOutputContains(output, "Info: Processing single workdir ../my-projectA")
+
+	// One workdir-map entry and one bare repo
+	workdirMap, err := os.ReadFile(filepath.Join(wmemDir, "md-internal", "workdir-map.json"))
+	if err != nil {
+		t.Fatalf("Failed to read workdir map: %v", err)
+	}
+	if count := strings.Count(string(workdirMap), "../my-projectA"); count != 1 {
+		t.Errorf("Expected 1 workdir-map entry for ../my-projectA, got %d:\n%s", count, workdirMap)
+	}
+	repos, _ := filepath.Glob(filepath.Join(wmemDir, "repos", "*.git"))
+	if len(repos) != 1 {
+		t.Errorf("Expected 1 bare repo, got %v", repos)
+	}
+
+	message, err := h.RunGit("log", "-1", "--format=%B")
+	h.AssertCommandSuccess(message, err, "git log -1")
+	if count := strings.Count(message, "- `my-projectA`"); count != 1 {
+		t.Errorf("Expected my-projectA listed once in the wmem-repo commit, got %d:\n%s", count, message)
+	}
+}
+
+// TestValidations_TreatWarningsAsErrors tests that a warning fails the run with --treat-warnings-as-errors
+func TestValidations_TreatWarningsAsErrors(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit", "--treat-warnings-as-errors")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --treat-warnings-as-errors without warnings")
+
+	// A duplicate workdir path is a warning
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA/")
+	output, err = h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "git-wmem commit with a warning")
+	h.AssertOutputContains(output, "Warning: Duplicate workdir path")
+
+	output, err = h.RunGitWmem("commit", "--treat-warnings-as-errors")
+	h.AssertCommandError(output, err, "1 warning(s) emitted (--treat-warnings-as-errors)", "git-wmem commit --treat-warnings-as-errors with a warning")
+	h.AssertOutputContains(output, "Warning: Duplicate workdir path")
+}
+
+// TestValidations_AuthorRequired tests that --author-required rejects the placeholder identity of git-wmem init
+// Reference: docs/validations.md#author-required
+func TestValidations_AuthorRequired(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit", "--author-required")
+	h.AssertCommandError(output, err, "md/commit/author is the placeholder identity WMem Git <git-wmem@mj41.cz> (--author-required)", "git-wmem commit --author-required with the default author")
+	if _, err := os.Stat(filepath.Join(wmemDir, "repos", "my-projectA.git")); !os.IsNotExist(err) {
+		t.Errorf("Expected no bare repo created by the rejected run")
+	}
+
+	h.WriteFile("md/commit/author", "Jane Doe <jane@example.com>")
+	output, err = h.RunGitWmem("commit", "--author-required")
+	h.AssertCommandError(output, err, "md/commit/committer is the placeholder identity", "git-wmem commit --author-required with the default committer")
+
+	h.WriteFile("md/commit/committer", "Jane Doe <jane@example.com>")
+	output, err = h.RunGitWmem("commit", "--author-required")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --author-required with a real identity")
+
+	output, err = h.RunGit("log", "-1", "--format=%an <%ae>|%cn <%ce>")
+	h.AssertCommandSuccess(output, err, "git log -1")
+	h.AssertOutputContains(output, "Jane Doe <jane@example.com>|Jane Doe <jane@example.com>")
+}
+
+// TestValidations_VerifyWorkdirCleanAfter tests that a normal commit leaves the workdir untouched
+// under --verify-workdir-clean-after
+// Reference: docs/validations.md#verify-workdir-clean-after
+func TestValidations_VerifyWorkdirCleanAfter(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit")
+	h.AssertCommandSuccess(output, err, "initial git-wmem commit")
+
+	h.SetWorkDir(projectA)
+	h.WriteFile("fileA.txt", "changed A")
+	h.MkdirAll("new-dir")
+	h.WriteFile("new-dir/new.txt", "new file")
+	statusBefore, err := h.RunGit("status", "--porcelain")
+	h.AssertCommandSuccess(statusBefore, err, "git status before")
+	infoBefore, err := os.Stat(filepath.Join(projectA, "fileA.txt"))
+	if err != nil {
+		t.Fatalf("Failed to stat fileA.txt: %v", err)
+	}
+
+	h.SetWorkDir(wmemDir)
+	output, err = h.RunGitWmem("commit", "--verify-workdir-clean-after")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --verify-workdir-clean-after")
+	h.AssertOutputContains(output, "Info: Verified 1 workdir(s) unchanged by the run (--verify-workdir-clean-after)")
+	h.AssertOutputContains(output, "Info: Created wmem-repo commit with changes from 1 workdir(s)")
+
+	h.SetWorkDir(projectA)
+	statusAfter, err := h.RunGit("status", "--porcelain")
+	h.AssertCommandSuccess(statusAfter, err, "git status after")
+	if statusAfter != statusBefore {
+		t.Errorf("Expected the workdir status to stay\n%s\ngot\n%s", statusBefore, statusAfter)
+	}
+	infoAfter, err := os.Stat(filepath.Join(projectA, "fileA.txt"))
+	if err != nil {
+		t.Fatalf("Failed to stat fileA.txt: %v", err)
+	}
+	if !infoAfter.ModTime().Equal(infoBefore.ModTime()) {
+		t.Errorf("Expected the mtime of fileA.txt to stay %v, got %v", infoBefore.ModTime(), infoAfter.ModTime())
+	}
+	h.AssertFileEquals("fileA.txt", "changed A")
+}
+
+// TestValidations_MaxDepth tests that --max-depth leaves deeply nested directories out of the snapshot with a warning
+// Reference: docs/validations.md#max-depth
+func TestValidations_MaxDepth(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	wmemDir := setupBasicWmemRepo(h)
+	projectA, _ := setupTestProjects(h)
+
+	h.SetWorkDir(projectA)
+	h.MkdirAll("a/b/c/d")
+	h.WriteFile("a/level1.txt", "level 1")
+	h.WriteFile("a/b/level2.txt", "level 2")
+	h.WriteFile("a/b/c/level3.txt", "level 3")
+	h.WriteFile("a/b/c/d/level4.txt", "level 4")
+
+	h.SetWorkDir(wmemDir)
+	h.AppendToFile("md/commit-workdir-paths", "../my-projectA")
+	output, err := h.RunGitWmem("commit", "--max-depth", "2")
+	h.AssertCommandSuccess(output, err, "git-wmem commit --max-depth 2")
+	h.AssertOutputContains(output, "deeper than --max-depth 2")
+	if count := strings.Count(output, "Warning: Skipping directory "); count != 1 {
+		t.Errorf("Expected one warning for a/b/c, got %d:\n%s", count, output)
+	}
+	h.AssertOutputContains(output, filepath.Join("a", "b", "c")+" deeper than")
+
+	files, err := h.RunGit("--git-dir", "repos/my-projectA.git", "ls-tree", "-r", "--name-only", "wmem-br/main")
+	h.AssertCommandSuccess(files, err, "git ls-tree wmem-br/main")
+	h.AssertOutputContains(files, "fileA.txt\n")
+	h.AssertOutputContains(files, "a/level1.txt\n")
+	h.AssertOutputContains(files, "a/b/level2.txt\n")
+	if strings.Contains(files, "level3.txt") || strings.Contains(files, "level4.txt") {
+		t.Errorf("Expected the files below a/b excluded by --max-depth 2, got:\n%s", files)
+	}
+
+	output, err = h.RunGitWmem("commit", "--max-depth", "2", "--treat-warnings-as-errors")
+	h.AssertCommandError(output, err, "warning(s) emitted (--treat-warnings-as-errors)", "git-wmem commit --max-depth 2 --treat-warnings-as-errors")
+}